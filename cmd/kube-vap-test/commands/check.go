@@ -1,24 +1,35 @@
 package commands
 
 import (
-	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"os/signal"
-	"path/filepath"
+	"slices"
 	"strings"
 	"syscall"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
-	"sigs.k8s.io/yaml"
 
+	"github.com/yashirook/kube-vap-test/internal/baseline"
+	"github.com/yashirook/kube-vap-test/internal/compat"
 	"github.com/yashirook/kube-vap-test/internal/engine"
+	"github.com/yashirook/kube-vap-test/internal/engine/plugins"
+	"github.com/yashirook/kube-vap-test/internal/engine/upstream"
+	"github.com/yashirook/kube-vap-test/internal/gate"
+	"github.com/yashirook/kube-vap-test/internal/helm"
+	"github.com/yashirook/kube-vap-test/internal/kustomize"
 	"github.com/yashirook/kube-vap-test/internal/loader"
+	"github.com/yashirook/kube-vap-test/internal/policyreport"
 	"github.com/yashirook/kube-vap-test/internal/reporter"
+	"github.com/yashirook/kube-vap-test/internal/snapshot"
 	kaptestv1 "github.com/yashirook/kube-vap-test/pkg/apis/admission/v1"
 	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
 )
@@ -26,13 +37,61 @@ import (
 // CheckOptions represents options for check command
 type CheckOptions struct {
 	CommonOptions
-	
+
 	// Command specific
 	PolicyFiles []string
 	ParamFile   string
-	Operation   string
-	Namespace   string
-	Cluster     bool
+	// Glob patterns of files skipped when expanding policy and manifest directories and globs
+	Ignore    []string
+	Operation string
+	Cluster   bool
+	// Evaluate the policies installed in the cluster, or the policy files, with the bindings,
+	// parameters and namespaces of the cluster (cluster mode)
+	ClusterPolicies bool
+	ClusterBindings bool
+	// Snapshot archive checked offline instead of the cluster (cluster mode)
+	Snapshot string
+	// Namespaces to check (cluster mode), or release namespace of --helm-chart
+	Namespaces []string
+	// Namespaces, labels and fields selecting the cluster objects to check, the number of
+	// objects listed per request, and the request rate to the apiserver (cluster mode)
+	ExcludeNamespaces []string
+	Selector          string
+	FieldSelector     string
+	ChunkSize         int64
+	QPS               float32
+	Burst             int
+	// Kustomize overlays rendered and checked next to manifest files (local mode)
+	Kustomizations []string
+	// Helm chart rendered and checked next to manifest files with its values files and --set
+	// values, in the release namespace given with --namespace (local mode)
+	HelmChart  string
+	HelmValues []string
+	HelmSet    []string
+
+	// Built-in mutating admission plugins to emulate (local mode)
+	AdmissionPlugins []string
+	// Apply Kubernetes API defaults to manifests before evaluation
+	ApplyDefaults bool
+	// Pod Security Standards level and version evaluated next to policies
+	PodSecurityLevel   string
+	PodSecurityVersion string
+	// Evaluation engine, and whether the other engine evaluates every resource as well
+	Engine       string
+	Differential bool
+	// Kubernetes version to report the required policy API versions for
+	TargetVersion string
+	// Create or update PolicyReports of the results in the cluster (cluster mode)
+	ApplyReports bool
+	// Least severe kind of problem failing the check (deny, warn, error), and the number of
+	// violations allowed in total and per policy
+	FailOn              string
+	MaxViolations       int
+	PolicyMaxViolations map[string]int
+	// Baseline of accepted violations, only new violations fail, and the file recording the
+	// violations of this check as a baseline
+	Baseline      string
+	WriteBaseline string
 }
 
 // NewCheckCommand creates a new check command
@@ -40,27 +99,55 @@ func NewCheckCommand(opts *CheckOptions) *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "check [resources...]",
 		Short: "Check resources against policies",
-		Long:  `Check specified resources (local files or cluster resources) against specified policies.
-With --cluster flag, resources are fetched directly from the cluster for validation.`,
-		Args:  cobra.MinimumNArgs(0),
+		Long: `Check specified resources (local files or cluster resources) against specified policies.
+With --cluster flag, resources are fetched directly from the cluster for validation.
+Use - to read manifests or policies from standard input. Manifests are read from standard input
+as well when none are given and it is not a terminal.`,
+		Args: cobra.MinimumNArgs(0),
 		RunE: func(cmd *cobra.Command, args []string) error {
 			// Do not show usage on errors
 			cmd.SilenceUsage = true
 
+			// A snapshot is checked as the cluster it was taken of, with its policies unless
+			// policy files are given
+			if opts.Snapshot != "" {
+				if opts.ApplyReports {
+					return fmt.Errorf("--apply-reports cannot be combined with --snapshot")
+				}
+				opts.Cluster = true
+				if len(opts.PolicyFiles) == 0 && !opts.ClusterBindings {
+					opts.ClusterPolicies = true
+				}
+			}
+
 			// Check required parameters
-			if len(opts.PolicyFiles) == 0 {
+			if (opts.ClusterPolicies || opts.ClusterBindings) && !opts.Cluster {
+				return fmt.Errorf("--cluster-policies and --cluster-bindings are only available in cluster mode (--cluster)")
+			}
+			if opts.ClusterPolicies && len(opts.PolicyFiles) > 0 {
+				return fmt.Errorf("--policy cannot be combined with --cluster-policies, use --cluster-bindings to evaluate policy files with the bindings of the cluster")
+			}
+			if len(opts.PolicyFiles) == 0 && !opts.ClusterPolicies {
 				return fmt.Errorf("Please specify policy files with --policy flag")
 			}
 
 			if opts.Operation == "" {
-				// Default to CREATE operation
+				// Default to CREATE operation for manifests, and to UPDATE re-applying the
+				// objects of the cluster
 				opts.Operation = "CREATE"
+				if opts.Cluster {
+					opts.Operation = "UPDATE"
+				}
+			}
+			// The upstream engine resolves bindings, parameters and namespaces as the apiserver does
+			if (opts.ClusterPolicies || opts.ClusterBindings) && !cmd.Flags().Changed("engine") {
+				opts.Engine = engine.EngineUpstream
 			}
 
 			// Set up context (cancellable with Ctrl+C)
 			ctx, cancel := context.WithCancel(context.Background())
 			defer cancel()
-			
+
 			// Set up signal handler
 			sigCh := make(chan os.Signal, 1)
 			signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
@@ -72,75 +159,190 @@ With --cluster flag, resources are fetched directly from the cluster for validat
 				cancel()
 			}()
 
-			// Validate common options
-			if err := opts.ValidateCommonOptions(); err != nil {
+			// Validate common options, SARIF and PolicyReport output are only available for check
+			if err := opts.validateOutputFormats(append(outputFormats, reporter.OutputFormatSARIF, reporter.OutputFormatPolicyReport)); err != nil {
+				return err
+			}
+			if len(opts.Kustomizations) > 0 && opts.Cluster {
+				return fmt.Errorf("--kustomize is only available in local mode")
+			}
+			if opts.HelmChart != "" && opts.Cluster {
+				return fmt.Errorf("--helm-chart is only available in local mode")
+			}
+			if opts.HelmChart == "" && (len(opts.HelmValues) > 0 || len(opts.HelmSet) > 0) {
+				return fmt.Errorf("--values and --set are only available with --helm-chart")
+			}
+			if opts.ApplyReports && !opts.Cluster {
+				return fmt.Errorf("--apply-reports is only available in cluster mode (--cluster)")
+			}
+			if !opts.Cluster && (len(opts.ExcludeNamespaces) > 0 || opts.Selector != "" || opts.FieldSelector != "") {
+				return fmt.Errorf("--exclude-namespace, --selector and --field-selector are only available in cluster mode (--cluster)")
+			}
+			if opts.HelmChart != "" && len(opts.Namespaces) > 1 {
+				return fmt.Errorf("--helm-chart takes a single release namespace")
+			}
+			if err := opts.listOptions().Validate(); err != nil {
+				return err
+			}
+			gateOpts, err := opts.gateOptions(cmd.Flags().Changed("max-violations") || opts.Baseline != "")
+			if err != nil {
 				return err
 			}
 
 			// Initialize reporter
-			rep := opts.GetReporter()
+			rep, err := opts.GetReporter()
+			if err != nil {
+				return err
+			}
+			defer closeReporter(rep)
 
 			// Initialize simulator
 			simulator, err := engine.NewPolicySimulator()
 			if err != nil {
 				return fmt.Errorf("Failed to initialize policy simulator: %w", err)
 			}
+			simulator.SetApplyDefaults(opts.ApplyDefaults)
+
+			podSecurity, err := buildPodSecurityEvaluator(opts.PodSecurityLevel, opts.PodSecurityVersion, opts.Quiet)
+			if err != nil {
+				return err
+			}
+			simulator.SetPodSecurity(podSecurity)
+
+			closeEngine, err := configureEngine(simulator, opts.Engine, opts.Differential, opts.Quiet)
+			if err != nil {
+				return err
+			}
+			defer closeEngine()
+
+			analyzer, err := buildCompatAnalyzer(opts.TargetVersion, opts.Quiet)
+			if err != nil {
+				return err
+			}
 
 			// Branch processing for cluster mode and local mode
+			var counts gate.Counts
 			if opts.Cluster {
 				// Cluster mode
-				return runClusterCheck(ctx, rep, simulator, args, opts)
+				counts, err = runClusterCheck(ctx, rep, simulator, analyzer, args, opts)
 			} else {
 				// Local mode
-				if len(args) == 0 {
-					return fmt.Errorf("Please specify manifest files in local mode")
+				// Manifests are read from standard input when none are given and it is piped
+				policyStdin := slices.Contains(opts.PolicyFiles, loader.StdinPath)
+				if len(args) == 0 && len(opts.Kustomizations) == 0 && opts.HelmChart == "" && !policyStdin && loader.StdinPiped() {
+					args = []string{loader.StdinPath}
+				}
+				if policyStdin && slices.Contains(args, loader.StdinPath) {
+					return fmt.Errorf("Policies and manifests cannot both be read from standard input")
+				}
+				if len(args) == 0 && len(opts.Kustomizations) == 0 && opts.HelmChart == "" {
+					return fmt.Errorf("Please specify manifest files, --kustomize overlays or a --helm-chart in local mode")
 				}
-				return runLocalCheck(ctx, rep, simulator, args, opts)
+				counts, err = runLocalCheck(ctx, rep, simulator, analyzer, args, opts)
 			}
+			if err != nil {
+				return err
+			}
+
+			// Write reports buffering the results
+			if err := reporter.Flush(rep); err != nil {
+				return fmt.Errorf("Failed to report results: %w", err)
+			}
+
+			// Fail with an exit code telling the problems apart when they reach the thresholds
+			verdict := gate.Evaluate(counts, gateOpts)
+			if verdict.Failed() {
+				err := fmt.Errorf("Check failed: %s", strings.Join(verdict.Reasons, ", "))
+				reporter.PrintError(err)
+				return &ExitError{Code: verdict.ExitCode, Err: err}
+			}
+			return nil
 		},
 	}
 
 	// Command-specific flags
-	cmd.Flags().StringSliceVar(&opts.PolicyFiles, "policy", []string{}, "Policy files to use for validation (required, can specify multiple)")
+	cmd.Flags().StringSliceVar(&opts.PolicyFiles, "policy", []string{}, "Policy files, directories or glob patterns to use for validation, or - for standard input (required, can specify multiple)")
+	cmd.Flags().StringSliceVar(&opts.Ignore, "ignore", []string{}, "Glob patterns of files and directories to skip when expanding policy and manifest directories or globs (can specify multiple)")
 	cmd.Flags().StringVar(&opts.ParamFile, "param", "", "Parameter file for policies (optional)")
-	cmd.Flags().StringVar(&opts.Operation, "operation", "CREATE", "Operation to validate (CREATE, UPDATE, DELETE)")
+	cmd.Flags().StringVar(&opts.Operation, "operation", "", "Operation to validate (CREATE, UPDATE, DELETE), CREATE for manifests and UPDATE re-applying the objects in cluster mode by default")
 	cmd.Flags().BoolVarP(&opts.Cluster, "cluster", "c", false, "Run in cluster mode (fetch resources from cluster)")
-	cmd.Flags().StringVarP(&opts.Namespace, "namespace", "n", "", "Namespace to validate (cluster mode)")
+	cmd.Flags().BoolVar(&opts.ClusterPolicies, "cluster-policies", false, "Evaluate the ValidatingAdmissionPolicies installed in the cluster with their bindings, parameters and namespaces instead of --policy files (cluster mode, upstream engine by default)")
+	cmd.Flags().BoolVar(&opts.ClusterBindings, "cluster-bindings", false, "Evaluate --policy files with the bindings, parameters and namespaces of the cluster (cluster mode, upstream engine by default)")
+	cmd.Flags().StringVar(&opts.Snapshot, "snapshot", "", "Snapshot archive written by the snapshot command to check offline instead of the cluster (implies --cluster, and --cluster-policies without --policy)")
+	cmd.Flags().StringSliceVarP(&opts.Namespaces, "namespace", "n", []string{}, "Namespace to validate (cluster mode, can specify multiple), or release namespace of --helm-chart for templates that do not set one")
+	cmd.Flags().StringSliceVar(&opts.ExcludeNamespaces, "exclude-namespace", []string{}, "Namespace whose resources are not validated (cluster mode, can specify multiple)")
+	cmd.Flags().StringVarP(&opts.Selector, "selector", "l", "", "Label selector of the resources to validate, e.g. app=web,tier!=cache (cluster mode)")
+	cmd.Flags().StringVar(&opts.FieldSelector, "field-selector", "", "Field selector of the resources to validate, e.g. status.phase=Running (cluster mode)")
+	cmd.Flags().Int64Var(&opts.ChunkSize, "chunk-size", loader.DefaultChunkSize, "Number of resources retrieved per list request, 0 retrieves all resources of a type at once (cluster mode)")
+	cmd.Flags().Float32Var(&opts.QPS, "qps", 50, "Maximum requests per second to the apiserver (cluster mode)")
+	cmd.Flags().IntVar(&opts.Burst, "burst", 100, "Maximum burst of requests to the apiserver (cluster mode)")
+	cmd.Flags().StringArrayVar(&opts.Kustomizations, "kustomize", []string{}, "Kustomization directory to build offline and check the rendered resources of (can specify multiple)")
+	cmd.Flags().StringVar(&opts.HelmChart, "helm-chart", "", "Local Helm chart directory or archive to render offline and check the rendered objects of")
+	cmd.Flags().StringArrayVar(&opts.HelmValues, "values", []string{}, "Values file of --helm-chart (can specify multiple)")
+	cmd.Flags().StringArrayVar(&opts.HelmSet, "set", []string{}, "Value of --helm-chart, as key=value (can specify multiple or separate values with commas)")
+	cmd.Flags().BoolVar(&opts.ApplyDefaults, "apply-defaults", false, "Apply Kubernetes API defaults to manifests before evaluation")
+	cmd.Flags().StringVar(&opts.PodSecurityLevel, "pod-security-level", "", "Evaluate Pod Security Standards at this level (privileged, baseline, restricted) next to policies")
+	cmd.Flags().StringVar(&opts.PodSecurityVersion, "pod-security-version", "latest", "Pod Security Standards version to evaluate (e.g. v1.32, latest)")
+	cmd.Flags().StringVar(&opts.Engine, "engine", engine.EngineNative, "Evaluation engine (native, upstream)")
+	cmd.Flags().BoolVar(&opts.Differential, "differential", false, "Evaluate every resource with both engines and report resources where they disagree")
+	cmd.Flags().StringVar(&opts.TargetVersion, "target-version", "", "Report the policy API version each policy needs on this Kubernetes version (e.g. 1.29)")
+	cmd.Flags().StringVar(&opts.FailOn, "fail-on", "", "Exit with a non-zero code on problems of this severity or worse: deny (violations), warn (also violations of policies bound with the Warn action only), error (evaluation and load errors only)")
+	cmd.Flags().IntVar(&opts.MaxViolations, "max-violations", 0, "Number of violations allowed before the check fails, for policies without their own threshold (implies --fail-on=deny)")
+	cmd.Flags().StringToIntVar(&opts.PolicyMaxViolations, "policy-max-violations", map[string]int{}, "Number of violations allowed per policy, as policy=N (e.g. no-latest-tag=10, implies --fail-on=deny)")
+	cmd.Flags().StringVar(&opts.Baseline, "baseline", "", "Baseline file of accepted violations, only new violations are reported as failures (implies --fail-on=deny)")
+	cmd.Flags().StringVar(&opts.WriteBaseline, "write-baseline", "", "Write the violations of this check to a baseline file")
+	cmd.Flags().BoolVar(&opts.ApplyReports, "apply-reports", false, "Create or update wgpolicyk8s.io PolicyReports and ClusterPolicyReports of the results in the cluster (cluster mode)")
+	cmd.Flags().StringSliceVar(&opts.AdmissionPlugins, "admission-plugins", []string{}, fmt.Sprintf("Built-in mutating admission plugins to emulate before evaluation, with fixtures read from --policy files (%s)", strings.Join(plugins.SupportedPlugins(), ", ")))
 
 	return cmd
 }
 
 // runLocalCheck executes check for local files
-func runLocalCheck(ctx context.Context, rep reporter.Reporter, simulator *engine.PolicySimulator, manifestFiles []string, opts *CheckOptions) error {
+// It returns the problems of the check, judged against the failure thresholds
+func runLocalCheck(ctx context.Context, rep reporter.Reporter, simulator *engine.PolicySimulator, analyzer *compat.Analyzer, manifestFiles []string, opts *CheckOptions) (gate.Counts, error) {
 	// Initialize resource loader
 	resourceLoader, err := loader.NewLocalResourceLoader()
 	if err != nil {
-		return fmt.Errorf("Failed to initialize resource loader: %w", err)
+		return gate.Counts{}, fmt.Errorf("Failed to initialize resource loader: %w", err)
 	}
 
 	// Source configuration for loading policy files
 	resourceSource := loader.ResourceSource{
-		Type:  loader.SourceTypeLocal,
-		Files: opts.PolicyFiles,
+		Type:   loader.SourceTypeLocal,
+		Files:  opts.PolicyFiles,
+		Ignore: opts.Ignore,
 	}
 
-	// Load multiple policy files
-	policies, err := resourceLoader.LoadPolicies(resourceSource)
+	// Load multiple policy files, which may also hold parameters
+	bundle, err := resourceLoader.LoadBundle(resourceSource)
 	if err != nil {
 		if !opts.Quiet {
 			reporter.PrintError(fmt.Errorf("Failed to load policies: %w", err))
 		}
-		return fmt.Errorf("Failed to load policies: %w", err)
+		return gate.Counts{}, &ExitError{Code: gate.ExitLoadError, Err: fmt.Errorf("Failed to load policies: %w", err)}
+	}
+	reportUnknownDocuments(bundle, opts.Quiet)
+	simulator.SetPolicySources(bundle.PolicySources)
+
+	// Waivers of the policy files accept violations until they expire
+	waivers, err := buildWaivers(bundle, opts.Quiet)
+	if err != nil {
+		reporter.PrintError(err)
+		return gate.Counts{}, &ExitError{Code: gate.ExitLoadError, Err: err}
 	}
+	simulator.SetWaivers(waivers)
+	policies := bundle.Policies
+	reporter.SetPolicies(rep, policies)
 
 	for _, policy := range policies {
 		if !opts.Quiet {
 			reporter.PrintInfo(fmt.Sprintf("Using policy '%s' for validation", policy.Name))
 		}
 	}
+	warnUnknownThresholds(policies, opts)
 
-	// Load parameters (optional)
-	var paramObj runtime.Object
+	// Load parameters (optional), the --param file takes precedence over parameters of the policy files
+	paramObj := bundle.Parameter()
 	if opts.ParamFile != "" {
 		paramSource := loader.ResourceSource{
 			Type:  loader.SourceTypeLocal,
@@ -154,32 +356,76 @@ func runLocalCheck(ctx context.Context, rep reporter.Reporter, simulator *engine
 		}
 	}
 
+	// Set up built-in admission plugin emulation
+	chain, err := buildAdmissionChain(resourceLoader, resourceSource, opts.AdmissionPlugins, opts.Quiet)
+	if err != nil {
+		return gate.Counts{}, err
+	}
+	simulator.SetAdmissionPlugins(chain)
+
 	// Store validation results by resource type
 	var allResults []*kaptestv1.TestResult
 	var totalCount, successCount, failedCount int
+	// Manifests and documents that could not be loaded, and resources that could not be evaluated
+	var problems gate.Counts
+
+	// Expand manifest directories and glob patterns
+	manifestFiles, err = loader.ExpandPaths(manifestFiles, opts.Ignore)
+	if err != nil {
+		reporter.PrintError(fmt.Errorf("Failed to find manifest files: %w", err))
+		return gate.Counts{}, &ExitError{Code: gate.ExitLoadError, Err: fmt.Errorf("Failed to find manifest files: %w", err)}
+	}
 
 	// Process manifest files
 	for _, manifestPath := range manifestFiles {
-		manifestPath = filepath.Clean(manifestPath)
 
 		if !opts.Quiet {
-			reporter.PrintInfo(fmt.Sprintf("Processing manifest file: %s", manifestPath))
+			reporter.PrintInfo(fmt.Sprintf("Processing manifest file: %s", loader.SourceName(manifestPath)))
 		}
 
-		results, err := processManifestFile(ctx, manifestPath, policies, paramObj, simulator, opts)
+		// Results of the documents read before an error are kept
+		results, err := processManifestFile(ctx, manifestPath, policies, paramObj, simulator, &problems, opts)
 		if err != nil {
 			reporter.PrintError(err)
-			continue
+			problems.LoadErrors++
 		}
+		allResults = append(allResults, results...)
+	}
 
-		for _, result := range results {
-			totalCount++
-			if result.ActualResponse.Allowed {
-				successCount++
-			} else {
-				failedCount++
-			}
-			allResults = append(allResults, result)
+	// Process Kustomize overlays
+	for _, kustomization := range opts.Kustomizations {
+		if !opts.Quiet {
+			reporter.PrintInfo(fmt.Sprintf("Building kustomization: %s", kustomization))
+		}
+
+		results, err := processKustomization(ctx, kustomization, policies, paramObj, simulator, &problems, opts)
+		if err != nil {
+			reporter.PrintError(err)
+			problems.LoadErrors++
+		}
+		allResults = append(allResults, results...)
+	}
+
+	// Process the Helm chart
+	if opts.HelmChart != "" {
+		if !opts.Quiet {
+			reporter.PrintInfo(fmt.Sprintf("Rendering Helm chart: %s", opts.HelmChart))
+		}
+
+		results, err := processHelmChart(ctx, policies, paramObj, simulator, &problems, opts)
+		if err != nil {
+			reporter.PrintError(err)
+			problems.LoadErrors++
+		}
+		allResults = append(allResults, results...)
+	}
+
+	for _, result := range allResults {
+		totalCount++
+		if result.ActualResponse.Allowed {
+			successCount++
+		} else {
+			failedCount++
 		}
 	}
 
@@ -196,78 +442,132 @@ func runLocalCheck(ctx context.Context, rep reporter.Reporter, simulator *engine
 			Successful: successCount,
 			Failed:     failedCount,
 		},
+		PodSecurity: simulator.SummarizePodSecurity(resultsArray),
+		Engine:      simulator.EngineName(),
+		APIVersions: reportAPIVersions(analyzer, policies),
+	}
+
+	if err := compareBaseline(status, opts); err != nil {
+		return gate.Counts{}, err
 	}
 
 	// Report test results
 	if err := rep.Report(status); err != nil {
 		reporter.PrintError(fmt.Errorf("Failed to report results: %w", err))
-		return err
+		return gate.Counts{}, err
 	}
 
-	// check command only reports validation results and does not return error even if there are failures
-	return nil
+	if err := writeBaseline(status, opts); err != nil {
+		return gate.Counts{}, err
+	}
+
+	// Failures are judged against the thresholds once the reports are written
+	return countProblems(status, bundle.Bindings, problems), nil
 }
 
-func processManifestFile(ctx context.Context, manifestPath string, policies []*admissionregistrationv1.ValidatingAdmissionPolicy, paramObj runtime.Object, simulator *engine.PolicySimulator, opts *CheckOptions) ([]*kaptestv1.TestResult, error) {
-	data, err := os.ReadFile(manifestPath)
+// processManifestFile evaluates the documents of a manifest file
+// Documents that cannot be read or evaluated are skipped and counted in problems
+func processManifestFile(ctx context.Context, manifestPath string, policies []*admissionregistrationv1.ValidatingAdmissionPolicy, paramObj runtime.Object, simulator *engine.PolicySimulator, problems *gate.Counts, opts *CheckOptions) ([]*kaptestv1.TestResult, error) {
+	var results []*kaptestv1.TestResult
+	err := visitManifestFile(manifestPath, problems, func(unstructuredObj *unstructured.Unstructured, location kaptestv1.SourceLocation) {
+		result, err := evaluateObject(ctx, unstructuredObj, policies, paramObj, simulator, opts)
+		if err != nil {
+			reporter.PrintError(err)
+			problems.EvaluationErrors++
+			return
+		}
+		result.Source = &location
+
+		results = append(results, result)
+	})
+	return results, err
+}
+
+// visitManifestFile calls visit with the objects of the documents of a manifest file, as they are read
+// Documents that cannot be read are skipped and counted in problems
+func visitManifestFile(manifestPath string, problems *gate.Counts, visit func(*unstructured.Unstructured, kaptestv1.SourceLocation)) error {
+	file, err := loader.Open(manifestPath)
 	if err != nil {
-		return nil, fmt.Errorf("Failed to read manifest file: %w", err)
+		return fmt.Errorf("Failed to read manifest file: %w", err)
 	}
+	defer file.Close()
 
-	var results []*kaptestv1.TestResult
-
-	// Split YAML documents
-	documents := bytes.Split(data, []byte("---\n"))
-	for _, doc := range documents {
-		doc = bytes.TrimSpace(doc)
-		if len(doc) == 0 {
+	decoder := loader.NewDocumentDecoder(file, loader.SourceName(manifestPath))
+	for {
+		doc, err := decoder.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		var documentErr *loader.DocumentError
+		if errors.As(err, &documentErr) {
+			reporter.PrintError(err)
+			problems.LoadErrors++
 			continue
 		}
-
-		// Convert to JSON
-		jsonData, err := yaml.YAMLToJSON(doc)
 		if err != nil {
-			reporter.PrintError(fmt.Errorf("Failed to convert YAML to JSON: %w", err))
-			continue
+			return fmt.Errorf("Failed to read manifest file: %w", err)
 		}
 
 		// Convert to Unstructured for dynamic client
 		unstructuredObj := &unstructured.Unstructured{}
-		if err := unstructuredObj.UnmarshalJSON(jsonData); err != nil {
-			reporter.PrintError(fmt.Errorf("Failed to convert JSON to Unstructured: %w", err))
+		if err := unstructuredObj.UnmarshalJSON(doc.JSON); err != nil {
+			reporter.PrintError(fmt.Errorf("Failed to convert JSON to Unstructured (%s): %w", doc, err))
+			problems.LoadErrors++
 			continue
 		}
 
-		resourceType := fmt.Sprintf("%s.%s", strings.ToLower(unstructuredObj.GetKind()), unstructuredObj.GetAPIVersion())
-		resourceName := unstructuredObj.GetName()
-
-		if resourceName == "" {
-			resourceName = fmt.Sprintf("unnamed-%s", uuid.NewString()[:8])
-		}
+		visit(unstructuredObj, doc.Location())
+	}
+}
 
-		// Create test case
-		testCase := kaptestv1.TestCase{
-			Name:      fmt.Sprintf("%s/%s", resourceType, resourceName),
-			Operation: opts.Operation,
-			Object: runtime.RawExtension{
-				Object: unstructuredObj,
-			},
-			Expected: kaptestv1.ExpectedResult{
-				Allowed: true, // Expected value is not used, so any value is OK
-			},
-		}
+// processKustomization builds a Kustomize overlay and evaluates its rendered resources
+// Results point at the files the resources originate from, and the patches applied to them
+func processKustomization(ctx context.Context, path string, policies []*admissionregistrationv1.ValidatingAdmissionPolicy, paramObj runtime.Object, simulator *engine.PolicySimulator, problems *gate.Counts, opts *CheckOptions) ([]*kaptestv1.TestResult, error) {
+	resources, err := kustomize.Build(path)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to build kustomization %s: %w", path, err)
+	}
 
-		// Simulation using multiple policies
-		result, err := simulator.SimulateTestCaseWithMultiPolicies(ctx, policies, paramObj, testCase)
+	var results []*kaptestv1.TestResult
+	for _, resource := range resources {
+		result, err := evaluateObject(ctx, resource.Object, policies, paramObj, simulator, opts)
 		if err != nil {
-			reporter.PrintError(fmt.Errorf("Failed to validate resource (%s/%s): %w", resourceType, resourceName, err))
+			reporter.PrintError(err)
+			problems.EvaluationErrors++
 			continue
 		}
+		source := resource.Source
+		result.Source = &source
+		result.Patches = resource.Patches
+
+		results = append(results, result)
+	}
+
+	return results, nil
+}
+
+// processHelmChart renders the Helm chart and evaluates its objects
+// Results point at the templates the objects are rendered from
+func processHelmChart(ctx context.Context, policies []*admissionregistrationv1.ValidatingAdmissionPolicy, paramObj runtime.Object, simulator *engine.PolicySimulator, problems *gate.Counts, opts *CheckOptions) ([]*kaptestv1.TestResult, error) {
+	resources, err := helm.Render(opts.HelmChart, helm.Options{
+		Namespace:  helmNamespace(opts.Namespaces),
+		ValueFiles: opts.HelmValues,
+		Values:     opts.HelmSet,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Failed to render Helm chart %s: %w", opts.HelmChart, err)
+	}
 
-		// Add resource type information
-		result.Metadata = map[string]string{
-			"resourceType": resourceType,
+	var results []*kaptestv1.TestResult
+	for _, resource := range resources {
+		result, err := evaluateObject(ctx, resource.Object, policies, paramObj, simulator, opts)
+		if err != nil {
+			reporter.PrintError(err)
+			problems.EvaluationErrors++
+			continue
 		}
+		source := resource.Source
+		result.Source = &source
 
 		results = append(results, result)
 	}
@@ -275,37 +575,98 @@ func processManifestFile(ctx context.Context, manifestPath string, policies []*a
 	return results, nil
 }
 
-// runClusterCheck executes check for cluster resources
-func runClusterCheck(ctx context.Context, rep reporter.Reporter, simulator *engine.PolicySimulator, resourceSpecs []string, opts *CheckOptions) error {
-	// Initialize resource loader
-	resourceLoader, err := loader.NewClusterResourceLoader(opts.Kubeconfig)
+// evaluateObject evaluates an object of a manifest against the policies
+func evaluateObject(ctx context.Context, unstructuredObj *unstructured.Unstructured, policies []*admissionregistrationv1.ValidatingAdmissionPolicy, paramObj runtime.Object, simulator *engine.PolicySimulator, opts *CheckOptions) (*kaptestv1.TestResult, error) {
+	resourceType := fmt.Sprintf("%s.%s", strings.ToLower(unstructuredObj.GetKind()), unstructuredObj.GetAPIVersion())
+	resourceName := unstructuredObj.GetName()
+
+	if resourceName == "" {
+		resourceName = fmt.Sprintf("unnamed-%s", uuid.NewString()[:8])
+	}
+
+	// Create test case
+	testCase := kaptestv1.TestCase{
+		Name:      fmt.Sprintf("%s/%s", resourceType, resourceName),
+		Operation: opts.Operation,
+		Object: runtime.RawExtension{
+			Object: unstructuredObj,
+		},
+		Expected: kaptestv1.ExpectedResult{
+			Allowed: true, // Expected value is not used, so any value is OK
+		},
+	}
+
+	// Simulation using multiple policies
+	result, err := simulator.SimulateTestCaseWithMultiPolicies(ctx, policies, paramObj, testCase)
 	if err != nil {
-		return fmt.Errorf("Failed to initialize cluster resource loader: %w", err)
+		return nil, fmt.Errorf("Failed to validate resource (%s/%s): %w", resourceType, resourceName, err)
 	}
 
-	// Source configuration for loading policy files
-	policySource := loader.ResourceSource{
-		Type:  loader.SourceTypeLocal,
-		Files: opts.PolicyFiles,
+	// Add resource type information
+	result.Metadata = map[string]string{
+		"resourceType": resourceType,
 	}
+	result.Resource = resourceReference(unstructuredObj)
 
-	// Load multiple policy files
-	policies, err := resourceLoader.LoadPolicies(policySource)
+	return result, nil
+}
+
+// runClusterCheck executes check for cluster resources
+// It returns the problems of the check, judged against the failure thresholds
+func runClusterCheck(ctx context.Context, rep reporter.Reporter, simulator *engine.PolicySimulator, analyzer *compat.Analyzer, resourceSpecs []string, opts *CheckOptions) (gate.Counts, error) {
+	// Initialize resource loader, serving the snapshot when one is given
+	resourceLoader, clusterSnapshot, err := clusterCheckLoader(opts)
+	if err != nil {
+		reporter.PrintError(err)
+		return gate.Counts{}, &ExitError{Code: gate.ExitLoadError, Err: err}
+	}
+
+	// Load the policy files, which may also hold parameters, or the policies of the cluster
+	bundle, err := loadClusterCheckBundle(ctx, resourceLoader, opts)
 	if err != nil {
 		if !opts.Quiet {
 			reporter.PrintError(fmt.Errorf("Failed to load policies: %w", err))
 		}
-		return fmt.Errorf("Failed to load policies: %w", err)
+		return gate.Counts{}, &ExitError{Code: gate.ExitLoadError, Err: fmt.Errorf("Failed to load policies: %w", err)}
 	}
+	reportUnknownDocuments(bundle, opts.Quiet)
+	simulator.SetPolicySources(bundle.PolicySources)
+
+	// Waivers of the policy files accept violations until they expire
+	waivers, err := buildWaivers(bundle, opts.Quiet)
+	if err != nil {
+		reporter.PrintError(err)
+		return gate.Counts{}, &ExitError{Code: gate.ExitLoadError, Err: err}
+	}
+	simulator.SetWaivers(waivers)
+
+	// With the bindings of the cluster, policies are evaluated through their bindings as the
+	// apiserver does, so policies without bindings are not evaluated
+	clusterBindings := opts.ClusterPolicies || opts.ClusterBindings
+	policies := bundle.Policies
+	if clusterBindings {
+		policies = boundPolicies(bundle.Policies, bundle.Bindings, opts.Quiet)
+		simulator.SetParams(bundle.Params)
+		simulator.SetNamespaces(bundle.Namespaces)
+		if !opts.Quiet {
+			reporter.PrintInfo(fmt.Sprintf("Loaded %d policy bindings, %d parameters and %d namespaces from cluster", len(bundle.Bindings), len(bundle.Params), len(bundle.Namespaces)))
+		}
+	}
+	reporter.SetPolicies(rep, policies)
 
 	for _, policy := range policies {
 		if !opts.Quiet {
 			reporter.PrintInfo(fmt.Sprintf("Using policy '%s' for validation", policy.Name))
 		}
 	}
+	warnUnknownThresholds(policies, opts)
 
-	// Load parameters (optional)
+	// Load parameters (optional), the --param file takes precedence over parameters of the policy files
+	// Parameters of the policy files are selected by the paramRef of the bindings of the cluster
 	var paramObj runtime.Object
+	if !clusterBindings {
+		paramObj = bundle.Parameter()
+	}
 	if opts.ParamFile != "" {
 		paramSource := loader.ResourceSource{
 			Type:  loader.SourceTypeLocal,
@@ -319,152 +680,485 @@ func runClusterCheck(ctx context.Context, rep reporter.Reporter, simulator *engi
 		}
 	}
 
-	// Determine resource types to validate
-	var resourceTypes []string
+	// Determine resource types to validate, resolved with the API resources the cluster serves
+	var mappings []*meta.RESTMapping
 	if len(resourceSpecs) > 0 {
 		// When specified in arguments
-		resourceTypes = resourceSpecs
+		mappings, err = resourceLoader.ResolveResources(resourceSpecs)
+		if err != nil {
+			return gate.Counts{}, &ExitError{Code: gate.ExitLoadError, Err: fmt.Errorf("Failed to resolve resource types: %w", err)}
+		}
 	} else {
-		// Extract target resources from policies
-		resourceTypes, err = extractResourceTypesFromPolicies(policies)
+		// Resources intercepted by the resource rules of the policies
+		mappings, err = resourceLoader.ResolvePolicyResources(policies)
 		if err != nil {
-			return fmt.Errorf("Failed to extract resource types from policies: %w", err)
+			return gate.Counts{}, &ExitError{Code: gate.ExitLoadError, Err: fmt.Errorf("Failed to extract resource types from policies: %w", err)}
+		}
+	}
+
+	// Objects of cluster-scoped resources are in no namespace
+	if len(opts.Namespaces) > 0 {
+		var namespaced []*meta.RESTMapping
+		for _, mapping := range mappings {
+			if mapping.Scope.Name() == meta.RESTScopeNameNamespace {
+				namespaced = append(namespaced, mapping)
+			} else if !opts.Quiet {
+				reporter.PrintInfo(fmt.Sprintf("Skipping cluster-scoped resource %s in namespaces %s", loader.ResourceType(mapping), strings.Join(opts.Namespaces, ", ")))
+			}
 		}
+		mappings = namespaced
 	}
 
+	resourceTypes := make([]string, len(mappings))
+	for i, mapping := range mappings {
+		resourceTypes[i] = loader.ResourceType(mapping)
+		if clusterSnapshot != nil && !clusterSnapshot.Captured(mapping.Resource) && !opts.Quiet {
+			reporter.PrintWarning(fmt.Sprintf("Resource %s is not in the snapshot, no objects are checked", resourceTypes[i]))
+		}
+	}
 	if !opts.Quiet {
 		reporter.PrintInfo(fmt.Sprintf("Resources to validate: %s", strings.Join(resourceTypes, ", ")))
 	}
 
 	// When no resources are specified
 	if len(resourceTypes) == 0 {
-		return fmt.Errorf("No resources specified for validation")
+		return gate.Counts{}, fmt.Errorf("No resources specified for validation")
 	}
 
 	if !opts.Quiet {
 		reporter.PrintInfo(fmt.Sprintf("Fetching resources from cluster..."))
 	}
 
-	// Store validation results by resource type
-	var allResults []*kaptestv1.TestResult
-	var totalCount, successCount, failedCount int
-
-	// Configuration for fetching resources from cluster
-	resourceSource := loader.ResourceSource{
-		Type:      loader.SourceTypeCluster,
-		Namespace: opts.Namespace,
+	// Results are passed on as they are produced, so only their counts are kept
+	results, err := newClusterResults(simulator, policies, bundle.Bindings, opts)
+	if err != nil {
+		return gate.Counts{}, err
 	}
+	// Resource types that could not be fetched, and resources that could not be evaluated
+	var problems gate.Counts
+	var reportErr error
 
 	// Process each resource type
-	for _, resourceType := range resourceTypes {
-		// Fetch resources from cluster
-		resources, err := resourceLoader.GetResources(ctx, resourceType, resourceSource)
+	// Objects are evaluated as they are listed, so only a chunk of the listed objects is held at once
+	var bindings []*admissionregistrationv1.ValidatingAdmissionPolicyBinding
+	if clusterBindings {
+		bindings = bundle.Bindings
+	}
+	listOptions := opts.listOptions()
+	for i, mapping := range mappings {
+		resourceType := resourceTypes[i]
+
+		fetched := 0
+		err := resourceLoader.VisitResources(ctx, mapping, listOptions, func(unstructuredObj *unstructured.Unstructured) error {
+			fetched++
+
+			// Simulation using multiple policies, through the bindings of the cluster
+			result, err := evaluateClusterObject(ctx, unstructuredObj, resourceType, policies, bindings, paramObj, simulator, opts)
+			if err != nil {
+				reporter.PrintError(err)
+				problems.EvaluationErrors++
+				return nil
+			}
+
+			if err := results.add(rep, result); err != nil {
+				reportErr = err
+				return err
+			}
+			return nil
+		})
+		if reportErr != nil {
+			reporter.PrintError(fmt.Errorf("Failed to report results: %w", reportErr))
+			return gate.Counts{}, reportErr
+		}
 		if err != nil {
+			// Results of the objects listed before the error are kept
 			reporter.PrintError(fmt.Errorf("Failed to fetch resources (%s): %w", resourceType, err))
+			problems.LoadErrors++
 			continue
 		}
 
 		if !opts.Quiet {
-			reporter.PrintInfo(fmt.Sprintf("Fetched resources: %s (%d items)", resourceType, len(resources)))
+			reporter.PrintInfo(fmt.Sprintf("Fetched resources: %s (%d items)", resourceType, fetched))
 		}
+	}
 
-		// Validate each resource with policies
-		for _, resource := range resources {
-			// Get resource name
-			unstructuredObj, ok := resource.(*unstructured.Unstructured)
-			if !ok {
-				reporter.PrintError(fmt.Errorf("Failed to convert resource type: %T", resource))
-				continue
-			}
+	// Create test result status, whose results were reported one at a time
+	status := &kaptestv1.ValidatingAdmissionPolicyTestStatus{
+		Summary:     results.summary,
+		PodSecurity: results.podSecurity,
+		Engine:      simulator.EngineName(),
+		APIVersions: reportAPIVersions(analyzer, policies),
+	}
+	if results.comparison != nil {
+		status.Baseline = results.comparison.Report()
+	}
 
-			resourceName := unstructuredObj.GetName()
-
-			// Create test case
-			testCase := kaptestv1.TestCase{
-				Name:      fmt.Sprintf("%s/%s", resourceType, resourceName),
-				Operation: "CREATE", // Assume CREATE operation for validation
-				Object: runtime.RawExtension{
-					Object: resource,
-				},
-				Expected: kaptestv1.ExpectedResult{
-					Allowed: true, // Expected value is not used, so any value is OK
-				},
-			}
+	// Report test results
+	if err := rep.Report(status); err != nil {
+		reporter.PrintError(fmt.Errorf("Failed to report results: %w", err))
+		return gate.Counts{}, err
+	}
 
-			// Simulation using multiple policies
-			result, err := simulator.SimulateTestCaseWithMultiPolicies(ctx, policies, paramObj, testCase)
-			if err != nil {
-				reporter.PrintError(fmt.Errorf("Failed to validate resource (%s/%s): %w", resourceType, resourceName, err))
-				continue
-			}
+	if results.recorder != nil {
+		if err := saveBaseline(results.recorder.Baseline(), opts); err != nil {
+			return gate.Counts{}, err
+		}
+	}
 
-			// Save results
-			totalCount++
-			if result.ActualResponse.Allowed {
-				successCount++
-			} else {
-				failedCount++
-			}
+	if results.reports != nil {
+		reports := results.reports.Reports()
+		if err := policyreport.Apply(ctx, resourceLoader.DynamicClient(), reports); err != nil {
+			reporter.PrintError(fmt.Errorf("Failed to apply policy reports: %w", err))
+			return gate.Counts{}, fmt.Errorf("Failed to apply policy reports: %w", err)
+		}
+		if !opts.Quiet {
+			reporter.PrintSuccess(fmt.Sprintf("Applied %d policy reports", len(reports)))
+		}
+	}
 
-			// Add resource type information
-			result.Metadata = map[string]string{
-				"resourceType": resourceType,
-			}
+	// Failures are judged against the thresholds once the reports are written
+	counts := results.counter.Counts()
+	counts.LoadErrors += problems.LoadErrors
+	counts.EvaluationErrors += problems.EvaluationErrors
+	return counts, nil
+}
+
+// clusterResults follows the results of a cluster check as they are produced, passing each to
+// the reporters, the baselines, the policy reports and the failure thresholds, so that only their
+// counts are kept however many objects the cluster has
+type clusterResults struct {
+	simulator   *engine.PolicySimulator
+	summary     kaptestv1.TestSummary
+	podSecurity *kaptestv1.PodSecuritySummary
+	counter     *gate.Counter
+	// comparison compares the results with the --baseline file
+	comparison *baseline.Comparison
+	// recorder records the violations of the --write-baseline file
+	recorder *baseline.Recorder
+	// reports builds the policy reports of --apply-reports
+	reports *policyreport.Builder
+}
 
-			allResults = append(allResults, result)
+// newClusterResults creates the followers of the results of a cluster check with the options
+func newClusterResults(simulator *engine.PolicySimulator, policies []*admissionregistrationv1.ValidatingAdmissionPolicy, bindings []*admissionregistrationv1.ValidatingAdmissionPolicyBinding, opts *CheckOptions) (*clusterResults, error) {
+	results := &clusterResults{
+		simulator:   simulator,
+		podSecurity: simulator.SummarizePodSecurity(nil),
+		counter:     gate.NewCounter(bindings),
+	}
+	if opts.Baseline != "" {
+		base, err := loadBaseline(opts)
+		if err != nil {
+			return nil, err
 		}
+		results.comparison = base.Compare(opts.Baseline)
+	}
+	if opts.WriteBaseline != "" {
+		results.recorder = baseline.NewRecorder()
+	}
+	if opts.ApplyReports {
+		results.reports = policyreport.NewBuilder(policies, time.Now())
 	}
+	return results, nil
+}
 
-	// Create test result status
-	resultsArray := make([]kaptestv1.TestResult, len(allResults))
-	for i, result := range allResults {
-		resultsArray[i] = *result
+// add passes on the result of an object
+// Violations are compared with the baseline first, so that the reporters and the failure
+// thresholds know which are accepted
+func (c *clusterResults) add(rep reporter.Reporter, result *kaptestv1.TestResult) error {
+	c.summary.Total++
+	if result.ActualResponse.Allowed {
+		c.summary.Successful++
+	} else {
+		c.summary.Failed++
 	}
 
-	status := &kaptestv1.ValidatingAdmissionPolicyTestStatus{
-		Results: resultsArray,
-		Summary: kaptestv1.TestSummary{
-			Total:      totalCount,
-			Successful: successCount,
-			Failed:     failedCount,
+	if c.comparison != nil {
+		c.comparison.Apply(result)
+	}
+	if c.recorder != nil {
+		c.recorder.Add(result)
+	}
+	if c.reports != nil {
+		c.reports.Add(result)
+	}
+	c.counter.Add(result)
+	c.simulator.AddPodSecurity(c.podSecurity, result)
+	return reporter.ReportResult(rep, result)
+}
+
+// evaluateClusterObject evaluates an object of the cluster against the policies, through the
+// bindings when given and against every policy otherwise
+func evaluateClusterObject(ctx context.Context, unstructuredObj *unstructured.Unstructured, resourceType string, policies []*admissionregistrationv1.ValidatingAdmissionPolicy, bindings []*admissionregistrationv1.ValidatingAdmissionPolicyBinding, paramObj runtime.Object, simulator *engine.PolicySimulator, opts *CheckOptions) (*kaptestv1.TestResult, error) {
+	resourceName := unstructuredObj.GetName()
+
+	// Create test case
+	// Objects are re-applied over themselves, so UPDATE and DELETE requests see them as the
+	// old object as well
+	testCase := kaptestv1.TestCase{
+		Name:      fmt.Sprintf("%s/%s", resourceType, resourceName),
+		Operation: opts.Operation,
+		Object: runtime.RawExtension{
+			Object: unstructuredObj,
+		},
+		Expected: kaptestv1.ExpectedResult{
+			Allowed: true, // Expected value is not used, so any value is OK
 		},
 	}
+	if opts.Operation != "CREATE" {
+		testCase.OldObject = &runtime.RawExtension{Object: unstructuredObj}
+	}
 
-	// Report test results
-	if err := rep.Report(status); err != nil {
-		reporter.PrintError(fmt.Errorf("Failed to report results: %w", err))
+	result, err := simulator.SimulateWithPolicyBindings(ctx, policies, bindings, paramObj, testCase)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to validate resource (%s/%s): %w", resourceType, resourceName, err)
+	}
+
+	// Add resource type information
+	result.Metadata = map[string]string{
+		"resourceType": resourceType,
+	}
+	result.Resource = resourceReference(unstructuredObj)
+
+	return result, nil
+}
+
+// clusterCheckLoader returns the loader of the cluster a check audits, or the loader serving the
+// snapshot of it with the snapshot when --snapshot is given
+func clusterCheckLoader(opts *CheckOptions) (*loader.ClusterResourceLoader, *snapshot.Snapshot, error) {
+	if opts.Snapshot == "" {
+		resourceLoader, err := loader.NewClusterResourceLoaderWithOptions(opts.Kubeconfig, loader.ClientOptions{QPS: opts.QPS, Burst: opts.Burst})
+		if err != nil {
+			return nil, nil, fmt.Errorf("Failed to initialize cluster resource loader: %w", err)
+		}
+		return resourceLoader, nil, nil
+	}
+
+	clusterSnapshot, err := snapshot.Open(opts.Snapshot)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Failed to read snapshot: %w", err)
+	}
+	resourceLoader, err := clusterSnapshot.Loader()
+	if err != nil {
+		return nil, nil, fmt.Errorf("Failed to read snapshot: %w", err)
+	}
+	if !opts.Quiet {
+		manifest := clusterSnapshot.Manifest
+		server := "unknown version"
+		if manifest.ServerVersion != nil {
+			server = manifest.ServerVersion.GitVersion
+		}
+		reporter.PrintInfo(fmt.Sprintf("Checking snapshot %s of cluster %s taken at %s", opts.Snapshot, server, manifest.CreatedAt.UTC().Format(time.RFC3339)))
+	}
+	return resourceLoader, clusterSnapshot, nil
+}
+
+// compareBaseline marks the violations accepted by the baseline, and reports how the violations
+// compare with it
+func compareBaseline(status *kaptestv1.ValidatingAdmissionPolicyTestStatus, opts *CheckOptions) error {
+	if opts.Baseline == "" {
+		return nil
+	}
+
+	base, err := loadBaseline(opts)
+	if err != nil {
 		return err
 	}
+	status.Baseline = base.Apply(status, opts.Baseline)
+	return nil
+}
+
+// loadBaseline reads the baseline file violations are compared with
+func loadBaseline(opts *CheckOptions) (*baseline.Baseline, error) {
+	base, err := baseline.Load(opts.Baseline)
+	if err != nil {
+		reporter.PrintError(fmt.Errorf("Failed to load baseline: %w", err))
+		return nil, &ExitError{Code: gate.ExitLoadError, Err: fmt.Errorf("Failed to load baseline: %w", err)}
+	}
+	return base, nil
+}
+
+// writeBaseline records the violations of the check in the baseline file
+func writeBaseline(status *kaptestv1.ValidatingAdmissionPolicyTestStatus, opts *CheckOptions) error {
+	if opts.WriteBaseline == "" {
+		return nil
+	}
+	return saveBaseline(baseline.FromResults(status), opts)
+}
 
-	// check command only reports validation results and does not return error even if there are failures
+// saveBaseline writes the baseline of the violations of the check to the baseline file
+func saveBaseline(base *baseline.Baseline, opts *CheckOptions) error {
+	if err := base.Write(opts.WriteBaseline); err != nil {
+		reporter.PrintError(fmt.Errorf("Failed to write baseline: %w", err))
+		return fmt.Errorf("Failed to write baseline: %w", err)
+	}
+	if !opts.Quiet {
+		reporter.PrintSuccess(fmt.Sprintf("Wrote %d violations to baseline %s", len(base.Violations), opts.WriteBaseline))
+	}
 	return nil
 }
 
-// extractResourceTypesFromPolicies extracts target resource types from policies
-func extractResourceTypesFromPolicies(policies []*admissionregistrationv1.ValidatingAdmissionPolicy) ([]string, error) {
-	resourceMap := make(map[string]bool)
+// gateOptions returns the failure thresholds of the check
+// Violation thresholds and baselines imply failing on denials
+func (o *CheckOptions) gateOptions(thresholdSet bool) (gate.Options, error) {
+	level, err := gate.ParseLevel(o.FailOn)
+	if err != nil {
+		return gate.Options{}, err
+	}
+	if o.MaxViolations < 0 {
+		return gate.Options{}, fmt.Errorf("invalid --max-violations: %d (must not be negative)", o.MaxViolations)
+	}
+	for policy, limit := range o.PolicyMaxViolations {
+		if limit < 0 {
+			return gate.Options{}, fmt.Errorf("invalid --policy-max-violations for policy '%s': %d (must not be negative)", policy, limit)
+		}
+	}
+	if level == gate.LevelNone && (thresholdSet || len(o.PolicyMaxViolations) > 0) {
+		level = gate.LevelDeny
+	}
+	return gate.Options{FailOn: level, MaxViolations: o.MaxViolations, PolicyMaxViolations: o.PolicyMaxViolations}, nil
+}
 
-	for _, policy := range policies {
-		if policy.Spec.MatchConstraints == nil || len(policy.Spec.MatchConstraints.ResourceRules) == 0 {
-			// Skip if no match constraints
-			continue
+// warnUnknownThresholds warns about per-policy violation thresholds of policies that are not loaded
+func warnUnknownThresholds(policies []*admissionregistrationv1.ValidatingAdmissionPolicy, opts *CheckOptions) {
+	if opts.Quiet {
+		return
+	}
+	for name := range opts.PolicyMaxViolations {
+		if !slices.ContainsFunc(policies, func(policy *admissionregistrationv1.ValidatingAdmissionPolicy) bool {
+			return policy.Name == name
+		}) {
+			reporter.PrintWarning(fmt.Sprintf("--policy-max-violations names unknown policy '%s'", name))
 		}
+	}
+}
 
-		for _, rule := range policy.Spec.MatchConstraints.ResourceRules {
-			for _, resource := range rule.Resources {
-				// "*" represents all resources but is not practical, so ignore it
-				if resource != "*" {
-					resourceMap[resource] = true
-				}
-			}
+// countProblems counts the problems of check results, with the manifests, documents and resources
+// that could not be loaded or evaluated
+func countProblems(status *kaptestv1.ValidatingAdmissionPolicyTestStatus, bindings []*admissionregistrationv1.ValidatingAdmissionPolicyBinding, problems gate.Counts) gate.Counts {
+	counts := gate.Count(status, bindings)
+	counts.LoadErrors += problems.LoadErrors
+	counts.EvaluationErrors += problems.EvaluationErrors
+	return counts
+}
+
+// resourceReference returns the reference of a checked object, in the namespace it would be created
+// in when namespaced and unset
+func resourceReference(obj *unstructured.Unstructured) *kaptestv1.ResourceReference {
+	namespace := obj.GetNamespace()
+	if namespace == "" && !upstream.IsClusterScoped(obj.GroupVersionKind().GroupKind()) {
+		namespace = "default"
+	}
+	return &kaptestv1.ResourceReference{
+		APIVersion: obj.GetAPIVersion(),
+		Kind:       obj.GetKind(),
+		Namespace:  namespace,
+		Name:       obj.GetName(),
+		UID:        string(obj.GetUID()),
+	}
+}
+
+// reportAPIVersions reports the policy API version each policy needs on the target Kubernetes version
+// Nothing is reported without a target version
+func reportAPIVersions(analyzer *compat.Analyzer, policies []*admissionregistrationv1.ValidatingAdmissionPolicy) *kaptestv1.APIVersionReport {
+	if analyzer == nil {
+		return nil
+	}
+	return analyzer.Report(policies)
+}
+
+// listOptions returns the options selecting the cluster objects to check
+func (o *CheckOptions) listOptions() loader.ListOptions {
+	return loader.ListOptions{
+		Namespaces:        o.Namespaces,
+		ExcludeNamespaces: o.ExcludeNamespaces,
+		LabelSelector:     o.Selector,
+		FieldSelector:     o.FieldSelector,
+		ChunkSize:         o.ChunkSize,
+	}
+}
+
+// helmNamespace returns the release namespace of --helm-chart, the default namespace of Helm when
+// none is given
+func helmNamespace(namespaces []string) string {
+	if len(namespaces) == 0 {
+		return ""
+	}
+	return namespaces[0]
+}
+
+// loadClusterCheckBundle loads the policies of a cluster check
+// With --cluster-policies the policies and bindings of the cluster are loaded, and with
+// --cluster-bindings the policy files with the bindings of the cluster, bindings of the files
+// replacing those of the same name. Both load the parameters the bindings select and the
+// namespaces of the cluster, next to the parameters of the policy files
+func loadClusterCheckBundle(ctx context.Context, resourceLoader *loader.ClusterResourceLoader, opts *CheckOptions) (*loader.Bundle, error) {
+	var bundle *loader.Bundle
+	var err error
+	if opts.ClusterPolicies {
+		bundle, err = resourceLoader.LoadBundle(loader.ResourceSource{Type: loader.SourceTypeCluster})
+	} else {
+		bundle, err = resourceLoader.LoadBundle(loader.ResourceSource{
+			Type:   loader.SourceTypeLocal,
+			Files:  opts.PolicyFiles,
+			Ignore: opts.Ignore,
+		})
+	}
+	if err != nil || !(opts.ClusterPolicies || opts.ClusterBindings) {
+		return bundle, err
+	}
+
+	if opts.ClusterBindings {
+		bindings, err := resourceLoader.LoadPolicyBindings(loader.ResourceSource{Type: loader.SourceTypeCluster})
+		if err != nil {
+			return nil, err
+		}
+		bundle.Bindings = mergeBindings(bindings, bundle.Bindings)
+	}
+
+	params, err := resourceLoader.LoadParams(ctx, bundle.Policies, bundle.Bindings)
+	if err != nil {
+		return nil, err
+	}
+	bundle.Params = append(params, bundle.Params...)
+
+	bundle.Namespaces, err = resourceLoader.LoadNamespaces(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return bundle, nil
+}
+
+// mergeBindings returns the bindings of the cluster with the local bindings applied over them
+func mergeBindings(clusterBindings, localBindings []*admissionregistrationv1.ValidatingAdmissionPolicyBinding) []*admissionregistrationv1.ValidatingAdmissionPolicyBinding {
+	local := make(map[string]bool)
+	for _, binding := range localBindings {
+		local[binding.Name] = true
+	}
+
+	var merged []*admissionregistrationv1.ValidatingAdmissionPolicyBinding
+	for _, binding := range clusterBindings {
+		if !local[binding.Name] {
+			merged = append(merged, binding)
 		}
 	}
+	return append(merged, localBindings...)
+}
 
-	// Convert map to slice
-	resources := make([]string, 0, len(resourceMap))
-	for resource := range resourceMap {
-		resources = append(resources, resource)
+// boundPolicies returns the policies with a binding, which the apiserver evaluates
+func boundPolicies(policies []*admissionregistrationv1.ValidatingAdmissionPolicy, bindings []*admissionregistrationv1.ValidatingAdmissionPolicyBinding, quiet bool) []*admissionregistrationv1.ValidatingAdmissionPolicy {
+	bound := make(map[string]bool)
+	for _, binding := range bindings {
+		bound[binding.Spec.PolicyName] = true
 	}
 
-	return resources, nil
-}
\ No newline at end of file
+	var result []*admissionregistrationv1.ValidatingAdmissionPolicy
+	for _, policy := range policies {
+		if bound[policy.Name] {
+			result = append(result, policy)
+		} else if !quiet {
+			reporter.PrintInfo(fmt.Sprintf("Skipping policy '%s' without bindings", policy.Name))
+		}
+	}
+	return result
+}
@@ -2,14 +2,27 @@ package commands
 
 import (
 	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
 
+	"github.com/yashirook/kube-vap-test/internal/compat"
+	"github.com/yashirook/kube-vap-test/internal/engine"
+	"github.com/yashirook/kube-vap-test/internal/engine/plugins"
+	"github.com/yashirook/kube-vap-test/internal/engine/podsecurity"
+	"github.com/yashirook/kube-vap-test/internal/engine/upstream"
+	"github.com/yashirook/kube-vap-test/internal/engine/waiver"
+	"github.com/yashirook/kube-vap-test/internal/loader"
 	"github.com/yashirook/kube-vap-test/internal/reporter"
 )
 
 // CommonOptions contains options shared by multiple commands
 type CommonOptions struct {
-	// Output format (table, json, yaml)
+	// Output format (table, json, yaml, junit)
 	OutputFormat string
+	// Reports written to files, as format=path
+	Reports []string
 	// Suppress progress information
 	Quiet bool
 	// Show detailed output
@@ -18,18 +31,223 @@ type CommonOptions struct {
 	Kubeconfig string
 }
 
+// ExitError is an error exiting the command with a specific exit code
+type ExitError struct {
+	Code int
+	Err  error
+}
+
+// Error returns the message of the error
+func (e *ExitError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the original error
+func (e *ExitError) Unwrap() error {
+	return e.Err
+}
+
+// outputFormats are the output formats supported by every command
+var outputFormats = []reporter.OutputFormat{
+	reporter.OutputFormatTable,
+	reporter.OutputFormatJSON,
+	reporter.OutputFormatYAML,
+	reporter.OutputFormatJUnit,
+}
+
 // ValidateCommonOptions validates common options
 func (o *CommonOptions) ValidateCommonOptions() error {
-	switch o.OutputFormat {
-	case "table", "json", "yaml":
-		// Valid formats
-	default:
-		return fmt.Errorf("invalid output format: %s (must be table, json, or yaml)", o.OutputFormat)
+	return o.validateOutputFormats(outputFormats)
+}
+
+// validateOutputFormats validates the output format and the reports against the formats of a command
+func (o *CommonOptions) validateOutputFormats(formats []reporter.OutputFormat) error {
+	names := make([]string, len(formats))
+	for i, format := range formats {
+		names[i] = string(format)
+	}
+	valid := strings.Join(names[:len(names)-1], ", ") + ", or " + names[len(names)-1]
+
+	if !slices.Contains(formats, reporter.OutputFormat(o.OutputFormat)) {
+		return fmt.Errorf("invalid output format: %s (must be %s)", o.OutputFormat, valid)
+	}
+
+	paths := make(map[string]bool)
+	for _, report := range o.Reports {
+		target, err := reporter.ParseReportTarget(report)
+		if err != nil {
+			return err
+		}
+		if !slices.Contains(formats, target.Format) {
+			return fmt.Errorf("invalid report format: %s (must be %s)", target.Format, valid)
+		}
+		path := filepath.Clean(target.Path)
+		if paths[path] {
+			return fmt.Errorf("report file %s is given more than once", target.Path)
+		}
+		paths[path] = true
 	}
 	return nil
 }
 
-// GetReporter returns a reporter based on common options
-func (o *CommonOptions) GetReporter() reporter.Reporter {
-	return reporter.NewReporter(reporter.OutputFormat(o.OutputFormat), o.Verbose)
-}
\ No newline at end of file
+// GetReporter returns a reporter writing the output format to standard output and each report to its file
+// The reporter must be closed to close the report files
+func (o *CommonOptions) GetReporter() (*reporter.MultiReporter, error) {
+	rep := reporter.NewMultiReporter(reporter.NewReporter(reporter.OutputFormat(o.OutputFormat), o.Verbose))
+	for _, report := range o.Reports {
+		target, err := reporter.ParseReportTarget(report)
+		if err == nil {
+			err = rep.AddFile(target, o.Verbose)
+		}
+		if err != nil {
+			rep.Close()
+			return nil, fmt.Errorf("Failed to open report: %w", err)
+		}
+	}
+	return rep, nil
+}
+
+// closeReporter closes the report files, reporting errors
+func closeReporter(rep *reporter.MultiReporter) {
+	if err := rep.Close(); err != nil {
+		reporter.PrintError(err)
+	}
+}
+
+// reportUnknownDocuments warns about documents of kinds the loader does not classify
+func reportUnknownDocuments(bundle *loader.Bundle, quiet bool) {
+	if quiet {
+		return
+	}
+	for _, unknown := range bundle.Unknown {
+		reporter.PrintWarning(fmt.Sprintf("Ignoring %s", unknown.String()))
+	}
+}
+
+// buildWaivers creates the set of waivers of the bundle, warning about expired waivers
+// Waivers are disabled when the bundle has none
+func buildWaivers(bundle *loader.Bundle, quiet bool) (*waiver.Set, error) {
+	if len(bundle.Waivers) == 0 {
+		return nil, nil
+	}
+
+	waivers, err := waiver.NewSet(bundle.Waivers, time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("Failed to load waivers: %w", err)
+	}
+
+	if !quiet {
+		reporter.PrintInfo(fmt.Sprintf("Loaded %d waivers", len(bundle.Waivers)))
+	}
+	for _, expired := range waivers.Expired() {
+		reporter.PrintWarning(fmt.Sprintf("Waiver '%s' expired on %s, its violations are no longer waived", expired.Name, expired.Spec.Expires))
+	}
+
+	return waivers, nil
+}
+
+// buildAdmissionChain creates the admission plugin chain for the given plugin names
+// Fixtures are loaded from the source only when at least one plugin is enabled
+func buildAdmissionChain(resourceLoader loader.ResourceLoader, source loader.ResourceSource, names []string, quiet bool) (*plugins.Chain, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+
+	fixtures, err := resourceLoader.LoadAdmissionFixtures(source)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to load admission plugin fixtures: %w", err)
+	}
+
+	chain, err := plugins.NewChain(names, fixtures)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to configure admission plugins: %w", err)
+	}
+
+	if !quiet {
+		pluginNames := make([]string, 0, len(chain.Plugins()))
+		for _, plugin := range chain.Plugins() {
+			pluginNames = append(pluginNames, plugin.Name())
+		}
+		reporter.PrintInfo(fmt.Sprintf("Emulating admission plugins: %s (%d fixtures)", strings.Join(pluginNames, ", "), fixtures.Len()))
+	}
+
+	return chain, nil
+}
+
+// buildPodSecurityEvaluator creates the Pod Security Admission evaluator for the given level and version
+// Evaluation is disabled when no level is given
+func buildPodSecurityEvaluator(level, version string, quiet bool) (*podsecurity.Evaluator, error) {
+	if level == "" {
+		return nil, nil
+	}
+
+	evaluator, err := podsecurity.NewEvaluator(level, version)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to configure pod security evaluation: %w", err)
+	}
+
+	if !quiet {
+		reporter.PrintInfo(fmt.Sprintf("Evaluating Pod Security Standards: %s", evaluator.Policy()))
+	}
+
+	return evaluator, nil
+}
+
+// buildCompatAnalyzer creates the analyzer reporting policy API versions for the target Kubernetes version
+// Nothing is reported when no target version is given
+func buildCompatAnalyzer(targetVersion string, quiet bool) (*compat.Analyzer, error) {
+	if targetVersion == "" {
+		return nil, nil
+	}
+
+	analyzer, err := compat.NewAnalyzer(targetVersion)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to configure target version: %w", err)
+	}
+
+	if !quiet {
+		reporter.PrintInfo(fmt.Sprintf("Reporting policy API versions for Kubernetes %s", analyzer.KubernetesVersion()))
+	}
+
+	return analyzer, nil
+}
+
+// configureEngine selects the evaluation engine of the simulator
+// With differential evaluation, the other engine evaluates every test case as well
+// The returned function releases the engines and must be called when evaluation is done
+func configureEngine(simulator *engine.PolicySimulator, name string, differential bool, quiet bool) (func(), error) {
+	if name == "" {
+		name = engine.EngineNative
+	}
+	if name != engine.EngineNative && name != engine.EngineUpstream {
+		return nil, fmt.Errorf("Invalid engine: %s (valid values: %s, %s)", name, engine.EngineNative, engine.EngineUpstream)
+	}
+
+	cleanup := func() {}
+	if name == engine.EngineUpstream || differential {
+		upstreamEngine, err := upstream.NewEngine()
+		if err != nil {
+			return nil, fmt.Errorf("Failed to initialize upstream engine: %w", err)
+		}
+		cleanup = upstreamEngine.Close
+
+		if name == engine.EngineUpstream {
+			simulator.SetEngine(upstreamEngine)
+			if differential {
+				simulator.SetDifferentialEngine(simulator.NativeEngine())
+			}
+		} else {
+			simulator.SetDifferentialEngine(upstreamEngine)
+		}
+	}
+
+	if !quiet {
+		if differential {
+			reporter.PrintInfo(fmt.Sprintf("Evaluation engine: %s (differential)", name))
+		} else if name != engine.EngineNative {
+			reporter.PrintInfo(fmt.Sprintf("Evaluation engine: %s", name))
+		}
+	}
+
+	return cleanup, nil
+}
@@ -0,0 +1,523 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/spf13/cobra"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"github.com/yashirook/kube-vap-test/internal/engine"
+	"github.com/yashirook/kube-vap-test/internal/gate"
+	"github.com/yashirook/kube-vap-test/internal/gitrev"
+	"github.com/yashirook/kube-vap-test/internal/impact"
+	"github.com/yashirook/kube-vap-test/internal/loader"
+	"github.com/yashirook/kube-vap-test/internal/reporter"
+	"github.com/yashirook/kube-vap-test/internal/snapshot"
+	kaptestv1 "github.com/yashirook/kube-vap-test/pkg/apis/admission/v1"
+)
+
+// DiffImpactOptions represents options for diff-impact command
+type DiffImpactOptions struct {
+	CommonOptions
+	// Policy files, directories, glob patterns or git revisions (git:<revision>:<path>) of the
+	// old and new versions of the policies
+	OldPolicies []string
+	NewPolicies []string
+	ParamFile   string
+	// Glob patterns of files skipped when expanding policy and manifest directories and globs
+	Ignore    []string
+	Operation string
+	// Compare the objects of the cluster, or of a snapshot of it, instead of manifests, with the
+	// bindings, parameters and namespaces of the cluster when ClusterBindings is set
+	Cluster         bool
+	ClusterBindings bool
+	Snapshot        string
+	// Namespaces, labels and fields selecting the cluster objects to compare, the number of
+	// objects listed per request, and the request rate to the apiserver (cluster mode)
+	Namespaces        []string
+	ExcludeNamespaces []string
+	Selector          string
+	FieldSelector     string
+	ChunkSize         int64
+	QPS               float32
+	Burst             int
+	// Apply Kubernetes API defaults to objects before evaluation
+	ApplyDefaults bool
+	// Evaluation engine of both versions
+	Engine string
+	// Least severe kind of problem failing the comparison (deny for newly denied resources, error)
+	FailOn string
+}
+
+// impactSide is a version of the policies compared by diff-impact, with the simulator evaluating it
+type impactSide struct {
+	simulator *engine.PolicySimulator
+	policies  []*admissionregistrationv1.ValidatingAdmissionPolicy
+	// Bindings of the cluster the policies are evaluated through, none to evaluate every policy
+	bindings []*admissionregistrationv1.ValidatingAdmissionPolicyBinding
+	paramObj runtime.Object
+	// close releases the engines of the simulator
+	close func()
+}
+
+// NewDiffImpactCommand creates a new diff-impact command
+func NewDiffImpactCommand(opts *DiffImpactOptions) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "diff-impact --old <policies> --new <policies> [manifests or resources...]",
+		Short: "Report what a policy change newly denies or allows",
+		Long: `Evaluate two versions of the policies against the same objects, manifests or the objects of the cluster
+with --cluster, and report the resources the new policies newly deny, newly allow, or deny with a different
+message. Policies are read from files, directories and glob patterns, or from revisions of the git repository
+of the working directory with git:<revision>:<path>, e.g. --old git:HEAD~1:policies/ --new policies/.`,
+		Args: cobra.MinimumNArgs(0),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			// Do not show usage on errors
+			cmd.SilenceUsage = true
+
+			// A snapshot is compared as the cluster it was taken of
+			if opts.Snapshot != "" {
+				opts.Cluster = true
+			}
+
+			// Check required parameters
+			if len(opts.OldPolicies) == 0 || len(opts.NewPolicies) == 0 {
+				return fmt.Errorf("Please specify the policies to compare with --old and --new")
+			}
+			if slices.Contains(opts.OldPolicies, loader.StdinPath) || slices.Contains(opts.NewPolicies, loader.StdinPath) {
+				return fmt.Errorf("--old and --new policies cannot be read from standard input")
+			}
+			if opts.ClusterBindings && !opts.Cluster {
+				return fmt.Errorf("--cluster-bindings is only available in cluster mode (--cluster)")
+			}
+			if !opts.Cluster && (len(opts.Namespaces) > 0 || len(opts.ExcludeNamespaces) > 0 || opts.Selector != "" || opts.FieldSelector != "") {
+				return fmt.Errorf("--namespace, --exclude-namespace, --selector and --field-selector are only available in cluster mode (--cluster)")
+			}
+			checkOpts := opts.checkOptions()
+			if err := checkOpts.listOptions().Validate(); err != nil {
+				return err
+			}
+			level, err := gate.ParseLevel(opts.FailOn)
+			if err != nil {
+				return err
+			}
+			if level == gate.LevelWarn {
+				return fmt.Errorf("invalid fail-on level %q for diff-impact (must be deny or error)", opts.FailOn)
+			}
+			if err := opts.ValidateCommonOptions(); err != nil {
+				return err
+			}
+
+			if checkOpts.Operation == "" {
+				// Default to CREATE operation for manifests, and to UPDATE re-applying the
+				// objects of the cluster
+				checkOpts.Operation = "CREATE"
+				if opts.Cluster {
+					checkOpts.Operation = "UPDATE"
+				}
+			}
+			// The upstream engine resolves bindings, parameters and namespaces as the apiserver does
+			if opts.ClusterBindings && !cmd.Flags().Changed("engine") {
+				checkOpts.Engine = engine.EngineUpstream
+			}
+
+			// Manifests are read from standard input when none are given and it is piped
+			if !opts.Cluster {
+				if len(args) == 0 && loader.StdinPiped() {
+					args = []string{loader.StdinPath}
+				}
+				if len(args) == 0 {
+					return fmt.Errorf("Please specify manifest files to evaluate, or --cluster")
+				}
+			}
+
+			// Set up context (cancellable with Ctrl+C)
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			// Set up signal handler
+			sigCh := make(chan os.Signal, 1)
+			signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
+			go func() {
+				<-sigCh
+				if !opts.Quiet {
+					reporter.PrintWarning("Cancelling...")
+				}
+				cancel()
+			}()
+
+			// Initialize reporter
+			rep, err := opts.GetReporter()
+			if err != nil {
+				return err
+			}
+			defer closeReporter(rep)
+
+			// Policies read from git revisions are extracted to a temporary directory
+			dir, err := os.MkdirTemp("", "vaptest-diff-impact-")
+			if err != nil {
+				return fmt.Errorf("Failed to create temporary directory: %w", err)
+			}
+			defer os.RemoveAll(dir)
+
+			// Initialize resource loader, serving the snapshot when one is given
+			var resourceLoader *loader.ClusterResourceLoader
+			var clusterSnapshot *snapshot.Snapshot
+			if opts.Cluster {
+				resourceLoader, clusterSnapshot, err = clusterCheckLoader(checkOpts)
+				if err != nil {
+					reporter.PrintError(err)
+					return &ExitError{Code: gate.ExitLoadError, Err: err}
+				}
+			}
+
+			oldSide, err := loadImpactSide(ctx, "old", opts.OldPolicies, filepath.Join(dir, "old"), resourceLoader, checkOpts)
+			if err != nil {
+				reporter.PrintError(err)
+				return &ExitError{Code: gate.ExitLoadError, Err: err}
+			}
+			defer oldSide.close()
+			newSide, err := loadImpactSide(ctx, "new", opts.NewPolicies, filepath.Join(dir, "new"), resourceLoader, checkOpts)
+			if err != nil {
+				reporter.PrintError(err)
+				return &ExitError{Code: gate.ExitLoadError, Err: err}
+			}
+			defer newSide.close()
+			if !opts.Quiet && checkOpts.Engine != engine.EngineNative {
+				reporter.PrintInfo(fmt.Sprintf("Evaluation engine: %s", checkOpts.Engine))
+			}
+
+			// Evaluate the same objects with both versions
+			comparison := impact.NewComparison(opts.OldPolicies, opts.NewPolicies)
+			var problems gate.Counts
+			if opts.Cluster {
+				problems, err = runClusterImpact(ctx, comparison, resourceLoader, clusterSnapshot, oldSide, newSide, args, checkOpts)
+			} else {
+				problems, err = runLocalImpact(ctx, comparison, oldSide, newSide, args, checkOpts)
+			}
+			if err != nil {
+				return err
+			}
+
+			status := comparison.Status()
+			status.Engine = newSide.simulator.EngineName()
+			if err := rep.Report(status); err != nil {
+				reporter.PrintError(fmt.Errorf("Failed to report results: %w", err))
+				return err
+			}
+			if err := reporter.Flush(rep); err != nil {
+				return fmt.Errorf("Failed to report results: %w", err)
+			}
+
+			// Fail with an exit code telling the problems apart, errors taking precedence over
+			// newly denied resources
+			var verdict gate.Verdict
+			if level != gate.LevelNone {
+				verdict = gate.Evaluate(problems, gate.Options{FailOn: gate.LevelError})
+			}
+			if level == gate.LevelDeny && status.Impact.NewlyDenied > 0 {
+				if !verdict.Failed() {
+					verdict.ExitCode = gate.ExitDenied
+				}
+				verdict.Reasons = append(verdict.Reasons, fmt.Sprintf("%d resources newly denied", status.Impact.NewlyDenied))
+			}
+			if verdict.Failed() {
+				err := fmt.Errorf("Diff impact failed: %s", strings.Join(verdict.Reasons, ", "))
+				reporter.PrintError(err)
+				return &ExitError{Code: verdict.ExitCode, Err: err}
+			}
+			return nil
+		},
+	}
+
+	// Command-specific flags
+	cmd.Flags().StringSliceVar(&opts.OldPolicies, "old", []string{}, "Policy files, directories, glob patterns or git revisions (git:<revision>:<path>, e.g. git:HEAD~1:policies/) of the old policies (required, can specify multiple)")
+	cmd.Flags().StringSliceVar(&opts.NewPolicies, "new", []string{}, "Policy files, directories, glob patterns or git revisions (git:<revision>:<path>) of the new policies (required, can specify multiple)")
+	cmd.Flags().StringSliceVar(&opts.Ignore, "ignore", []string{}, "Glob patterns of files and directories to skip when expanding policy and manifest directories or globs (can specify multiple)")
+	cmd.Flags().StringVar(&opts.ParamFile, "param", "", "Parameter file for both versions of the policies (optional)")
+	cmd.Flags().StringVar(&opts.Operation, "operation", "", "Operation to validate (CREATE, UPDATE, DELETE), CREATE for manifests and UPDATE re-applying the objects in cluster mode by default")
+	cmd.Flags().BoolVarP(&opts.Cluster, "cluster", "c", false, "Compare the objects of the cluster instead of manifests")
+	cmd.Flags().BoolVar(&opts.ClusterBindings, "cluster-bindings", false, "Evaluate both versions with the bindings, parameters and namespaces of the cluster (cluster mode, upstream engine by default)")
+	cmd.Flags().StringVar(&opts.Snapshot, "snapshot", "", "Snapshot archive written by the snapshot command to compare offline instead of the cluster (implies --cluster)")
+	cmd.Flags().StringSliceVarP(&opts.Namespaces, "namespace", "n", []string{}, "Namespace to compare (cluster mode, can specify multiple)")
+	cmd.Flags().StringSliceVar(&opts.ExcludeNamespaces, "exclude-namespace", []string{}, "Namespace whose resources are not compared (cluster mode, can specify multiple)")
+	cmd.Flags().StringVarP(&opts.Selector, "selector", "l", "", "Label selector of the resources to compare, e.g. app=web,tier!=cache (cluster mode)")
+	cmd.Flags().StringVar(&opts.FieldSelector, "field-selector", "", "Field selector of the resources to compare, e.g. status.phase=Running (cluster mode)")
+	cmd.Flags().Int64Var(&opts.ChunkSize, "chunk-size", loader.DefaultChunkSize, "Number of resources retrieved per list request, 0 retrieves all resources of a type at once (cluster mode)")
+	cmd.Flags().Float32Var(&opts.QPS, "qps", 50, "Maximum requests per second to the apiserver (cluster mode)")
+	cmd.Flags().IntVar(&opts.Burst, "burst", 100, "Maximum burst of requests to the apiserver (cluster mode)")
+	cmd.Flags().BoolVar(&opts.ApplyDefaults, "apply-defaults", false, "Apply Kubernetes API defaults to objects before evaluation")
+	cmd.Flags().StringVar(&opts.Engine, "engine", engine.EngineNative, "Evaluation engine (native, upstream)")
+	cmd.Flags().StringVar(&opts.FailOn, "fail-on", "", "Exit with a non-zero code on problems of this severity or worse: deny (newly denied resources), error (evaluation and load errors only)")
+
+	return cmd
+}
+
+// checkOptions returns the check options evaluating the objects of the comparison
+func (o *DiffImpactOptions) checkOptions() *CheckOptions {
+	return &CheckOptions{
+		CommonOptions:     o.CommonOptions,
+		ParamFile:         o.ParamFile,
+		Ignore:            o.Ignore,
+		Operation:         o.Operation,
+		Cluster:           o.Cluster,
+		ClusterBindings:   o.ClusterBindings,
+		Snapshot:          o.Snapshot,
+		Namespaces:        o.Namespaces,
+		ExcludeNamespaces: o.ExcludeNamespaces,
+		Selector:          o.Selector,
+		FieldSelector:     o.FieldSelector,
+		ChunkSize:         o.ChunkSize,
+		QPS:               o.QPS,
+		Burst:             o.Burst,
+		ApplyDefaults:     o.ApplyDefaults,
+		Engine:            o.Engine,
+	}
+}
+
+// loadImpactSide loads a version of the policies, read from git revisions extracted to dir, and
+// the simulator evaluating it
+// In cluster mode the policies are loaded with the bindings, parameters and namespaces of the
+// cluster when --cluster-bindings is given
+func loadImpactSide(ctx context.Context, name string, sources []string, dir string, resourceLoader *loader.ClusterResourceLoader, opts *CheckOptions) (*impactSide, error) {
+	policyFiles, err := resolvePolicySources(ctx, sources, dir)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to load %s policies: %w", name, err)
+	}
+	sideOpts := *opts
+	sideOpts.PolicyFiles = policyFiles
+
+	var bundle *loader.Bundle
+	if resourceLoader != nil {
+		bundle, err = loadClusterCheckBundle(ctx, resourceLoader, &sideOpts)
+	} else {
+		var localLoader *loader.LocalResourceLoader
+		localLoader, err = loader.NewLocalResourceLoader()
+		if err == nil {
+			bundle, err = localLoader.LoadBundle(loader.ResourceSource{
+				Type:   loader.SourceTypeLocal,
+				Files:  policyFiles,
+				Ignore: opts.Ignore,
+			})
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Failed to load %s policies: %w", name, err)
+	}
+	reportUnknownDocuments(bundle, opts.Quiet)
+
+	simulator, err := engine.NewPolicySimulator()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to initialize policy simulator: %w", err)
+	}
+	simulator.SetApplyDefaults(opts.ApplyDefaults)
+	closeEngine, err := configureEngine(simulator, opts.Engine, false, true)
+	if err != nil {
+		return nil, err
+	}
+	// Policy sources are left out, since the messages of both versions are compared and the
+	// positions of their policies differ
+	side := &impactSide{simulator: simulator, policies: bundle.Policies, close: closeEngine}
+
+	// Waivers of the policy files accept violations until they expire
+	waivers, err := buildWaivers(bundle, opts.Quiet)
+	if err != nil {
+		side.close()
+		return nil, err
+	}
+	simulator.SetWaivers(waivers)
+
+	// With the bindings of the cluster, policies are evaluated through their bindings as the
+	// apiserver does, and parameters are selected by their paramRef
+	if opts.ClusterBindings {
+		side.policies = boundPolicies(bundle.Policies, bundle.Bindings, opts.Quiet)
+		side.bindings = bundle.Bindings
+		simulator.SetParams(bundle.Params)
+		simulator.SetNamespaces(bundle.Namespaces)
+	} else {
+		side.paramObj = bundle.Parameter()
+	}
+	// The --param file takes precedence over parameters of the policy files
+	if opts.ParamFile != "" {
+		paramLoader, err := loader.NewLocalResourceLoader()
+		if err == nil {
+			side.paramObj, err = paramLoader.LoadParameter(loader.ResourceSource{
+				Type:  loader.SourceTypeLocal,
+				Files: []string{opts.ParamFile},
+			})
+		}
+		if err != nil && !opts.Quiet {
+			reporter.PrintWarning(fmt.Sprintf("Failed to load parameters: %s", err.Error()))
+		}
+	}
+
+	if !opts.Quiet {
+		reporter.PrintInfo(fmt.Sprintf("Loaded %d %s policies from %s", len(side.policies), name, strings.Join(sources, ", ")))
+	}
+	return side, nil
+}
+
+// resolvePolicySources returns the paths of policy sources, extracting the sources read from git
+// revisions to a directory of their own under dir
+func resolvePolicySources(ctx context.Context, sources []string, dir string) ([]string, error) {
+	paths := make([]string, len(sources))
+	for i, spec := range sources {
+		if !gitrev.IsSource(spec) {
+			paths[i] = spec
+			continue
+		}
+
+		source, err := gitrev.Parse(spec)
+		if err != nil {
+			return nil, err
+		}
+		target := filepath.Join(dir, strconv.Itoa(i))
+		if err := os.MkdirAll(target, 0o755); err != nil {
+			return nil, fmt.Errorf("failed to create temporary directory: %w", err)
+		}
+		paths[i], err = source.Extract(ctx, target)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return paths, nil
+}
+
+// runLocalImpact evaluates the objects of manifest files with both versions of the policies
+// It returns the manifests, documents and objects that could not be loaded or evaluated
+func runLocalImpact(ctx context.Context, comparison *impact.Comparison, oldSide, newSide *impactSide, manifestFiles []string, opts *CheckOptions) (gate.Counts, error) {
+	var problems gate.Counts
+
+	// Expand manifest directories and glob patterns
+	manifestFiles, err := loader.ExpandPaths(manifestFiles, opts.Ignore)
+	if err != nil {
+		reporter.PrintError(fmt.Errorf("Failed to find manifest files: %w", err))
+		return problems, &ExitError{Code: gate.ExitLoadError, Err: fmt.Errorf("Failed to find manifest files: %w", err)}
+	}
+
+	for _, manifestPath := range manifestFiles {
+		if !opts.Quiet {
+			reporter.PrintInfo(fmt.Sprintf("Processing manifest file: %s", loader.SourceName(manifestPath)))
+		}
+
+		// Objects read before an error are compared
+		err := visitManifestFile(manifestPath, &problems, func(unstructuredObj *unstructured.Unstructured, location kaptestv1.SourceLocation) {
+			// Evaluation may default the object, so each version evaluates a copy of its own
+			oldResult, err := evaluateObject(ctx, unstructuredObj.DeepCopy(), oldSide.policies, oldSide.paramObj, oldSide.simulator, opts)
+			if err != nil {
+				reporter.PrintError(err)
+				problems.EvaluationErrors++
+				return
+			}
+			newResult, err := evaluateObject(ctx, unstructuredObj, newSide.policies, newSide.paramObj, newSide.simulator, opts)
+			if err != nil {
+				reporter.PrintError(err)
+				problems.EvaluationErrors++
+				return
+			}
+			newResult.Source = &location
+			comparison.Add(oldResult, newResult)
+		})
+		if err != nil {
+			reporter.PrintError(err)
+			problems.LoadErrors++
+		}
+	}
+	return problems, nil
+}
+
+// runClusterImpact evaluates the objects of the cluster with both versions of the policies
+// Each object is listed once and evaluated by both versions, so they see the same objects
+// It returns the resources that could not be fetched or evaluated
+func runClusterImpact(ctx context.Context, comparison *impact.Comparison, resourceLoader *loader.ClusterResourceLoader, clusterSnapshot *snapshot.Snapshot, oldSide, newSide *impactSide, resourceSpecs []string, opts *CheckOptions) (gate.Counts, error) {
+	var problems gate.Counts
+
+	// Determine resource types to compare, those intercepted by either version by default
+	var mappings []*meta.RESTMapping
+	var err error
+	if len(resourceSpecs) > 0 {
+		mappings, err = resourceLoader.ResolveResources(resourceSpecs)
+		if err != nil {
+			return problems, &ExitError{Code: gate.ExitLoadError, Err: fmt.Errorf("Failed to resolve resource types: %w", err)}
+		}
+	} else {
+		mappings, err = resourceLoader.ResolvePolicyResources(slices.Concat(oldSide.policies, newSide.policies))
+		if err != nil {
+			return problems, &ExitError{Code: gate.ExitLoadError, Err: fmt.Errorf("Failed to extract resource types from policies: %w", err)}
+		}
+	}
+
+	// Objects of cluster-scoped resources are in no namespace
+	if len(opts.Namespaces) > 0 {
+		var namespaced []*meta.RESTMapping
+		for _, mapping := range mappings {
+			if mapping.Scope.Name() == meta.RESTScopeNameNamespace {
+				namespaced = append(namespaced, mapping)
+			} else if !opts.Quiet {
+				reporter.PrintInfo(fmt.Sprintf("Skipping cluster-scoped resource %s in namespaces %s", loader.ResourceType(mapping), strings.Join(opts.Namespaces, ", ")))
+			}
+		}
+		mappings = namespaced
+	}
+	if len(mappings) == 0 {
+		return problems, fmt.Errorf("No resources specified for comparison")
+	}
+
+	resourceTypes := make([]string, len(mappings))
+	for i, mapping := range mappings {
+		resourceTypes[i] = loader.ResourceType(mapping)
+		if clusterSnapshot != nil && !clusterSnapshot.Captured(mapping.Resource) && !opts.Quiet {
+			reporter.PrintWarning(fmt.Sprintf("Resource %s is not in the snapshot, no objects are compared", resourceTypes[i]))
+		}
+	}
+	if !opts.Quiet {
+		reporter.PrintInfo(fmt.Sprintf("Resources to compare: %s", strings.Join(resourceTypes, ", ")))
+	}
+
+	listOptions := opts.listOptions()
+	for i, mapping := range mappings {
+		resourceType := resourceTypes[i]
+
+		fetched := 0
+		err := resourceLoader.VisitResources(ctx, mapping, listOptions, func(unstructuredObj *unstructured.Unstructured) error {
+			fetched++
+
+			// Evaluation may default the object, so each version evaluates a copy of its own
+			oldResult, err := evaluateClusterObject(ctx, unstructuredObj.DeepCopy(), resourceType, oldSide.policies, oldSide.bindings, oldSide.paramObj, oldSide.simulator, opts)
+			if err != nil {
+				reporter.PrintError(err)
+				problems.EvaluationErrors++
+				return nil
+			}
+			newResult, err := evaluateClusterObject(ctx, unstructuredObj, resourceType, newSide.policies, newSide.bindings, newSide.paramObj, newSide.simulator, opts)
+			if err != nil {
+				reporter.PrintError(err)
+				problems.EvaluationErrors++
+				return nil
+			}
+			comparison.Add(oldResult, newResult)
+			return nil
+		})
+		if err != nil {
+			// Objects listed before the error are compared
+			reporter.PrintError(fmt.Errorf("Failed to fetch resources (%s): %w", resourceType, err))
+			problems.LoadErrors++
+			continue
+		}
+
+		if !opts.Quiet {
+			reporter.PrintInfo(fmt.Sprintf("Fetched resources: %s (%d items)", resourceType, fetched))
+		}
+	}
+	return problems, nil
+}
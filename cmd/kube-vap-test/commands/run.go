@@ -6,13 +6,15 @@ import (
 	"os"
 	"os/signal"
 	"path/filepath"
+	"strings"
 	"syscall"
 
 	"github.com/spf13/cobra"
-	"k8s.io/apimachinery/pkg/runtime"
 	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
 
 	"github.com/yashirook/kube-vap-test/internal/engine"
+	"github.com/yashirook/kube-vap-test/internal/engine/plugins"
+	"github.com/yashirook/kube-vap-test/internal/gate"
 	"github.com/yashirook/kube-vap-test/internal/loader"
 	"github.com/yashirook/kube-vap-test/internal/reporter"
 	vaptestv1 "github.com/yashirook/kube-vap-test/pkg/apis/admission/v1"
@@ -21,8 +23,18 @@ import (
 // RunOptions represents options for run command
 type RunOptions struct {
 	CommonOptions
-	Cluster      bool
-	SkipBindings bool
+	Cluster          bool
+	SkipBindings     bool
+	AdmissionPlugins []string
+	ApplyDefaults    bool
+	// Pod Security Standards level and version evaluated next to policies, and whether the
+	// version was given on the command line rather than defaulted
+	PodSecurityLevel      string
+	PodSecurityVersion    string
+	PodSecurityVersionSet bool
+	// Evaluation engine, and whether the other engine evaluates every test case as well
+	Engine       string
+	Differential bool
 }
 
 // NewRunCommand creates a new run command
@@ -39,7 +51,7 @@ func NewRunCommand(opts *RunOptions) *cobra.Command {
 			// Set up context (cancellable with Ctrl+C)
 			ctx, cancel := context.WithCancel(context.Background())
 			defer cancel()
-			
+
 			// Set up signal handler
 			sigCh := make(chan os.Signal, 1)
 			signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
@@ -51,16 +63,20 @@ func NewRunCommand(opts *RunOptions) *cobra.Command {
 				cancel()
 			}()
 
-			// Validate format
-			format := reporter.OutputFormat(opts.OutputFormat)
-			if format != reporter.OutputFormatTable &&
-				format != reporter.OutputFormatJSON &&
-				format != reporter.OutputFormatYAML {
-				return fmt.Errorf("Invalid output format: %s (valid values: table, json, yaml)", opts.OutputFormat)
+			// Validate output format and reports
+			if err := opts.ValidateCommonOptions(); err != nil {
+				return err
 			}
 
+			// An explicit version overrides podSecurity.version of test files, the default does not
+			opts.PodSecurityVersionSet = cmd.Flags().Changed("pod-security-version")
+
 			// Initialize reporter
-			rep := reporter.NewReporter(format, opts.Verbose)
+			rep, err := opts.GetReporter()
+			if err != nil {
+				return err
+			}
+			defer closeReporter(rep)
 
 			// Initialize simulator
 			simulator, err := engine.NewPolicySimulator()
@@ -68,6 +84,11 @@ func NewRunCommand(opts *RunOptions) *cobra.Command {
 				return fmt.Errorf("Failed to initialize policy simulator: %w", err)
 			}
 
+			closeEngine, err := configureEngine(simulator, opts.Engine, opts.Differential, opts.Quiet)
+			if err != nil {
+				return err
+			}
+			defer closeEngine()
 
 			// Process each test file
 			var lastErr error
@@ -77,6 +98,11 @@ func NewRunCommand(opts *RunOptions) *cobra.Command {
 				}
 			}
 
+			// Write reports covering every test file
+			if err := reporter.Flush(rep); err != nil {
+				return fmt.Errorf("Failed to report results: %w", err)
+			}
+
 			return lastErr
 		},
 	}
@@ -84,6 +110,12 @@ func NewRunCommand(opts *RunOptions) *cobra.Command {
 	// Command-specific flags
 	cmd.Flags().BoolVar(&opts.Cluster, "cluster", false, "Run tests in cluster mode")
 	cmd.Flags().BoolVar(&opts.SkipBindings, "skip-bindings", false, "Skip policy bindings and test policy logic only")
+	cmd.Flags().BoolVar(&opts.ApplyDefaults, "apply-defaults", false, "Apply Kubernetes API defaults to test objects before evaluation (test cases can override with applyDefaults)")
+	cmd.Flags().StringVar(&opts.PodSecurityLevel, "pod-security-level", "", "Evaluate Pod Security Standards at this level (privileged, baseline, restricted) next to policies (overrides podSecurity in test files)")
+	cmd.Flags().StringVar(&opts.PodSecurityVersion, "pod-security-version", "latest", "Pod Security Standards version to evaluate (e.g. v1.32, latest)")
+	cmd.Flags().StringSliceVar(&opts.AdmissionPlugins, "admission-plugins", []string{}, fmt.Sprintf("Built-in mutating admission plugins to emulate before evaluation (%s)", strings.Join(plugins.SupportedPlugins(), ", ")))
+	cmd.Flags().StringVar(&opts.Engine, "engine", engine.EngineNative, "Evaluation engine (native, upstream)")
+	cmd.Flags().BoolVar(&opts.Differential, "differential", false, "Evaluate every test case with both engines and fail test cases where they disagree")
 
 	return cmd
 }
@@ -128,8 +160,9 @@ func runTestFile(ctx context.Context, testFilePath string, simulator *engine.Pol
 			return err
 		}
 		resourceSource = loader.ResourceSource{
-			Type:  loader.SourceTypeLocal,
-			Files: test.Spec.Source.Files,
+			Type:   loader.SourceTypeLocal,
+			Files:  test.Spec.Source.Files,
+			Ignore: test.Spec.Source.Ignore,
 		}
 	case vaptestv1.SourceTypeCluster:
 		// Use resources from cluster
@@ -147,22 +180,23 @@ func runTestFile(ctx context.Context, testFilePath string, simulator *engine.Pol
 		return fmt.Errorf("Invalid source type: %s", sourceType)
 	}
 
-	// Load parameters (optional)
-	var paramObj runtime.Object
-	if test.Spec.IncludeParameters {
-		// Load parameters from the same source
-		paramObj, err = resourceLoader.LoadParameter(resourceSource)
-		if err != nil {
-			reporter.PrintWarning(fmt.Sprintf("Failed to load parameters: %s", err.Error()))
-		}
+	// Load policies, bindings and parameters based on source
+	bundle, err := resourceLoader.LoadBundle(resourceSource)
+	if err != nil {
+		reporter.PrintError(fmt.Errorf("Failed to load policies: %w", err))
+		return err
 	}
+	reportUnknownDocuments(bundle, opts.Quiet)
+	simulator.SetPolicySources(bundle.PolicySources)
 
-	// Load policies based on source
-	policies, err := resourceLoader.LoadPolicies(resourceSource)
+	// Waivers of the source accept violations until they expire
+	waivers, err := buildWaivers(bundle, opts.Quiet)
 	if err != nil {
-		reporter.PrintError(fmt.Errorf("Failed to load policies: %w", err))
+		reporter.PrintError(err)
 		return err
 	}
+	simulator.SetWaivers(waivers)
+	policies := bundle.Policies
 
 	// Check if policies exist
 	if len(policies) == 0 {
@@ -170,15 +204,20 @@ func runTestFile(ctx context.Context, testFilePath string, simulator *engine.Pol
 		return fmt.Errorf("No policies were loaded")
 	}
 
-	// Load policy bindings unless --skip-bindings is specified
-	var bindings []*admissionregistrationv1.ValidatingAdmissionPolicyBinding
-	if !opts.SkipBindings {
-		bindings, err = resourceLoader.LoadPolicyBindings(resourceSource)
+	// Parameters of the policies' paramKind are used when the source holds them
+	paramObj := bundle.Parameter()
+	if paramObj == nil && test.Spec.IncludeParameters {
+		// Load parameters from the same source
+		paramObj, err = resourceLoader.LoadParameter(resourceSource)
 		if err != nil {
-			// Warn but continue - bindings might be optional
-			reporter.PrintWarning(fmt.Sprintf("Failed to load policy bindings: %s", err.Error()))
+			reporter.PrintWarning(fmt.Sprintf("Failed to load parameters: %s", err.Error()))
 		}
-		
+	}
+
+	// Use policy bindings unless --skip-bindings is specified
+	var bindings []*admissionregistrationv1.ValidatingAdmissionPolicyBinding
+	if !opts.SkipBindings {
+		bindings = bundle.Bindings
 		if !opts.Quiet && len(bindings) > 0 {
 			reporter.PrintInfo(fmt.Sprintf("Loaded %d policy bindings", len(bindings)))
 		}
@@ -188,6 +227,32 @@ func runTestFile(ctx context.Context, testFilePath string, simulator *engine.Pol
 		}
 	}
 
+	// Set up built-in admission plugin emulation
+	chain, err := buildAdmissionChain(resourceLoader, resourceSource, append(test.Spec.AdmissionPlugins, opts.AdmissionPlugins...), opts.Quiet)
+	if err != nil {
+		reporter.PrintError(err)
+		return err
+	}
+	simulator.SetAdmissionPlugins(chain)
+
+	// API defaulting is enabled by the flag or the test definition
+	simulator.SetApplyDefaults(opts.ApplyDefaults || test.Spec.ApplyDefaults)
+
+	// Pod Security Admission evaluation is enabled by the flag or the test definition
+	podSecurityLevel, podSecurityVersion := opts.PodSecurityLevel, opts.PodSecurityVersion
+	if podSecurityLevel == "" && test.Spec.PodSecurity != nil {
+		podSecurityLevel = test.Spec.PodSecurity.Level
+		if !opts.PodSecurityVersionSet && test.Spec.PodSecurity.Version != "" {
+			podSecurityVersion = test.Spec.PodSecurity.Version
+		}
+	}
+	podSecurity, err := buildPodSecurityEvaluator(podSecurityLevel, podSecurityVersion, opts.Quiet)
+	if err != nil {
+		reporter.PrintError(err)
+		return err
+	}
+	simulator.SetPodSecurity(podSecurity)
+
 	// Execute tests based on whether we have bindings
 	var status *vaptestv1.ValidatingAdmissionPolicyTestStatus
 	if len(bindings) > 0 && !opts.SkipBindings {
@@ -197,11 +262,12 @@ func runTestFile(ctx context.Context, testFilePath string, simulator *engine.Pol
 		// Execute tests with policies only (backward compatible)
 		status, err = simulator.RunPolicyTestsWithMultiPolicies(ctx, policies, paramObj, test.Spec.TestCases)
 	}
-	
+
 	if err != nil {
 		reporter.PrintError(fmt.Errorf("Failed to execute test: %w", err))
 		return err
 	}
+	status.TestFile = testFilePath
 
 	// Report test results
 	if err := rep.Report(status); err != nil {
@@ -214,5 +280,12 @@ func runTestFile(ctx context.Context, testFilePath string, simulator *engine.Pol
 		return fmt.Errorf("%d tests failed", status.Summary.Failed)
 	}
 
+	// Violations of expired waivers fail even when the test cases expect the denials
+	if expired := gate.Count(status, bindings).ExpiredWaivers; expired > 0 {
+		err := fmt.Errorf("%d violations of expired waivers", expired)
+		reporter.PrintError(err)
+		return &ExitError{Code: gate.ExitDenied, Err: err}
+	}
+
 	return nil
-}
\ No newline at end of file
+}
@@ -0,0 +1,153 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/spf13/cobra"
+
+	"github.com/yashirook/kube-vap-test/internal/gate"
+	"github.com/yashirook/kube-vap-test/internal/loader"
+	"github.com/yashirook/kube-vap-test/internal/reporter"
+	"github.com/yashirook/kube-vap-test/internal/snapshot"
+)
+
+// SnapshotOptions represents options for snapshot command
+type SnapshotOptions struct {
+	CommonOptions
+	// Archive the snapshot is written to
+	OutputFile string
+	// Namespaces to capture, all namespaces when empty
+	Namespaces []string
+	// Namespaces whose objects are not captured
+	ExcludeNamespaces []string
+	// Label and field selectors of the objects to capture
+	Selector      string
+	FieldSelector string
+	// Number of objects retrieved per list request
+	ChunkSize int64
+	// Request rate limits of the client
+	QPS   float32
+	Burst int
+}
+
+// NewSnapshotCommand creates a new snapshot command
+func NewSnapshotCommand(opts *SnapshotOptions) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "snapshot [resources...]",
+		Short: "Capture a cluster in an archive to check offline",
+		Long: `Capture the ValidatingAdmissionPolicies, bindings, parameters and namespaces of a cluster, the objects
+of the resources to check and the discovery data the resources are resolved with, in a gzipped tar archive.
+check --snapshot then audits the archive offline, without credentials for the cluster.
+Without resource arguments, the resources intercepted by the policies of the cluster are captured.`,
+		Args: cobra.MinimumNArgs(0),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			// Do not show usage on errors
+			cmd.SilenceUsage = true
+
+			if opts.OutputFile == "" {
+				return fmt.Errorf("Please specify the snapshot archive with --output")
+			}
+			listOptions := loader.ListOptions{
+				Namespaces:        opts.Namespaces,
+				ExcludeNamespaces: opts.ExcludeNamespaces,
+				LabelSelector:     opts.Selector,
+				FieldSelector:     opts.FieldSelector,
+				ChunkSize:         opts.ChunkSize,
+			}
+			if err := listOptions.Validate(); err != nil {
+				return err
+			}
+
+			// Set up context (cancellable with Ctrl+C)
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			// Set up signal handler
+			sigCh := make(chan os.Signal, 1)
+			signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
+			go func() {
+				<-sigCh
+				if !opts.Quiet {
+					reporter.PrintWarning("Cancelling...")
+				}
+				cancel()
+			}()
+
+			resourceLoader, err := loader.NewClusterResourceLoaderWithOptions(opts.Kubeconfig, loader.ClientOptions{QPS: opts.QPS, Burst: opts.Burst})
+			if err != nil {
+				err = fmt.Errorf("Failed to initialize cluster resource loader: %w", err)
+				reporter.PrintError(err)
+				return &ExitError{Code: gate.ExitLoadError, Err: err}
+			}
+
+			if !opts.Quiet {
+				reporter.PrintInfo("Capturing cluster...")
+			}
+			manifest, err := writeSnapshot(ctx, resourceLoader, snapshot.Options{Resources: args, List: listOptions}, opts.OutputFile)
+			if err != nil {
+				err = fmt.Errorf("Failed to capture snapshot: %w", err)
+				reporter.PrintError(err)
+				return &ExitError{Code: gate.ExitLoadError, Err: err}
+			}
+
+			if !opts.Quiet {
+				if len(manifest.UnavailableGroupVersions) > 0 {
+					reporter.PrintWarning(fmt.Sprintf("Skipped API group versions whose discovery failed: %s", strings.Join(manifest.UnavailableGroupVersions, ", ")))
+				}
+				total := 0
+				for _, resource := range manifest.Resources {
+					reporter.PrintInfo(fmt.Sprintf("Captured resources: %s (%d items)", resourceType(resource), resource.Count))
+					total += resource.Count
+				}
+				reporter.PrintSuccess(fmt.Sprintf("Wrote snapshot of %d objects to %s", total, opts.OutputFile))
+			}
+			return nil
+		},
+	}
+
+	// Command-specific flags, --output names the archive instead of the output format
+	cmd.Flags().StringVarP(&opts.OutputFile, "output", "o", "", "Snapshot archive to write, e.g. cluster.tar.gz (required)")
+	cmd.Flags().StringSliceVarP(&opts.Namespaces, "namespace", "n", []string{}, "Namespace whose objects to capture (can specify multiple)")
+	cmd.Flags().StringSliceVar(&opts.ExcludeNamespaces, "exclude-namespace", []string{}, "Namespace whose objects are not captured (can specify multiple)")
+	cmd.Flags().StringVarP(&opts.Selector, "selector", "l", "", "Label selector of the objects to capture, e.g. app=web,tier!=cache")
+	cmd.Flags().StringVar(&opts.FieldSelector, "field-selector", "", "Field selector of the objects to capture, e.g. status.phase=Running")
+	cmd.Flags().Int64Var(&opts.ChunkSize, "chunk-size", loader.DefaultChunkSize, "Number of objects retrieved per list request, 0 retrieves all objects of a type at once")
+	cmd.Flags().Float32Var(&opts.QPS, "qps", 50, "Maximum requests per second to the apiserver")
+	cmd.Flags().IntVar(&opts.Burst, "burst", 100, "Maximum burst of requests to the apiserver")
+
+	return cmd
+}
+
+// writeSnapshot captures a snapshot of the cluster in an archive
+// The archive is written to a temporary file renamed once complete, so that failed captures
+// leave no partial archive behind
+func writeSnapshot(ctx context.Context, resourceLoader *loader.ClusterResourceLoader, opts snapshot.Options, path string) (*snapshot.Manifest, error) {
+	file, err := os.CreateTemp(filepath.Dir(path), ".snapshot-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create snapshot file: %w", err)
+	}
+	defer os.Remove(file.Name())
+
+	manifest, err := snapshot.Capture(ctx, resourceLoader, opts, file)
+	if closeErr := file.Close(); err == nil && closeErr != nil {
+		err = fmt.Errorf("failed to write snapshot file: %w", closeErr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Rename(file.Name(), path); err != nil {
+		return nil, fmt.Errorf("failed to write snapshot file: %w", err)
+	}
+	return manifest, nil
+}
+
+// resourceType returns the name of a resource of a snapshot as results name it
+func resourceType(resource snapshot.Resource) string {
+	return fmt.Sprintf("%s.%s", resource.Resource, resource.GroupVersionResource().GroupVersion().String())
+}
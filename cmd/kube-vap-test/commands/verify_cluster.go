@@ -0,0 +1,152 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/restmapper"
+	"k8s.io/client-go/tools/clientcmd"
+
+	"github.com/yashirook/kube-vap-test/internal/engine"
+	"github.com/yashirook/kube-vap-test/internal/engine/cluster"
+	"github.com/yashirook/kube-vap-test/internal/reporter"
+)
+
+// VerifyClusterOptions represents options for verify-cluster command
+type VerifyClusterOptions struct {
+	RunOptions
+	// Wait after applying policies for the apiserver to load them
+	SettleTime time.Duration
+}
+
+// NewVerifyClusterCommand creates a new verify-cluster command
+func NewVerifyClusterCommand(opts *VerifyClusterOptions) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "verify-cluster [test-files...]",
+		Short: "Compare simulator verdicts with a real apiserver",
+		Long: `Apply the policies and bindings of test definitions to a cluster, send every test case object
+as a server-side dry-run (dryRun=All) request and compare the apiserver's verdict and message with the simulator's.
+Test cases where they disagree fail. Objects created in the cluster are deleted afterwards, but policies are
+enforced cluster-wide while verification runs, so use a disposable cluster.
+
+UPDATE and DELETE test cases apply to an existing object, which is created for real, without dry-run, when
+the cluster has none with that name, before the policies are applied and excluded from them. Deployments,
+replica sets, stateful sets and replication controllers are created with no replicas, jobs and cron jobs
+suspended, and pods and daemon sets are never created: they have to exist in the cluster already.`,
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			// Do not show usage on errors
+			cmd.SilenceUsage = true
+
+			// Set up context (cancellable with Ctrl+C)
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			// Set up signal handler
+			sigCh := make(chan os.Signal, 1)
+			signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
+			go func() {
+				<-sigCh
+				if !opts.Quiet {
+					reporter.PrintWarning("Cancelling...")
+				}
+				cancel()
+			}()
+
+			// Validate common options
+			if err := opts.ValidateCommonOptions(); err != nil {
+				return err
+			}
+
+			// Initialize reporter
+			rep, err := opts.GetReporter()
+			if err != nil {
+				return err
+			}
+			defer closeReporter(rep)
+
+			// Initialize simulator
+			simulator, err := engine.NewPolicySimulator()
+			if err != nil {
+				return fmt.Errorf("Failed to initialize policy simulator: %w", err)
+			}
+
+			closeEngine, err := configureEngine(simulator, opts.Engine, false, opts.Quiet)
+			if err != nil {
+				return err
+			}
+			defer closeEngine()
+
+			clusterEngine, err := buildClusterEngine(opts.Kubeconfig)
+			if err != nil {
+				reporter.PrintError(err)
+				return err
+			}
+			clusterEngine.SetSettleTime(opts.SettleTime)
+			simulator.SetDifferentialEngine(clusterEngine)
+
+			// Delete the objects created in the cluster even when cancelled
+			defer func() {
+				if err := clusterEngine.Close(context.Background()); err != nil {
+					reporter.PrintWarning(fmt.Sprintf("Failed to clean up cluster objects: %s", err.Error()))
+				}
+			}()
+
+			if !opts.Quiet {
+				reporter.PrintWarning("Policies and bindings are applied to the cluster while verification runs")
+			}
+
+			// Process each test file
+			var lastErr error
+			for _, testFilePath := range args {
+				if err := runTestFile(ctx, testFilePath, simulator, rep, &opts.RunOptions); err != nil {
+					lastErr = err
+				}
+			}
+
+			// Write reports covering every test file
+			if err := reporter.Flush(rep); err != nil {
+				return fmt.Errorf("Failed to report results: %w", err)
+			}
+
+			return lastErr
+		},
+	}
+
+	// Command-specific flags
+	cmd.Flags().BoolVar(&opts.SkipBindings, "skip-bindings", false, "Skip policy bindings and test policy logic only")
+	cmd.Flags().BoolVar(&opts.ApplyDefaults, "apply-defaults", false, "Apply Kubernetes API defaults to test objects before simulation (test cases can override with applyDefaults)")
+	cmd.Flags().StringVar(&opts.Engine, "engine", engine.EngineNative, "Evaluation engine compared with the apiserver (native, upstream)")
+	cmd.Flags().DurationVar(&opts.SettleTime, "settle-time", cluster.DefaultSettleTime, "Time to wait after applying policies for the apiserver to load them")
+
+	return cmd
+}
+
+// buildClusterEngine creates the engine sending dry-run requests to the cluster of the kubeconfig
+func buildClusterEngine(kubeconfigPath string) (*cluster.Engine, error) {
+	config, err := clientcmd.BuildConfigFromFlags("", kubeconfigPath)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to load kubeconfig: %w", err)
+	}
+
+	dynamicClient, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create dynamic client: %w", err)
+	}
+
+	discoveryClient, err := discovery.NewDiscoveryClientForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create discovery client: %w", err)
+	}
+	restMapper := restmapper.NewDeferredDiscoveryRESTMapper(memory.NewMemCacheClient(discoveryClient))
+
+	return cluster.NewEngine(dynamicClient, restMapper), nil
+}
@@ -1,19 +1,23 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
 
 	"github.com/spf13/cobra"
-	
+
 	"github.com/yashirook/kube-vap-test/cmd/kube-vap-test/commands"
+	"github.com/yashirook/kube-vap-test/internal/loader"
+	"github.com/yashirook/kube-vap-test/internal/reporter"
 )
 
 var (
 	// Global options
 	globalOpts = struct {
 		OutputFormat   string
+		Reports        []string
 		Quiet          bool
 		Verbose        bool
 		KubeconfigPath string
@@ -24,6 +28,15 @@ var (
 
 	// Check command options
 	checkOpts = &commands.CheckOptions{}
+
+	// Verify-cluster command options
+	verifyClusterOpts = &commands.VerifyClusterOptions{}
+
+	// Snapshot command options
+	snapshotOpts = &commands.SnapshotOptions{}
+
+	// Diff-impact command options
+	diffImpactOpts = &commands.DiffImpactOptions{}
 )
 
 // rootCmd represents the application's root command
@@ -48,7 +61,8 @@ func init() {
 	}
 
 	// Global flags
-	rootCmd.PersistentFlags().StringVar(&globalOpts.OutputFormat, "output", "table", "Output format (table, json, yaml)")
+	rootCmd.PersistentFlags().StringVar(&globalOpts.OutputFormat, "output", "table", "Output format (table, json, yaml, junit, sarif and policyreport for check)")
+	rootCmd.PersistentFlags().StringArrayVar(&globalOpts.Reports, "report", []string{}, "Also write a report to a file, as format=path (e.g. junit=reports/junit.xml, can specify multiple)")
 	rootCmd.PersistentFlags().BoolVar(&globalOpts.Quiet, "quiet", false, "Suppress progress information")
 	rootCmd.PersistentFlags().StringVar(&globalOpts.KubeconfigPath, "kubeconfig", globalOpts.KubeconfigPath, "Path to kubeconfig file (default: \"~/.kube/config\")")
 	rootCmd.PersistentFlags().BoolVarP(&globalOpts.Verbose, "verbose", "v", false, "Show detailed output")
@@ -57,21 +71,54 @@ func init() {
 	cobra.OnInitialize(func() {
 		// Run command options
 		runOpts.OutputFormat = globalOpts.OutputFormat
+		runOpts.Reports = globalOpts.Reports
 		runOpts.Quiet = globalOpts.Quiet
 		runOpts.Verbose = globalOpts.Verbose
 		runOpts.Kubeconfig = globalOpts.KubeconfigPath
 
 		// Check command options
 		checkOpts.OutputFormat = globalOpts.OutputFormat
+		checkOpts.Reports = globalOpts.Reports
 		checkOpts.Quiet = globalOpts.Quiet
 		checkOpts.Verbose = globalOpts.Verbose
 		checkOpts.Kubeconfig = globalOpts.KubeconfigPath
 
+		// Verify-cluster command options
+		verifyClusterOpts.OutputFormat = globalOpts.OutputFormat
+		verifyClusterOpts.Reports = globalOpts.Reports
+		verifyClusterOpts.Quiet = globalOpts.Quiet
+		verifyClusterOpts.Verbose = globalOpts.Verbose
+		verifyClusterOpts.Kubeconfig = globalOpts.KubeconfigPath
+
+		// Snapshot command options, whose --output names the archive
+		snapshotOpts.Quiet = globalOpts.Quiet
+		snapshotOpts.Verbose = globalOpts.Verbose
+		snapshotOpts.Kubeconfig = globalOpts.KubeconfigPath
+
+		// Diff-impact command options
+		diffImpactOpts.OutputFormat = globalOpts.OutputFormat
+		diffImpactOpts.Reports = globalOpts.Reports
+		diffImpactOpts.Quiet = globalOpts.Quiet
+		diffImpactOpts.Verbose = globalOpts.Verbose
+		diffImpactOpts.Kubeconfig = globalOpts.KubeconfigPath
+
+		// Keep messages off standard output when it carries a machine-readable report
+		if globalOpts.OutputFormat != string(reporter.OutputFormatTable) {
+			reporter.SetMessageOutput(os.Stderr)
+		}
+
+		// Show warnings about loaded resources, such as deprecated policy API versions
+		if !globalOpts.Quiet {
+			loader.SetWarningHandler(reporter.PrintWarning)
+		}
 	})
 
 	// Add subcommands
 	rootCmd.AddCommand(commands.NewRunCommand(runOpts))
 	rootCmd.AddCommand(commands.NewCheckCommand(checkOpts))
+	rootCmd.AddCommand(commands.NewVerifyClusterCommand(verifyClusterOpts))
+	rootCmd.AddCommand(commands.NewSnapshotCommand(snapshotOpts))
+	rootCmd.AddCommand(commands.NewDiffImpactCommand(diffImpactOpts))
 	rootCmd.AddCommand(commands.NewVersionCommand())
 }
 
@@ -80,6 +127,11 @@ func main() {
 	// error messages are displayed by PrintError in each command,
 	// and won't be duplicated here
 	if err := rootCmd.Execute(); err != nil {
+		// Commands such as check exit with codes telling failures apart
+		var exitErr *commands.ExitError
+		if errors.As(err, &exitErr) {
+			os.Exit(exitErr.Code)
+		}
 		os.Exit(1)
 	}
-}
\ No newline at end of file
+}
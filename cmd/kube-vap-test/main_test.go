@@ -40,6 +40,24 @@ func TestCommandStructure(t *testing.T) {
 			wantErr: false,
 			wantOutput: "--skip-bindings",
 		},
+		{
+			name:       "verify-cluster command exists",
+			args:       []string{"verify-cluster", "--help"},
+			wantErr:    false,
+			wantOutput: "dryRun=All",
+		},
+		{
+			name:       "snapshot command exists",
+			args:       []string{"snapshot", "--help"},
+			wantErr:    false,
+			wantOutput: "check --snapshot",
+		},
+		{
+			name:       "diff-impact command exists",
+			args:       []string{"diff-impact", "--help"},
+			wantErr:    false,
+			wantOutput: "newly deny",
+		},
 	}
 
 	for _, tt := range tests {
@@ -0,0 +1,253 @@
+// Package baseline records the violations of a check in a baseline file, and compares later checks
+// with it so that only new violations fail
+package baseline
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"github.com/yashirook/kube-vap-test/internal/engine/waiver"
+	kaptestv1 "github.com/yashirook/kube-vap-test/pkg/apis/admission/v1"
+)
+
+const (
+	// APIVersion is the API version of baseline files
+	APIVersion = "admission.k8s.io/v1"
+	// Kind is the kind of baseline files
+	Kind = "ViolationBaseline"
+)
+
+// Baseline is a set of accepted violations
+type Baseline struct {
+	APIVersion string                        `json:"apiVersion"`
+	Kind       string                        `json:"kind"`
+	Violations []kaptestv1.BaselineViolation `json:"violations"`
+}
+
+// key identifies a violation across checks
+// Resources are identified by group, kind, namespace and name, so that changing the API version
+// or moving the manifest keeps the violation known
+type key struct {
+	group      string
+	kind       string
+	namespace  string
+	name       string
+	policy     string
+	validation string
+}
+
+func keyOf(violation kaptestv1.BaselineViolation) key {
+	return key{
+		group:      schema.FromAPIVersionAndKind(violation.Resource.APIVersion, violation.Resource.Kind).Group,
+		kind:       violation.Resource.Kind,
+		namespace:  violation.Resource.Namespace,
+		name:       violation.Resource.Name,
+		policy:     violation.Policy,
+		validation: violation.Validation,
+	}
+}
+
+// FromResults returns the baseline of the violations of check results
+func FromResults(status *kaptestv1.ValidatingAdmissionPolicyTestStatus) *Baseline {
+	recorder := NewRecorder()
+	for i := range status.Results {
+		recorder.Add(&status.Results[i])
+	}
+	return recorder.Baseline()
+}
+
+// Recorder records the violations of check results one result at a time, so that results need
+// not be kept until the check ends
+type Recorder struct {
+	violations []kaptestv1.BaselineViolation
+	seen       map[key]bool
+}
+
+// NewRecorder creates a Recorder without violations
+func NewRecorder() *Recorder {
+	return &Recorder{violations: []kaptestv1.BaselineViolation{}, seen: make(map[key]bool)}
+}
+
+// Add records the violations of a result
+func (r *Recorder) Add(result *kaptestv1.TestResult) {
+	for _, policyResult := range result.PolicyResults {
+		for _, violation := range violations(*result, policyResult) {
+			if r.seen[keyOf(violation)] {
+				continue
+			}
+			r.seen[keyOf(violation)] = true
+			r.violations = append(r.violations, violation)
+		}
+	}
+}
+
+// Baseline returns the baseline of the violations recorded so far
+func (r *Recorder) Baseline() *Baseline {
+	baseline := &Baseline{APIVersion: APIVersion, Kind: Kind, Violations: append([]kaptestv1.BaselineViolation{}, r.violations...)}
+	sortViolations(baseline.Violations)
+	return baseline
+}
+
+// violations returns the violations of a policy result
+// Validations that could not be evaluated are errors rather than violations, and waived violations
+// are accepted until the waiver expires, so neither is recorded
+// Results without violation details, such as those of the upstream engine, are a single violation
+// of the policy
+func violations(result kaptestv1.TestResult, policyResult kaptestv1.PolicyResult) []kaptestv1.BaselineViolation {
+	if policyResult.Allowed || waiver.Waived(policyResult) || result.Resource == nil {
+		return nil
+	}
+
+	resource := *result.Resource
+	// UIDs change when objects are recreated
+	resource.UID = ""
+
+	if len(policyResult.Violations) == 0 {
+		return []kaptestv1.BaselineViolation{{Policy: policyResult.PolicyName, Resource: resource, Message: policyResult.Message}}
+	}
+	var recorded []kaptestv1.BaselineViolation
+	for _, violation := range policyResult.Violations {
+		if violation.EvaluationError {
+			continue
+		}
+		recorded = append(recorded, kaptestv1.BaselineViolation{
+			Policy:     policyResult.PolicyName,
+			Validation: violation.Field,
+			Resource:   resource,
+			Message:    violation.Message,
+		})
+	}
+	return recorded
+}
+
+// sortViolations sorts violations by resource, then policy and validation
+func sortViolations(violations []kaptestv1.BaselineViolation) {
+	sort.SliceStable(violations, func(i, j int) bool {
+		a, b := keyOf(violations[i]), keyOf(violations[j])
+		if a.namespace != b.namespace {
+			return a.namespace < b.namespace
+		}
+		if a.group != b.group {
+			return a.group < b.group
+		}
+		if a.kind != b.kind {
+			return a.kind < b.kind
+		}
+		if a.name != b.name {
+			return a.name < b.name
+		}
+		if a.policy != b.policy {
+			return a.policy < b.policy
+		}
+		return a.validation < b.validation
+	})
+}
+
+// Load reads a baseline file
+func Load(path string) (*Baseline, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read baseline file: %w", err)
+	}
+
+	var baseline Baseline
+	if err := json.Unmarshal(data, &baseline); err != nil {
+		return nil, fmt.Errorf("failed to parse baseline file (%s): %w", path, err)
+	}
+	if baseline.Kind != Kind {
+		return nil, fmt.Errorf("invalid baseline file (%s): kind must be %s, got %q", path, Kind, baseline.Kind)
+	}
+	return &baseline, nil
+}
+
+// Write writes the baseline to a file
+func (b *Baseline) Write(path string) error {
+	data, err := json.MarshalIndent(b, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal baseline: %w", err)
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("failed to write baseline file: %w", err)
+	}
+	return nil
+}
+
+// Apply marks the policy results whose violations are all in the baseline as baselined, and
+// returns how the violations compare with the baseline
+// Baseline violations no longer occurring, including those of resources that were not checked,
+// are reported as fixed
+func (b *Baseline) Apply(status *kaptestv1.ValidatingAdmissionPolicyTestStatus, path string) *kaptestv1.BaselineReport {
+	comparison := b.Compare(path)
+	for i := range status.Results {
+		comparison.Apply(&status.Results[i])
+	}
+	return comparison.Report()
+}
+
+// Comparison compares check results with a baseline one result at a time, as Apply does, so that
+// results need not be kept until the check ends
+type Comparison struct {
+	baseline *Baseline
+	report   kaptestv1.BaselineReport
+	// known tells whether each violation of the baseline occurred so far
+	known map[key]bool
+}
+
+// Compare starts comparing check results with the baseline of a file
+func (b *Baseline) Compare(path string) *Comparison {
+	known := make(map[key]bool, len(b.Violations))
+	for _, violation := range b.Violations {
+		known[keyOf(violation)] = false
+	}
+	return &Comparison{baseline: b, report: kaptestv1.BaselineReport{File: path}, known: known}
+}
+
+// Apply marks the policy results of a result whose violations are all in the baseline as baselined
+func (c *Comparison) Apply(result *kaptestv1.TestResult) {
+	for j := range result.PolicyResults {
+		policyResult := &result.PolicyResults[j]
+		current := violations(*result, *policyResult)
+		baselined := len(current) > 0
+		for _, violation := range current {
+			if _, ok := c.known[keyOf(violation)]; ok {
+				c.known[keyOf(violation)] = true
+				c.report.Known++
+			} else {
+				c.report.New++
+				baselined = false
+			}
+		}
+		policyResult.Baselined = baselined
+	}
+}
+
+// Report returns how the violations of the results compared so far compare with the baseline
+func (c *Comparison) Report() *kaptestv1.BaselineReport {
+	report := c.report
+	report.Fixed = nil
+	for _, violation := range c.baseline.Violations {
+		if !c.known[keyOf(violation)] {
+			report.Fixed = append(report.Fixed, violation)
+		}
+	}
+	return &report
+}
+
+// Known reports whether a denied result only has violations accepted by the baseline
+func Known(result kaptestv1.TestResult) bool {
+	denied := false
+	for _, policyResult := range result.PolicyResults {
+		if policyResult.Allowed {
+			continue
+		}
+		if !policyResult.Baselined {
+			return false
+		}
+		denied = true
+	}
+	return denied
+}
@@ -0,0 +1,173 @@
+package baseline
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	kaptestv1 "github.com/yashirook/kube-vap-test/pkg/apis/admission/v1"
+)
+
+func pod(name string) *kaptestv1.ResourceReference {
+	return &kaptestv1.ResourceReference{APIVersion: "v1", Kind: "Pod", Namespace: "apps", Name: name, UID: name + "-uid"}
+}
+
+func violation(field, message string) kaptestv1.PolicyViolation {
+	return kaptestv1.PolicyViolation{Field: field, Message: message}
+}
+
+func testStatus() *kaptestv1.ValidatingAdmissionPolicyTestStatus {
+	return &kaptestv1.ValidatingAdmissionPolicyTestStatus{
+		Results: []kaptestv1.TestResult{
+			{
+				Name:     "pod.v1/web",
+				Resource: pod("web"),
+				PolicyResults: []kaptestv1.PolicyResult{
+					{
+						PolicyName: "no-latest-tag",
+						Allowed:    false,
+						Violations: []kaptestv1.PolicyViolation{violation("spec.validations[1]", "latest tag is not allowed")},
+					},
+					{PolicyName: "label-required", Allowed: true},
+					{
+						PolicyName: "image-registry",
+						Allowed:    false,
+						Violations: []kaptestv1.PolicyViolation{violation("spec.validations[0]", "registry is not allowed")},
+						Waiver:     &kaptestv1.WaiverReference{Name: "legacy-registry", Expires: "2026-12-31"},
+					},
+				},
+			},
+			{
+				Name:     "deployment.apps/v1/api",
+				Resource: &kaptestv1.ResourceReference{APIVersion: "apps/v1", Kind: "Deployment", Namespace: "apps", Name: "api"},
+				PolicyResults: []kaptestv1.PolicyResult{
+					{
+						PolicyName: "replica-limit",
+						Allowed:    false,
+						Violations: []kaptestv1.PolicyViolation{
+							violation("spec.validations[0]", "too many replicas"),
+							{Field: "spec.validations[1]", Message: "no such key: strategy", EvaluationError: true},
+						},
+					},
+					// Results of the upstream engine have no violation details
+					{PolicyName: "label-required", Allowed: false, Message: "team label is required"},
+				},
+			},
+		},
+	}
+}
+
+func TestFromResults(t *testing.T) {
+	baseline := FromResults(testStatus())
+	assert.Equal(t, APIVersion, baseline.APIVersion)
+	assert.Equal(t, Kind, baseline.Kind)
+
+	// Violations are sorted by namespace and resource, evaluation errors, waived violations and UIDs
+	// are not recorded
+	assert.Equal(t, []kaptestv1.BaselineViolation{
+		{
+			Policy:     "no-latest-tag",
+			Validation: "spec.validations[1]",
+			Resource:   kaptestv1.ResourceReference{APIVersion: "v1", Kind: "Pod", Namespace: "apps", Name: "web"},
+			Message:    "latest tag is not allowed",
+		},
+		{
+			Policy:   "label-required",
+			Resource: kaptestv1.ResourceReference{APIVersion: "apps/v1", Kind: "Deployment", Namespace: "apps", Name: "api"},
+			Message:  "team label is required",
+		},
+		{
+			Policy:     "replica-limit",
+			Validation: "spec.validations[0]",
+			Resource:   kaptestv1.ResourceReference{APIVersion: "apps/v1", Kind: "Deployment", Namespace: "apps", Name: "api"},
+			Message:    "too many replicas",
+		},
+	}, baseline.Violations)
+}
+
+func TestWriteLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "baseline.json")
+	require.NoError(t, FromResults(testStatus()).Write(path))
+
+	loaded, err := Load(path)
+	require.NoError(t, err)
+	assert.Equal(t, FromResults(testStatus()), loaded)
+
+	// Files of other kinds are rejected
+	other := filepath.Join(t.TempDir(), "other.json")
+	require.NoError(t, os.WriteFile(other, []byte(`{"kind": "ValidatingAdmissionPolicyTest"}`), 0o644))
+	_, err = Load(other)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "kind must be ViolationBaseline")
+
+	_, err = Load(filepath.Join(t.TempDir(), "missing.json"))
+	assert.Error(t, err)
+}
+
+func TestApply(t *testing.T) {
+	baseline := FromResults(testStatus())
+	// A violation since fixed
+	baseline.Violations = append(baseline.Violations, kaptestv1.BaselineViolation{
+		Policy:     "no-latest-tag",
+		Validation: "spec.validations[0]",
+		Resource:   kaptestv1.ResourceReference{APIVersion: "v1", Kind: "Pod", Namespace: "apps", Name: "db"},
+	})
+	// The deployment violation was recorded with an older API version
+	baseline.Violations[2].Resource.APIVersion = "apps/v1beta2"
+
+	status := testStatus()
+	// A new violation of a known resource and policy
+	status.Results[0].PolicyResults[0].Violations = append(status.Results[0].PolicyResults[0].Violations,
+		violation("spec.validations[2]", "image pull policy must be Always"))
+
+	report := baseline.Apply(status, "baseline.json")
+	assert.Equal(t, "baseline.json", report.File)
+	assert.Equal(t, 1, report.New)
+	assert.Equal(t, 3, report.Known)
+	require.Len(t, report.Fixed, 1)
+	assert.Equal(t, "db", report.Fixed[0].Resource.Name)
+
+	// Policy results are baselined when all their violations are known
+	assert.False(t, status.Results[0].PolicyResults[0].Baselined)
+	assert.False(t, status.Results[0].PolicyResults[1].Baselined, "allowed policies are not baselined")
+	assert.True(t, status.Results[1].PolicyResults[0].Baselined)
+	assert.True(t, status.Results[1].PolicyResults[1].Baselined)
+
+	assert.False(t, Known(status.Results[0]))
+	assert.True(t, Known(status.Results[1]))
+	assert.False(t, Known(kaptestv1.TestResult{PolicyResults: []kaptestv1.PolicyResult{{PolicyName: "no-latest-tag", Allowed: true}}}))
+}
+
+func TestCompare(t *testing.T) {
+	baseline := FromResults(testStatus())
+	status := testStatus()
+
+	// Results are compared one at a time, and violations of results not compared yet are fixed
+	comparison := baseline.Compare("baseline.json")
+	comparison.Apply(&status.Results[1])
+	report := comparison.Report()
+	assert.Equal(t, 2, report.Known)
+	require.Len(t, report.Fixed, 1)
+	assert.Equal(t, "web", report.Fixed[0].Resource.Name)
+	assert.True(t, status.Results[1].PolicyResults[0].Baselined)
+
+	comparison.Apply(&status.Results[0])
+	report = comparison.Report()
+	assert.Equal(t, 3, report.Known)
+	assert.Equal(t, 0, report.New)
+	assert.Empty(t, report.Fixed)
+}
+
+func TestRecorder(t *testing.T) {
+	status := testStatus()
+
+	// Violations recorded one at a time are sorted and recorded once
+	recorder := NewRecorder()
+	recorder.Add(&status.Results[1])
+	recorder.Add(&status.Results[0])
+	recorder.Add(&status.Results[0])
+	assert.Equal(t, FromResults(testStatus()), recorder.Baseline())
+}
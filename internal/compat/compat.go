@@ -0,0 +1,253 @@
+package compat
+
+import (
+	"fmt"
+	"strings"
+
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	admissionregistrationv1alpha1 "k8s.io/api/admissionregistration/v1alpha1"
+	admissionregistrationv1beta1 "k8s.io/api/admissionregistration/v1beta1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/version"
+	plugincel "k8s.io/apiserver/pkg/admission/plugin/cel"
+	"k8s.io/apiserver/pkg/admission/plugin/policy/validating"
+	"k8s.io/apiserver/pkg/admission/plugin/webhook/matchconditions"
+	"k8s.io/apiserver/pkg/cel/environment"
+
+	kaptestv1 "github.com/yashirook/kube-vap-test/pkg/apis/admission/v1"
+)
+
+// policyAPIVersion is a served version of the ValidatingAdmissionPolicy API
+type policyAPIVersion struct {
+	groupVersion schema.GroupVersion
+	// Kubernetes minor versions introducing and removing the API (removed is 0 while served)
+	introduced int
+	removed    int
+	// Note shown when the version is the one to use
+	note string
+}
+
+// apiLifecycle is implemented by prerelease API types
+type apiLifecycle interface {
+	APILifecycleIntroduced() (major, minor int)
+	APILifecycleRemoved() (major, minor int)
+}
+
+// prereleaseVersion returns the served versions of a prerelease API from its lifecycle
+func prereleaseVersion(groupVersion schema.GroupVersion, lifecycle apiLifecycle, note string) policyAPIVersion {
+	_, introduced := lifecycle.APILifecycleIntroduced()
+	_, removed := lifecycle.APILifecycleRemoved()
+	return policyAPIVersion{groupVersion: groupVersion, introduced: introduced, removed: removed, note: note}
+}
+
+// policyAPIVersions lists the policy API versions, preferred versions first
+var policyAPIVersions = []policyAPIVersion{
+	{groupVersion: admissionregistrationv1.SchemeGroupVersion, introduced: 30},
+	prereleaseVersion(admissionregistrationv1beta1.SchemeGroupVersion, &admissionregistrationv1beta1.ValidatingAdmissionPolicy{},
+		"beta API disabled by default: enable the ValidatingAdmissionPolicy feature gate and --runtime-config=admissionregistration.k8s.io/v1beta1=true"),
+	prereleaseVersion(admissionregistrationv1alpha1.SchemeGroupVersion, &admissionregistrationv1alpha1.ValidatingAdmissionPolicy{},
+		"alpha API: enable the ValidatingAdmissionPolicy feature gate and --runtime-config=admissionregistration.k8s.io/v1alpha1=true"),
+}
+
+// fieldRequirement is a policy field added after the API was introduced
+type fieldRequirement struct {
+	field      string
+	introduced int
+	used       func(policy *admissionregistrationv1.ValidatingAdmissionPolicy) bool
+}
+
+var fieldRequirements = []fieldRequirement{
+	{
+		field:      "spec.matchConditions",
+		introduced: 27,
+		used: func(policy *admissionregistrationv1.ValidatingAdmissionPolicy) bool {
+			return len(policy.Spec.MatchConditions) > 0
+		},
+	},
+	{
+		field:      "spec.auditAnnotations",
+		introduced: 27,
+		used: func(policy *admissionregistrationv1.ValidatingAdmissionPolicy) bool {
+			return len(policy.Spec.AuditAnnotations) > 0
+		},
+	},
+	{
+		field:      "spec.validations[].messageExpression",
+		introduced: 27,
+		used: func(policy *admissionregistrationv1.ValidatingAdmissionPolicy) bool {
+			for _, validation := range policy.Spec.Validations {
+				if validation.MessageExpression != "" {
+					return true
+				}
+			}
+			return false
+		},
+	},
+	{
+		field:      "spec.variables",
+		introduced: 28,
+		used: func(policy *admissionregistrationv1.ValidatingAdmissionPolicy) bool {
+			return len(policy.Spec.Variables) > 0
+		},
+	},
+}
+
+// ParseKubernetesVersion parses a Kubernetes version such as 1.29, v1.29 or v1.29.3
+// Only the major and minor versions are kept
+func ParseKubernetesVersion(value string) (*version.Version, error) {
+	parsed, err := version.ParseGeneric(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Kubernetes version %q: %w", value, err)
+	}
+	if parsed.Major() != 1 {
+		return nil, fmt.Errorf("invalid Kubernetes version %q: only 1.x versions are supported", value)
+	}
+	return version.MajorMinor(parsed.Major(), parsed.Minor()), nil
+}
+
+// Analyzer reports the policy API version each policy needs on a target Kubernetes version
+type Analyzer struct {
+	target *version.Version
+	// CEL environments of new expressions on the target version
+	envSet *environment.EnvSet
+}
+
+// NewAnalyzer creates an Analyzer for the target Kubernetes version
+func NewAnalyzer(kubernetesVersion string) (*Analyzer, error) {
+	target, err := ParseKubernetesVersion(kubernetesVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	// Apiservers compile new expressions with the libraries of the previous minor version,
+	// so that they can still be read after a rollback
+	compatibility := target
+	if target.Minor() > 0 {
+		compatibility = version.MajorMinor(target.Major(), target.Minor()-1)
+	}
+
+	return &Analyzer{
+		target: target,
+		envSet: environment.MustBaseEnvSet(compatibility, true),
+	}, nil
+}
+
+// KubernetesVersion returns the target Kubernetes version (e.g. 1.29)
+func (a *Analyzer) KubernetesVersion() string {
+	return fmt.Sprintf("%d.%d", a.target.Major(), a.target.Minor())
+}
+
+// Report analyzes every policy
+func (a *Analyzer) Report(policies []*admissionregistrationv1.ValidatingAdmissionPolicy) *kaptestv1.APIVersionReport {
+	report := &kaptestv1.APIVersionReport{
+		KubernetesVersion: a.KubernetesVersion(),
+	}
+	for _, policy := range policies {
+		report.Policies = append(report.Policies, a.Analyze(policy))
+	}
+	return report
+}
+
+// Analyze returns the API version the policy needs on the target version,
+// with the fields and CEL functions the target version does not support
+func (a *Analyzer) Analyze(policy *admissionregistrationv1.ValidatingAdmissionPolicy) kaptestv1.PolicyAPIVersion {
+	result := kaptestv1.PolicyAPIVersion{
+		Policy: policy.Name,
+	}
+
+	minor := int(a.target.Minor())
+	apiVersion := servedAPIVersion(minor)
+	if apiVersion == nil {
+		result.Notes = append(result.Notes, fmt.Sprintf("ValidatingAdmissionPolicy is not available before Kubernetes 1.%d", policyAPIVersions[len(policyAPIVersions)-1].introduced))
+		return result
+	}
+
+	result.APIVersion = apiVersion.groupVersion.String()
+	result.Supported = true
+	if apiVersion.note != "" {
+		result.Notes = append(result.Notes, apiVersion.note)
+	}
+
+	for _, requirement := range fieldRequirements {
+		if minor < requirement.introduced && requirement.used(policy) {
+			result.Supported = false
+			result.Notes = append(result.Notes, fmt.Sprintf("%s requires Kubernetes 1.%d or later", requirement.field, requirement.introduced))
+		}
+	}
+
+	if notes := a.checkExpressions(policy); len(notes) > 0 {
+		result.Supported = false
+		result.Notes = append(result.Notes, notes...)
+	}
+
+	return result
+}
+
+// servedAPIVersion returns the preferred policy API version served by the Kubernetes minor version
+func servedAPIVersion(minor int) *policyAPIVersion {
+	for i := range policyAPIVersions {
+		apiVersion := &policyAPIVersions[i]
+		if minor >= apiVersion.introduced && (apiVersion.removed == 0 || minor < apiVersion.removed) {
+			return apiVersion
+		}
+	}
+	return nil
+}
+
+// checkExpressions compiles the policy expressions with the CEL libraries of the target version
+// Expressions that do not compile with any library version are invalid regardless of the target
+// and are left to evaluation to report
+func (a *Analyzer) checkExpressions(policy *admissionregistrationv1.ValidatingAdmissionPolicy) []string {
+	compiler, err := plugincel.NewCompositedCompiler(a.envSet)
+	if err != nil {
+		return []string{fmt.Sprintf("failed to create CEL compiler: %v", err)}
+	}
+
+	hasParams := policy.Spec.ParamKind != nil
+	optionalVars := plugincel.OptionalVariableDeclarations{HasParams: hasParams, HasAuthorizer: true, StrictCost: true}
+	messageVars := plugincel.OptionalVariableDeclarations{HasParams: hasParams, HasAuthorizer: false, StrictCost: true}
+
+	var notes []string
+	check := func(field string, accessor plugincel.ExpressionAccessor, options plugincel.OptionalVariableDeclarations) {
+		if accessor.GetExpression() == "" {
+			return
+		}
+		result := compiler.CompileCELExpression(accessor, options, environment.NewExpressions)
+		if result.Error == nil {
+			return
+		}
+		if compiler.CompileCELExpression(accessor, options, environment.StoredExpressions).Error != nil {
+			return
+		}
+		notes = append(notes, fmt.Sprintf("%s uses CEL features unavailable in Kubernetes %s: %s", field, a.KubernetesVersion(), compileError(result.Error.Detail)))
+	}
+
+	for i, variable := range policy.Spec.Variables {
+		accessor := &validating.Variable{Name: variable.Name, Expression: variable.Expression}
+		check(fmt.Sprintf("spec.variables[%d].expression", i), accessor, optionalVars)
+		// Later expressions refer to the variable by its type
+		compiler.CompileAndStoreVariable(accessor, optionalVars, environment.StoredExpressions)
+	}
+	for i := range policy.Spec.MatchConditions {
+		check(fmt.Sprintf("spec.matchConditions[%d].expression", i), (*matchconditions.MatchCondition)(&policy.Spec.MatchConditions[i]), optionalVars)
+	}
+	for i, validation := range policy.Spec.Validations {
+		check(fmt.Sprintf("spec.validations[%d].expression", i), &validating.ValidationCondition{Expression: validation.Expression}, optionalVars)
+		check(fmt.Sprintf("spec.validations[%d].messageExpression", i), &validating.MessageExpressionCondition{MessageExpression: validation.MessageExpression}, messageVars)
+	}
+	for i, annotation := range policy.Spec.AuditAnnotations {
+		check(fmt.Sprintf("spec.auditAnnotations[%d].valueExpression", i), &validating.AuditAnnotationCondition{Key: annotation.Key, ValueExpression: annotation.ValueExpression}, optionalVars)
+	}
+
+	return notes
+}
+
+// compileError returns the first line of a CEL compilation error without its prefix
+func compileError(detail string) string {
+	detail = strings.TrimPrefix(detail, "compilation failed: ")
+	detail = strings.TrimPrefix(detail, "ERROR: ")
+	if i := strings.Index(detail, "\n"); i >= 0 {
+		detail = detail[:i]
+	}
+	return detail
+}
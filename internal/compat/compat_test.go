@@ -0,0 +1,131 @@
+package compat
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func newPolicy(name string, expressions ...string) *admissionregistrationv1.ValidatingAdmissionPolicy {
+	policy := &admissionregistrationv1.ValidatingAdmissionPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+	}
+	for _, expression := range expressions {
+		policy.Spec.Validations = append(policy.Spec.Validations, admissionregistrationv1.Validation{Expression: expression})
+	}
+	return policy
+}
+
+func TestParseKubernetesVersion(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{value: "1.29", want: "1.29"},
+		{value: "v1.30", want: "1.30"},
+		{value: "v1.31.4", want: "1.31"},
+		{value: "2.0", wantErr: true},
+		{value: "latest", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			parsed, err := ParseKubernetesVersion(tt.value)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, parsed.String())
+		})
+	}
+}
+
+func TestAnalyzeAPIVersion(t *testing.T) {
+	policy := newPolicy("simple", "object.metadata.name != ''")
+
+	tests := []struct {
+		kubernetesVersion string
+		wantAPIVersion    string
+		wantSupported     bool
+		wantNote          string
+	}{
+		{kubernetesVersion: "1.25", wantAPIVersion: "", wantSupported: false, wantNote: "not available before Kubernetes 1.26"},
+		{kubernetesVersion: "1.26", wantAPIVersion: "admissionregistration.k8s.io/v1alpha1", wantSupported: true, wantNote: "alpha API"},
+		{kubernetesVersion: "1.28", wantAPIVersion: "admissionregistration.k8s.io/v1beta1", wantSupported: true, wantNote: "beta API disabled by default"},
+		{kubernetesVersion: "1.30", wantAPIVersion: "admissionregistration.k8s.io/v1", wantSupported: true},
+		{kubernetesVersion: "1.35", wantAPIVersion: "admissionregistration.k8s.io/v1", wantSupported: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.kubernetesVersion, func(t *testing.T) {
+			analyzer, err := NewAnalyzer(tt.kubernetesVersion)
+			require.NoError(t, err)
+
+			result := analyzer.Analyze(policy)
+			assert.Equal(t, "simple", result.Policy)
+			assert.Equal(t, tt.wantAPIVersion, result.APIVersion)
+			assert.Equal(t, tt.wantSupported, result.Supported)
+			if tt.wantNote == "" {
+				assert.Empty(t, result.Notes)
+			} else {
+				require.Len(t, result.Notes, 1)
+				assert.Contains(t, result.Notes[0], tt.wantNote)
+			}
+		})
+	}
+}
+
+func TestAnalyzeFields(t *testing.T) {
+	policy := newPolicy("with-variables", "variables.name != ''")
+	policy.Spec.Variables = []admissionregistrationv1.Variable{{Name: "name", Expression: "object.metadata.name"}}
+	policy.Spec.MatchConditions = []admissionregistrationv1.MatchCondition{{Name: "named", Expression: "has(object.metadata.name)"}}
+
+	analyzer, err := NewAnalyzer("1.27")
+	require.NoError(t, err)
+	result := analyzer.Analyze(policy)
+	assert.False(t, result.Supported)
+	assert.Contains(t, result.Notes, "spec.variables requires Kubernetes 1.28 or later")
+	assert.NotContains(t, result.Notes, "spec.matchConditions requires Kubernetes 1.27 or later")
+
+	analyzer, err = NewAnalyzer("1.28")
+	require.NoError(t, err)
+	result = analyzer.Analyze(policy)
+	assert.True(t, result.Supported, result.Notes)
+}
+
+func TestAnalyzeCELLibraries(t *testing.T) {
+	// The IP library was introduced in 1.30 and is available to new expressions from 1.31
+	policy := newPolicy("ip", "!has(object.spec.podIP) || ip(object.spec.podIP).family() == 4")
+
+	analyzer, err := NewAnalyzer("1.30")
+	require.NoError(t, err)
+	result := analyzer.Analyze(policy)
+	assert.False(t, result.Supported)
+	require.Len(t, result.Notes, 1)
+	assert.Contains(t, result.Notes[0], "spec.validations[0].expression uses CEL features unavailable in Kubernetes 1.30")
+
+	analyzer, err = NewAnalyzer("1.31")
+	require.NoError(t, err)
+	result = analyzer.Analyze(policy)
+	assert.True(t, result.Supported, result.Notes)
+
+	// Invalid expressions are not reported as version incompatibilities
+	invalid := newPolicy("invalid", "object.metadata.name ==")
+	assert.True(t, analyzer.Analyze(invalid).Supported)
+}
+
+func TestReport(t *testing.T) {
+	analyzer, err := NewAnalyzer("v1.29.3")
+	require.NoError(t, err)
+
+	report := analyzer.Report([]*admissionregistrationv1.ValidatingAdmissionPolicy{newPolicy("a", "true"), newPolicy("b", "true")})
+	assert.Equal(t, "1.29", report.KubernetesVersion)
+	require.Len(t, report.Policies, 2)
+	assert.Equal(t, "a", report.Policies[0].Policy)
+	assert.Equal(t, "admissionregistration.k8s.io/v1beta1", report.Policies[1].APIVersion)
+}
@@ -32,6 +32,9 @@ type AdmissionTarget struct {
 	// Convenience fields for testing
 	Namespace string
 	Labels    map[string]string
+
+	// NamespaceLabels are the labels of the namespace of the object, nil when they are unknown
+	NamespaceLabels map[string]string
 }
 
 // PrepareObject sets the metadata of Object from Namespace and Labels fields
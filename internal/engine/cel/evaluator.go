@@ -1,11 +1,60 @@
 package cel
 
 import (
+	"errors"
 	"fmt"
 
 	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common/types"
 )
 
+// PositionError is a CEL error with its position in the expression
+type PositionError struct {
+	// Line starts at 1 and Column at 0, like CEL source locations
+	// Line is 0 when the position is unknown
+	Line   int
+	Column int
+	// Message is the CEL error without position and snippet
+	Message string
+	err     error
+}
+
+// Error returns the CEL error
+func (e *PositionError) Error() string {
+	return e.err.Error()
+}
+
+// Unwrap returns the CEL error
+func (e *PositionError) Unwrap() error {
+	return e.err
+}
+
+// compileError returns the compilation error of the issues with the position of the first error
+func compileError(issues *cel.Issues) error {
+	positionErr := &PositionError{err: issues.Err()}
+	if errs := issues.Errors(); len(errs) > 0 {
+		positionErr.Message = errs[0].Message
+		if location := errs[0].Location; location.Line() > 0 {
+			positionErr.Line = location.Line()
+			positionErr.Column = location.Column()
+		}
+	}
+	return positionErr
+}
+
+// evaluationError returns the evaluation error with the position of the failing expression node
+func evaluationError(ast *cel.Ast, err error) error {
+	positionErr := &PositionError{Message: err.Error(), err: err}
+	var celErr *types.Err
+	if errors.As(err, &celErr) && celErr.NodeID() != 0 {
+		if location := ast.NativeRep().SourceInfo().GetStartLocation(celErr.NodeID()); location.Line() > 0 {
+			positionErr.Line = location.Line()
+			positionErr.Column = location.Column()
+		}
+	}
+	return positionErr
+}
+
 // Evaluator evaluates CEL expressions with a pre-configured environment
 type Evaluator struct {
 	env *cel.Env
@@ -26,11 +75,12 @@ func NewEvaluatorWithEnv(env *cel.Env) *Evaluator {
 }
 
 // Evaluate evaluates a CEL expression with the given variables
+// Compilation and evaluation errors wrap a PositionError
 func (e *Evaluator) Evaluate(expression string, vars map[string]interface{}) (interface{}, error) {
 	// Compile expression
 	ast, issues := e.env.Compile(expression)
 	if issues != nil && issues.Err() != nil {
-		return nil, fmt.Errorf("failed to compile expression: %w", issues.Err())
+		return nil, fmt.Errorf("failed to compile expression: %w", compileError(issues))
 	}
 
 	program, err := e.env.Program(ast)
@@ -41,7 +91,7 @@ func (e *Evaluator) Evaluate(expression string, vars map[string]interface{}) (in
 	// Evaluate expression
 	out, _, err := program.Eval(vars)
 	if err != nil {
-		return nil, fmt.Errorf("failed to evaluate expression: %w", err)
+		return nil, fmt.Errorf("failed to evaluate expression: %w", evaluationError(ast, err))
 	}
 
 	return out.Value(), nil
@@ -51,7 +101,7 @@ func (e *Evaluator) Evaluate(expression string, vars map[string]interface{}) (in
 func (e *Evaluator) CompileAndCache(expression string) (cel.Program, error) {
 	ast, issues := e.env.Compile(expression)
 	if issues != nil && issues.Err() != nil {
-		return nil, fmt.Errorf("failed to compile expression: %w", issues.Err())
+		return nil, fmt.Errorf("failed to compile expression: %w", compileError(issues))
 	}
 
 	program, err := e.env.Program(ast)
@@ -0,0 +1,480 @@
+package cluster
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/dynamic"
+
+	"github.com/yashirook/kube-vap-test/internal/engine"
+	"github.com/yashirook/kube-vap-test/internal/engine/upstream"
+)
+
+const (
+	// ManagedByLabel marks the objects the engine creates in the cluster
+	ManagedByLabel = "app.kubernetes.io/managed-by"
+	// ManagedByValue is the value of ManagedByLabel on objects created by the engine
+	ManagedByValue = "kube-vap-test"
+
+	// DefaultSettleTime is the default wait for the apiserver to load applied policies
+	DefaultSettleTime = 2 * time.Second
+
+	// observeTimeout bounds the wait for the apiserver to observe applied policies
+	observeTimeout = 30 * time.Second
+)
+
+// excludeManagedObjects keeps the applied policies from matching the namespaces and existing
+// objects the engine creates for requests, so that they are created even when they violate the
+// policies, while the objects of dry-run requests are still matched
+var excludeManagedObjects = admissionregistrationv1.MatchCondition{
+	Name: "kube-vap-test-exclude-managed-objects",
+	Expression: fmt.Sprintf("object == null || !has(object.metadata.labels) || !('%s' in object.metadata.labels) || object.metadata.labels['%s'] != '%s'",
+		ManagedByLabel, ManagedByLabel, ManagedByValue),
+}
+
+// Workloads created as existing objects of requests never run pods
+var (
+	// scaledWorkloads are created with no replicas
+	scaledWorkloads = map[schema.GroupKind]bool{
+		{Group: "apps", Kind: "Deployment"}:  true,
+		{Group: "apps", Kind: "ReplicaSet"}:  true,
+		{Group: "apps", Kind: "StatefulSet"}: true,
+		{Kind: "ReplicationController"}:      true,
+	}
+	// suspendedWorkloads are created suspended
+	suspendedWorkloads = map[schema.GroupKind]bool{
+		{Group: "batch", Kind: "Job"}:     true,
+		{Group: "batch", Kind: "CronJob"}: true,
+	}
+	// runningWorkloads cannot be created without running pods, and have to exist in the cluster
+	runningWorkloads = map[schema.GroupKind]bool{
+		{Kind: "Pod"}:                      true,
+		{Group: "apps", Kind: "DaemonSet"}: true,
+	}
+)
+
+var (
+	policyResource    = admissionregistrationv1.SchemeGroupVersion.WithResource("validatingadmissionpolicies")
+	bindingResource   = admissionregistrationv1.SchemeGroupVersion.WithResource("validatingadmissionpolicybindings")
+	namespaceResource = corev1.SchemeGroupVersion.WithResource("namespaces")
+)
+
+// Engine evaluates policies with the apiserver of a cluster
+// Policies, bindings and the parameter are applied to the cluster, and every object is sent
+// as a server-side dry-run request, so the verdict is the one of the real admission chain
+type Engine struct {
+	client     dynamic.Interface
+	restMapper meta.RESTMapper
+	settleTime time.Duration
+
+	// Policies, bindings and parameter currently applied to the cluster
+	policies []*admissionregistrationv1.ValidatingAdmissionPolicy
+	bindings []*admissionregistrationv1.ValidatingAdmissionPolicyBinding
+	paramObj runtime.Object
+	applied  bool
+
+	// Objects created in the cluster, deleted on Close
+	created []createdObject
+}
+
+// createdObject is an object the engine created in the cluster
+type createdObject struct {
+	resource  schema.GroupVersionResource
+	namespace string
+	name      string
+}
+
+// NewEngine creates an Engine sending requests through the client
+func NewEngine(client dynamic.Interface, restMapper meta.RESTMapper) *Engine {
+	return &Engine{
+		client:     client,
+		restMapper: restMapper,
+		settleTime: DefaultSettleTime,
+	}
+}
+
+// SetSettleTime sets how long to wait after applying policies before sending requests
+// The apiserver loads policies asynchronously, even after they are observed by the type checker
+func (e *Engine) SetSettleTime(settleTime time.Duration) {
+	e.settleTime = settleTime
+}
+
+// Name returns the engine name
+func (e *Engine) Name() string {
+	return engine.EngineCluster
+}
+
+// Evaluate sends the request to the apiserver as a dry-run request
+// Policies, bindings and the parameter are applied again when they change between requests
+// Objects UPDATE and DELETE requests apply to are created before the policies, which never
+// match the objects created by the engine
+func (e *Engine) Evaluate(ctx context.Context, request *engine.EvaluationRequest) (*engine.EvaluationResponse, error) {
+	if !e.applied || !e.serves(request) {
+		if err := e.Close(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	obj := request.Object
+	if obj == nil {
+		obj = request.OldObject
+	}
+	if obj == nil {
+		return nil, fmt.Errorf("request has no object")
+	}
+
+	gvk := obj.GroupVersionKind()
+	mapping, err := e.restMapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve resource of %s: %w", gvk, err)
+	}
+
+	// Namespaced objects without a namespace are created in the default namespace, as kubectl does
+	namespace := ""
+	if mapping.Scope.Name() == meta.RESTScopeNameNamespace {
+		namespace = obj.GetNamespace()
+		if namespace == "" {
+			namespace = metav1.NamespaceDefault
+		}
+		if err := e.ensureNamespace(ctx, namespace); err != nil {
+			return nil, err
+		}
+	}
+
+	// UPDATE and DELETE requests need an existing object to dry-run against
+	operation := strings.ToUpper(request.Operation)
+	var current *unstructured.Unstructured
+	switch operation {
+	case string(admissionregistrationv1.Update):
+		if request.Object == nil {
+			return nil, fmt.Errorf("UPDATE request has no object")
+		}
+		old := request.OldObject
+		if old == nil {
+			old = request.Object
+		}
+		current, err = e.ensureObject(ctx, mapping.Resource, namespace, old, operation)
+	case string(admissionregistrationv1.Delete):
+		current, err = e.ensureObject(ctx, mapping.Resource, namespace, obj, operation)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if !e.applied {
+		if err := e.apply(ctx, request); err != nil {
+			return nil, err
+		}
+	}
+
+	resource := e.client.Resource(mapping.Resource).Namespace(namespace)
+	dryRun := []string{metav1.DryRunAll}
+
+	switch operation {
+	case "", string(admissionregistrationv1.Create):
+		if request.Object == nil {
+			return nil, fmt.Errorf("CREATE request has no object")
+		}
+		object := request.Object.DeepCopy()
+		object.SetNamespace(namespace)
+		_, err = resource.Create(ctx, object, metav1.CreateOptions{DryRun: dryRun})
+		if apierrors.IsAlreadyExists(err) {
+			return nil, fmt.Errorf("%s %s already exists in the cluster", gvk.Kind, object.GetName())
+		}
+
+	case string(admissionregistrationv1.Update):
+		object := request.Object.DeepCopy()
+		object.SetNamespace(namespace)
+		object.SetResourceVersion(current.GetResourceVersion())
+		_, err = resource.Update(ctx, object, metav1.UpdateOptions{DryRun: dryRun})
+		if apierrors.IsConflict(err) {
+			return nil, fmt.Errorf("%s %s was modified in the cluster during verification", gvk.Kind, object.GetName())
+		}
+
+	case string(admissionregistrationv1.Delete):
+		err = resource.Delete(ctx, current.GetName(), metav1.DeleteOptions{DryRun: dryRun})
+
+	default:
+		return nil, fmt.Errorf("unsupported operation for dry-run requests: %s", request.Operation)
+	}
+
+	return upstream.ResponseFromError(err)
+}
+
+// Close deletes the objects the engine created in the cluster
+// Bindings and policies are deleted first, so that they do not deny deleting the other objects
+func (e *Engine) Close(ctx context.Context) error {
+	ordered := make([]createdObject, 0, len(e.created))
+	for _, resource := range []schema.GroupVersionResource{bindingResource, policyResource} {
+		for i := len(e.created) - 1; i >= 0; i-- {
+			if e.created[i].resource == resource {
+				ordered = append(ordered, e.created[i])
+			}
+		}
+	}
+	for i := len(e.created) - 1; i >= 0; i-- {
+		if e.created[i].resource != bindingResource && e.created[i].resource != policyResource {
+			ordered = append(ordered, e.created[i])
+		}
+	}
+
+	var errs []error
+	for _, created := range ordered {
+		if err := e.delete(ctx, created); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	e.created = nil
+	e.applied = false
+	return errors.Join(errs...)
+}
+
+// delete deletes an object created by the engine
+// Deletions denied by admission are retried, since the apiserver keeps enforcing deleted policies until it unloads them
+func (e *Engine) delete(ctx context.Context, created createdObject) error {
+	var lastErr error
+	err := wait.PollUntilContextTimeout(ctx, 100*time.Millisecond, observeTimeout, true, func(ctx context.Context) (bool, error) {
+		lastErr = e.client.Resource(created.resource).Namespace(created.namespace).Delete(ctx, created.name, metav1.DeleteOptions{})
+		switch {
+		case lastErr == nil, apierrors.IsNotFound(lastErr):
+			return true, nil
+		case apierrors.IsForbidden(lastErr), apierrors.IsInvalid(lastErr):
+			return false, nil
+		default:
+			return false, lastErr
+		}
+	})
+	if err != nil {
+		if lastErr != nil {
+			err = lastErr
+		}
+		return fmt.Errorf("failed to delete %s %s: %w", created.resource.Resource, created.name, err)
+	}
+	return nil
+}
+
+// serves returns true if the policies, bindings and parameter of the request are applied
+func (e *Engine) serves(request *engine.EvaluationRequest) bool {
+	if e.paramObj != request.ParamObj || len(e.policies) != len(request.Policies) || len(e.bindings) != len(request.Bindings) {
+		return false
+	}
+	for i := range e.policies {
+		if e.policies[i] != request.Policies[i] {
+			return false
+		}
+	}
+	for i := range e.bindings {
+		if e.bindings[i] != request.Bindings[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// apply creates the parameter, policies and bindings of the request in the cluster
+// and waits until the apiserver has loaded them
+func (e *Engine) apply(ctx context.Context, request *engine.EvaluationRequest) error {
+	var param *unstructured.Unstructured
+	if request.ParamObj != nil {
+		content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(request.ParamObj)
+		if err != nil {
+			return fmt.Errorf("failed to convert parameter object: %w", err)
+		}
+		param = &unstructured.Unstructured{Object: content}
+
+		gvk := param.GroupVersionKind()
+		mapping, err := e.restMapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+		if err != nil {
+			return fmt.Errorf("failed to resolve resource of parameter %s: %w", gvk, err)
+		}
+		if param.GetNamespace() != "" {
+			if err := e.ensureNamespace(ctx, param.GetNamespace()); err != nil {
+				return err
+			}
+		}
+		if err := e.createOrReplace(ctx, mapping.Resource, param); err != nil {
+			return err
+		}
+	}
+
+	policies, bindings := upstream.PolicyObjects(request.Policies, request.Bindings, param)
+	var observe []string
+	for _, policy := range policies {
+		policy.Spec.MatchConditions = append(policy.Spec.MatchConditions, excludeManagedObjects)
+		policy.TypeMeta = metav1.TypeMeta{APIVersion: admissionregistrationv1.SchemeGroupVersion.String(), Kind: "ValidatingAdmissionPolicy"}
+		obj, err := toUnstructured(policy)
+		if err != nil {
+			return err
+		}
+		if err := e.createOrReplace(ctx, policyResource, obj); err != nil {
+			return err
+		}
+		observe = append(observe, policy.Name)
+	}
+	for _, binding := range bindings {
+		binding.TypeMeta = metav1.TypeMeta{APIVersion: admissionregistrationv1.SchemeGroupVersion.String(), Kind: "ValidatingAdmissionPolicyBinding"}
+		obj, err := toUnstructured(binding)
+		if err != nil {
+			return err
+		}
+		if err := e.createOrReplace(ctx, bindingResource, obj); err != nil {
+			return err
+		}
+	}
+
+	for _, name := range observe {
+		if err := e.waitForPolicy(ctx, name); err != nil {
+			return err
+		}
+	}
+	if e.settleTime > 0 {
+		select {
+		case <-time.After(e.settleTime):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	e.policies = request.Policies
+	e.bindings = request.Bindings
+	e.paramObj = request.ParamObj
+	e.applied = true
+	return nil
+}
+
+// createOrReplace creates the object, or replaces an object left over by an earlier run
+// Objects not created by the engine are never modified
+func (e *Engine) createOrReplace(ctx context.Context, resource schema.GroupVersionResource, obj *unstructured.Unstructured) error {
+	obj = obj.DeepCopy()
+	labels := obj.GetLabels()
+	if labels == nil {
+		labels = map[string]string{}
+	}
+	labels[ManagedByLabel] = ManagedByValue
+	obj.SetLabels(labels)
+	obj.SetResourceVersion("")
+
+	client := e.client.Resource(resource).Namespace(obj.GetNamespace())
+	_, err := client.Create(ctx, obj, metav1.CreateOptions{})
+	if apierrors.IsAlreadyExists(err) {
+		existing, getErr := client.Get(ctx, obj.GetName(), metav1.GetOptions{})
+		if getErr != nil {
+			return fmt.Errorf("failed to get %s %s: %w", resource.Resource, obj.GetName(), getErr)
+		}
+		if existing.GetLabels()[ManagedByLabel] != ManagedByValue {
+			return fmt.Errorf("%s %s already exists in the cluster and is not managed by %s", resource.Resource, obj.GetName(), ManagedByValue)
+		}
+		obj.SetResourceVersion(existing.GetResourceVersion())
+		_, err = client.Update(ctx, obj, metav1.UpdateOptions{})
+	}
+	if err != nil {
+		return fmt.Errorf("failed to apply %s %s: %w", resource.Resource, obj.GetName(), err)
+	}
+
+	created := createdObject{resource: resource, namespace: obj.GetNamespace(), name: obj.GetName()}
+	for _, existing := range e.created {
+		if existing == created {
+			return nil
+		}
+	}
+	e.created = append(e.created, created)
+	return nil
+}
+
+// ensureNamespace creates the namespace if it does not exist
+func (e *Engine) ensureNamespace(ctx context.Context, name string) error {
+	_, err := e.client.Resource(namespaceResource).Get(ctx, name, metav1.GetOptions{})
+	if err == nil {
+		return nil
+	}
+	if !apierrors.IsNotFound(err) {
+		return fmt.Errorf("failed to get namespace %s: %w", name, err)
+	}
+
+	namespace := &unstructured.Unstructured{}
+	namespace.SetGroupVersionKind(corev1.SchemeGroupVersion.WithKind("Namespace"))
+	namespace.SetName(name)
+	return e.createOrReplace(ctx, namespaceResource, namespace)
+}
+
+// ensureObject returns the object an UPDATE or DELETE request applies to from the cluster
+// The object is created unless it exists and was not created by the engine. Workloads are created
+// without replicas or suspended, and pods and daemon sets are never created, since they would run
+func (e *Engine) ensureObject(ctx context.Context, resource schema.GroupVersionResource, namespace string, obj *unstructured.Unstructured, operation string) (*unstructured.Unstructured, error) {
+	client := e.client.Resource(resource).Namespace(namespace)
+	current, err := client.Get(ctx, obj.GetName(), metav1.GetOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return nil, fmt.Errorf("failed to get %s %s: %w", resource.Resource, obj.GetName(), err)
+	}
+	if err == nil && current.GetLabels()[ManagedByLabel] != ManagedByValue {
+		return current, nil
+	}
+
+	obj = obj.DeepCopy()
+	obj.SetNamespace(namespace)
+	groupKind := obj.GroupVersionKind().GroupKind()
+	switch {
+	case runningWorkloads[groupKind]:
+		return nil, fmt.Errorf("%s %s/%s does not exist in the cluster: %s requests apply to an existing object, and creating it would run it, so create it first or use an existing object",
+			groupKind.Kind, namespace, obj.GetName(), operation)
+	case scaledWorkloads[groupKind]:
+		if err := unstructured.SetNestedField(obj.Object, int64(0), "spec", "replicas"); err != nil {
+			return nil, fmt.Errorf("failed to scale %s %s: %w", groupKind.Kind, obj.GetName(), err)
+		}
+	case suspendedWorkloads[groupKind]:
+		if err := unstructured.SetNestedField(obj.Object, true, "spec", "suspend"); err != nil {
+			return nil, fmt.Errorf("failed to suspend %s %s: %w", groupKind.Kind, obj.GetName(), err)
+		}
+	}
+
+	if err := e.createOrReplace(ctx, resource, obj); err != nil {
+		return nil, fmt.Errorf("failed to create existing object for the request: %w", err)
+	}
+	current, err = client.Get(ctx, obj.GetName(), metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get %s %s: %w", resource.Resource, obj.GetName(), err)
+	}
+	return current, nil
+}
+
+// waitForPolicy waits until the apiserver has observed the current generation of the policy
+// Servers that do not track generations, such as fake clients, are not waited for
+func (e *Engine) waitForPolicy(ctx context.Context, name string) error {
+	err := wait.PollUntilContextTimeout(ctx, 100*time.Millisecond, observeTimeout, true, func(ctx context.Context) (bool, error) {
+		policy, err := e.client.Resource(policyResource).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+		if policy.GetGeneration() == 0 {
+			return true, nil
+		}
+		observed, _, _ := unstructured.NestedInt64(policy.Object, "status", "observedGeneration")
+		return observed >= policy.GetGeneration(), nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to wait for policy %s: %w", name, err)
+	}
+	return nil
+}
+
+// toUnstructured converts a typed object to unstructured
+func toUnstructured(obj runtime.Object) (*unstructured.Unstructured, error) {
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert %s: %w", obj.GetObjectKind().GroupVersionKind().Kind, err)
+	}
+	return &unstructured.Unstructured{Object: content}, nil
+}
@@ -0,0 +1,417 @@
+package cluster
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+
+	"github.com/yashirook/kube-vap-test/internal/engine"
+	kaptestv1 "github.com/yashirook/kube-vap-test/pkg/apis/admission/v1"
+)
+
+var (
+	podResource        = corev1.SchemeGroupVersion.WithResource("pods")
+	deploymentResource = appsv1.SchemeGroupVersion.WithResource("deployments")
+)
+
+// fakeCluster is a fake apiserver whose admission denies pods using the latest image tag
+// The fake dynamic client drops request options, so dry-run requests are intercepted before it
+type fakeCluster struct {
+	client *dynamicfake.FakeDynamicClient
+	// dryRuns records the operations of dry-run requests
+	dryRuns []string
+}
+
+func newFakeCluster(t *testing.T, objects ...runtime.Object) *fakeCluster {
+	t.Helper()
+	scheme := runtime.NewScheme()
+	require.NoError(t, clientgoscheme.AddToScheme(scheme))
+
+	namespace := &unstructured.Unstructured{}
+	namespace.SetGroupVersionKind(corev1.SchemeGroupVersion.WithKind("Namespace"))
+	namespace.SetName(metav1.NamespaceDefault)
+	objects = append(objects, namespace)
+
+	return &fakeCluster{client: dynamicfake.NewSimpleDynamicClient(scheme, objects...)}
+}
+
+func (c *fakeCluster) Resource(resource schema.GroupVersionResource) dynamic.NamespaceableResourceInterface {
+	client := c.client.Resource(resource)
+	return &fakeResource{ResourceInterface: client, namespaceable: client, cluster: c}
+}
+
+// fakeResource passes requests to the fake dynamic client, except dry-run requests
+type fakeResource struct {
+	dynamic.ResourceInterface
+	namespaceable dynamic.NamespaceableResourceInterface
+	cluster       *fakeCluster
+}
+
+func (r *fakeResource) Namespace(namespace string) dynamic.ResourceInterface {
+	return &fakeResource{ResourceInterface: r.namespaceable.Namespace(namespace), namespaceable: r.namespaceable, cluster: r.cluster}
+}
+
+func (r *fakeResource) Create(ctx context.Context, obj *unstructured.Unstructured, options metav1.CreateOptions, subresources ...string) (*unstructured.Unstructured, error) {
+	if len(options.DryRun) > 0 {
+		return r.cluster.admit("CREATE", options.DryRun, obj)
+	}
+	return r.ResourceInterface.Create(ctx, obj, options, subresources...)
+}
+
+func (r *fakeResource) Update(ctx context.Context, obj *unstructured.Unstructured, options metav1.UpdateOptions, subresources ...string) (*unstructured.Unstructured, error) {
+	if len(options.DryRun) > 0 {
+		return r.cluster.admit("UPDATE", options.DryRun, obj)
+	}
+	return r.ResourceInterface.Update(ctx, obj, options, subresources...)
+}
+
+func (r *fakeResource) Delete(ctx context.Context, name string, options metav1.DeleteOptions, subresources ...string) error {
+	if len(options.DryRun) > 0 {
+		_, err := r.cluster.admit("DELETE", options.DryRun, nil)
+		return err
+	}
+	return r.ResourceInterface.Delete(ctx, name, options, subresources...)
+}
+
+// admit emulates the admission of a dry-run request
+func (c *fakeCluster) admit(operation string, dryRun []string, obj *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+	c.dryRuns = append(c.dryRuns, operation+":"+strings.Join(dryRun, ","))
+	if obj == nil || obj.GetKind() != "Pod" {
+		return obj, nil
+	}
+
+	containers, _, _ := unstructured.NestedSlice(obj.Object, "spec", "containers")
+	for _, container := range containers {
+		image, _, _ := unstructured.NestedString(container.(map[string]interface{}), "image")
+		if strings.HasSuffix(image, ":latest") {
+			return nil, &apierrors.StatusError{ErrStatus: metav1.Status{
+				Status: metav1.StatusFailure,
+				Code:   422,
+				Reason: metav1.StatusReasonInvalid,
+				Message: fmt.Sprintf("pods %q is forbidden: ValidatingAdmissionPolicy 'no-latest' with binding 'no-latest' denied request: %s",
+					obj.GetName(), "latest tag is not allowed"),
+			}}
+		}
+	}
+	return obj, nil
+}
+
+func newRESTMapper() meta.RESTMapper {
+	restMapper := meta.NewDefaultRESTMapper(nil)
+	restMapper.Add(corev1.SchemeGroupVersion.WithKind("Pod"), meta.RESTScopeNamespace)
+	restMapper.Add(corev1.SchemeGroupVersion.WithKind("ConfigMap"), meta.RESTScopeNamespace)
+	restMapper.Add(corev1.SchemeGroupVersion.WithKind("Namespace"), meta.RESTScopeRoot)
+	restMapper.Add(appsv1.SchemeGroupVersion.WithKind("Deployment"), meta.RESTScopeNamespace)
+	return restMapper
+}
+
+func newEngine(cluster *fakeCluster) *Engine {
+	e := NewEngine(cluster, newRESTMapper())
+	e.SetSettleTime(0)
+	return e
+}
+
+func newPolicy(name string) *admissionregistrationv1.ValidatingAdmissionPolicy {
+	return &admissionregistrationv1.ValidatingAdmissionPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec: admissionregistrationv1.ValidatingAdmissionPolicySpec{
+			Validations: []admissionregistrationv1.Validation{
+				{
+					Expression: "!object.spec.containers.exists(c, c.image.endsWith(':latest'))",
+					Message:    "latest tag is not allowed",
+				},
+			},
+		},
+	}
+}
+
+func newPod(name, namespace, image string) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Pod",
+		"metadata":   map[string]interface{}{"name": name, "namespace": namespace},
+		"spec": map[string]interface{}{
+			"containers": []interface{}{map[string]interface{}{"name": "app", "image": image}},
+		},
+	}}
+}
+
+func TestEngineEvaluate(t *testing.T) {
+	ctx := context.Background()
+	cluster := newFakeCluster(t)
+	e := newEngine(cluster)
+	policies := []*admissionregistrationv1.ValidatingAdmissionPolicy{newPolicy("no-latest")}
+
+	response, err := e.Evaluate(ctx, &engine.EvaluationRequest{
+		Policies:  policies,
+		Object:    newPod("tagged", "verify", "nginx:1.25"),
+		Operation: "CREATE",
+	})
+	require.NoError(t, err)
+	assert.True(t, response.Allowed)
+
+	response, err = e.Evaluate(ctx, &engine.EvaluationRequest{
+		Policies:  policies,
+		Object:    newPod("latest", "verify", "nginx:latest"),
+		Operation: "CREATE",
+	})
+	require.NoError(t, err)
+	assert.False(t, response.Allowed)
+	assert.Equal(t, string(metav1.StatusReasonInvalid), response.Reason)
+	require.Len(t, response.PolicyResults, 1)
+	assert.Equal(t, "no-latest", response.PolicyResults[0].PolicyName)
+	assert.Equal(t, "latest tag is not allowed", response.PolicyResults[0].Message)
+	assert.Equal(t, []string{"CREATE:All", "CREATE:All"}, cluster.dryRuns)
+
+	// The policy, a binding for it and the request namespace are applied once and labeled
+	policy, err := cluster.client.Resource(policyResource).Get(ctx, "no-latest", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, ManagedByValue, policy.GetLabels()[ManagedByLabel])
+	binding, err := cluster.client.Resource(bindingResource).Get(ctx, "no-latest", metav1.GetOptions{})
+	require.NoError(t, err)
+	policyName, _, _ := unstructured.NestedString(binding.Object, "spec", "policyName")
+	assert.Equal(t, "no-latest", policyName)
+	_, err = cluster.client.Resource(namespaceResource).Get(ctx, "verify", metav1.GetOptions{})
+	require.NoError(t, err)
+
+	// Dry-run requests do not create pods
+	pods, err := cluster.client.Resource(podResource).Namespace("verify").List(ctx, metav1.ListOptions{})
+	require.NoError(t, err)
+	assert.Empty(t, pods.Items)
+
+	// Close deletes the created objects only
+	require.NoError(t, e.Close(ctx))
+	_, err = cluster.client.Resource(policyResource).Get(ctx, "no-latest", metav1.GetOptions{})
+	assert.True(t, apierrors.IsNotFound(err))
+	_, err = cluster.client.Resource(bindingResource).Get(ctx, "no-latest", metav1.GetOptions{})
+	assert.True(t, apierrors.IsNotFound(err))
+	_, err = cluster.client.Resource(namespaceResource).Get(ctx, "verify", metav1.GetOptions{})
+	assert.True(t, apierrors.IsNotFound(err))
+	_, err = cluster.client.Resource(namespaceResource).Get(ctx, metav1.NamespaceDefault, metav1.GetOptions{})
+	assert.NoError(t, err)
+}
+
+func TestEngineUpdateAndDelete(t *testing.T) {
+	ctx := context.Background()
+	existing := newPod("app", "default", "nginx:1.25")
+	cluster := newFakeCluster(t, existing)
+	e := newEngine(cluster)
+	policies := []*admissionregistrationv1.ValidatingAdmissionPolicy{newPolicy("no-latest")}
+
+	response, err := e.Evaluate(ctx, &engine.EvaluationRequest{
+		Policies:  policies,
+		Object:    newPod("app", "default", "nginx:latest"),
+		OldObject: newPod("app", "default", "nginx:1.25"),
+		Operation: "UPDATE",
+	})
+	require.NoError(t, err)
+	assert.False(t, response.Allowed)
+
+	response, err = e.Evaluate(ctx, &engine.EvaluationRequest{
+		Policies:  policies,
+		OldObject: newPod("app", "default", "nginx:1.25"),
+		Operation: "DELETE",
+	})
+	require.NoError(t, err)
+	assert.True(t, response.Allowed)
+	assert.Equal(t, []string{"UPDATE:All", "DELETE:All"}, cluster.dryRuns)
+
+	// Existing objects are not modified or deleted
+	require.NoError(t, e.Close(ctx))
+	pod, err := cluster.client.Resource(podResource).Namespace("default").Get(ctx, "app", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Empty(t, pod.GetLabels())
+}
+
+func TestEngineCreatesExistingObjects(t *testing.T) {
+	ctx := context.Background()
+	cluster := newFakeCluster(t)
+	e := newEngine(cluster)
+	policies := []*admissionregistrationv1.ValidatingAdmissionPolicy{newPolicy("no-latest")}
+
+	deployment := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "apps/v1",
+		"kind":       "Deployment",
+		"metadata":   map[string]interface{}{"name": "web", "namespace": "default"},
+		"spec":       map[string]interface{}{"replicas": int64(3)},
+	}}
+	updated := deployment.DeepCopy()
+	require.NoError(t, unstructured.SetNestedField(updated.Object, int64(5), "spec", "replicas"))
+
+	response, err := e.Evaluate(ctx, &engine.EvaluationRequest{
+		Policies:  policies,
+		Object:    updated,
+		OldObject: deployment,
+		Operation: "UPDATE",
+	})
+	require.NoError(t, err)
+	assert.True(t, response.Allowed)
+
+	// The old deployment is created without replicas, before the policy
+	created, err := cluster.client.Resource(deploymentResource).Namespace("default").Get(ctx, "web", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, ManagedByValue, created.GetLabels()[ManagedByLabel])
+	replicas, _, _ := unstructured.NestedInt64(created.Object, "spec", "replicas")
+	assert.Equal(t, int64(0), replicas)
+	var creates []string
+	for _, action := range cluster.client.Actions() {
+		if action.GetVerb() == "create" {
+			creates = append(creates, action.GetResource().Resource)
+		}
+	}
+	assert.Equal(t, []string{"deployments", "validatingadmissionpolicies", "validatingadmissionpolicybindings"}, creates)
+
+	// The policy never matches the objects created by the engine
+	policy, err := cluster.client.Resource(policyResource).Get(ctx, "no-latest", metav1.GetOptions{})
+	require.NoError(t, err)
+	conditions, _, _ := unstructured.NestedSlice(policy.Object, "spec", "matchConditions")
+	require.Len(t, conditions, 1)
+	assert.Equal(t, excludeManagedObjects.Name, conditions[0].(map[string]interface{})["name"])
+
+	// Pods are never created, since they would run
+	_, err = e.Evaluate(ctx, &engine.EvaluationRequest{
+		Policies:  policies,
+		OldObject: newPod("app", "default", "nginx:1.25"),
+		Operation: "DELETE",
+	})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "Pod default/app does not exist in the cluster")
+	_, err = cluster.client.Resource(podResource).Namespace("default").Get(ctx, "app", metav1.GetOptions{})
+	assert.True(t, apierrors.IsNotFound(err))
+
+	require.NoError(t, e.Close(ctx))
+	_, err = cluster.client.Resource(deploymentResource).Namespace("default").Get(ctx, "web", metav1.GetOptions{})
+	assert.True(t, apierrors.IsNotFound(err))
+}
+
+func TestEngineParam(t *testing.T) {
+	ctx := context.Background()
+	cluster := newFakeCluster(t)
+	e := newEngine(cluster)
+
+	policy := newPolicy("no-latest")
+	policy.Spec.ParamKind = &admissionregistrationv1.ParamKind{APIVersion: "v1", Kind: "ConfigMap"}
+	param := &corev1.ConfigMap{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "ConfigMap"},
+		ObjectMeta: metav1.ObjectMeta{Name: "settings", Namespace: "params"},
+	}
+
+	_, err := e.Evaluate(ctx, &engine.EvaluationRequest{
+		Policies:  []*admissionregistrationv1.ValidatingAdmissionPolicy{policy},
+		ParamObj:  param,
+		Object:    newPod("app", "default", "nginx:1.25"),
+		Operation: "CREATE",
+	})
+	require.NoError(t, err)
+
+	_, err = cluster.client.Resource(corev1.SchemeGroupVersion.WithResource("configmaps")).Namespace("params").Get(ctx, "settings", metav1.GetOptions{})
+	require.NoError(t, err)
+	binding, err := cluster.client.Resource(bindingResource).Get(ctx, "no-latest", metav1.GetOptions{})
+	require.NoError(t, err)
+	paramName, _, _ := unstructured.NestedString(binding.Object, "spec", "paramRef", "name")
+	assert.Equal(t, "settings", paramName)
+
+	require.NoError(t, e.Close(ctx))
+}
+
+func TestEngineUnmanagedPolicy(t *testing.T) {
+	existing := &unstructured.Unstructured{}
+	existing.SetGroupVersionKind(admissionregistrationv1.SchemeGroupVersion.WithKind("ValidatingAdmissionPolicy"))
+	existing.SetName("no-latest")
+
+	cluster := newFakeCluster(t, existing)
+	e := newEngine(cluster)
+
+	_, err := e.Evaluate(context.Background(), &engine.EvaluationRequest{
+		Policies:  []*admissionregistrationv1.ValidatingAdmissionPolicy{newPolicy("no-latest")},
+		Object:    newPod("app", "default", "nginx:1.25"),
+		Operation: "CREATE",
+	})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "not managed by kube-vap-test")
+}
+
+func TestVerifySimulation(t *testing.T) {
+	cluster := newFakeCluster(t)
+	simulator, err := engine.NewPolicySimulator()
+	require.NoError(t, err)
+	simulator.SetDifferentialEngine(newEngine(cluster))
+
+	// The native engine evaluates the policy on every kind, the fake apiserver on pods only
+	policy := newPolicy("no-latest")
+	policy.Spec.Validations[0].Expression = "!has(object.spec.containers) || !object.spec.containers.exists(c, c.image.endsWith(':latest'))"
+	latestPod := newPod("latest", "default", "nginx:latest")
+	latestConfigMap := newPod("latest", "default", "nginx:latest")
+	latestConfigMap.SetKind("ConfigMap")
+
+	testCases := []kaptestv1.TestCase{
+		{
+			Name:      "latest-pod",
+			Object:    runtime.RawExtension{Object: latestPod},
+			Operation: "CREATE",
+			Expected:  kaptestv1.ExpectedResult{Allowed: false},
+		},
+		{
+			Name:      "latest-configmap",
+			Object:    runtime.RawExtension{Object: latestConfigMap},
+			Operation: "CREATE",
+			Expected:  kaptestv1.ExpectedResult{Allowed: false},
+		},
+	}
+
+	status, err := simulator.RunPolicyTestsWithMultiPolicies(context.Background(), []*admissionregistrationv1.ValidatingAdmissionPolicy{policy}, nil, testCases)
+	require.NoError(t, err)
+
+	require.NotNil(t, status.Results[0].Differential)
+	assert.True(t, status.Results[0].Differential.Agree)
+	assert.True(t, status.Results[0].Success, status.Results[0].Details)
+
+	require.NotNil(t, status.Results[1].Differential)
+	assert.Equal(t, engine.EngineCluster, status.Results[1].Differential.Engine)
+	assert.False(t, status.Results[1].Differential.Agree)
+	assert.True(t, status.Results[1].Differential.Allowed)
+	assert.False(t, status.Results[1].Success)
+}
+
+func TestVerifySimulationError(t *testing.T) {
+	existing := &unstructured.Unstructured{}
+	existing.SetGroupVersionKind(admissionregistrationv1.SchemeGroupVersion.WithKind("ValidatingAdmissionPolicy"))
+	existing.SetName("no-latest")
+
+	simulator, err := engine.NewPolicySimulator()
+	require.NoError(t, err)
+	simulator.SetDifferentialEngine(newEngine(newFakeCluster(t, existing)))
+
+	// Errors of the cluster fail the test case only
+	testCases := []kaptestv1.TestCase{
+		{
+			Name:      "tagged-pod",
+			Object:    runtime.RawExtension{Object: newPod("tagged", "default", "nginx:1.25")},
+			Operation: "CREATE",
+			Expected:  kaptestv1.ExpectedResult{Allowed: true},
+		},
+	}
+	status, err := simulator.RunPolicyTestsWithMultiPolicies(context.Background(), []*admissionregistrationv1.ValidatingAdmissionPolicy{newPolicy("no-latest")}, nil, testCases)
+	require.NoError(t, err)
+
+	require.NotNil(t, status.Results[0].Differential)
+	assert.Contains(t, status.Results[0].Differential.Error, "not managed by kube-vap-test")
+	assert.False(t, status.Results[0].Success)
+	assert.Contains(t, status.Results[0].Details, "cluster engine failed")
+}
@@ -0,0 +1,69 @@
+// Package defaulting applies the API defaults of built-in types to objects, as the apiserver does
+// when it decodes a request, before admission
+// The defaulting functions are those the apiserver registers (k8s.io/kubernetes/pkg/apis/*/v1), at
+// the Kubernetes version of the k8s.io/api module. The tests compare them with responses of an
+// apiserver of that version in testdata, which scripts/update-defaulting-fixtures.sh regenerates
+// when the Kubernetes version is upgraded
+package defaulting
+
+import (
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+)
+
+// Defaulter applies Kubernetes API defaults to objects before evaluation
+// Objects are converted to their typed form, defaulted through the scheme and
+// converted back, so the result has the shape the apiserver passes to admission
+type Defaulter struct {
+	scheme *runtime.Scheme
+}
+
+// NewDefaulter creates a Defaulter with defaulting functions for built-in types
+func NewDefaulter() (*Defaulter, error) {
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		return nil, fmt.Errorf("failed to add built-in types to scheme: %w", err)
+	}
+	if err := RegisterDefaults(scheme); err != nil {
+		return nil, fmt.Errorf("failed to register defaulting functions: %w", err)
+	}
+
+	return &Defaulter{scheme: scheme}, nil
+}
+
+// Recognizes returns true if the object's kind is a known built-in type
+func (d *Defaulter) Recognizes(obj *unstructured.Unstructured) bool {
+	return d.scheme.Recognizes(obj.GroupVersionKind())
+}
+
+// Default returns a defaulted copy of the object
+// Objects of unknown kinds (such as custom resources) are returned unchanged
+func (d *Defaulter) Default(obj *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+	if obj == nil || !d.Recognizes(obj) {
+		return obj, nil
+	}
+
+	gvk := obj.GroupVersionKind()
+	typed, err := d.scheme.New(gvk)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s: %w", gvk, err)
+	}
+
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.UnstructuredContent(), typed); err != nil {
+		return nil, fmt.Errorf("failed to convert %s to typed object: %w", gvk.Kind, err)
+	}
+
+	d.scheme.Default(typed)
+
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(typed)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert %s to unstructured: %w", gvk.Kind, err)
+	}
+
+	defaulted := &unstructured.Unstructured{Object: content}
+	defaulted.SetGroupVersionKind(gvk)
+	return defaulted, nil
+}
@@ -0,0 +1,41 @@
+package defaulting
+
+import (
+	"k8s.io/apimachinery/pkg/runtime"
+	admissionregistrationv1 "k8s.io/kubernetes/pkg/apis/admissionregistration/v1"
+	appsv1 "k8s.io/kubernetes/pkg/apis/apps/v1"
+	autoscalingv1 "k8s.io/kubernetes/pkg/apis/autoscaling/v1"
+	autoscalingv2 "k8s.io/kubernetes/pkg/apis/autoscaling/v2"
+	batchv1 "k8s.io/kubernetes/pkg/apis/batch/v1"
+	corev1 "k8s.io/kubernetes/pkg/apis/core/v1"
+	discoveryv1 "k8s.io/kubernetes/pkg/apis/discovery/v1"
+	networkingv1 "k8s.io/kubernetes/pkg/apis/networking/v1"
+	policyv1 "k8s.io/kubernetes/pkg/apis/policy/v1"
+	rbacv1 "k8s.io/kubernetes/pkg/apis/rbac/v1"
+	schedulingv1 "k8s.io/kubernetes/pkg/apis/scheduling/v1"
+	storagev1 "k8s.io/kubernetes/pkg/apis/storage/v1"
+)
+
+// RegisterDefaults registers the defaulting functions of the apiserver for the built-in types of
+// the GA API groups with the scheme
+func RegisterDefaults(scheme *runtime.Scheme) error {
+	for _, register := range []func(*runtime.Scheme) error{
+		admissionregistrationv1.RegisterDefaults,
+		appsv1.RegisterDefaults,
+		autoscalingv1.RegisterDefaults,
+		autoscalingv2.RegisterDefaults,
+		batchv1.RegisterDefaults,
+		corev1.RegisterDefaults,
+		discoveryv1.RegisterDefaults,
+		networkingv1.RegisterDefaults,
+		policyv1.RegisterDefaults,
+		rbacv1.RegisterDefaults,
+		schedulingv1.RegisterDefaults,
+		storagev1.RegisterDefaults,
+	} {
+		if err := register(scheme); err != nil {
+			return err
+		}
+	}
+	return nil
+}
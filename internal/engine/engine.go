@@ -0,0 +1,242 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"github.com/yashirook/kube-vap-test/internal/engine/admission"
+	"github.com/yashirook/kube-vap-test/internal/engine/selector"
+	kaptestv1 "github.com/yashirook/kube-vap-test/pkg/apis/admission/v1"
+)
+
+const (
+	// EngineNative is the built-in CEL evaluation engine
+	EngineNative = "native"
+	// EngineUpstream is the engine driving the apiserver ValidatingAdmissionPolicy plugin
+	EngineUpstream = "upstream"
+	// EngineCluster is the apiserver of a live cluster, reached through server-side dry-run requests
+	EngineCluster = "cluster"
+)
+
+// Engine evaluates an admission request against ValidatingAdmissionPolicies
+type Engine interface {
+	// Name returns the engine name
+	Name() string
+	// Evaluate returns the admission verdict for the request
+	Evaluate(ctx context.Context, request *EvaluationRequest) (*EvaluationResponse, error)
+}
+
+// EvaluationRequest is an admission request with the policies it is evaluated against
+type EvaluationRequest struct {
+	// Policies are the policies to evaluate
+	Policies []*admissionregistrationv1.ValidatingAdmissionPolicy
+	// Bindings select the policies that apply to the object
+	// Policies without bindings are evaluated against every object
+	Bindings []*admissionregistrationv1.ValidatingAdmissionPolicyBinding
+	// ParamObj is the parameter object of parameterized policies
+	ParamObj runtime.Object
+	// Object is the object after admission mutation (nil for DELETE)
+	Object *unstructured.Unstructured
+	// OldObject is the existing object for UPDATE and DELETE
+	OldObject *unstructured.Unstructured
+	// Operation is the admission operation (CREATE, UPDATE, DELETE, CONNECT)
+	Operation string
+	// Params are the parameter objects the paramRef of bindings select from, used when
+	// ParamObj is not set
+	Params []*unstructured.Unstructured
+	// Namespaces are the namespaces whose labels namespace selectors match
+	// Namespaces not listed only have the kubernetes.io/metadata.name label
+	Namespaces []*corev1.Namespace
+}
+
+// EvaluationResponse is the admission verdict of an engine
+type EvaluationResponse struct {
+	// Allowed indicates whether the request was admitted
+	Allowed bool
+	// Reason is the reason of the first denial
+	Reason string
+	// Message describes the denials
+	Message string
+	// PolicyResults are the results of the evaluated policies
+	PolicyResults []kaptestv1.PolicyResult
+	// ExpressionErrors are the CEL errors of the policy expressions
+	ExpressionErrors []kaptestv1.ExpressionError
+}
+
+// nativeEngine evaluates policies with the built-in CEL validator
+type nativeEngine struct {
+	validator *PolicyValidator
+}
+
+// newNativeEngine creates the built-in engine using the given validator
+func newNativeEngine(validator *PolicyValidator) *nativeEngine {
+	return &nativeEngine{validator: validator}
+}
+
+// Name returns the engine name
+func (e *nativeEngine) Name() string {
+	return EngineNative
+}
+
+// Evaluate evaluates each policy once per parameter of the matching bindings with a Deny action
+// The first denial of a policy is its result
+func (e *nativeEngine) Evaluate(ctx context.Context, request *EvaluationRequest) (*EvaluationResponse, error) {
+	response := &EvaluationResponse{
+		Allowed:       true,
+		PolicyResults: make([]kaptestv1.PolicyResult, 0, len(request.Policies)),
+	}
+
+	// Create policy and binding mapping
+	policyBindings := make(map[string][]*admissionregistrationv1.ValidatingAdmissionPolicyBinding)
+	for _, binding := range request.Bindings {
+		policyName := binding.Spec.PolicyName
+		policyBindings[policyName] = append(policyBindings[policyName], binding)
+	}
+	namespaceLabels := request.namespaceLabels()
+
+	// Evaluate each policy
+	for _, policy := range request.Policies {
+		// Policies only intercept the requests of their match constraints
+		if !matchesConstraints(policy, request, namespaceLabels) {
+			continue
+		}
+		relatedBindings := policyBindings[policy.Name]
+
+		// If no bindings, evaluate policy directly
+		var matched []*admissionregistrationv1.ValidatingAdmissionPolicyBinding
+		for _, binding := range relatedBindings {
+			// Only bindings denying on failure are evaluated
+			if matchesBinding(binding, request.Object, request.Operation, namespaceLabels) && shouldValidate(binding.Spec.ValidationActions) {
+				matched = append(matched, binding)
+			}
+		}
+		if len(relatedBindings) > 0 && len(matched) == 0 {
+			continue
+		}
+
+		params, policyResult := request.policyParams(policy, matched)
+		if policyResult == nil {
+			var err error
+			policyResult, err = e.evaluatePolicy(ctx, policy, params, request, response)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if policyResult == nil {
+			// Every binding allows missing parameters
+			continue
+		}
+		response.PolicyResults = append(response.PolicyResults, *policyResult)
+
+		// If any policy denies, overall deny
+		if !policyResult.Allowed {
+			response.Allowed = false
+			if response.Reason == "" {
+				response.Reason = policyResult.Reason
+			}
+			if response.Message == "" {
+				response.Message = policyResult.Message
+			} else {
+				response.Message = fmt.Sprintf("%s; %s", response.Message, policyResult.Message)
+			}
+		}
+	}
+
+	return response, nil
+}
+
+// evaluatePolicy evaluates the policy with each parameter, stopping at the first denial
+// It returns nil when there are no parameters to evaluate the policy with
+func (e *nativeEngine) evaluatePolicy(ctx context.Context, policy *admissionregistrationv1.ValidatingAdmissionPolicy, params []runtime.Object, request *EvaluationRequest, response *EvaluationResponse) (*kaptestv1.PolicyResult, error) {
+	var policyResult *kaptestv1.PolicyResult
+	for _, param := range params {
+		// Create evaluation context
+		if err := e.validator.SetupEvaluationContext(request.Object, request.OldObject, param, request.Operation); err != nil {
+			return nil, fmt.Errorf("failed to set up evaluation context: %w", err)
+		}
+
+		validationResult := e.validator.ValidatePolicy(ctx, policy, true)
+		policyResult = &kaptestv1.PolicyResult{
+			PolicyName: policy.Name,
+			Allowed:    validationResult.IsAllowed(),
+			Reason:     validationResult.GetReason(),
+			Message:    validationResult.GetMessage(),
+		}
+		for _, violation := range validationResult.GetViolations() {
+			policyResult.Violations = append(policyResult.Violations, kaptestv1.PolicyViolation{
+				Field:           violation.Field,
+				Reason:          violation.Reason,
+				Message:         violation.Message,
+				EvaluationError: violation.EvaluationError,
+			})
+			if violation.Error != nil {
+				response.ExpressionErrors = append(response.ExpressionErrors, *violation.Error)
+			}
+		}
+		if !policyResult.Allowed {
+			break
+		}
+	}
+	return policyResult, nil
+}
+
+// matchesBinding checks if a binding matches the object
+// Namespace selectors match the labels of the object's namespace when they are known
+func matchesBinding(
+	binding *admissionregistrationv1.ValidatingAdmissionPolicyBinding,
+	obj *unstructured.Unstructured,
+	operation string,
+	namespaceLabels map[string]string,
+) bool {
+	if binding.Spec.MatchResources == nil {
+		return true
+	}
+
+	target := admission.NewAdmissionTarget(obj, operation)
+	target.NamespaceLabels = namespaceLabels
+	return selector.Matches(binding.Spec.MatchResources, target)
+}
+
+// matchesConstraints checks if the request is one of the policy's match constraints
+// Resource rules match the resource of the object kind, and selectors the old object of DELETE requests
+func matchesConstraints(policy *admissionregistrationv1.ValidatingAdmissionPolicy, request *EvaluationRequest, namespaceLabels map[string]string) bool {
+	if policy.Spec.MatchConstraints == nil {
+		return true
+	}
+
+	obj := request.Object
+	if obj == nil {
+		obj = request.OldObject
+	}
+	target := admission.NewAdmissionTarget(obj, request.Operation)
+	target.NamespaceLabels = namespaceLabels
+	if obj != nil {
+		resource, _ := meta.UnsafeGuessKindToResource(obj.GroupVersionKind())
+		target.Resource = resource.Resource
+	}
+	return selector.Matches(policy.Spec.MatchConstraints, target)
+}
+
+// shouldValidate checks if validation should be performed based on validation actions
+func shouldValidate(actions []admissionregistrationv1.ValidationAction) bool {
+	// If no actions specified, default to Deny
+	if len(actions) == 0 {
+		return true
+	}
+
+	// Check if Deny action is present
+	for _, action := range actions {
+		if action == admissionregistrationv1.Deny {
+			return true
+		}
+	}
+
+	// Only Warn or Audit actions, skip validation
+	return false
+}
@@ -0,0 +1,124 @@
+package engine
+
+import (
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	kaptestv1 "github.com/yashirook/kube-vap-test/pkg/apis/admission/v1"
+)
+
+// paramNotFoundMessage is the message of the apiserver for bindings without parameters
+const paramNotFoundMessage = "failed to configure binding: no params found for policy binding with `Deny` parameterNotFoundAction"
+
+// policyParams returns the parameters a policy is evaluated with through the matching bindings
+// The parameter of the request is used when it is set, or when no binding selects parameters
+// with a paramRef. Otherwise the parameters of the paramKind of the policy selected by the
+// paramRef of each binding are used, and a binding denying missing parameters that selects
+// none returns the denial of the policy, unless its failurePolicy is Ignore
+func (r *EvaluationRequest) policyParams(policy *admissionregistrationv1.ValidatingAdmissionPolicy, bindings []*admissionregistrationv1.ValidatingAdmissionPolicyBinding) ([]runtime.Object, *kaptestv1.PolicyResult) {
+	if r.ParamObj != nil || policy.Spec.ParamKind == nil {
+		return []runtime.Object{r.ParamObj}, nil
+	}
+
+	var params []runtime.Object
+	selected := make(map[*unstructured.Unstructured]bool)
+	referenced := false
+	for _, binding := range bindings {
+		paramRef := binding.Spec.ParamRef
+		if paramRef == nil {
+			continue
+		}
+		referenced = true
+
+		found := false
+		for _, param := range r.Params {
+			if !r.selectsParam(policy.Spec.ParamKind, paramRef, param) {
+				continue
+			}
+			found = true
+			if !selected[param] {
+				selected[param] = true
+				params = append(params, param)
+			}
+		}
+
+		if !found && paramRef.ParameterNotFoundAction != nil && *paramRef.ParameterNotFoundAction == admissionregistrationv1.DenyAction {
+			if policy.Spec.FailurePolicy != nil && *policy.Spec.FailurePolicy == admissionregistrationv1.Ignore {
+				continue
+			}
+			return nil, &kaptestv1.PolicyResult{
+				PolicyName: policy.Name,
+				Allowed:    false,
+				Reason:     string(metav1.StatusReasonInvalid),
+				Message:    paramNotFoundMessage,
+			}
+		}
+	}
+
+	if !referenced {
+		return []runtime.Object{nil}, nil
+	}
+	return params, nil
+}
+
+// selectsParam reports whether a paramRef selects an object of the paramKind
+// Parameters are looked up in the namespace of the paramRef, or in the namespace of the
+// object for namespaced parameters when the paramRef has none
+func (r *EvaluationRequest) selectsParam(paramKind *admissionregistrationv1.ParamKind, paramRef *admissionregistrationv1.ParamRef, param *unstructured.Unstructured) bool {
+	if param.GetAPIVersion() != paramKind.APIVersion || param.GetKind() != paramKind.Kind {
+		return false
+	}
+
+	namespace := param.GetNamespace()
+	switch {
+	case paramRef.Namespace != "":
+		if namespace != paramRef.Namespace {
+			return false
+		}
+	case namespace != "":
+		if r.Object == nil || namespace != r.Object.GetNamespace() {
+			return false
+		}
+	}
+
+	if paramRef.Name != "" {
+		return param.GetName() == paramRef.Name
+	}
+	if paramRef.Selector == nil {
+		return false
+	}
+	selector, err := metav1.LabelSelectorAsSelector(paramRef.Selector)
+	if err != nil {
+		return false
+	}
+	return selector.Matches(labels.Set(param.GetLabels()))
+}
+
+// namespaceLabels returns the labels of the namespace of the object
+// It returns nil when the request holds no namespaces or the object is not namespaced
+func (r *EvaluationRequest) namespaceLabels() map[string]string {
+	obj := r.Object
+	if obj == nil {
+		obj = r.OldObject
+	}
+	if len(r.Namespaces) == 0 || obj == nil || obj.GetNamespace() == "" {
+		return nil
+	}
+
+	// The apiserver labels every namespace with its name
+	name := obj.GetNamespace()
+	namespaceLabels := map[string]string{corev1.LabelMetadataName: name}
+	for _, namespace := range r.Namespaces {
+		if namespace.Name == name {
+			for key, value := range namespace.Labels {
+				namespaceLabels[key] = value
+			}
+			break
+		}
+	}
+	return namespaceLabels
+}
@@ -0,0 +1,75 @@
+package plugins
+
+import (
+	"sort"
+
+	storagev1 "k8s.io/api/storage/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const (
+	// isDefaultStorageClassAnnotation marks the cluster default StorageClass
+	isDefaultStorageClassAnnotation = "storageclass.kubernetes.io/is-default-class"
+	// betaIsDefaultStorageClassAnnotation is the deprecated beta form of the annotation
+	betaIsDefaultStorageClassAnnotation = "storageclass.beta.kubernetes.io/is-default-class"
+)
+
+// defaultStorageClassPlugin emulates the DefaultStorageClass admission plugin
+type defaultStorageClassPlugin struct {
+	fixtures *Fixtures
+}
+
+// Name returns the plugin name
+func (p *defaultStorageClassPlugin) Name() string {
+	return DefaultStorageClass
+}
+
+// Admit sets spec.storageClassName on claims that do not specify one
+// An explicit empty string requests no class and is left unchanged
+func (p *defaultStorageClassPlugin) Admit(obj *unstructured.Unstructured, operation string) error {
+	gvk := obj.GroupVersionKind()
+	if operation != "CREATE" || gvk.Group != "" || gvk.Kind != "PersistentVolumeClaim" {
+		return nil
+	}
+
+	spec, ok := obj.Object["spec"].(map[string]interface{})
+	if !ok {
+		spec = map[string]interface{}{}
+		obj.Object["spec"] = spec
+	}
+	if _, set := spec["storageClassName"]; set {
+		return nil
+	}
+
+	defaultClass := p.defaultClass()
+	if defaultClass == nil {
+		return nil
+	}
+	spec["storageClassName"] = defaultClass.Name
+
+	return nil
+}
+
+// defaultClass returns the default StorageClass, preferring the newest when several are marked
+func (p *defaultStorageClassPlugin) defaultClass() *storagev1.StorageClass {
+	var defaults []*storagev1.StorageClass
+	for _, class := range p.fixtures.StorageClasses {
+		if class.Annotations[isDefaultStorageClassAnnotation] == "true" ||
+			class.Annotations[betaIsDefaultStorageClassAnnotation] == "true" {
+			defaults = append(defaults, class)
+		}
+	}
+	if len(defaults) == 0 {
+		return nil
+	}
+
+	sort.Slice(defaults, func(i, j int) bool {
+		ti, tj := defaults[i].CreationTimestamp, defaults[j].CreationTimestamp
+		if !ti.Equal(&tj) {
+			return tj.Before(&ti)
+		}
+		return defaults[i].Name < defaults[j].Name
+	})
+
+	return defaults[0]
+}
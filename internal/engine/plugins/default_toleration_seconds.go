@@ -0,0 +1,76 @@
+package plugins
+
+import (
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const (
+	// taintNodeNotReady is the taint added to nodes that are not ready
+	taintNodeNotReady = "node.kubernetes.io/not-ready"
+	// taintNodeUnreachable is the taint added to unreachable nodes
+	taintNodeUnreachable = "node.kubernetes.io/unreachable"
+	// defaultTolerationSeconds matches the kube-apiserver flag defaults
+	defaultTolerationSeconds = int64(300)
+)
+
+// defaultTolerationSecondsPlugin emulates the DefaultTolerationSeconds admission plugin
+type defaultTolerationSecondsPlugin struct{}
+
+// Name returns the plugin name
+func (p *defaultTolerationSecondsPlugin) Name() string {
+	return DefaultTolerationSeconds
+}
+
+// Admit adds NoExecute tolerations for not-ready and unreachable nodes unless already tolerated
+func (p *defaultTolerationSecondsPlugin) Admit(obj *unstructured.Unstructured, operation string) error {
+	if (operation != "CREATE" && operation != "UPDATE") || !isPod(obj) {
+		return nil
+	}
+
+	spec, ok := obj.Object["spec"].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+
+	tolerations, _ := spec["tolerations"].([]interface{})
+	toleratesNotReady := toleratesNoExecute(tolerations, taintNodeNotReady)
+	toleratesUnreachable := toleratesNoExecute(tolerations, taintNodeUnreachable)
+
+	if !toleratesNotReady {
+		tolerations = append(tolerations, noExecuteToleration(taintNodeNotReady))
+	}
+	if !toleratesUnreachable {
+		tolerations = append(tolerations, noExecuteToleration(taintNodeUnreachable))
+	}
+	if !toleratesNotReady || !toleratesUnreachable {
+		spec["tolerations"] = tolerations
+	}
+
+	return nil
+}
+
+// toleratesNoExecute returns true if any toleration covers the NoExecute taint with the key
+func toleratesNoExecute(tolerations []interface{}, key string) bool {
+	for _, item := range tolerations {
+		toleration, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		tolerationKey, _ := toleration["key"].(string)
+		effect, _ := toleration["effect"].(string)
+		if (tolerationKey == key || tolerationKey == "") && (effect == "NoExecute" || effect == "") {
+			return true
+		}
+	}
+	return false
+}
+
+// noExecuteToleration builds the default toleration for the taint key
+func noExecuteToleration(key string) map[string]interface{} {
+	return map[string]interface{}{
+		"key":               key,
+		"operator":          "Exists",
+		"effect":            "NoExecute",
+		"tolerationSeconds": defaultTolerationSeconds,
+	}
+}
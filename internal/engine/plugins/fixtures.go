@@ -0,0 +1,99 @@
+package plugins
+
+import (
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// Fixtures holds the cluster objects that the emulated plugins read
+type Fixtures struct {
+	// LimitRanges used by LimitRanger
+	LimitRanges []*corev1.LimitRange
+	// StorageClasses used by DefaultStorageClass
+	StorageClasses []*storagev1.StorageClass
+	// ServiceAccounts used by ServiceAccount
+	ServiceAccounts []*corev1.ServiceAccount
+}
+
+// IsFixtureKind returns true if objects of the kind are consumed as plugin fixtures
+func IsFixtureKind(apiVersion, kind string) bool {
+	switch {
+	case apiVersion == "v1" && (kind == "LimitRange" || kind == "ServiceAccount"):
+		return true
+	case apiVersion == "storage.k8s.io/v1" && kind == "StorageClass":
+		return true
+	}
+	return false
+}
+
+// Add converts an object to its typed form and adds it to the fixtures
+// Objects of other kinds are ignored and false is returned
+func (f *Fixtures) Add(obj *unstructured.Unstructured) (bool, error) {
+	if !IsFixtureKind(obj.GetAPIVersion(), obj.GetKind()) {
+		return false, nil
+	}
+
+	switch obj.GetKind() {
+	case "LimitRange":
+		limitRange := &corev1.LimitRange{}
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.UnstructuredContent(), limitRange); err != nil {
+			return false, fmt.Errorf("failed to convert LimitRange %s: %w", obj.GetName(), err)
+		}
+		f.LimitRanges = append(f.LimitRanges, limitRange)
+	case "StorageClass":
+		storageClass := &storagev1.StorageClass{}
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.UnstructuredContent(), storageClass); err != nil {
+			return false, fmt.Errorf("failed to convert StorageClass %s: %w", obj.GetName(), err)
+		}
+		f.StorageClasses = append(f.StorageClasses, storageClass)
+	case "ServiceAccount":
+		serviceAccount := &corev1.ServiceAccount{}
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.UnstructuredContent(), serviceAccount); err != nil {
+			return false, fmt.Errorf("failed to convert ServiceAccount %s: %w", obj.GetName(), err)
+		}
+		f.ServiceAccounts = append(f.ServiceAccounts, serviceAccount)
+	}
+
+	return true, nil
+}
+
+// Len returns the total number of fixture objects
+func (f *Fixtures) Len() int {
+	if f == nil {
+		return 0
+	}
+	return len(f.LimitRanges) + len(f.StorageClasses) + len(f.ServiceAccounts)
+}
+
+// serviceAccount returns the named service account in the namespace, if present
+func (f *Fixtures) serviceAccount(namespace, name string) *corev1.ServiceAccount {
+	for _, sa := range f.ServiceAccounts {
+		if sa.Name == name && namespaceOrDefault(sa.Namespace) == namespaceOrDefault(namespace) {
+			return sa
+		}
+	}
+	return nil
+}
+
+// limitRangesFor returns the LimitRanges that apply to the namespace
+func (f *Fixtures) limitRangesFor(namespace string) []*corev1.LimitRange {
+	var result []*corev1.LimitRange
+	for _, lr := range f.LimitRanges {
+		if namespaceOrDefault(lr.Namespace) == namespaceOrDefault(namespace) {
+			result = append(result, lr)
+		}
+	}
+	return result
+}
+
+// namespaceOrDefault returns "default" for an empty namespace
+func namespaceOrDefault(namespace string) string {
+	if namespace == "" {
+		return "default"
+	}
+	return namespace
+}
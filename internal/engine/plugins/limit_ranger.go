@@ -0,0 +1,153 @@
+package plugins
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// limitRangerAnnotation records which defaults were applied to a pod
+const limitRangerAnnotation = "kubernetes.io/limit-ranger"
+
+// limitRangerPlugin emulates the LimitRanger admission plugin
+type limitRangerPlugin struct {
+	fixtures *Fixtures
+}
+
+// Name returns the plugin name
+func (p *limitRangerPlugin) Name() string {
+	return LimitRanger
+}
+
+// Admit applies Container-type LimitRange defaults to containers without requests or limits
+func (p *limitRangerPlugin) Admit(obj *unstructured.Unstructured, operation string) error {
+	if operation != "CREATE" || !isPod(obj) {
+		return nil
+	}
+
+	limitRanges := p.fixtures.limitRangesFor(obj.GetNamespace())
+	if len(limitRanges) == 0 {
+		return nil
+	}
+
+	spec, ok := obj.Object["spec"].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+
+	var annotations []string
+	for _, limitRange := range limitRanges {
+		for _, item := range limitRange.Spec.Limits {
+			if item.Type != corev1.LimitTypeContainer {
+				continue
+			}
+			defaultLimits, defaultRequests := containerDefaults(item)
+			for _, container := range podSpecContainers(spec) {
+				annotations = append(annotations, mergeContainerResources(container, defaultLimits, defaultRequests)...)
+			}
+		}
+	}
+
+	if len(annotations) > 0 {
+		podAnnotations := obj.GetAnnotations()
+		if podAnnotations == nil {
+			podAnnotations = map[string]string{}
+		}
+		podAnnotations[limitRangerAnnotation] = "LimitRanger plugin set: " + strings.Join(annotations, "; ")
+		obj.SetAnnotations(podAnnotations)
+	}
+
+	return nil
+}
+
+// containerDefaults resolves default limits and requests the way LimitRange defaulting does
+// Missing defaults fall back to max, and missing default requests fall back to the default or min
+func containerDefaults(item corev1.LimitRangeItem) (map[string]string, map[string]string) {
+	limits := make(map[string]string)
+	requests := make(map[string]string)
+
+	for name, quantity := range item.Default {
+		limits[string(name)] = quantity.String()
+	}
+	for name, quantity := range item.Max {
+		if _, ok := limits[string(name)]; !ok {
+			limits[string(name)] = quantity.String()
+		}
+	}
+
+	for name, quantity := range item.DefaultRequest {
+		requests[string(name)] = quantity.String()
+	}
+	for name, value := range limits {
+		if _, ok := requests[name]; !ok {
+			requests[name] = value
+		}
+	}
+	for name, quantity := range item.Min {
+		if _, ok := requests[string(name)]; !ok {
+			requests[string(name)] = quantity.String()
+		}
+	}
+
+	return limits, requests
+}
+
+// mergeContainerResources fills in missing container requests and limits
+// It returns the annotation fragments describing what was set
+func mergeContainerResources(container map[string]interface{}, defaultLimits, defaultRequests map[string]string) []string {
+	resources, _ := container["resources"].(map[string]interface{})
+	if resources == nil {
+		resources = map[string]interface{}{}
+	}
+	limits, _ := resources["limits"].(map[string]interface{})
+	requests, _ := resources["requests"].(map[string]interface{})
+
+	var setLimits, setRequests []string
+	for name, value := range defaultLimits {
+		if _, ok := limits[name]; ok {
+			continue
+		}
+		if limits == nil {
+			limits = map[string]interface{}{}
+		}
+		limits[name] = value
+		setLimits = append(setLimits, name)
+	}
+	for name, value := range defaultRequests {
+		if _, ok := requests[name]; ok {
+			continue
+		}
+		if requests == nil {
+			requests = map[string]interface{}{}
+		}
+		requests[name] = value
+		setRequests = append(setRequests, name)
+	}
+
+	if len(setLimits) == 0 && len(setRequests) == 0 {
+		return nil
+	}
+
+	if limits != nil {
+		resources["limits"] = limits
+	}
+	if requests != nil {
+		resources["requests"] = requests
+	}
+	container["resources"] = resources
+
+	name, _ := container["name"].(string)
+	var fragments []string
+	if len(setRequests) > 0 {
+		sort.Strings(setRequests)
+		fragments = append(fragments, fmt.Sprintf("%s request for container %s", strings.Join(setRequests, ", "), name))
+	}
+	if len(setLimits) > 0 {
+		sort.Strings(setLimits)
+		fragments = append(fragments, fmt.Sprintf("%s limit for container %s", strings.Join(setLimits, ", "), name))
+	}
+	return fragments
+}
@@ -0,0 +1,176 @@
+package plugins
+
+import (
+	"fmt"
+	"strings"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// Names of the built-in admission plugins that can be emulated
+const (
+	// ServiceAccount assigns the default service account and mounts its token
+	ServiceAccount = "ServiceAccount"
+	// DefaultTolerationSeconds adds the default not-ready/unreachable tolerations
+	DefaultTolerationSeconds = "DefaultTolerationSeconds"
+	// LimitRanger applies LimitRange defaults to container resources
+	LimitRanger = "LimitRanger"
+	// DefaultStorageClass assigns the default StorageClass to claims
+	DefaultStorageClass = "DefaultStorageClass"
+	// PodSecurity only validates, and is not emulated: Pod Security Standards are evaluated with
+	// the podsecurity package instead
+	PodSecurity = "PodSecurity"
+)
+
+// orderedPlugins lists the supported plugins in the order used by kube-apiserver
+var orderedPlugins = []string{
+	LimitRanger,
+	ServiceAccount,
+	DefaultTolerationSeconds,
+	DefaultStorageClass,
+}
+
+// Plugin emulates a single built-in mutating admission plugin
+type Plugin interface {
+	// Name returns the plugin name as used by --enable-admission-plugins
+	Name() string
+	// Admit mutates the object in place for the given operation
+	Admit(obj *unstructured.Unstructured, operation string) error
+}
+
+// Chain runs a set of plugins in kube-apiserver order
+type Chain struct {
+	plugins []Plugin
+}
+
+// NewChain creates a chain for the named plugins using the given fixtures
+// Plugin names are matched case-insensitively and duplicates are ignored
+func NewChain(names []string, fixtures *Fixtures) (*Chain, error) {
+	if fixtures == nil {
+		fixtures = &Fixtures{}
+	}
+
+	enabled := make(map[string]bool)
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if strings.EqualFold(name, PodSecurity) {
+			return nil, fmt.Errorf("admission plugin %s validates pods without mutating them and is not emulated, evaluate the Pod Security Standards with --pod-security-level (spec.podSecurity in test definitions) instead", PodSecurity)
+		}
+		canonical, ok := canonicalName(name)
+		if !ok {
+			return nil, fmt.Errorf("unsupported admission plugin: %s (supported: %s)", name, strings.Join(orderedPlugins, ", "))
+		}
+		enabled[canonical] = true
+	}
+
+	chain := &Chain{}
+	for _, name := range orderedPlugins {
+		if !enabled[name] {
+			continue
+		}
+		switch name {
+		case ServiceAccount:
+			chain.plugins = append(chain.plugins, &serviceAccountPlugin{fixtures: fixtures})
+		case DefaultTolerationSeconds:
+			chain.plugins = append(chain.plugins, &defaultTolerationSecondsPlugin{})
+		case LimitRanger:
+			chain.plugins = append(chain.plugins, &limitRangerPlugin{fixtures: fixtures})
+		case DefaultStorageClass:
+			chain.plugins = append(chain.plugins, &defaultStorageClassPlugin{fixtures: fixtures})
+		}
+	}
+
+	return chain, nil
+}
+
+// SupportedPlugins returns the names of all plugins that can be emulated
+func SupportedPlugins() []string {
+	return append([]string(nil), orderedPlugins...)
+}
+
+// Plugins returns the plugins in the order they are run
+func (c *Chain) Plugins() []Plugin {
+	if c == nil {
+		return nil
+	}
+	return c.plugins
+}
+
+// Empty returns true if the chain has no plugins
+func (c *Chain) Empty() bool {
+	return c == nil || len(c.plugins) == 0
+}
+
+// Admit runs every plugin of the chain against the object
+// The object is mutated in place
+func (c *Chain) Admit(obj *unstructured.Unstructured, operation string) error {
+	if c == nil || obj == nil {
+		return nil
+	}
+
+	for _, plugin := range c.plugins {
+		if err := plugin.Admit(obj, operation); err != nil {
+			// Plugins reject requests with API status errors, other errors fail the emulation
+			if _, ok := err.(apierrors.APIStatus); ok {
+				return &RejectionError{Plugin: plugin.Name(), Err: err}
+			}
+			return fmt.Errorf("admission plugin %s failed: %w", plugin.Name(), err)
+		}
+	}
+
+	return nil
+}
+
+// RejectionError is returned when a plugin rejects the request, as the apiserver would
+// Err is the API status error the apiserver responds with
+type RejectionError struct {
+	Plugin string
+	Err    error
+}
+
+// Error returns the message of the apiserver response
+func (e *RejectionError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the API status error
+func (e *RejectionError) Unwrap() error {
+	return e.Err
+}
+
+// canonicalName resolves a plugin name case-insensitively
+func canonicalName(name string) (string, bool) {
+	for _, known := range orderedPlugins {
+		if strings.EqualFold(known, name) {
+			return known, true
+		}
+	}
+	return "", false
+}
+
+// isPod returns true if the object is a core/v1 Pod
+func isPod(obj *unstructured.Unstructured) bool {
+	gvk := obj.GroupVersionKind()
+	return gvk.Group == "" && gvk.Kind == "Pod"
+}
+
+// podSpecContainers returns the containers and init containers of a pod spec
+func podSpecContainers(spec map[string]interface{}) []map[string]interface{} {
+	var containers []map[string]interface{}
+	for _, field := range []string{"initContainers", "containers"} {
+		list, ok := spec[field].([]interface{})
+		if !ok {
+			continue
+		}
+		for _, item := range list {
+			if container, ok := item.(map[string]interface{}); ok {
+				containers = append(containers, container)
+			}
+		}
+	}
+	return containers
+}
@@ -0,0 +1,312 @@
+package plugins
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func newTestPod(namespace string, spec map[string]interface{}) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Pod",
+		"metadata": map[string]interface{}{
+			"name":      "test-pod",
+			"namespace": namespace,
+		},
+		"spec": spec,
+	}}
+}
+
+func newTestContainer(name string) map[string]interface{} {
+	return map[string]interface{}{
+		"name":  name,
+		"image": "nginx:1.21.0",
+	}
+}
+
+func TestNewChain(t *testing.T) {
+	t.Run("orders plugins like kube-apiserver", func(t *testing.T) {
+		chain, err := NewChain([]string{"DefaultStorageClass", "serviceaccount", "LimitRanger", "LimitRanger"}, nil)
+		require.NoError(t, err)
+
+		var names []string
+		for _, plugin := range chain.Plugins() {
+			names = append(names, plugin.Name())
+		}
+		assert.Equal(t, []string{LimitRanger, ServiceAccount, DefaultStorageClass}, names)
+	})
+
+	t.Run("rejects unknown plugins", func(t *testing.T) {
+		_, err := NewChain([]string{"AlwaysPullImages"}, nil)
+		assert.Error(t, err)
+	})
+
+	t.Run("rejects PodSecurity", func(t *testing.T) {
+		_, err := NewChain([]string{"PodSecurity"}, nil)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "--pod-security-level")
+		assert.NotContains(t, SupportedPlugins(), PodSecurity)
+	})
+
+	t.Run("empty chain is a no-op", func(t *testing.T) {
+		chain, err := NewChain(nil, nil)
+		require.NoError(t, err)
+		assert.True(t, chain.Empty())
+
+		pod := newTestPod("default", map[string]interface{}{
+			"containers": []interface{}{newTestContainer("app")},
+		})
+		before := pod.DeepCopy()
+		require.NoError(t, chain.Admit(pod, "CREATE"))
+		assert.Equal(t, before, pod)
+	})
+}
+
+func TestServiceAccountPlugin(t *testing.T) {
+	automountFalse := false
+
+	tests := []struct {
+		name            string
+		spec            map[string]interface{}
+		serviceAccounts []*corev1.ServiceAccount
+		operation       string
+		wantAccount     string
+		wantMount       bool
+	}{
+		{
+			name:        "defaults service account and mounts token",
+			spec:        map[string]interface{}{"containers": []interface{}{newTestContainer("app")}},
+			operation:   "CREATE",
+			wantAccount: "default",
+			wantMount:   true,
+		},
+		{
+			name: "pod opts out of automount",
+			spec: map[string]interface{}{
+				"serviceAccountName":           "builder",
+				"automountServiceAccountToken": false,
+				"containers":                   []interface{}{newTestContainer("app")},
+			},
+			operation:   "CREATE",
+			wantAccount: "builder",
+			wantMount:   false,
+		},
+		{
+			name: "service account opts out of automount",
+			spec: map[string]interface{}{"containers": []interface{}{newTestContainer("app")}},
+			serviceAccounts: []*corev1.ServiceAccount{{
+				ObjectMeta:                   metav1.ObjectMeta{Name: "default", Namespace: "default"},
+				AutomountServiceAccountToken: &automountFalse,
+			}},
+			operation:   "CREATE",
+			wantAccount: "default",
+			wantMount:   false,
+		},
+		{
+			name:      "updates are not mutated",
+			spec:      map[string]interface{}{"containers": []interface{}{newTestContainer("app")}},
+			operation: "UPDATE",
+			wantMount: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chain, err := NewChain([]string{ServiceAccount}, &Fixtures{ServiceAccounts: tt.serviceAccounts})
+			require.NoError(t, err)
+
+			pod := newTestPod("default", tt.spec)
+			require.NoError(t, chain.Admit(pod, tt.operation))
+
+			account, _, _ := unstructured.NestedString(pod.Object, "spec", "serviceAccountName")
+			assert.Equal(t, tt.wantAccount, account)
+
+			containers, _, _ := unstructured.NestedSlice(pod.Object, "spec", "containers")
+			require.Len(t, containers, 1)
+			mounted := hasMountAt(containers[0].(map[string]interface{}), serviceAccountTokenMountPath)
+			assert.Equal(t, tt.wantMount, mounted)
+
+			volumes, _, _ := unstructured.NestedSlice(pod.Object, "spec", "volumes")
+			if tt.wantMount {
+				require.Len(t, volumes, 1)
+				assert.Equal(t, tokenVolumeName(pod), volumes[0].(map[string]interface{})["name"])
+			} else {
+				assert.Empty(t, volumes)
+			}
+		})
+	}
+}
+
+func TestServiceAccountPluginMissingAccount(t *testing.T) {
+	fixtures := &Fixtures{ServiceAccounts: []*corev1.ServiceAccount{{
+		ObjectMeta: metav1.ObjectMeta{Name: "builder", Namespace: "ci"},
+	}}}
+	chain, err := NewChain([]string{ServiceAccount}, fixtures)
+	require.NoError(t, err)
+
+	// Service accounts of the fixtures, and the default one, are found
+	for _, account := range []string{"builder", ""} {
+		pod := newTestPod("ci", map[string]interface{}{
+			"serviceAccountName": account,
+			"containers":         []interface{}{newTestContainer("app")},
+		})
+		require.NoError(t, chain.Admit(pod, "CREATE"))
+	}
+
+	// Pods of other service accounts are forbidden
+	pod := newTestPod("default", map[string]interface{}{
+		"serviceAccountName": "builder",
+		"containers":         []interface{}{newTestContainer("app")},
+	})
+	err = chain.Admit(pod, "CREATE")
+	var rejection *RejectionError
+	require.ErrorAs(t, err, &rejection)
+	assert.Equal(t, ServiceAccount, rejection.Plugin)
+	assert.True(t, apierrors.IsForbidden(errors.Unwrap(err)))
+	assert.Equal(t, `pods "test-pod" is forbidden: error looking up service account default/builder: serviceaccount "builder" not found`, err.Error())
+}
+
+func TestDefaultTolerationSecondsPlugin(t *testing.T) {
+	chain, err := NewChain([]string{DefaultTolerationSeconds}, nil)
+	require.NoError(t, err)
+
+	t.Run("adds both tolerations", func(t *testing.T) {
+		pod := newTestPod("default", map[string]interface{}{"containers": []interface{}{newTestContainer("app")}})
+		require.NoError(t, chain.Admit(pod, "CREATE"))
+
+		tolerations, _, _ := unstructured.NestedSlice(pod.Object, "spec", "tolerations")
+		require.Len(t, tolerations, 2)
+		assert.Equal(t, taintNodeNotReady, tolerations[0].(map[string]interface{})["key"])
+		assert.Equal(t, taintNodeUnreachable, tolerations[1].(map[string]interface{})["key"])
+		assert.Equal(t, defaultTolerationSeconds, tolerations[0].(map[string]interface{})["tolerationSeconds"])
+	})
+
+	t.Run("keeps existing tolerations", func(t *testing.T) {
+		pod := newTestPod("default", map[string]interface{}{
+			"containers": []interface{}{newTestContainer("app")},
+			"tolerations": []interface{}{
+				map[string]interface{}{"key": taintNodeNotReady, "operator": "Exists", "effect": "NoExecute", "tolerationSeconds": int64(10)},
+			},
+		})
+		require.NoError(t, chain.Admit(pod, "CREATE"))
+
+		tolerations, _, _ := unstructured.NestedSlice(pod.Object, "spec", "tolerations")
+		require.Len(t, tolerations, 2)
+		assert.Equal(t, int64(10), tolerations[0].(map[string]interface{})["tolerationSeconds"])
+		assert.Equal(t, taintNodeUnreachable, tolerations[1].(map[string]interface{})["key"])
+	})
+}
+
+func TestLimitRangerPlugin(t *testing.T) {
+	fixtures := &Fixtures{LimitRanges: []*corev1.LimitRange{{
+		ObjectMeta: metav1.ObjectMeta{Name: "limits", Namespace: "default"},
+		Spec: corev1.LimitRangeSpec{Limits: []corev1.LimitRangeItem{{
+			Type: corev1.LimitTypeContainer,
+			Default: corev1.ResourceList{
+				corev1.ResourceCPU:    resource.MustParse("500m"),
+				corev1.ResourceMemory: resource.MustParse("256Mi"),
+			},
+			DefaultRequest: corev1.ResourceList{
+				corev1.ResourceCPU: resource.MustParse("100m"),
+			},
+		}}},
+	}}}
+	chain, err := NewChain([]string{LimitRanger}, fixtures)
+	require.NoError(t, err)
+
+	t.Run("applies defaults in matching namespace", func(t *testing.T) {
+		container := newTestContainer("app")
+		container["resources"] = map[string]interface{}{
+			"limits": map[string]interface{}{"memory": "1Gi"},
+		}
+		pod := newTestPod("default", map[string]interface{}{"containers": []interface{}{container}})
+		require.NoError(t, chain.Admit(pod, "CREATE"))
+
+		limits, _, _ := unstructured.NestedStringMap(container, "resources", "limits")
+		assert.Equal(t, map[string]string{"cpu": "500m", "memory": "1Gi"}, limits)
+
+		// The default request falls back to the default limit
+		requests, _, _ := unstructured.NestedStringMap(container, "resources", "requests")
+		assert.Equal(t, map[string]string{"cpu": "100m", "memory": "256Mi"}, requests)
+
+		assert.Equal(t,
+			"LimitRanger plugin set: cpu, memory request for container app; cpu limit for container app",
+			pod.GetAnnotations()[limitRangerAnnotation])
+	})
+
+	t.Run("ignores other namespaces", func(t *testing.T) {
+		pod := newTestPod("team-a", map[string]interface{}{"containers": []interface{}{newTestContainer("app")}})
+		before := pod.DeepCopy()
+		require.NoError(t, chain.Admit(pod, "CREATE"))
+		assert.Equal(t, before, pod)
+	})
+}
+
+func TestDefaultStorageClassPlugin(t *testing.T) {
+	older := metav1.NewTime(metav1.Now().Add(-3600e9))
+	newer := metav1.Now()
+	fixtures := &Fixtures{StorageClasses: []*storagev1.StorageClass{
+		{ObjectMeta: metav1.ObjectMeta{Name: "slow"}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "standard", CreationTimestamp: older, Annotations: map[string]string{isDefaultStorageClassAnnotation: "true"}}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "fast", CreationTimestamp: newer, Annotations: map[string]string{isDefaultStorageClassAnnotation: "true"}}},
+	}}
+	chain, err := NewChain([]string{DefaultStorageClass}, fixtures)
+	require.NoError(t, err)
+
+	newClaim := func(spec map[string]interface{}) *unstructured.Unstructured {
+		return &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "PersistentVolumeClaim",
+			"metadata":   map[string]interface{}{"name": "data", "namespace": "default"},
+			"spec":       spec,
+		}}
+	}
+
+	claim := newClaim(map[string]interface{}{})
+	require.NoError(t, chain.Admit(claim, "CREATE"))
+	className, _, _ := unstructured.NestedString(claim.Object, "spec", "storageClassName")
+	assert.Equal(t, "fast", className, "newest default class should win")
+
+	explicit := newClaim(map[string]interface{}{"storageClassName": ""})
+	require.NoError(t, chain.Admit(explicit, "CREATE"))
+	className, _, _ = unstructured.NestedString(explicit.Object, "spec", "storageClassName")
+	assert.Equal(t, "", className)
+}
+
+func TestFixturesAdd(t *testing.T) {
+	fixtures := &Fixtures{}
+
+	added, err := fixtures.Add(&unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "LimitRange",
+		"metadata":   map[string]interface{}{"name": "limits", "namespace": "default"},
+		"spec": map[string]interface{}{
+			"limits": []interface{}{
+				map[string]interface{}{"type": "Container", "default": map[string]interface{}{"cpu": "1"}},
+			},
+		},
+	}})
+	require.NoError(t, err)
+	assert.True(t, added)
+
+	added, err = fixtures.Add(&unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata":   map[string]interface{}{"name": "config"},
+	}})
+	require.NoError(t, err)
+	assert.False(t, added)
+
+	assert.Equal(t, 1, fixtures.Len())
+	require.Len(t, fixtures.LimitRanges, 1)
+	assert.Equal(t, "1", fixtures.LimitRanges[0].Spec.Limits[0].Default.Cpu().String())
+}
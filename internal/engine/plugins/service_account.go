@@ -0,0 +1,178 @@
+package plugins
+
+import (
+	"fmt"
+	"hash/fnv"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const (
+	// defaultServiceAccountName is assigned to pods that do not set one
+	defaultServiceAccountName = "default"
+	// serviceAccountTokenMountPath is where the API token volume is mounted
+	serviceAccountTokenMountPath = "/var/run/secrets/kubernetes.io/serviceaccount"
+	// serviceAccountTokenVolumePrefix is the name prefix of the projected token volume
+	serviceAccountTokenVolumePrefix = "kube-api-access-"
+	// serviceAccountTokenExpirationSeconds matches the apiserver's bound token expiry
+	serviceAccountTokenExpirationSeconds = int64(3607)
+	// projectedVolumeDefaultMode is the file mode set on the token volume (0644)
+	projectedVolumeDefaultMode = int64(420)
+	// mirrorPodAnnotation marks static pods, which the plugin leaves untouched
+	mirrorPodAnnotation = "kubernetes.io/config.mirror"
+)
+
+// serviceAccountPlugin emulates the ServiceAccount admission plugin
+type serviceAccountPlugin struct {
+	fixtures *Fixtures
+}
+
+// Name returns the plugin name
+func (p *serviceAccountPlugin) Name() string {
+	return ServiceAccount
+}
+
+// Admit defaults spec.serviceAccountName and mounts the projected API token volume
+// Pods of service accounts missing from the fixtures are forbidden, as the apiserver forbids pods
+// of service accounts it cannot find, unless no service account fixtures are given. The default
+// service account is created in every namespace, so it is never missing
+func (p *serviceAccountPlugin) Admit(obj *unstructured.Unstructured, operation string) error {
+	if operation != "CREATE" || !isPod(obj) {
+		return nil
+	}
+	if _, mirror := obj.GetAnnotations()[mirrorPodAnnotation]; mirror {
+		return nil
+	}
+
+	spec, ok := obj.Object["spec"].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+
+	serviceAccountName, _ := spec["serviceAccountName"].(string)
+	if serviceAccountName == "" {
+		serviceAccountName = defaultServiceAccountName
+		spec["serviceAccountName"] = serviceAccountName
+	}
+
+	if len(p.fixtures.ServiceAccounts) > 0 && serviceAccountName != defaultServiceAccountName &&
+		p.fixtures.serviceAccount(obj.GetNamespace(), serviceAccountName) == nil {
+		notFound := apierrors.NewNotFound(schema.GroupResource{Resource: "serviceaccount"}, serviceAccountName)
+		return apierrors.NewForbidden(schema.GroupResource{Resource: "pods"}, obj.GetName(),
+			fmt.Errorf("error looking up service account %s/%s: %w", namespaceOrDefault(obj.GetNamespace()), serviceAccountName, notFound))
+	}
+
+	if !p.shouldAutomount(spec, obj.GetNamespace(), serviceAccountName) {
+		return nil
+	}
+
+	// Containers that already mount something at the token path are left alone
+	var needsMount []map[string]interface{}
+	for _, container := range podSpecContainers(spec) {
+		if !hasMountAt(container, serviceAccountTokenMountPath) {
+			needsMount = append(needsMount, container)
+		}
+	}
+	if len(needsMount) == 0 {
+		return nil
+	}
+
+	volumeName := tokenVolumeName(obj)
+	for _, container := range needsMount {
+		mounts, _ := container["volumeMounts"].([]interface{})
+		container["volumeMounts"] = append(mounts, map[string]interface{}{
+			"name":      volumeName,
+			"readOnly":  true,
+			"mountPath": serviceAccountTokenMountPath,
+		})
+	}
+
+	volumes, _ := spec["volumes"].([]interface{})
+	spec["volumes"] = append(volumes, tokenVolume(volumeName))
+
+	return nil
+}
+
+// shouldAutomount resolves automountServiceAccountToken from the pod and service account
+func (p *serviceAccountPlugin) shouldAutomount(spec map[string]interface{}, namespace, serviceAccountName string) bool {
+	if automount, ok := spec["automountServiceAccountToken"].(bool); ok {
+		return automount
+	}
+	if sa := p.fixtures.serviceAccount(namespace, serviceAccountName); sa != nil && sa.AutomountServiceAccountToken != nil {
+		return *sa.AutomountServiceAccountToken
+	}
+	return true
+}
+
+// hasMountAt returns true if the container mounts a volume at the given path
+func hasMountAt(container map[string]interface{}, mountPath string) bool {
+	mounts, _ := container["volumeMounts"].([]interface{})
+	for _, item := range mounts {
+		mount, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if path, _ := mount["mountPath"].(string); path == mountPath {
+			return true
+		}
+	}
+	return false
+}
+
+// tokenVolumeName returns a stable volume name for the pod
+// The apiserver uses a random suffix; a hash keeps test results reproducible
+func tokenVolumeName(obj *unstructured.Unstructured) string {
+	const alphabet = "bcdfghjklmnpqrstvwxz2456789"
+
+	h := fnv.New32a()
+	fmt.Fprintf(h, "%s/%s/%s", obj.GetNamespace(), obj.GetName(), obj.GetGenerateName())
+	sum := h.Sum32()
+
+	suffix := make([]byte, 5)
+	for i := range suffix {
+		suffix[i] = alphabet[sum%uint32(len(alphabet))]
+		sum /= uint32(len(alphabet))
+	}
+	return serviceAccountTokenVolumePrefix + string(suffix)
+}
+
+// tokenVolume builds the projected volume injected by the plugin
+func tokenVolume(name string) map[string]interface{} {
+	return map[string]interface{}{
+		"name": name,
+		"projected": map[string]interface{}{
+			"defaultMode": projectedVolumeDefaultMode,
+			"sources": []interface{}{
+				map[string]interface{}{
+					"serviceAccountToken": map[string]interface{}{
+						"expirationSeconds": serviceAccountTokenExpirationSeconds,
+						"path":              "token",
+					},
+				},
+				map[string]interface{}{
+					"configMap": map[string]interface{}{
+						"name": "kube-root-ca.crt",
+						"items": []interface{}{
+							map[string]interface{}{"key": "ca.crt", "path": "ca.crt"},
+						},
+					},
+				},
+				map[string]interface{}{
+					"downwardAPI": map[string]interface{}{
+						"items": []interface{}{
+							map[string]interface{}{
+								"path": "namespace",
+								"fieldRef": map[string]interface{}{
+									"apiVersion": "v1",
+									"fieldPath":  "metadata.namespace",
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
@@ -0,0 +1,165 @@
+package podsecurity
+
+import (
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	psaapi "k8s.io/pod-security-admission/api"
+	psapolicy "k8s.io/pod-security-admission/policy"
+
+	kaptestv1 "github.com/yashirook/kube-vap-test/pkg/apis/admission/v1"
+)
+
+// Evaluator evaluates the Pod Security Standards on pod-bearing objects
+// It runs the same checks as the PodSecurity admission plugin in the apiserver
+type Evaluator struct {
+	levelVersion psaapi.LevelVersion
+	evaluator    psapolicy.Evaluator
+}
+
+// NewEvaluator creates an Evaluator for the given level and version
+// An empty version evaluates the latest Pod Security Standards
+func NewEvaluator(level, version string) (*Evaluator, error) {
+	parsedLevel, err := psaapi.ParseLevel(level)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pod security level %q: %w", level, err)
+	}
+
+	if version == "" {
+		version = "latest"
+	}
+	parsedVersion, err := psaapi.ParseVersion(version)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pod security version %q: %w", version, err)
+	}
+
+	evaluator, err := psapolicy.NewEvaluator(psapolicy.DefaultChecks())
+	if err != nil {
+		return nil, fmt.Errorf("failed to create pod security evaluator: %w", err)
+	}
+
+	return &Evaluator{
+		levelVersion: psaapi.LevelVersion{Level: parsedLevel, Version: parsedVersion},
+		evaluator:    evaluator,
+	}, nil
+}
+
+// Policy returns the evaluated level and version (e.g. restricted:latest)
+func (e *Evaluator) Policy() string {
+	return e.levelVersion.String()
+}
+
+// Evaluate returns the Pod Security Admission verdict for the object
+// It returns nil for objects that do not carry a pod template
+func (e *Evaluator) Evaluate(obj *unstructured.Unstructured) (*kaptestv1.PodSecurityResult, error) {
+	metadata, spec, err := extractPodSpec(obj)
+	if err != nil {
+		return nil, err
+	}
+	if spec == nil {
+		return nil, nil
+	}
+
+	aggregate := psapolicy.AggregateCheckResults(e.evaluator.EvaluatePod(e.levelVersion, metadata, spec))
+	result := &kaptestv1.PodSecurityResult{
+		Policy:  e.Policy(),
+		Allowed: aggregate.Allowed,
+	}
+	if !aggregate.Allowed {
+		result.ForbiddenReason = aggregate.ForbiddenReason()
+		result.ForbiddenDetail = aggregate.ForbiddenDetail()
+	}
+
+	return result, nil
+}
+
+// Compare sets the divergence between the policy verdict and the Pod Security Admission verdict
+func Compare(result *kaptestv1.PodSecurityResult, vapAllowed bool) {
+	switch {
+	case vapAllowed == result.Allowed:
+		result.Divergence = kaptestv1.PodSecurityAgree
+	case vapAllowed:
+		result.Divergence = kaptestv1.PodSecurityVAPLooser
+	default:
+		result.Divergence = kaptestv1.PodSecurityVAPStricter
+	}
+}
+
+// Summarize counts the divergences recorded in the test results
+func (e *Evaluator) Summarize(results []kaptestv1.TestResult) *kaptestv1.PodSecuritySummary {
+	summary := &kaptestv1.PodSecuritySummary{Policy: e.Policy()}
+	for i := range results {
+		Add(summary, &results[i])
+	}
+
+	return summary
+}
+
+// Add counts the divergence recorded in a test result in a summary
+func Add(summary *kaptestv1.PodSecuritySummary, result *kaptestv1.TestResult) {
+	if result.PodSecurity == nil {
+		return
+	}
+
+	summary.Evaluated++
+	switch result.PodSecurity.Divergence {
+	case kaptestv1.PodSecurityVAPStricter:
+		summary.VAPStricter++
+	case kaptestv1.PodSecurityVAPLooser:
+		summary.VAPLooser++
+	default:
+		summary.Agree++
+	}
+}
+
+// podTemplatePaths maps pod-bearing workload kinds to the location of their pod template
+var podTemplatePaths = map[string][]string{
+	"/PodTemplate":           {"template"},
+	"/ReplicationController": {"spec", "template"},
+	"apps/Deployment":        {"spec", "template"},
+	"apps/StatefulSet":       {"spec", "template"},
+	"apps/DaemonSet":         {"spec", "template"},
+	"apps/ReplicaSet":        {"spec", "template"},
+	"batch/Job":              {"spec", "template"},
+	"batch/CronJob":          {"spec", "jobTemplate", "spec", "template"},
+}
+
+// extractPodSpec returns the pod metadata and spec carried by the object
+// It returns a nil spec for objects that are not pod-bearing
+func extractPodSpec(obj *unstructured.Unstructured) (*metav1.ObjectMeta, *corev1.PodSpec, error) {
+	if obj == nil {
+		return nil, nil, nil
+	}
+
+	gvk := obj.GroupVersionKind()
+	if gvk.Group == "" && gvk.Kind == "Pod" {
+		pod := &corev1.Pod{}
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.UnstructuredContent(), pod); err != nil {
+			return nil, nil, fmt.Errorf("failed to convert Pod: %w", err)
+		}
+		return &pod.ObjectMeta, &pod.Spec, nil
+	}
+
+	path, ok := podTemplatePaths[gvk.Group+"/"+gvk.Kind]
+	if !ok {
+		return nil, nil, nil
+	}
+
+	content, found, err := unstructured.NestedMap(obj.Object, path...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read pod template of %s: %w", gvk.Kind, err)
+	}
+	if !found {
+		return nil, nil, nil
+	}
+
+	template := &corev1.PodTemplateSpec{}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(content, template); err != nil {
+		return nil, nil, fmt.Errorf("failed to convert pod template of %s: %w", gvk.Kind, err)
+	}
+
+	return &template.ObjectMeta, &template.Spec, nil
+}
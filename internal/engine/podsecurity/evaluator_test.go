@@ -0,0 +1,228 @@
+package podsecurity
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	kaptestv1 "github.com/yashirook/kube-vap-test/pkg/apis/admission/v1"
+)
+
+func privilegedPodSpec() map[string]interface{} {
+	return map[string]interface{}{
+		"containers": []interface{}{
+			map[string]interface{}{
+				"name":            "nginx",
+				"image":           "nginx",
+				"securityContext": map[string]interface{}{"privileged": true},
+			},
+		},
+	}
+}
+
+func restrictedPodSpec() map[string]interface{} {
+	return map[string]interface{}{
+		"securityContext": map[string]interface{}{
+			"runAsNonRoot":   true,
+			"seccompProfile": map[string]interface{}{"type": "RuntimeDefault"},
+		},
+		"containers": []interface{}{
+			map[string]interface{}{
+				"name":  "nginx",
+				"image": "nginx",
+				"securityContext": map[string]interface{}{
+					"allowPrivilegeEscalation": false,
+					"capabilities":             map[string]interface{}{"drop": []interface{}{"ALL"}},
+				},
+			},
+		},
+	}
+}
+
+func TestNewEvaluator(t *testing.T) {
+	tests := []struct {
+		name       string
+		level      string
+		version    string
+		wantPolicy string
+		wantErr    bool
+	}{
+		{name: "default version", level: "baseline", wantPolicy: "baseline:latest"},
+		{name: "explicit version", level: "restricted", version: "v1.30", wantPolicy: "restricted:v1.30"},
+		{name: "invalid level", level: "strict", wantErr: true},
+		{name: "invalid version", level: "baseline", version: "1.30", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			evaluator, err := NewEvaluator(tt.level, tt.version)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantPolicy, evaluator.Policy())
+		})
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	tests := []struct {
+		name        string
+		level       string
+		obj         map[string]interface{}
+		wantResult  bool
+		wantAllowed bool
+		wantReason  string
+	}{
+		{
+			name:  "privileged pod denied by baseline",
+			level: "baseline",
+			obj: map[string]interface{}{
+				"apiVersion": "v1",
+				"kind":       "Pod",
+				"metadata":   map[string]interface{}{"name": "test-pod"},
+				"spec":       privilegedPodSpec(),
+			},
+			wantResult:  true,
+			wantAllowed: false,
+			wantReason:  "privileged",
+		},
+		{
+			name:  "privileged pod allowed by privileged",
+			level: "privileged",
+			obj: map[string]interface{}{
+				"apiVersion": "v1",
+				"kind":       "Pod",
+				"metadata":   map[string]interface{}{"name": "test-pod"},
+				"spec":       privilegedPodSpec(),
+			},
+			wantResult:  true,
+			wantAllowed: true,
+		},
+		{
+			name:  "deployment template evaluated",
+			level: "baseline",
+			obj: map[string]interface{}{
+				"apiVersion": "apps/v1",
+				"kind":       "Deployment",
+				"metadata":   map[string]interface{}{"name": "test-deployment"},
+				"spec": map[string]interface{}{
+					"template": map[string]interface{}{"spec": privilegedPodSpec()},
+				},
+			},
+			wantResult:  true,
+			wantAllowed: false,
+			wantReason:  "privileged",
+		},
+		{
+			name:  "cronjob template evaluated",
+			level: "restricted",
+			obj: map[string]interface{}{
+				"apiVersion": "batch/v1",
+				"kind":       "CronJob",
+				"metadata":   map[string]interface{}{"name": "test-cronjob"},
+				"spec": map[string]interface{}{
+					"jobTemplate": map[string]interface{}{
+						"spec": map[string]interface{}{
+							"template": map[string]interface{}{"spec": restrictedPodSpec()},
+						},
+					},
+				},
+			},
+			wantResult:  true,
+			wantAllowed: true,
+		},
+		{
+			name:  "default pod denied by restricted",
+			level: "restricted",
+			obj: map[string]interface{}{
+				"apiVersion": "v1",
+				"kind":       "Pod",
+				"metadata":   map[string]interface{}{"name": "test-pod"},
+				"spec": map[string]interface{}{
+					"containers": []interface{}{map[string]interface{}{"name": "nginx", "image": "nginx"}},
+				},
+			},
+			wantResult:  true,
+			wantAllowed: false,
+			wantReason:  "runAsNonRoot",
+		},
+		{
+			name:  "non pod-bearing object skipped",
+			level: "restricted",
+			obj: map[string]interface{}{
+				"apiVersion": "v1",
+				"kind":       "ConfigMap",
+				"metadata":   map[string]interface{}{"name": "test-config"},
+			},
+			wantResult: false,
+		},
+		{
+			name:  "custom resource with template skipped",
+			level: "restricted",
+			obj: map[string]interface{}{
+				"apiVersion": "example.com/v1",
+				"kind":       "Deployment",
+				"metadata":   map[string]interface{}{"name": "test-custom"},
+				"spec": map[string]interface{}{
+					"template": map[string]interface{}{"spec": privilegedPodSpec()},
+				},
+			},
+			wantResult: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			evaluator, err := NewEvaluator(tt.level, "")
+			require.NoError(t, err)
+
+			result, err := evaluator.Evaluate(&unstructured.Unstructured{Object: tt.obj})
+			require.NoError(t, err)
+			if !tt.wantResult {
+				assert.Nil(t, result)
+				return
+			}
+
+			require.NotNil(t, result)
+			assert.Equal(t, tt.wantAllowed, result.Allowed)
+			assert.Contains(t, result.ForbiddenReason, tt.wantReason)
+		})
+	}
+}
+
+func TestCompareAndSummarize(t *testing.T) {
+	evaluator, err := NewEvaluator("baseline", "")
+	require.NoError(t, err)
+
+	tests := []struct {
+		vapAllowed bool
+		psaAllowed bool
+		want       kaptestv1.PodSecurityDivergence
+	}{
+		{vapAllowed: true, psaAllowed: true, want: kaptestv1.PodSecurityAgree},
+		{vapAllowed: false, psaAllowed: false, want: kaptestv1.PodSecurityAgree},
+		{vapAllowed: false, psaAllowed: true, want: kaptestv1.PodSecurityVAPStricter},
+		{vapAllowed: true, psaAllowed: false, want: kaptestv1.PodSecurityVAPLooser},
+	}
+
+	results := []kaptestv1.TestResult{{Name: "not-pod-bearing"}}
+	for _, tt := range tests {
+		podSecurity := &kaptestv1.PodSecurityResult{Allowed: tt.psaAllowed}
+		Compare(podSecurity, tt.vapAllowed)
+		assert.Equal(t, tt.want, podSecurity.Divergence)
+		results = append(results, kaptestv1.TestResult{PodSecurity: podSecurity})
+	}
+
+	summary := evaluator.Summarize(results)
+	assert.Equal(t, &kaptestv1.PodSecuritySummary{
+		Policy:      "baseline:latest",
+		Evaluated:   4,
+		Agree:       2,
+		VAPStricter: 1,
+		VAPLooser:   1,
+	}, summary)
+}
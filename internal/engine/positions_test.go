@@ -0,0 +1,78 @@
+package engine
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"github.com/yashirook/kube-vap-test/internal/source"
+	vaptestv1 "github.com/yashirook/kube-vap-test/pkg/apis/admission/v1"
+)
+
+func TestExpressionErrorPositions(t *testing.T) {
+	policy := &admissionregistrationv1.ValidatingAdmissionPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: "positions-policy"},
+		Spec: admissionregistrationv1.ValidatingAdmissionPolicySpec{
+			Validations: []admissionregistrationv1.Validation{
+				{
+					Expression: "object.metadata.name != '' &&\n  object.spec.missingField > 1",
+					Message:    "invalid",
+				},
+			},
+		},
+	}
+	testCase := vaptestv1.TestCase{
+		Name:      "missing-field",
+		Object:    runtime.RawExtension{Raw: []byte(`{"apiVersion":"v1","kind":"Pod","metadata":{"name":"pod"},"spec":{}}`)},
+		Operation: "CREATE",
+		Expected:  vaptestv1.ExpectedResult{Allowed: false},
+	}
+
+	tests := []struct {
+		name     string
+		sources  map[string]*source.Policy
+		location *vaptestv1.SourceLocation
+	}{
+		{
+			name: "position in the policy file",
+			sources: map[string]*source.Policy{
+				"positions-policy": {
+					File: "policy.yaml",
+					Line: 1,
+					Expressions: map[string]source.Scalar{
+						"spec.validations[0].expression": {File: "policy.yaml", Line: 12, Column: 7, Exact: true},
+					},
+				},
+			},
+			// The runtime error points at the select of missingField on the second line
+			location: &vaptestv1.SourceLocation{File: "policy.yaml", Line: 13, Column: 20},
+		},
+		{
+			name: "policy without source",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			simulator, err := NewPolicySimulator()
+			require.NoError(t, err)
+			simulator.SetPolicySources(tt.sources)
+
+			result, err := simulator.SimulateTestCase(context.Background(), policy, nil, testCase)
+			require.NoError(t, err)
+			require.Len(t, result.ExpressionErrors, 1)
+
+			expressionErr := result.ExpressionErrors[0]
+			assert.Equal(t, "positions-policy", expressionErr.Policy)
+			assert.Equal(t, "spec.validations[0].expression", expressionErr.Field)
+			assert.Contains(t, expressionErr.Message, "missingField")
+			assert.Equal(t, tt.location, expressionErr.Location)
+			assert.Equal(t, "  object.spec.missingField > 1\n             ^", expressionErr.Excerpt)
+		})
+	}
+}
@@ -3,6 +3,8 @@ package engine
 import (
 	"fmt"
 	"strings"
+
+	kaptestv1 "github.com/yashirook/kube-vap-test/pkg/apis/admission/v1"
 )
 
 // ValidationResult represents the result of a validation
@@ -19,12 +21,19 @@ type ValidationResult interface {
 
 // Violation represents a single validation violation
 type Violation struct {
+	// Field is the path of the failed policy entry, e.g. spec.validations[0]
+	Field string
 	// Expression that failed
 	Expression string
 	// Reason for the failure
 	Reason string
 	// Message describing the failure
 	Message string
+	// Error is the CEL error of the expression, if the failure comes from one
+	Error *kaptestv1.ExpressionError
+	// EvaluationError is true when the policy could not be evaluated,
+	// rather than a validation returning false
+	EvaluationError bool
 }
 
 // validationResult is the default implementation of ValidationResult
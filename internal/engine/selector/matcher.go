@@ -4,6 +4,7 @@ import (
 	"github.com/yashirook/kube-vap-test/internal/engine/admission"
 	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 )
 
 // Matcher evaluates whether resources match the matching conditions
@@ -30,7 +31,7 @@ func (m *DefaultMatcher) Matches(matchResources *admissionregistrationv1.MatchRe
 	}
 
 	// Check namespace selector
-	if matchResources.NamespaceSelector != nil && !m.matchesNamespaceSelector(matchResources.NamespaceSelector, admissionTarget.Object) {
+	if matchResources.NamespaceSelector != nil && !m.matchesNamespaceSelector(matchResources.NamespaceSelector, admissionTarget) {
 		return false, nil
 	}
 
@@ -69,9 +70,19 @@ func (m *DefaultMatcher) Matches(matchResources *admissionregistrationv1.MatchRe
 }
 
 // matchesNamespaceSelector evaluates whether it matches the namespace selector
-func (m *DefaultMatcher) matchesNamespaceSelector(selector *metav1.LabelSelector, object map[string]interface{}) bool {
+// The whole selector is matched when the labels of the namespace are known, otherwise only
+// expressions on the kubernetes.io/metadata.name label are
+func (m *DefaultMatcher) matchesNamespaceSelector(selector *metav1.LabelSelector, admissionTarget admission.AdmissionTarget) bool {
+	if admissionTarget.NamespaceLabels != nil {
+		namespaceSelector, err := metav1.LabelSelectorAsSelector(selector)
+		if err != nil {
+			return false
+		}
+		return namespaceSelector.Matches(labels.Set(admissionTarget.NamespaceLabels))
+	}
+
 	// Does not match if the object is not a map
-	metadata, ok := object["metadata"].(map[string]interface{})
+	metadata, ok := admissionTarget.Object["metadata"].(map[string]interface{})
 	if !ok {
 		return false
 	}
@@ -3,39 +3,58 @@ package engine
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"strings"
 
 	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
 
-	"github.com/yashirook/kube-vap-test/internal/engine/admission"
-	"github.com/yashirook/kube-vap-test/internal/engine/selector"
+	"github.com/yashirook/kube-vap-test/internal/engine/defaulting"
+	"github.com/yashirook/kube-vap-test/internal/engine/plugins"
+	"github.com/yashirook/kube-vap-test/internal/engine/podsecurity"
+	"github.com/yashirook/kube-vap-test/internal/engine/waiver"
+	"github.com/yashirook/kube-vap-test/internal/source"
 	kaptestv1 "github.com/yashirook/kube-vap-test/pkg/apis/admission/v1"
 )
 
 // PolicySimulator executes policy simulations
 type PolicySimulator struct {
-	validator *PolicyValidator
-	evaluator *DefaultCELEvaluator
+	validator          *PolicyValidator
+	native             Engine
+	engine             Engine
+	differentialEngine Engine
+	defaulter          *defaulting.Defaulter
+	applyDefaults      bool
+	admissionChain     *plugins.Chain
+	podSecurity        *podsecurity.Evaluator
+	waivers            *waiver.Set
+	params             []*unstructured.Unstructured
+	namespaces         []*corev1.Namespace
 }
 
 // NewPolicySimulator creates a new PolicySimulator
+// Policies are evaluated by the native engine unless another engine is set
 func NewPolicySimulator() (*PolicySimulator, error) {
 	validator, err := NewPolicyValidator()
 	if err != nil {
 		return nil, fmt.Errorf("failed to create policy validator: %w", err)
 	}
 
-	evaluator, err := NewDefaultCELEvaluator()
+	defaulter, err := defaulting.NewDefaulter()
 	if err != nil {
-		return nil, fmt.Errorf("failed to create CEL evaluator: %w", err)
+		return nil, fmt.Errorf("failed to create defaulter: %w", err)
 	}
 
+	native := newNativeEngine(validator)
 	return &PolicySimulator{
 		validator: validator,
-		evaluator: evaluator,
+		native:    native,
+		engine:    native,
+		defaulter: defaulter,
 	}, nil
 }
 
@@ -44,6 +63,89 @@ func (p *PolicySimulator) SetContextVariables(vars map[string]interface{}) {
 	p.validator.SetContextVariables(vars)
 }
 
+// SetPolicySources sets the positions of the policies in their files, by policy name
+// CEL errors of the native engine then point to the file, line and column of the error
+func (p *PolicySimulator) SetPolicySources(sources map[string]*source.Policy) {
+	p.validator.SetPolicySources(sources)
+}
+
+// NativeEngine returns the built-in evaluation engine
+func (p *PolicySimulator) NativeEngine() Engine {
+	return p.native
+}
+
+// SetEngine sets the engine whose verdict is compared with the expected results
+func (p *PolicySimulator) SetEngine(engine Engine) {
+	p.engine = engine
+}
+
+// SetDifferentialEngine sets a second engine evaluated for every test case
+// Test cases where both engines disagree fail; passing nil disables the comparison
+func (p *PolicySimulator) SetDifferentialEngine(engine Engine) {
+	p.differentialEngine = engine
+}
+
+// EngineName returns the name of the engine whose verdict is reported
+func (p *PolicySimulator) EngineName() string {
+	return p.engine.Name()
+}
+
+// SetApplyDefaults enables Kubernetes API defaulting of objects before evaluation
+// Test cases can override this with their applyDefaults field
+func (p *PolicySimulator) SetApplyDefaults(enabled bool) {
+	p.applyDefaults = enabled
+}
+
+// SetAdmissionPlugins sets the built-in admission plugins emulated before policy evaluation
+// Passing nil disables the emulation
+func (p *PolicySimulator) SetAdmissionPlugins(chain *plugins.Chain) {
+	p.admissionChain = chain
+}
+
+// SetPodSecurity sets the Pod Security Admission evaluator whose verdict is reported
+// next to the policy verdict for pod-bearing objects
+// Passing nil disables the evaluation
+func (p *PolicySimulator) SetPodSecurity(evaluator *podsecurity.Evaluator) {
+	p.podSecurity = evaluator
+}
+
+// SetWaivers sets the waivers accepting policy violations
+// Passing nil disables waivers
+func (p *PolicySimulator) SetWaivers(waivers *waiver.Set) {
+	p.waivers = waivers
+}
+
+// SetParams sets the parameter objects the paramRef of bindings select from, when no
+// parameter is given for the test case
+// Passing nil leaves bindings with only the given parameter
+func (p *PolicySimulator) SetParams(params []*unstructured.Unstructured) {
+	p.params = params
+}
+
+// SetNamespaces sets the namespaces whose labels the namespace selectors of bindings match
+// Passing nil matches namespace selectors on the namespace name only
+func (p *PolicySimulator) SetNamespaces(namespaces []*corev1.Namespace) {
+	p.namespaces = namespaces
+}
+
+// SummarizePodSecurity counts divergences between policy and Pod Security Admission verdicts
+// It returns nil when Pod Security Admission evaluation is disabled
+func (p *PolicySimulator) SummarizePodSecurity(results []kaptestv1.TestResult) *kaptestv1.PodSecuritySummary {
+	if p.podSecurity == nil {
+		return nil
+	}
+	return p.podSecurity.Summarize(results)
+}
+
+// AddPodSecurity counts the divergence between the policy and Pod Security Admission verdicts of
+// a result in a summary of SummarizePodSecurity, and does nothing for a nil summary
+func (p *PolicySimulator) AddPodSecurity(summary *kaptestv1.PodSecuritySummary, result *kaptestv1.TestResult) {
+	if summary == nil {
+		return
+	}
+	podsecurity.Add(summary, result)
+}
+
 // SimulateTestCase simulates a single test case
 func (p *PolicySimulator) SimulateTestCase(
 	ctx context.Context,
@@ -57,100 +159,31 @@ func (p *PolicySimulator) SimulateTestCase(
 		Success: false,
 	}
 
-	// Convert object
-	reqObj, err := p.convertRawExtension(testCase.Object)
-	if err != nil {
-		return result, fmt.Errorf("failed to convert object: %w", err)
+	reqObj, oldObj, err := p.prepareObjects(testCase)
+	var rejection *plugins.RejectionError
+	if errors.As(err, &rejection) {
+		// Requests rejected by an admission plugin never reach the policies
+		result.ActualResponse = rejectionResponse(rejection)
+		result.RejectedBy = rejection.Plugin
+		return p.completeResult(reqObj, testCase, result)
 	}
-
-	var oldObj *unstructured.Unstructured
-	if testCase.OldObject != nil {
-		oldObj, err = p.convertRawExtension(*testCase.OldObject)
-		if err != nil {
-			return result, fmt.Errorf("failed to convert old object: %w", err)
-		}
-	}
-
-	// Setup evaluation context
-	if err := p.validator.SetupEvaluationContext(reqObj, oldObj, paramObj, testCase.Operation); err != nil {
-		return result, fmt.Errorf("failed to set up evaluation context: %w", err)
-	}
-
-	// Check if policy matches the object
-	objectMap, err := runtime.DefaultUnstructuredConverter.ToUnstructured(reqObj)
 	if err != nil {
-		return result, fmt.Errorf("failed to convert object to map: %w", err)
+		return result, err
 	}
 
-	matches, err := p.evaluator.MatchesPolicy(policy, objectMap)
-	if err != nil {
-		return result, fmt.Errorf("failed to check policy match: %w", err)
+	// The engine decides whether the policy matches the request
+	request := &EvaluationRequest{
+		Policies:  []*admissionregistrationv1.ValidatingAdmissionPolicy{policy},
+		ParamObj:  paramObj,
+		Object:    reqObj,
+		OldObject: oldObj,
+		Operation: testCase.Operation,
 	}
-
-	// If policy doesn't match, allow the object (policy is not applicable)
-	var validationResult ValidationResult
-	if !matches {
-		result.ActualResponse = &kaptestv1.ResponseDetails{
-			Allowed: true,
-			Reason:  "",
-			Message: "",
-		}
-		validationResult = NewValidationResult(true, nil)
-	} else {
-		// Validate policy
-		validationResult = p.validator.ValidatePolicy(ctx, policy, true)
-
-		// Set actual response
-		result.ActualResponse = &kaptestv1.ResponseDetails{
-			Allowed: validationResult.IsAllowed(),
-			Reason:  validationResult.GetReason(),
-			Message: validationResult.GetMessage(),
-		}
-	}
-
-	// Compare with expected result
-	if validationResult.IsAllowed() == testCase.Expected.Allowed {
-		// Allow/deny result matches
-		if !validationResult.IsAllowed() {
-			// For deny, also check reason and message
-			reasonMatch := testCase.Expected.Reason == "" || 
-				testCase.Expected.Reason == validationResult.GetReason() || 
-				strings.Contains(validationResult.GetReason(), testCase.Expected.Reason)
-			
-			messageMatch := true
-			if testCase.Expected.Message != "" {
-				messageMatch = testCase.Expected.Message == validationResult.GetMessage() || 
-					strings.Contains(validationResult.GetMessage(), testCase.Expected.Message)
-			}
-			if testCase.Expected.MessageContains != "" {
-				messageMatch = messageMatch && strings.Contains(validationResult.GetMessage(), testCase.Expected.MessageContains)
-			}
-
-			if reasonMatch && messageMatch {
-				result.Success = true
-			} else {
-				result.Details = fmt.Sprintf(
-					"actual response does not match expected. Expected: (reason=%s, message=%s, messageContains=%s), Actual: (reason=%s, message=%s)",
-					testCase.Expected.Reason,
-					testCase.Expected.Message,
-					testCase.Expected.MessageContains,
-					validationResult.GetReason(),
-					validationResult.GetMessage(),
-				)
-			}
-		} else {
-			result.Success = true
-		}
-	} else {
-		result.Success = false
-		result.Details = fmt.Sprintf(
-			"expected result (allowed=%t) and actual result (allowed=%t) does not match",
-			testCase.Expected.Allowed,
-			validationResult.IsAllowed(),
-		)
+	if err := p.evaluate(ctx, request, result); err != nil {
+		return result, err
 	}
 
-	return result, nil
+	return p.completeResult(reqObj, testCase, result)
 }
 
 // SimulateWithPolicyBindings simulates test cases with multiple policies and bindings
@@ -167,135 +200,230 @@ func (p *PolicySimulator) SimulateWithPolicyBindings(
 		Success: false,
 	}
 
+	reqObj, oldObj, err := p.prepareObjects(testCase)
+	var rejection *plugins.RejectionError
+	if errors.As(err, &rejection) {
+		// Requests rejected by an admission plugin never reach the policies
+		result.ActualResponse = rejectionResponse(rejection)
+		result.RejectedBy = rejection.Plugin
+		return p.completeResult(reqObj, testCase, result)
+	}
+	if err != nil {
+		return result, err
+	}
+
+	request := &EvaluationRequest{
+		Policies:   policies,
+		Bindings:   bindings,
+		ParamObj:   paramObj,
+		Object:     reqObj,
+		OldObject:  oldObj,
+		Operation:  testCase.Operation,
+		Params:     p.params,
+		Namespaces: p.namespaces,
+	}
+	if err := p.evaluate(ctx, request, result); err != nil {
+		return result, err
+	}
+
+	return p.completeResult(reqObj, testCase, result)
+}
+
+// convertRawExtension converts a RawExtension to an Unstructured object
+func (p *PolicySimulator) convertRawExtension(raw runtime.RawExtension) (*unstructured.Unstructured, error) {
+	// Parse the object
+	obj := &unstructured.Unstructured{}
+
+	// If raw JSON is provided, parse it
+	if len(raw.Raw) > 0 {
+		if err := json.Unmarshal(raw.Raw, obj); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal raw extension: %w", err)
+		}
+		return obj, nil
+	}
+
+	// If object is provided, convert it
+	if raw.Object != nil {
+		// If it's already an Unstructured, return it
+		if u, ok := raw.Object.(*unstructured.Unstructured); ok {
+			return u, nil
+		}
+
+		// Otherwise convert it
+		content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(raw.Object)
+		if err != nil {
+			return nil, fmt.Errorf("failed to convert object to unstructured: %w", err)
+		}
+		obj.SetUnstructuredContent(content)
+		return obj, nil
+	}
+
+	return nil, fmt.Errorf("raw extension has neither raw nor object")
+}
+
+// prepareObjects converts the test case objects and applies defaulting and admission plugins
+// Requests rejected by an admission plugin return the object with a *plugins.RejectionError
+func (p *PolicySimulator) prepareObjects(testCase kaptestv1.TestCase) (*unstructured.Unstructured, *unstructured.Unstructured, error) {
 	// Convert object
 	reqObj, err := p.convertRawExtension(testCase.Object)
 	if err != nil {
-		return result, fmt.Errorf("failed to convert object: %w", err)
+		return nil, nil, fmt.Errorf("failed to convert object: %w", err)
+	}
+
+	// Apply API defaults and built-in mutating admission plugins before validation
+	reqObj, err = p.admitObject(reqObj, testCase)
+	if err != nil {
+		return reqObj, nil, err
 	}
 
 	var oldObj *unstructured.Unstructured
 	if testCase.OldObject != nil {
 		oldObj, err = p.convertRawExtension(*testCase.OldObject)
 		if err != nil {
-			return result, fmt.Errorf("failed to convert old object: %w", err)
+			return nil, nil, fmt.Errorf("failed to convert old object: %w", err)
 		}
-	}
 
-	// Create evaluation context
-	if err := p.validator.SetupEvaluationContext(reqObj, oldObj, paramObj, testCase.Operation); err != nil {
-		return result, fmt.Errorf("failed to set up evaluation context: %w", err)
-	}
-
-	// Initialize policy results
-	policyResults := make([]kaptestv1.PolicyResult, 0, len(policies))
-	finalAllowed := true
-	finalReason := ""
-	finalMessage := ""
-
-	// Create policy and binding mapping
-	policyBindings := make(map[string][]*admissionregistrationv1.ValidatingAdmissionPolicyBinding)
-	for _, binding := range bindings {
-		policyName := binding.Spec.PolicyName
-		policyBindings[policyName] = append(policyBindings[policyName], binding)
-	}
-
-	// Evaluate each policy
-	for _, policy := range policies {
-		// Check if policy has bindings
-		relatedBindings, hasBindings := policyBindings[policy.Name]
-		
-		// If no bindings, evaluate policy directly
-		if !hasBindings || len(relatedBindings) == 0 {
-			validationResult := p.validator.ValidatePolicy(ctx, policy, true)
-			
-			policyResult := kaptestv1.PolicyResult{
-				PolicyName: policy.Name,
-				Allowed:    validationResult.IsAllowed(),
-				Reason:     validationResult.GetReason(),
-				Message:    validationResult.GetMessage(),
-			}
-			policyResults = append(policyResults, policyResult)
-
-			if !validationResult.IsAllowed() {
-				finalAllowed = false
-				if finalReason == "" {
-					finalReason = validationResult.GetReason()
-				}
-				if finalMessage == "" {
-					finalMessage = validationResult.GetMessage()
-				} else {
-					finalMessage = fmt.Sprintf("%s; %s", finalMessage, validationResult.GetMessage())
-				}
+		// The stored object has already been defaulted by the apiserver
+		if p.shouldApplyDefaults(testCase) {
+			oldObj, err = p.defaulter.Default(oldObj)
+			if err != nil {
+				return nil, nil, fmt.Errorf("failed to apply defaults to old object: %w", err)
 			}
-			continue
 		}
+	}
 
-		// Evaluate policy with bindings
-		bindingMatched := false
-		for _, binding := range relatedBindings {
-			// Check if binding matches the object
-			if !p.matchesBinding(binding, reqObj, testCase.Operation) {
-				continue
-			}
-			bindingMatched = true
-
-			// Check validation action
-			if !p.shouldValidate(binding.Spec.ValidationActions) {
-				continue
-			}
+	return reqObj, oldObj, nil
+}
 
-			// Evaluate policy
-			validationResult := p.validator.ValidatePolicy(ctx, policy, true)
-			
-			policyResult := kaptestv1.PolicyResult{
-				PolicyName: policy.Name,
-				Allowed:    validationResult.IsAllowed(),
-				Reason:     validationResult.GetReason(),
-				Message:    validationResult.GetMessage(),
-			}
-			policyResults = append(policyResults, policyResult)
-
-			if !validationResult.IsAllowed() {
-				finalAllowed = false
-				if finalReason == "" {
-					finalReason = validationResult.GetReason()
-				}
-				if finalMessage == "" {
-					finalMessage = validationResult.GetMessage()
-				} else {
-					finalMessage = fmt.Sprintf("%s; %s", finalMessage, validationResult.GetMessage())
-				}
-			}
-			break // Only evaluate once per policy
+// admitObject prepares the object the way the apiserver does before validating admission:
+// API defaulting first, then the configured admission plugins
+// The input object is never modified, and requests rejected by a plugin return the defaulted
+// object with a *plugins.RejectionError
+func (p *PolicySimulator) admitObject(obj *unstructured.Unstructured, testCase kaptestv1.TestCase) (*unstructured.Unstructured, error) {
+	var err error
+	if p.shouldApplyDefaults(testCase) {
+		obj, err = p.defaulter.Default(obj)
+		if err != nil {
+			return nil, fmt.Errorf("failed to apply defaults: %w", err)
 		}
+	}
+
+	if p.admissionChain.Empty() {
+		return obj, nil
+	}
 
-		// If no binding matched, skip this policy
-		if !bindingMatched {
-			continue
+	mutated := obj.DeepCopy()
+	if err := p.admissionChain.Admit(mutated, testCase.Operation); err != nil {
+		var rejection *plugins.RejectionError
+		if errors.As(err, &rejection) {
+			return obj, rejection
 		}
+		return nil, fmt.Errorf("failed to apply admission plugins: %w", err)
+	}
+	return mutated, nil
+}
+
+// rejectionResponse returns the apiserver response to a request rejected by an admission plugin
+func rejectionResponse(rejection *plugins.RejectionError) *kaptestv1.ResponseDetails {
+	return &kaptestv1.ResponseDetails{
+		Allowed: false,
+		Reason:  string(apierrors.ReasonForError(rejection.Err)),
+		Message: rejection.Error(),
 	}
+}
 
-	// Set final result
-	result.PolicyResults = policyResults
+// evaluate runs the engine and records its verdict in the result
+// In differential mode the second engine's verdict is recorded next to it
+func (p *PolicySimulator) evaluate(ctx context.Context, request *EvaluationRequest, result *kaptestv1.TestResult) error {
+	response, err := p.engine.Evaluate(ctx, request)
+	if err != nil {
+		return fmt.Errorf("failed to evaluate policies with %s engine: %w", p.engine.Name(), err)
+	}
+
+	result.PolicyResults = response.PolicyResults
+	result.ExpressionErrors = response.ExpressionErrors
 	result.ActualResponse = &kaptestv1.ResponseDetails{
-		Allowed: finalAllowed,
-		Reason:  finalReason,
-		Message: finalMessage,
+		Allowed: response.Allowed,
+		Reason:  response.Reason,
+		Message: response.Message,
+	}
+
+	if p.differentialEngine == nil {
+		return nil
+	}
+
+	// Errors of the second engine fail the test case, not the whole run
+	other, err := p.differentialEngine.Evaluate(ctx, request)
+	if err != nil {
+		result.Differential = &kaptestv1.EngineComparison{
+			Engine: p.differentialEngine.Name(),
+			Error:  err.Error(),
+		}
+		return nil
 	}
 
+	result.Differential = &kaptestv1.EngineComparison{
+		Engine:  p.differentialEngine.Name(),
+		Allowed: other.Allowed,
+		Reason:  other.Reason,
+		Message: other.Message,
+		Agree:   responsesAgree(response, other),
+	}
+	return nil
+}
+
+// responsesAgree reports whether two engines reached the same verdict
+// Engines format denial messages differently, so denials agree when
+// a denial message of one engine is part of the other engine's message
+func responsesAgree(a, b *EvaluationResponse) bool {
+	if a.Allowed != b.Allowed {
+		return false
+	}
+	if a.Allowed {
+		return true
+	}
+
+	return containsDenialMessage(a.PolicyResults, b.Message) || containsDenialMessage(b.PolicyResults, a.Message)
+}
+
+// containsDenialMessage checks if the message contains the message of a denying policy
+func containsDenialMessage(policyResults []kaptestv1.PolicyResult, message string) bool {
+	for _, policyResult := range policyResults {
+		if !policyResult.Allowed && policyResult.Message != "" && strings.Contains(message, policyResult.Message) {
+			return true
+		}
+	}
+	return false
+}
+
+// completeResult applies waivers, adds the Pod Security Admission verdict and compares the actual response with the expected result
+func (p *PolicySimulator) completeResult(reqObj *unstructured.Unstructured, testCase kaptestv1.TestCase, result *kaptestv1.TestResult) (*kaptestv1.TestResult, error) {
+	p.waivers.Apply(reqObj, result)
+
+	if err := p.evaluatePodSecurity(reqObj, testCase, result); err != nil {
+		return result, err
+	}
+
+	expected := testCase.Expected
+	result.ExpectedResponse = &expected
+
+	actualAllowed := result.ActualResponse.Allowed
+	actualReason := result.ActualResponse.Reason
+	actualMessage := result.ActualResponse.Message
+
 	// Compare with expected result
-	if finalAllowed == testCase.Expected.Allowed {
+	if actualAllowed == testCase.Expected.Allowed {
 		// Allow/deny result matches
-		if !finalAllowed {
+		if !actualAllowed {
 			// For deny, also check reason and message
-			reasonMatch := testCase.Expected.Reason == "" || testCase.Expected.Reason == finalReason || strings.Contains(finalReason, testCase.Expected.Reason)
+			reasonMatch := testCase.Expected.Reason == "" || testCase.Expected.Reason == actualReason || strings.Contains(actualReason, testCase.Expected.Reason)
 			messageMatch := true
 
 			if testCase.Expected.Message != "" {
-				messageMatch = testCase.Expected.Message == finalMessage || strings.Contains(finalMessage, testCase.Expected.Message)
+				messageMatch = testCase.Expected.Message == actualMessage || strings.Contains(actualMessage, testCase.Expected.Message)
 			}
 			if testCase.Expected.MessageContains != "" {
-				messageMatch = messageMatch && strings.Contains(finalMessage, testCase.Expected.MessageContains)
+				messageMatch = messageMatch && strings.Contains(actualMessage, testCase.Expected.MessageContains)
 			}
 
 			if reasonMatch && messageMatch {
@@ -306,8 +434,8 @@ func (p *PolicySimulator) SimulateWithPolicyBindings(
 					testCase.Expected.Reason,
 					testCase.Expected.Message,
 					testCase.Expected.MessageContains,
-					finalReason,
-					finalMessage,
+					actualReason,
+					actualMessage,
 				)
 			}
 		} else {
@@ -318,75 +446,61 @@ func (p *PolicySimulator) SimulateWithPolicyBindings(
 		result.Details = fmt.Sprintf(
 			"expected result (allowed=%t) and actual result (allowed=%t) does not match",
 			testCase.Expected.Allowed,
-			finalAllowed,
+			actualAllowed,
 		)
 	}
 
-	return result, nil
-}
-
-// convertRawExtension converts a RawExtension to an Unstructured object
-func (p *PolicySimulator) convertRawExtension(raw runtime.RawExtension) (*unstructured.Unstructured, error) {
-	// Parse the object
-	obj := &unstructured.Unstructured{}
-	
-	// If raw JSON is provided, parse it
-	if len(raw.Raw) > 0 {
-		if err := json.Unmarshal(raw.Raw, obj); err != nil {
-			return nil, fmt.Errorf("failed to unmarshal raw extension: %w", err)
-		}
-		return obj, nil
-	}
-
-	// If object is provided, convert it
-	if raw.Object != nil {
-		// If it's already an Unstructured, return it
-		if u, ok := raw.Object.(*unstructured.Unstructured); ok {
-			return u, nil
+	// In differential mode, engines must agree
+	if result.Differential != nil && !result.Differential.Agree {
+		result.Success = false
+		disagreement := fmt.Sprintf(
+			"engines disagree: %s (allowed=%t, message=%s), %s (allowed=%t, message=%s)",
+			p.engine.Name(),
+			actualAllowed,
+			actualMessage,
+			result.Differential.Engine,
+			result.Differential.Allowed,
+			result.Differential.Message,
+		)
+		if result.Differential.Error != "" {
+			disagreement = fmt.Sprintf("%s engine failed: %s", result.Differential.Engine, result.Differential.Error)
 		}
-
-		// Otherwise convert it
-		content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(raw.Object)
-		if err != nil {
-			return nil, fmt.Errorf("failed to convert object to unstructured: %w", err)
+		if result.Details == "" {
+			result.Details = disagreement
+		} else {
+			result.Details = fmt.Sprintf("%s; %s", result.Details, disagreement)
 		}
-		obj.SetUnstructuredContent(content)
-		return obj, nil
 	}
 
-	return nil, fmt.Errorf("raw extension has neither raw nor object")
+	return result, nil
 }
 
-// matchesBinding checks if a binding matches the object
-func (p *PolicySimulator) matchesBinding(
-	binding *admissionregistrationv1.ValidatingAdmissionPolicyBinding,
-	obj *unstructured.Unstructured,
-	operation string,
-) bool {
-	if binding.Spec.MatchResources == nil {
-		return true
+// evaluatePodSecurity records the Pod Security Admission verdict for pod-bearing objects
+// DELETE requests are skipped, as the PodSecurity admission plugin does
+func (p *PolicySimulator) evaluatePodSecurity(obj *unstructured.Unstructured, testCase kaptestv1.TestCase, result *kaptestv1.TestResult) error {
+	if p.podSecurity == nil || strings.EqualFold(testCase.Operation, "DELETE") {
+		return nil
 	}
 
-	target := admission.NewAdmissionTarget(obj, operation)
-	return selector.Matches(binding.Spec.MatchResources, target)
-}
-
-// shouldValidate checks if validation should be performed based on validation actions
-func (p *PolicySimulator) shouldValidate(actions []admissionregistrationv1.ValidationAction) bool {
-	// If no actions specified, default to Deny
-	if len(actions) == 0 {
-		return true
+	podSecurityResult, err := p.podSecurity.Evaluate(obj)
+	if err != nil {
+		return fmt.Errorf("failed to evaluate pod security: %w", err)
 	}
-
-	// Check if Deny action is present
-	for _, action := range actions {
-		if action == admissionregistrationv1.Deny {
-			return true
-		}
+	if podSecurityResult == nil {
+		return nil
 	}
 
-	// Only Warn or Audit actions, skip validation
-	return false
+	podsecurity.Compare(podSecurityResult, result.ActualResponse.Allowed)
+	result.PodSecurity = podSecurityResult
+	return nil
+}
+
+// shouldApplyDefaults returns whether API defaulting is enabled for the test case
+func (p *PolicySimulator) shouldApplyDefaults(testCase kaptestv1.TestCase) bool {
+	if testCase.ApplyDefaults != nil {
+		return *testCase.ApplyDefaults
+	}
+	return p.applyDefaults
 }
 
 // RunPolicyTests executes policy tests
@@ -403,6 +517,7 @@ func (p *PolicySimulator) RunPolicyTests(
 			Successful: 0,
 			Failed:     0,
 		},
+		Engine: p.EngineName(),
 	}
 
 	for _, testCase := range testCases {
@@ -419,6 +534,7 @@ func (p *PolicySimulator) RunPolicyTests(
 			status.Summary.Failed++
 		}
 	}
+	status.PodSecurity = p.SummarizePodSecurity(status.Results)
 
 	return status, nil
 }
@@ -438,6 +554,7 @@ func (p *PolicySimulator) RunPolicyTestsWithBindings(
 			Successful: 0,
 			Failed:     0,
 		},
+		Engine: p.EngineName(),
 	}
 
 	for _, testCase := range testCases {
@@ -454,6 +571,7 @@ func (p *PolicySimulator) RunPolicyTestsWithBindings(
 			status.Summary.Failed++
 		}
 	}
+	status.PodSecurity = p.SummarizePodSecurity(status.Results)
 
 	return status, nil
 }
@@ -471,114 +589,12 @@ func (p *PolicySimulator) RunPolicyTestsWithMultiPolicies(
 }
 
 // SimulateTestCaseWithMultiPolicies simulates a single test case with multiple policies
+// Every policy is evaluated, regardless of bindings
 func (p *PolicySimulator) SimulateTestCaseWithMultiPolicies(
 	ctx context.Context,
 	policies []*admissionregistrationv1.ValidatingAdmissionPolicy,
 	paramObj runtime.Object,
 	testCase kaptestv1.TestCase,
 ) (*kaptestv1.TestResult, error) {
-	// Initialize test result
-	result := &kaptestv1.TestResult{
-		Name:          testCase.Name,
-		Success:       false,
-		PolicyResults: make([]kaptestv1.PolicyResult, 0, len(policies)),
-	}
-
-	// Convert object
-	reqObj, err := p.convertRawExtension(testCase.Object)
-	if err != nil {
-		return result, fmt.Errorf("failed to convert object: %w", err)
-	}
-
-	var oldObj *unstructured.Unstructured
-	if testCase.OldObject != nil {
-		oldObj, err = p.convertRawExtension(*testCase.OldObject)
-		if err != nil {
-			return result, fmt.Errorf("failed to convert old object: %w", err)
-		}
-	}
-
-	// Create evaluation context
-	if err := p.validator.SetupEvaluationContext(reqObj, oldObj, paramObj, testCase.Operation); err != nil {
-		return result, fmt.Errorf("failed to set up evaluation context: %w", err)
-	}
-
-	// Evaluate all policies
-	finalAllowed := true
-	var finalReason, finalMessage string
-
-	for _, policy := range policies {
-		// Evaluate each policy
-		validationResult := p.validator.ValidatePolicy(ctx, policy, true)
-
-		// Record individual policy result
-		policyResult := kaptestv1.PolicyResult{
-			PolicyName: policy.Name,
-			Allowed:    validationResult.IsAllowed(),
-			Reason:     validationResult.GetReason(),
-			Message:    validationResult.GetMessage(),
-		}
-		result.PolicyResults = append(result.PolicyResults, policyResult)
-
-		// If any policy denies, overall deny
-		if !validationResult.IsAllowed() {
-			finalAllowed = false
-			if finalReason == "" {
-				finalReason = validationResult.GetReason()
-			}
-			if finalMessage == "" {
-				finalMessage = validationResult.GetMessage()
-			} else {
-				finalMessage = fmt.Sprintf("%s; %s", finalMessage, validationResult.GetMessage())
-			}
-		}
-	}
-
-	// Set final result
-	result.ActualResponse = &kaptestv1.ResponseDetails{
-		Allowed: finalAllowed,
-		Reason:  finalReason,
-		Message: finalMessage,
-	}
-
-	// Compare with expected result
-	if finalAllowed == testCase.Expected.Allowed {
-		// Allow/deny result matches
-		if !finalAllowed {
-			// For deny, also check reason and message
-			reasonMatch := testCase.Expected.Reason == "" || testCase.Expected.Reason == finalReason || strings.Contains(finalReason, testCase.Expected.Reason)
-			messageMatch := true
-
-			if testCase.Expected.Message != "" {
-				messageMatch = testCase.Expected.Message == finalMessage || strings.Contains(finalMessage, testCase.Expected.Message)
-			}
-			if testCase.Expected.MessageContains != "" {
-				messageMatch = messageMatch && strings.Contains(finalMessage, testCase.Expected.MessageContains)
-			}
-
-			if reasonMatch && messageMatch {
-				result.Success = true
-			} else {
-				result.Details = fmt.Sprintf(
-					"actual response does not match expected. Expected: (reason=%s, message=%s, messageContains=%s), Actual: (reason=%s, message=%s)",
-					testCase.Expected.Reason,
-					testCase.Expected.Message,
-					testCase.Expected.MessageContains,
-					finalReason,
-					finalMessage,
-				)
-			}
-		} else {
-			result.Success = true
-		}
-	} else {
-		result.Success = false
-		result.Details = fmt.Sprintf(
-			"expected result (allowed=%t) and actual result (allowed=%t) does not match",
-			testCase.Expected.Allowed,
-			finalAllowed,
-		)
-	}
-
-	return result, nil
-}
\ No newline at end of file
+	return p.SimulateWithPolicyBindings(ctx, policies, nil, paramObj, testCase)
+}
@@ -3,14 +3,19 @@ package engine
 import (
 	"context"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
 
+	"github.com/yashirook/kube-vap-test/internal/engine/plugins"
+	"github.com/yashirook/kube-vap-test/internal/engine/podsecurity"
+	"github.com/yashirook/kube-vap-test/internal/engine/waiver"
 	kaptestv1 "github.com/yashirook/kube-vap-test/pkg/apis/admission/v1"
 )
 
@@ -473,4 +478,448 @@ func TestSimulatorMatchesPolicy(t *testing.T) {
 			// For now, this test is a placeholder
 		})
 	}
-}
\ No newline at end of file
+}
+func TestSimulatorApplyDefaults(t *testing.T) {
+	simulator, err := NewPolicySimulator()
+	require.NoError(t, err, "Failed to create policy simulator")
+
+	policy := &admissionregistrationv1.ValidatingAdmissionPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: "pull-always"},
+		Spec: admissionregistrationv1.ValidatingAdmissionPolicySpec{
+			Validations: []admissionregistrationv1.Validation{
+				{
+					Expression: "object.spec.containers.all(c, has(c.imagePullPolicy) && c.imagePullPolicy == 'Always')",
+					Message:    "imagePullPolicy must be Always",
+				},
+			},
+		},
+	}
+
+	newTestCase := func(applyDefaults *bool) kaptestv1.TestCase {
+		return kaptestv1.TestCase{
+			Name:      "untagged-image",
+			Operation: "CREATE",
+			Object: runtime.RawExtension{Object: &unstructured.Unstructured{Object: map[string]interface{}{
+				"apiVersion": "v1",
+				"kind":       "Pod",
+				"metadata":   map[string]interface{}{"name": "test-pod", "namespace": "default"},
+				"spec": map[string]interface{}{
+					"containers": []interface{}{map[string]interface{}{"name": "nginx", "image": "nginx"}},
+				},
+			}}},
+			ApplyDefaults: applyDefaults,
+		}
+	}
+	enabled, disabled := true, false
+
+	// Raw objects are evaluated as written
+	result, err := simulator.SimulateTestCaseWithMultiPolicies(context.Background(), []*admissionregistrationv1.ValidatingAdmissionPolicy{policy}, nil, newTestCase(nil))
+	require.NoError(t, err)
+	assert.False(t, result.ActualResponse.Allowed)
+
+	// The test case can enable defaulting on its own
+	result, err = simulator.SimulateTestCaseWithMultiPolicies(context.Background(), []*admissionregistrationv1.ValidatingAdmissionPolicy{policy}, nil, newTestCase(&enabled))
+	require.NoError(t, err)
+	assert.True(t, result.ActualResponse.Allowed)
+
+	// And can opt out when defaulting is enabled globally
+	simulator.SetApplyDefaults(true)
+	result, err = simulator.SimulateTestCaseWithMultiPolicies(context.Background(), []*admissionregistrationv1.ValidatingAdmissionPolicy{policy}, nil, newTestCase(&disabled))
+	require.NoError(t, err)
+	assert.False(t, result.ActualResponse.Allowed)
+
+	result, err = simulator.SimulateTestCaseWithMultiPolicies(context.Background(), []*admissionregistrationv1.ValidatingAdmissionPolicy{policy}, nil, newTestCase(nil))
+	require.NoError(t, err)
+	assert.True(t, result.ActualResponse.Allowed)
+}
+
+// recordingEngine records the requests it evaluates and admits them
+type recordingEngine struct {
+	operations []string
+}
+
+func (e *recordingEngine) Name() string { return "recording" }
+
+func (e *recordingEngine) Evaluate(_ context.Context, request *EvaluationRequest) (*EvaluationResponse, error) {
+	e.operations = append(e.operations, request.Operation)
+	return &EvaluationResponse{Allowed: true}, nil
+}
+
+func TestSimulateTestCaseMatchConstraints(t *testing.T) {
+	simulator, err := NewPolicySimulator()
+	require.NoError(t, err, "Failed to create policy simulator")
+
+	// The policy only intercepts pod updates
+	policy := newSimulatorTestHelper(t).loadDefaultTestPolicy()
+	policy.Spec.MatchConstraints = &admissionregistrationv1.MatchResources{
+		ResourceRules: []admissionregistrationv1.NamedRuleWithOperations{{
+			RuleWithOperations: admissionregistrationv1.RuleWithOperations{
+				Operations: []admissionregistrationv1.OperationType{admissionregistrationv1.Update},
+				Rule: admissionregistrationv1.Rule{
+					APIGroups:   []string{""},
+					APIVersions: []string{"v1"},
+					Resources:   []string{"pods"},
+				},
+			},
+		}},
+	}
+	pod := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Pod",
+		"metadata":   map[string]interface{}{"name": "privileged", "namespace": "default"},
+		"spec": map[string]interface{}{
+			"containers": []interface{}{map[string]interface{}{
+				"name":            "nginx",
+				"image":           "nginx",
+				"securityContext": map[string]interface{}{"privileged": true},
+			}},
+		},
+	}}
+	newTestCase := func(operation string) kaptestv1.TestCase {
+		testCase := kaptestv1.TestCase{
+			Name:      operation,
+			Operation: operation,
+			Object:    runtime.RawExtension{Object: pod},
+		}
+		if operation == "UPDATE" {
+			testCase.OldObject = &runtime.RawExtension{Object: pod}
+		}
+		return testCase
+	}
+
+	result, err := simulator.SimulateTestCase(context.Background(), policy, nil, newTestCase("CREATE"))
+	require.NoError(t, err)
+	assert.True(t, result.ActualResponse.Allowed, "Creations are not intercepted")
+
+	result, err = simulator.SimulateTestCase(context.Background(), policy, nil, newTestCase("UPDATE"))
+	require.NoError(t, err)
+	assert.False(t, result.ActualResponse.Allowed)
+
+	// The engine decides matching, so it sees every request
+	recorder := &recordingEngine{}
+	simulator.SetEngine(recorder)
+	for _, operation := range []string{"CREATE", "UPDATE"} {
+		_, err := simulator.SimulateTestCase(context.Background(), policy, nil, newTestCase(operation))
+		require.NoError(t, err)
+	}
+	assert.Equal(t, []string{"CREATE", "UPDATE"}, recorder.operations)
+}
+
+func TestSimulatorAdmissionPluginRejection(t *testing.T) {
+	simulator, err := NewPolicySimulator()
+	require.NoError(t, err, "Failed to create policy simulator")
+
+	chain, err := plugins.NewChain([]string{plugins.ServiceAccount}, &plugins.Fixtures{
+		ServiceAccounts: []*corev1.ServiceAccount{{ObjectMeta: metav1.ObjectMeta{Name: "builder", Namespace: "ci"}}},
+	})
+	require.NoError(t, err)
+	simulator.SetAdmissionPlugins(chain)
+
+	policy := newSimulatorTestHelper(t).loadDefaultTestPolicy()
+	newTestCase := func(namespace string) kaptestv1.TestCase {
+		return kaptestv1.TestCase{
+			Name:      "builder-in-" + namespace,
+			Operation: "CREATE",
+			Object: runtime.RawExtension{Object: &unstructured.Unstructured{Object: map[string]interface{}{
+				"apiVersion": "v1",
+				"kind":       "Pod",
+				"metadata":   map[string]interface{}{"name": "build", "namespace": namespace},
+				"spec": map[string]interface{}{
+					"serviceAccountName": "builder",
+					"containers":         []interface{}{map[string]interface{}{"name": "build", "image": "builder:1.0"}},
+				},
+			}}},
+			Expected: kaptestv1.ExpectedResult{Allowed: false, Reason: "Forbidden", MessageContains: `serviceaccount "builder" not found`},
+		}
+	}
+
+	// The service account exists, so the policies evaluate the pod
+	result, err := simulator.SimulateTestCaseWithMultiPolicies(context.Background(), []*admissionregistrationv1.ValidatingAdmissionPolicy{policy}, nil, newTestCase("ci"))
+	require.NoError(t, err)
+	assert.True(t, result.ActualResponse.Allowed)
+	assert.Empty(t, result.RejectedBy)
+
+	// A missing service account is denied as the apiserver does, and the test case can expect it
+	result, err = simulator.SimulateTestCaseWithMultiPolicies(context.Background(), []*admissionregistrationv1.ValidatingAdmissionPolicy{policy}, nil, newTestCase("default"))
+	require.NoError(t, err)
+	assert.True(t, result.Success, result.Details)
+	assert.Equal(t, plugins.ServiceAccount, result.RejectedBy)
+	assert.Empty(t, result.PolicyResults)
+	assert.Equal(t, &kaptestv1.ResponseDetails{
+		Allowed: false,
+		Reason:  "Forbidden",
+		Message: `pods "build" is forbidden: error looking up service account default/builder: serviceaccount "builder" not found`,
+	}, result.ActualResponse)
+}
+
+func TestSimulatorPodSecurity(t *testing.T) {
+	simulator, err := NewPolicySimulator()
+	require.NoError(t, err, "Failed to create policy simulator")
+
+	evaluator, err := podsecurity.NewEvaluator("baseline", "latest")
+	require.NoError(t, err)
+	simulator.SetPodSecurity(evaluator)
+
+	// The policy only checks hostNetwork, so it is looser than baseline for privileged containers
+	policy := &admissionregistrationv1.ValidatingAdmissionPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: "deny-host-network"},
+		Spec: admissionregistrationv1.ValidatingAdmissionPolicySpec{
+			Validations: []admissionregistrationv1.Validation{
+				{
+					Expression: "!has(object.spec.hostNetwork) || !object.spec.hostNetwork",
+					Message:    "hostNetwork is not allowed",
+				},
+			},
+		},
+	}
+
+	newTestCase := func(name string, spec map[string]interface{}) kaptestv1.TestCase {
+		return kaptestv1.TestCase{
+			Name:      name,
+			Operation: "CREATE",
+			Object: runtime.RawExtension{Object: &unstructured.Unstructured{Object: map[string]interface{}{
+				"apiVersion": "v1",
+				"kind":       "Pod",
+				"metadata":   map[string]interface{}{"name": name, "namespace": "default"},
+				"spec":       spec,
+			}}},
+			Expected: kaptestv1.ExpectedResult{Allowed: true},
+		}
+	}
+
+	testCases := []kaptestv1.TestCase{
+		newTestCase("plain", map[string]interface{}{
+			"containers": []interface{}{map[string]interface{}{"name": "nginx", "image": "nginx"}},
+		}),
+		newTestCase("privileged", map[string]interface{}{
+			"containers": []interface{}{map[string]interface{}{
+				"name":            "nginx",
+				"image":           "nginx",
+				"securityContext": map[string]interface{}{"privileged": true},
+			}},
+		}),
+	}
+
+	status, err := simulator.RunPolicyTestsWithMultiPolicies(context.Background(), []*admissionregistrationv1.ValidatingAdmissionPolicy{policy}, nil, testCases)
+	require.NoError(t, err)
+
+	require.NotNil(t, status.Results[0].PodSecurity)
+	assert.Equal(t, kaptestv1.PodSecurityAgree, status.Results[0].PodSecurity.Divergence)
+	require.NotNil(t, status.Results[1].PodSecurity)
+	assert.False(t, status.Results[1].PodSecurity.Allowed)
+	assert.Equal(t, kaptestv1.PodSecurityVAPLooser, status.Results[1].PodSecurity.Divergence)
+
+	// Pod Security Admission does not change the test outcome
+	assert.Equal(t, 2, status.Summary.Successful)
+	require.NotNil(t, status.PodSecurity)
+	assert.Equal(t, 2, status.PodSecurity.Evaluated)
+	assert.Equal(t, 1, status.PodSecurity.VAPLooser)
+}
+
+func TestPolicyResultViolations(t *testing.T) {
+	simulator, err := NewPolicySimulator()
+	require.NoError(t, err)
+
+	policy := &admissionregistrationv1.ValidatingAdmissionPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: "violations-policy"},
+		Spec: admissionregistrationv1.ValidatingAdmissionPolicySpec{
+			Validations: []admissionregistrationv1.Validation{
+				{Expression: "object.metadata.name != ''", Message: "name is required"},
+				{Expression: "object.metadata.name.startsWith('app-')", Message: "name must start with app-"},
+				{Expression: "object.spec.missingField > 1", Message: "invalid"},
+			},
+		},
+	}
+	testCase := kaptestv1.TestCase{
+		Name:      "violations",
+		Object:    runtime.RawExtension{Raw: []byte(`{"apiVersion":"v1","kind":"Pod","metadata":{"name":"web"},"spec":{}}`)},
+		Operation: "CREATE",
+	}
+
+	result, err := simulator.SimulateTestCaseWithMultiPolicies(context.Background(), []*admissionregistrationv1.ValidatingAdmissionPolicy{policy}, nil, testCase)
+	require.NoError(t, err)
+	require.Len(t, result.PolicyResults, 1)
+
+	// Violations name the failed validation, and whether it could not be evaluated
+	violations := result.PolicyResults[0].Violations
+	require.Len(t, violations, 2)
+	assert.Equal(t, "spec.validations[1]", violations[0].Field)
+	assert.Equal(t, "name must start with app-", violations[0].Message)
+	assert.False(t, violations[0].EvaluationError)
+	assert.Equal(t, "spec.validations[2]", violations[1].Field)
+	assert.True(t, violations[1].EvaluationError)
+}
+
+func TestSimulatorWaivers(t *testing.T) {
+	simulator, err := NewPolicySimulator()
+	require.NoError(t, err)
+
+	policy := &admissionregistrationv1.ValidatingAdmissionPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: "name-prefix"},
+		Spec: admissionregistrationv1.ValidatingAdmissionPolicySpec{
+			Validations: []admissionregistrationv1.Validation{
+				{Expression: "object.metadata.name.startsWith('app-')", Message: "name must start with app-"},
+			},
+		},
+	}
+	waivers, err := waiver.NewSet([]*kaptestv1.PolicyWaiver{{
+		ObjectMeta: metav1.ObjectMeta{Name: "legacy-pods"},
+		Spec: kaptestv1.PolicyWaiverSpec{
+			Policies:  []kaptestv1.WaivedPolicy{{Name: "name-prefix", Validations: []int{0}}},
+			Resources: []kaptestv1.WaivedResource{{Kind: "Pod", Name: "web"}},
+			Expires:   "2099-12-31",
+		},
+	}}, time.Now())
+	require.NoError(t, err)
+	simulator.SetWaivers(waivers)
+
+	testCase := kaptestv1.TestCase{
+		Name:      "waived",
+		Object:    runtime.RawExtension{Raw: []byte(`{"apiVersion":"v1","kind":"Pod","metadata":{"name":"web"},"spec":{}}`)},
+		Operation: "CREATE",
+		Expected:  kaptestv1.ExpectedResult{Allowed: true},
+	}
+
+	// Waived denials are allowed, and the waiver is recorded on the policy result
+	result, err := simulator.SimulateTestCaseWithMultiPolicies(context.Background(), []*admissionregistrationv1.ValidatingAdmissionPolicy{policy}, nil, testCase)
+	require.NoError(t, err)
+	assert.True(t, result.Success)
+	assert.True(t, result.Waived)
+	require.Len(t, result.PolicyResults, 1)
+	assert.False(t, result.PolicyResults[0].Allowed)
+	require.NotNil(t, result.PolicyResults[0].Waiver)
+	assert.Equal(t, "legacy-pods", result.PolicyResults[0].Waiver.Name)
+
+	// Other resources are still denied
+	testCase.Object = runtime.RawExtension{Raw: []byte(`{"apiVersion":"v1","kind":"Pod","metadata":{"name":"api"},"spec":{}}`)}
+	result, err = simulator.SimulateTestCaseWithMultiPolicies(context.Background(), []*admissionregistrationv1.ValidatingAdmissionPolicy{policy}, nil, testCase)
+	require.NoError(t, err)
+	assert.False(t, result.Success)
+	assert.False(t, result.Waived)
+	assert.Nil(t, result.PolicyResults[0].Waiver)
+}
+
+func TestSimulatorClusterParamsAndNamespaces(t *testing.T) {
+	simulator, err := NewPolicySimulator()
+	require.NoError(t, err)
+
+	policy := &admissionregistrationv1.ValidatingAdmissionPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: "allowed-registry"},
+		Spec: admissionregistrationv1.ValidatingAdmissionPolicySpec{
+			ParamKind: &admissionregistrationv1.ParamKind{APIVersion: "v1", Kind: "ConfigMap"},
+			Validations: []admissionregistrationv1.Validation{
+				{Expression: "object.spec.containers.all(c, c.image.startsWith(params.data.registry))", Message: "image registry is not allowed"},
+			},
+		},
+	}
+	allow := admissionregistrationv1.AllowAction
+	deny := admissionregistrationv1.DenyAction
+	binding := func(name string, paramRef *admissionregistrationv1.ParamRef) *admissionregistrationv1.ValidatingAdmissionPolicyBinding {
+		return &admissionregistrationv1.ValidatingAdmissionPolicyBinding{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Spec: admissionregistrationv1.ValidatingAdmissionPolicyBindingSpec{
+				PolicyName:        "allowed-registry",
+				ValidationActions: []admissionregistrationv1.ValidationAction{admissionregistrationv1.Deny},
+				ParamRef:          paramRef,
+				MatchResources: &admissionregistrationv1.MatchResources{
+					NamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"env": "prod"}},
+				},
+			},
+		}
+	}
+	configMap := func(namespace, name, registry string, labels map[string]interface{}) *unstructured.Unstructured {
+		metadata := map[string]interface{}{"name": name, "namespace": namespace}
+		if labels != nil {
+			metadata["labels"] = labels
+		}
+		return &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "ConfigMap",
+			"metadata":   metadata,
+			"data":       map[string]interface{}{"registry": registry},
+		}}
+	}
+	simulator.SetParams([]*unstructured.Unstructured{
+		configMap("team-a", "registry", "registry.example.com/", nil),
+		configMap("policies", "mirror", "mirror.example.com/", map[string]interface{}{"registry": "true"}),
+		configMap("policies", "internal", "internal.example.com/", map[string]interface{}{"registry": "true"}),
+	})
+	simulator.SetNamespaces([]*corev1.Namespace{
+		{ObjectMeta: metav1.ObjectMeta{Name: "team-a", Labels: map[string]string{"env": "prod"}}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "team-b", Labels: map[string]string{"env": "prod"}}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "team-c", Labels: map[string]string{"env": "dev"}}},
+	})
+
+	byName := binding("by-name", &admissionregistrationv1.ParamRef{Name: "registry", ParameterNotFoundAction: &deny})
+	tests := []struct {
+		name        string
+		binding     *admissionregistrationv1.ValidatingAdmissionPolicyBinding
+		paramObj    runtime.Object
+		namespace   string
+		image       string
+		wantAllowed bool
+		wantMessage string
+	}{
+		{name: "parameter of the object namespace", binding: byName, namespace: "team-a", image: "registry.example.com/nginx:1.25", wantAllowed: true},
+		{name: "denied with the parameter", binding: byName, namespace: "team-a", image: "docker.io/nginx:1.25", wantMessage: "image registry is not allowed"},
+		{name: "missing parameter", binding: byName, namespace: "team-b", image: "registry.example.com/nginx:1.25", wantMessage: "no params found for policy binding with `Deny` parameterNotFoundAction"},
+		{name: "namespace labels not selected", binding: byName, namespace: "team-c", image: "docker.io/nginx:1.25", wantAllowed: true},
+		{
+			// Only bindings with the Deny action deny objects without parameters, as the apiserver does
+			name:        "missing parameter without action",
+			binding:     binding("no-action", &admissionregistrationv1.ParamRef{Name: "registry"}),
+			namespace:   "team-b",
+			image:       "docker.io/nginx:1.25",
+			wantAllowed: true,
+		},
+		{
+			name:        "missing parameter allowed",
+			binding:     binding("allow-missing", &admissionregistrationv1.ParamRef{Name: "registry", ParameterNotFoundAction: &allow}),
+			namespace:   "team-b",
+			image:       "docker.io/nginx:1.25",
+			wantAllowed: true,
+		},
+		{
+			// Every selected parameter must allow the object
+			name:        "parameters selected by labels",
+			binding:     binding("by-selector", &admissionregistrationv1.ParamRef{Namespace: "policies", Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"registry": "true"}}}),
+			namespace:   "team-b",
+			image:       "mirror.example.com/nginx:1.25",
+			wantMessage: "image registry is not allowed",
+		},
+		{
+			name:        "parameter of the test case",
+			binding:     byName,
+			paramObj:    configMap("default", "registry", "docker.io/", nil),
+			namespace:   "team-b",
+			image:       "docker.io/nginx:1.25",
+			wantAllowed: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := &unstructured.Unstructured{Object: map[string]interface{}{
+				"apiVersion": "v1",
+				"kind":       "Pod",
+				"metadata":   map[string]interface{}{"name": "app", "namespace": tt.namespace},
+				"spec": map[string]interface{}{
+					"containers": []interface{}{map[string]interface{}{"name": "app", "image": tt.image}},
+				},
+			}}
+			result, err := simulator.SimulateWithPolicyBindings(context.Background(),
+				[]*admissionregistrationv1.ValidatingAdmissionPolicy{policy},
+				[]*admissionregistrationv1.ValidatingAdmissionPolicyBinding{tt.binding},
+				tt.paramObj,
+				kaptestv1.TestCase{
+					Name:      tt.name,
+					Operation: "UPDATE",
+					Object:    runtime.RawExtension{Object: pod},
+					OldObject: &runtime.RawExtension{Object: pod},
+				})
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantAllowed, result.ActualResponse.Allowed)
+			assert.Contains(t, result.ActualResponse.Message, tt.wantMessage)
+		})
+	}
+}
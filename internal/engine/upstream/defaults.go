@@ -0,0 +1,152 @@
+package upstream
+
+import (
+	"strings"
+
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// clusterScopedKinds lists the cluster-scoped built-in kinds
+var clusterScopedKinds = map[schema.GroupKind]bool{
+	{Group: "", Kind: "Namespace"}:                                                    true,
+	{Group: "", Kind: "Node"}:                                                         true,
+	{Group: "", Kind: "PersistentVolume"}:                                             true,
+	{Group: "", Kind: "ComponentStatus"}:                                              true,
+	{Group: "rbac.authorization.k8s.io", Kind: "ClusterRole"}:                         true,
+	{Group: "rbac.authorization.k8s.io", Kind: "ClusterRoleBinding"}:                  true,
+	{Group: "storage.k8s.io", Kind: "StorageClass"}:                                   true,
+	{Group: "storage.k8s.io", Kind: "CSIDriver"}:                                      true,
+	{Group: "storage.k8s.io", Kind: "CSINode"}:                                        true,
+	{Group: "storage.k8s.io", Kind: "VolumeAttachment"}:                               true,
+	{Group: "storage.k8s.io", Kind: "VolumeAttributesClass"}:                          true,
+	{Group: "scheduling.k8s.io", Kind: "PriorityClass"}:                               true,
+	{Group: "node.k8s.io", Kind: "RuntimeClass"}:                                      true,
+	{Group: "networking.k8s.io", Kind: "IngressClass"}:                                true,
+	{Group: "networking.k8s.io", Kind: "IPAddress"}:                                   true,
+	{Group: "networking.k8s.io", Kind: "ServiceCIDR"}:                                 true,
+	{Group: "admissionregistration.k8s.io", Kind: "ValidatingWebhookConfiguration"}:   true,
+	{Group: "admissionregistration.k8s.io", Kind: "MutatingWebhookConfiguration"}:     true,
+	{Group: "admissionregistration.k8s.io", Kind: "ValidatingAdmissionPolicy"}:        true,
+	{Group: "admissionregistration.k8s.io", Kind: "ValidatingAdmissionPolicyBinding"}: true,
+	{Group: "admissionregistration.k8s.io", Kind: "MutatingAdmissionPolicy"}:          true,
+	{Group: "admissionregistration.k8s.io", Kind: "MutatingAdmissionPolicyBinding"}:   true,
+	{Group: "apiextensions.k8s.io", Kind: "CustomResourceDefinition"}:                 true,
+	{Group: "apiregistration.k8s.io", Kind: "APIService"}:                             true,
+	{Group: "certificates.k8s.io", Kind: "CertificateSigningRequest"}:                 true,
+	{Group: "certificates.k8s.io", Kind: "ClusterTrustBundle"}:                        true,
+	{Group: "flowcontrol.apiserver.k8s.io", Kind: "FlowSchema"}:                       true,
+	{Group: "flowcontrol.apiserver.k8s.io", Kind: "PriorityLevelConfiguration"}:       true,
+	{Group: "resource.k8s.io", Kind: "DeviceClass"}:                                   true,
+	{Group: "internal.apiserver.k8s.io", Kind: "StorageVersion"}:                      true,
+	{Group: "authentication.k8s.io", Kind: "TokenReview"}:                             true,
+	{Group: "authentication.k8s.io", Kind: "SelfSubjectReview"}:                       true,
+	{Group: "authorization.k8s.io", Kind: "SubjectAccessReview"}:                      true,
+	{Group: "authorization.k8s.io", Kind: "SelfSubjectAccessReview"}:                  true,
+	{Group: "authorization.k8s.io", Kind: "SelfSubjectRulesReview"}:                   true,
+}
+
+// IsClusterScoped reports whether a built-in kind is cluster-scoped
+// Kinds that are not built in, such as custom resources, are reported as namespaced
+func IsClusterScoped(groupKind schema.GroupKind) bool {
+	return clusterScopedKinds[groupKind]
+}
+
+// newRESTMapper creates a REST mapper for the kinds registered in the scheme
+func newRESTMapper(scheme *runtime.Scheme) *meta.DefaultRESTMapper {
+	restMapper := meta.NewDefaultRESTMapper(nil)
+	for gvk := range scheme.AllKnownTypes() {
+		if gvk.Version == runtime.APIVersionInternal || strings.HasSuffix(gvk.Kind, "List") {
+			continue
+		}
+
+		scope := meta.RESTScopeNamespace
+		if clusterScopedKinds[gvk.GroupKind()] {
+			scope = meta.RESTScopeRoot
+		}
+		restMapper.Add(gvk, scope)
+	}
+	return restMapper
+}
+
+// setPolicyDefaults applies the defaults the apiserver sets on stored policies
+// Policies without match constraints, which the apiserver rejects, match every request as in the native engine
+func setPolicyDefaults(policy *admissionregistrationv1.ValidatingAdmissionPolicy) {
+	if policy.Spec.FailurePolicy == nil {
+		failurePolicy := admissionregistrationv1.Fail
+		policy.Spec.FailurePolicy = &failurePolicy
+	}
+	if policy.Spec.MatchConstraints == nil {
+		policy.Spec.MatchConstraints = matchAll()
+	}
+	setMatchResourcesDefaults(policy.Spec.MatchConstraints)
+}
+
+// matchAll returns match resources matching every operation on every resource
+func matchAll() *admissionregistrationv1.MatchResources {
+	return &admissionregistrationv1.MatchResources{
+		ResourceRules: []admissionregistrationv1.NamedRuleWithOperations{
+			{
+				RuleWithOperations: admissionregistrationv1.RuleWithOperations{
+					Operations: []admissionregistrationv1.OperationType{admissionregistrationv1.OperationAll},
+					Rule: admissionregistrationv1.Rule{
+						APIGroups:   []string{"*"},
+						APIVersions: []string{"*"},
+						Resources:   []string{"*"},
+					},
+				},
+			},
+		},
+	}
+}
+
+// setBindingDefaults applies the defaults the apiserver sets on stored bindings
+func setBindingDefaults(binding *admissionregistrationv1.ValidatingAdmissionPolicyBinding) {
+	if binding.Spec.MatchResources != nil {
+		setMatchResourcesDefaults(binding.Spec.MatchResources)
+	}
+}
+
+// setMatchResourcesDefaults matches every namespace and object, with equivalent resources and any scope
+func setMatchResourcesDefaults(matchResources *admissionregistrationv1.MatchResources) {
+	if matchResources.MatchPolicy == nil {
+		matchPolicy := admissionregistrationv1.Equivalent
+		matchResources.MatchPolicy = &matchPolicy
+	}
+	if matchResources.NamespaceSelector == nil {
+		matchResources.NamespaceSelector = &metav1.LabelSelector{}
+	}
+	if matchResources.ObjectSelector == nil {
+		matchResources.ObjectSelector = &metav1.LabelSelector{}
+	}
+	for i := range matchResources.ResourceRules {
+		setRuleDefaults(&matchResources.ResourceRules[i].RuleWithOperations)
+	}
+	for i := range matchResources.ExcludeResourceRules {
+		setRuleDefaults(&matchResources.ExcludeResourceRules[i].RuleWithOperations)
+	}
+}
+
+// setRuleDefaults matches any scope when none is set
+// Empty operations, groups, versions and resources, which the apiserver rejects, match everything as in the native engine
+func setRuleDefaults(rule *admissionregistrationv1.RuleWithOperations) {
+	if rule.Scope == nil {
+		scope := admissionregistrationv1.AllScopes
+		rule.Scope = &scope
+	}
+	if len(rule.Operations) == 0 {
+		rule.Operations = []admissionregistrationv1.OperationType{admissionregistrationv1.OperationAll}
+	}
+	if len(rule.APIGroups) == 0 {
+		rule.APIGroups = []string{"*"}
+	}
+	if len(rule.APIVersions) == 0 {
+		rule.APIVersions = []string{"*"}
+	}
+	if len(rule.Resources) == 0 {
+		rule.Resources = []string{"*"}
+	}
+}
@@ -0,0 +1,213 @@
+package upstream
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	goruntime "runtime"
+	"strings"
+	"sync"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apiserver/pkg/admission"
+	"k8s.io/apiserver/pkg/authentication/user"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/klog/v2"
+
+	"github.com/yashirook/kube-vap-test/internal/engine"
+	kaptestv1 "github.com/yashirook/kube-vap-test/pkg/apis/admission/v1"
+)
+
+// deniedPolicyPattern extracts the policy name and message from a denial of the admission plugin
+var deniedPolicyPattern = regexp.MustCompile(`(?s)ValidatingAdmissionPolicy '([^']+)'(?: with binding '[^']+')? denied request: (.*)$`)
+
+var filterKlogOnce sync.Once
+
+// Engine evaluates policies with the ValidatingAdmissionPolicy admission plugin of k8s.io/apiserver
+// Policies, bindings, parameters and namespaces are served to the plugin through fake clients
+// and informers, so matching, parameter resolution, failurePolicy and messages follow the apiserver
+type Engine struct {
+	scheme  *runtime.Scheme
+	harness *harness
+}
+
+// NewEngine creates an Engine
+func NewEngine() (*Engine, error) {
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		return nil, fmt.Errorf("failed to add built-in types to scheme: %w", err)
+	}
+
+	// The plugin and its informers log through klog, keep them off the report output
+	filterKlogOnce.Do(filterKlog)
+
+	return &Engine{scheme: scheme}, nil
+}
+
+// Name returns the engine name
+func (e *Engine) Name() string {
+	return engine.EngineUpstream
+}
+
+// Close stops the informers of the admission plugin
+func (e *Engine) Close() {
+	if e.harness != nil {
+		e.harness.stop()
+		e.harness = nil
+	}
+}
+
+// Evaluate dispatches the request to the admission plugin
+// The plugin is reused while the policies, bindings and parameter stay the same
+func (e *Engine) Evaluate(ctx context.Context, request *engine.EvaluationRequest) (*engine.EvaluationResponse, error) {
+	if e.harness == nil || !e.harness.serves(request) {
+		e.Close()
+
+		h, err := newHarness(e.scheme, request)
+		if err != nil {
+			return nil, err
+		}
+		e.harness = h
+	}
+
+	attributes, err := e.harness.attributes(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+
+	return ResponseFromError(e.harness.plugin.Validate(ctx, attributes, admission.NewObjectInterfacesFromScheme(e.scheme)))
+}
+
+// ResponseFromError converts the result of an admission request into a response
+// API status errors are denials, other errors are returned as is
+func ResponseFromError(err error) (*engine.EvaluationResponse, error) {
+	if err == nil {
+		return &engine.EvaluationResponse{Allowed: true}, nil
+	}
+
+	var statusErr *apierrors.StatusError
+	if !errors.As(err, &statusErr) {
+		return nil, fmt.Errorf("admission request failed: %w", err)
+	}
+
+	response := &engine.EvaluationResponse{
+		Allowed: false,
+		Reason:  string(statusErr.ErrStatus.Reason),
+		Message: statusErr.ErrStatus.Message,
+	}
+
+	// The apiserver reports the first denial only
+	if matches := deniedPolicyPattern.FindStringSubmatch(statusErr.ErrStatus.Message); matches != nil {
+		response.PolicyResults = []kaptestv1.PolicyResult{
+			{
+				PolicyName: matches[1],
+				Allowed:    false,
+				Reason:     response.Reason,
+				Message:    matches[2],
+			},
+		}
+	}
+
+	return response, nil
+}
+
+// newAttributes creates the admission attributes for the request
+func newAttributes(request *engine.EvaluationRequest, resource resourceInfo, namespace, name string) (admission.Attributes, error) {
+	operation := admission.Operation(strings.ToUpper(request.Operation))
+	if operation == "" {
+		operation = admission.Create
+	}
+
+	// Avoid typed nil objects in the attributes
+	var object, oldObject runtime.Object
+	if request.Object != nil && operation != admission.Delete {
+		object = request.Object
+	}
+	if request.OldObject != nil {
+		oldObject = request.OldObject
+	} else if operation == admission.Delete && request.Object != nil {
+		oldObject = request.Object
+	}
+	if object == nil && oldObject == nil {
+		return nil, fmt.Errorf("request has no object")
+	}
+
+	return admission.NewAttributesRecord(
+		object,
+		oldObject,
+		resource.kind,
+		namespace,
+		name,
+		resource.resource,
+		"",
+		operation,
+		nil,
+		false,
+		&user.DefaultInfo{},
+	), nil
+}
+
+// filterKlog drops the klog messages of the admission plugin and its informers
+// klog is global, so its messages are filtered by the packages logging them, and the messages of
+// other components, such as the client-side throttling of cluster requests, are still printed to
+// standard error
+func filterKlog() {
+	flags := flag.NewFlagSet("klog", flag.ContinueOnError)
+	klog.InitFlags(flags)
+	_ = flags.Set("logtostderr", "false")
+	_ = flags.Set("alsologtostderr", "false")
+	_ = flags.Set("stderrthreshold", "FATAL")
+	_ = flags.Set("one_output", "true")
+	klog.SetOutput(&pluginLogFilter{out: os.Stderr})
+}
+
+// pluginPackages are the package paths of the admission plugin, and of the informers only the
+// plugin runs, as prefixes of the functions on the stack of a log call
+var pluginPackages = []string{
+	"k8s.io/apiserver/pkg/admission/",
+	"k8s.io/client-go/tools/cache.",
+}
+
+// pluginLogFilter writes the klog messages not logged by the admission plugin
+// klog writes messages from the goroutine logging them, so the stack tells where they come from
+type pluginLogFilter struct {
+	out io.Writer
+}
+
+// Write writes a klog message unless a function of the plugin packages is logging it
+func (f *pluginLogFilter) Write(message []byte) (int, error) {
+	if loggedByPlugin() {
+		return len(message), nil
+	}
+	return f.out.Write(message)
+}
+
+// loggedByPlugin reports whether a function of the plugin packages is on the calling stack
+func loggedByPlugin() bool {
+	pcs := make([]uintptr, 64)
+	frames := goruntime.CallersFrames(pcs[:goruntime.Callers(3, pcs)])
+	for {
+		frame, more := frames.Next()
+		if pluginFunction(frame.Function) {
+			return true
+		}
+		if !more {
+			return false
+		}
+	}
+}
+
+// pluginFunction reports whether a fully qualified function belongs to the plugin packages
+func pluginFunction(function string) bool {
+	for _, prefix := range pluginPackages {
+		if strings.HasPrefix(function, prefix) {
+			return true
+		}
+	}
+	return false
+}
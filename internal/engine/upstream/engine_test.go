@@ -0,0 +1,382 @@
+package upstream
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+
+	"github.com/yashirook/kube-vap-test/internal/engine"
+	kaptestv1 "github.com/yashirook/kube-vap-test/pkg/apis/admission/v1"
+)
+
+func podRules() *admissionregistrationv1.MatchResources {
+	return &admissionregistrationv1.MatchResources{
+		ResourceRules: []admissionregistrationv1.NamedRuleWithOperations{
+			{
+				RuleWithOperations: admissionregistrationv1.RuleWithOperations{
+					Operations: []admissionregistrationv1.OperationType{admissionregistrationv1.Create, admissionregistrationv1.Update},
+					Rule: admissionregistrationv1.Rule{
+						APIGroups:   []string{""},
+						APIVersions: []string{"v1"},
+						Resources:   []string{"pods"},
+					},
+				},
+			},
+		},
+	}
+}
+
+func newPolicy(name, expression, message string) *admissionregistrationv1.ValidatingAdmissionPolicy {
+	return &admissionregistrationv1.ValidatingAdmissionPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec: admissionregistrationv1.ValidatingAdmissionPolicySpec{
+			MatchConstraints: podRules(),
+			Validations: []admissionregistrationv1.Validation{
+				{Expression: expression, Message: message},
+			},
+		},
+	}
+}
+
+func newPod(name, namespace, image string, labels map[string]interface{}) *unstructured.Unstructured {
+	metadata := map[string]interface{}{"name": name}
+	if namespace != "" {
+		metadata["namespace"] = namespace
+	}
+	if labels != nil {
+		metadata["labels"] = labels
+	}
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Pod",
+		"metadata":   metadata,
+		"spec": map[string]interface{}{
+			"containers": []interface{}{map[string]interface{}{"name": "app", "image": image}},
+		},
+	}}
+}
+
+func newEngine(t *testing.T) *Engine {
+	t.Helper()
+	e, err := NewEngine()
+	require.NoError(t, err)
+	t.Cleanup(e.Close)
+	return e
+}
+
+func TestEngineUnboundPolicy(t *testing.T) {
+	e := newEngine(t)
+	policies := []*admissionregistrationv1.ValidatingAdmissionPolicy{
+		newPolicy("no-latest", "!object.spec.containers.exists(c, c.image.endsWith(':latest'))", "latest tag is not allowed"),
+	}
+
+	response, err := e.Evaluate(context.Background(), &engine.EvaluationRequest{
+		Policies:  policies,
+		Object:    newPod("tagged", "default", "nginx:1.25", nil),
+		Operation: "CREATE",
+	})
+	require.NoError(t, err)
+	assert.True(t, response.Allowed)
+
+	// Policies without a namespace are evaluated in the default namespace
+	response, err = e.Evaluate(context.Background(), &engine.EvaluationRequest{
+		Policies:  policies,
+		Object:    newPod("latest", "", "nginx:latest", nil),
+		Operation: "CREATE",
+	})
+	require.NoError(t, err)
+	assert.False(t, response.Allowed)
+	assert.Equal(t, string(metav1.StatusReasonInvalid), response.Reason)
+	assert.Contains(t, response.Message, "ValidatingAdmissionPolicy 'no-latest' with binding 'no-latest' denied request: latest tag is not allowed")
+	require.Len(t, response.PolicyResults, 1)
+	assert.Equal(t, "no-latest", response.PolicyResults[0].PolicyName)
+	assert.Equal(t, "latest tag is not allowed", response.PolicyResults[0].Message)
+
+	// Operations outside the match constraints are not evaluated
+	response, err = e.Evaluate(context.Background(), &engine.EvaluationRequest{
+		Policies:  policies,
+		Object:    newPod("latest", "default", "nginx:latest", nil),
+		Operation: "DELETE",
+	})
+	require.NoError(t, err)
+	assert.True(t, response.Allowed)
+}
+
+func TestEngineBindings(t *testing.T) {
+	e := newEngine(t)
+	policy := newPolicy("require-team", "has(object.metadata.labels) && 'team' in object.metadata.labels", "team label is required")
+	bindings := []*admissionregistrationv1.ValidatingAdmissionPolicyBinding{
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "require-team-production"},
+			Spec: admissionregistrationv1.ValidatingAdmissionPolicyBindingSpec{
+				PolicyName:        "require-team",
+				ValidationActions: []admissionregistrationv1.ValidationAction{admissionregistrationv1.Deny},
+				MatchResources: &admissionregistrationv1.MatchResources{
+					NamespaceSelector: &metav1.LabelSelector{
+						MatchLabels: map[string]string{corev1.LabelMetadataName: "production"},
+					},
+				},
+			},
+		},
+	}
+
+	tests := []struct {
+		name        string
+		namespace   string
+		labels      map[string]interface{}
+		wantAllowed bool
+	}{
+		{name: "unlabeled in bound namespace", namespace: "production", wantAllowed: false},
+		{name: "labeled in bound namespace", namespace: "production", labels: map[string]interface{}{"team": "a"}, wantAllowed: true},
+		{name: "unlabeled in other namespace", namespace: "staging", wantAllowed: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response, err := e.Evaluate(context.Background(), &engine.EvaluationRequest{
+				Policies:  []*admissionregistrationv1.ValidatingAdmissionPolicy{policy},
+				Bindings:  bindings,
+				Object:    newPod("app", tt.namespace, "nginx:1.25", tt.labels),
+				Operation: "CREATE",
+			})
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantAllowed, response.Allowed)
+			if !tt.wantAllowed {
+				assert.Contains(t, response.Message, "with binding 'require-team-production'")
+			}
+		})
+	}
+}
+
+func TestEngineParams(t *testing.T) {
+	e := newEngine(t)
+	policy := newPolicy("allowed-registry", "object.spec.containers.all(c, c.image.startsWith(params.data.registry))", "image registry is not allowed")
+	policy.Spec.ParamKind = &admissionregistrationv1.ParamKind{APIVersion: "v1", Kind: "ConfigMap"}
+
+	param := &corev1.ConfigMap{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "ConfigMap"},
+		ObjectMeta: metav1.ObjectMeta{Name: "registry", Namespace: "default"},
+		Data:       map[string]string{"registry": "registry.example.com/"},
+	}
+
+	for image, wantAllowed := range map[string]bool{
+		"registry.example.com/nginx:1.25": true,
+		"docker.io/nginx:1.25":            false,
+	} {
+		response, err := e.Evaluate(context.Background(), &engine.EvaluationRequest{
+			Policies:  []*admissionregistrationv1.ValidatingAdmissionPolicy{policy},
+			ParamObj:  param,
+			Object:    newPod("app", "default", image, nil),
+			Operation: "CREATE",
+		})
+		require.NoError(t, err)
+		assert.Equal(t, wantAllowed, response.Allowed, image)
+	}
+}
+
+func TestEngineFailurePolicy(t *testing.T) {
+	e := newEngine(t)
+
+	// Runtime errors deny the request with failurePolicy Fail and are ignored with Ignore
+	policy := newPolicy("missing-field", "object.spec.missing == 'x'", "missing field")
+	response, err := e.Evaluate(context.Background(), &engine.EvaluationRequest{
+		Policies:  []*admissionregistrationv1.ValidatingAdmissionPolicy{policy},
+		Object:    newPod("app", "default", "nginx:1.25", nil),
+		Operation: "CREATE",
+	})
+	require.NoError(t, err)
+	assert.False(t, response.Allowed)
+
+	ignore := admissionregistrationv1.Ignore
+	ignored := policy.DeepCopy()
+	ignored.Spec.FailurePolicy = &ignore
+	response, err = e.Evaluate(context.Background(), &engine.EvaluationRequest{
+		Policies:  []*admissionregistrationv1.ValidatingAdmissionPolicy{ignored},
+		Object:    newPod("app", "default", "nginx:1.25", nil),
+		Operation: "CREATE",
+	})
+	require.NoError(t, err)
+	assert.True(t, response.Allowed)
+}
+
+// allowingEngine admits every request, standing in for an engine disagreeing with the plugin
+type allowingEngine struct{}
+
+func (allowingEngine) Name() string { return "allowing" }
+
+func (allowingEngine) Evaluate(context.Context, *engine.EvaluationRequest) (*engine.EvaluationResponse, error) {
+	return &engine.EvaluationResponse{Allowed: true}, nil
+}
+
+func TestDifferentialSimulation(t *testing.T) {
+	simulator, err := engine.NewPolicySimulator()
+	require.NoError(t, err)
+	simulator.SetEngine(newEngine(t))
+	simulator.SetDifferentialEngine(simulator.NativeEngine())
+
+	// Both engines evaluate the match constraints of unbound policies, so they agree on Deployments
+	policy := newPolicy("no-latest", "!has(object.spec.containers) || !object.spec.containers.exists(c, c.image.endsWith(':latest'))", "latest tag is not allowed")
+	deployment := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "apps/v1",
+		"kind":       "Deployment",
+		"metadata":   map[string]interface{}{"name": "app", "namespace": "default"},
+		"spec": map[string]interface{}{
+			"containers": []interface{}{map[string]interface{}{"name": "app", "image": "nginx:latest"}},
+		},
+	}}
+
+	testCases := []kaptestv1.TestCase{
+		{
+			Name:      "latest-pod",
+			Object:    runtime.RawExtension{Object: newPod("app", "default", "nginx:latest", nil)},
+			Operation: "CREATE",
+			Expected:  kaptestv1.ExpectedResult{Allowed: false, MessageContains: "latest tag is not allowed"},
+		},
+		{
+			Name:      "deployment",
+			Object:    runtime.RawExtension{Object: deployment},
+			Operation: "CREATE",
+			Expected:  kaptestv1.ExpectedResult{Allowed: true},
+		},
+	}
+
+	status, err := simulator.RunPolicyTestsWithMultiPolicies(context.Background(), []*admissionregistrationv1.ValidatingAdmissionPolicy{policy}, nil, testCases)
+	require.NoError(t, err)
+	assert.Equal(t, engine.EngineUpstream, status.Engine)
+	for _, result := range status.Results {
+		require.NotNil(t, result.Differential)
+		assert.Equal(t, engine.EngineNative, result.Differential.Engine)
+		assert.True(t, result.Differential.Agree, result.Name)
+		assert.True(t, result.Success, result.Details)
+	}
+
+	// Test cases where the engines disagree fail
+	simulator.SetDifferentialEngine(allowingEngine{})
+	status, err = simulator.RunPolicyTestsWithMultiPolicies(context.Background(), []*admissionregistrationv1.ValidatingAdmissionPolicy{policy}, nil, testCases)
+	require.NoError(t, err)
+
+	require.NotNil(t, status.Results[0].Differential)
+	assert.False(t, status.Results[0].Differential.Agree)
+	assert.False(t, status.Results[0].Success)
+	assert.Contains(t, status.Results[0].Details, "engines disagree")
+	assert.True(t, status.Results[1].Differential.Agree)
+}
+
+func TestEngineLenientMatchConstraints(t *testing.T) {
+	e := newEngine(t)
+
+	// Policies without match constraints or rule versions are matched as in the native engine
+	unconstrained := newPolicy("unconstrained", "false", "denied")
+	unconstrained.Spec.MatchConstraints = nil
+	unversioned := newPolicy("unversioned", "false", "denied")
+	unversioned.Spec.MatchConstraints.ResourceRules[0].APIVersions = nil
+
+	for _, policy := range []*admissionregistrationv1.ValidatingAdmissionPolicy{unconstrained, unversioned} {
+		response, err := e.Evaluate(context.Background(), &engine.EvaluationRequest{
+			Policies:  []*admissionregistrationv1.ValidatingAdmissionPolicy{policy},
+			Object:    newPod("app", "default", "nginx:1.25", nil),
+			Operation: "CREATE",
+		})
+		require.NoError(t, err)
+		assert.False(t, response.Allowed, policy.Name)
+	}
+}
+
+func TestEngineClusterParamsAndNamespaces(t *testing.T) {
+	e := newEngine(t)
+	policy := newPolicy("allowed-registry", "object.spec.containers.all(c, c.image.startsWith(params.data.registry))", "image registry is not allowed")
+	policy.Spec.ParamKind = &admissionregistrationv1.ParamKind{APIVersion: "v1", Kind: "ConfigMap"}
+	deny := admissionregistrationv1.DenyAction
+	bindings := []*admissionregistrationv1.ValidatingAdmissionPolicyBinding{
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "allowed-registry-prod"},
+			Spec: admissionregistrationv1.ValidatingAdmissionPolicyBindingSpec{
+				PolicyName:        "allowed-registry",
+				ValidationActions: []admissionregistrationv1.ValidationAction{admissionregistrationv1.Deny},
+				// Parameters are read from the namespace of each object
+				ParamRef: &admissionregistrationv1.ParamRef{Name: "registry", ParameterNotFoundAction: &deny},
+				MatchResources: &admissionregistrationv1.MatchResources{
+					NamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"env": "prod"}},
+				},
+			},
+		},
+	}
+	params := []*unstructured.Unstructured{
+		{Object: map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "ConfigMap",
+			"metadata":   map[string]interface{}{"name": "registry", "namespace": "team-a"},
+			"data":       map[string]interface{}{"registry": "registry.example.com/"},
+		}},
+	}
+	namespaces := []*corev1.Namespace{
+		{ObjectMeta: metav1.ObjectMeta{Name: "team-a", Labels: map[string]string{"env": "prod"}}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "team-b", Labels: map[string]string{"env": "prod"}}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "team-c", Labels: map[string]string{"env": "dev"}}},
+	}
+
+	tests := []struct {
+		name        string
+		namespace   string
+		image       string
+		wantAllowed bool
+		wantMessage string
+	}{
+		{name: "allowed registry", namespace: "team-a", image: "registry.example.com/nginx:1.25", wantAllowed: true},
+		{name: "other registry", namespace: "team-a", image: "docker.io/nginx:1.25", wantMessage: "image registry is not allowed"},
+		{name: "no parameter in namespace", namespace: "team-b", image: "registry.example.com/nginx:1.25", wantMessage: "no params found for policy binding with `Deny` parameterNotFoundAction"},
+		{name: "namespace not selected", namespace: "team-c", image: "docker.io/nginx:1.25", wantAllowed: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response, err := e.Evaluate(context.Background(), &engine.EvaluationRequest{
+				Policies:   []*admissionregistrationv1.ValidatingAdmissionPolicy{policy},
+				Bindings:   bindings,
+				Params:     params,
+				Namespaces: namespaces,
+				Object:     newPod("app", tt.namespace, tt.image, nil),
+				OldObject:  newPod("app", tt.namespace, tt.image, nil),
+				Operation:  "UPDATE",
+			})
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantAllowed, response.Allowed)
+			assert.Contains(t, response.Message, tt.wantMessage)
+		})
+	}
+}
+
+func TestPluginLogFilter(t *testing.T) {
+	filterKlogOnce.Do(filterKlog)
+	var out bytes.Buffer
+	klog.SetOutput(&pluginLogFilter{out: &out})
+	defer klog.SetOutput(&pluginLogFilter{out: os.Stderr})
+
+	// Messages logged by the informers of the plugin are dropped, wherever their file names
+	synced := func() bool { return true }
+	require.True(t, cache.WaitForNamedCacheSync("policySource", nil, synced))
+	klog.Flush()
+	assert.Empty(t, out.String())
+
+	// Messages of other packages are written, even from files named like those of the plugin
+	klog.Info("Waited for 1.2s due to client-side throttling, not priority and fairness")
+	klog.Flush()
+	assert.Contains(t, out.String(), "engine_test.go")
+	assert.Contains(t, out.String(), "client-side throttling")
+
+	assert.True(t, pluginFunction("k8s.io/apiserver/pkg/admission/plugin/policy/generic.(*policySource[...]).refreshPolicies"))
+	assert.True(t, pluginFunction("k8s.io/client-go/tools/cache.(*Reflector).ListAndWatch"))
+	assert.False(t, pluginFunction("k8s.io/client-go/rest.(*request).tryThrottle"))
+	assert.False(t, pluginFunction("github.com/example/validator.validate"))
+}
@@ -0,0 +1,345 @@
+package upstream
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/apiserver/pkg/admission"
+	"k8s.io/apiserver/pkg/admission/initializer"
+	"k8s.io/apiserver/pkg/admission/plugin/policy/validating"
+	"k8s.io/apiserver/pkg/authorization/authorizer"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/component-base/featuregate"
+
+	"github.com/yashirook/kube-vap-test/internal/engine"
+)
+
+// syncTimeout bounds the wait for the plugin's informers
+const syncTimeout = 10 * time.Second
+
+// harness is a ValidatingAdmissionPolicy plugin wired to fake clients holding one set of policies
+type harness struct {
+	policies   []*admissionregistrationv1.ValidatingAdmissionPolicy
+	bindings   []*admissionregistrationv1.ValidatingAdmissionPolicyBinding
+	paramObj   runtime.Object
+	params     []*unstructured.Unstructured
+	namespaces []*corev1.Namespace
+
+	plugin          *validating.Plugin
+	client          *fake.Clientset
+	namespaceLister corelisters.NamespaceLister
+	restMapper      meta.RESTMapper
+	cancel          context.CancelFunc
+}
+
+// resourceInfo is the kind and resource of a request
+type resourceInfo struct {
+	kind       schema.GroupVersionKind
+	resource   schema.GroupVersionResource
+	namespaced bool
+}
+
+// newHarness starts an admission plugin serving the policies, bindings and parameter of the request
+func newHarness(scheme *runtime.Scheme, request *engine.EvaluationRequest) (*harness, error) {
+	restMapper := newRESTMapper(scheme)
+
+	var typedObjects, dynamicObjects []runtime.Object
+	listKinds := map[schema.GroupVersionResource]string{}
+
+	// Built-in parameter kinds are served by the typed informers, custom ones by dynamic informers
+	var param *unstructured.Unstructured
+	if request.ParamObj != nil {
+		content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(request.ParamObj)
+		if err != nil {
+			return nil, fmt.Errorf("failed to convert parameter object: %w", err)
+		}
+		param = &unstructured.Unstructured{Object: content}
+	}
+	params := request.Params
+	if param != nil {
+		params = append([]*unstructured.Unstructured{param}, params...)
+	}
+	for _, param := range params {
+		gvk := param.GroupVersionKind()
+		if scheme.Recognizes(gvk) {
+			typed, err := scheme.New(gvk)
+			if err != nil {
+				return nil, fmt.Errorf("failed to create %s: %w", gvk, err)
+			}
+			if err := runtime.DefaultUnstructuredConverter.FromUnstructured(param.Object, typed); err != nil {
+				return nil, fmt.Errorf("failed to convert parameter object to %s: %w", gvk.Kind, err)
+			}
+			typedObjects = append(typedObjects, typed)
+		} else {
+			scope := meta.RESTScopeRoot
+			if param.GetNamespace() != "" {
+				scope = meta.RESTScopeNamespace
+			}
+			plural, singular := meta.UnsafeGuessKindToResource(gvk)
+			restMapper.AddSpecific(gvk, plural, singular, scope)
+			listKinds[plural] = gvk.Kind + "List"
+			dynamicObjects = append(dynamicObjects, param)
+		}
+	}
+
+	// Namespaces are served with their labels, other namespaces are created on request
+	for _, namespace := range request.Namespaces {
+		typedObjects = append(typedObjects, namespace)
+	}
+
+	policies, bindings := PolicyObjects(request.Policies, request.Bindings, param)
+	for _, policy := range policies {
+		typedObjects = append(typedObjects, policy)
+	}
+	for _, binding := range bindings {
+		typedObjects = append(typedObjects, binding)
+	}
+
+	client := fake.NewSimpleClientset(typedObjects...)
+	dynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(scheme, listKinds, dynamicObjects...)
+	informerFactory := informers.NewSharedInformerFactory(client, 0)
+	namespaceLister := informerFactory.Core().V1().Namespaces().Lister()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	plugin := validating.NewPlugin(nil)
+	initializer.New(
+		client,
+		dynamicClient,
+		informerFactory,
+		allowAllAuthorizer(),
+		featuregate.NewFeatureGate(),
+		ctx.Done(),
+		restMapper,
+	).Initialize(plugin)
+
+	if err := plugin.ValidateInitialization(); err != nil {
+		cancel()
+		return nil, fmt.Errorf("failed to initialize admission plugin: %w", err)
+	}
+
+	informerFactory.Start(ctx.Done())
+	if !plugin.WaitForReady() {
+		cancel()
+		return nil, fmt.Errorf("timed out waiting for admission plugin to sync policies")
+	}
+
+	return &harness{
+		policies:        request.Policies,
+		bindings:        request.Bindings,
+		paramObj:        request.ParamObj,
+		params:          request.Params,
+		namespaces:      request.Namespaces,
+		plugin:          plugin,
+		client:          client,
+		namespaceLister: namespaceLister,
+		restMapper:      restMapper,
+		cancel:          cancel,
+	}, nil
+}
+
+// serves returns true if the harness was started for the policies, bindings, parameters and
+// namespaces of the request
+func (h *harness) serves(request *engine.EvaluationRequest) bool {
+	if h.paramObj != request.ParamObj || len(h.policies) != len(request.Policies) || len(h.bindings) != len(request.Bindings) {
+		return false
+	}
+	if len(h.params) != len(request.Params) || len(h.namespaces) != len(request.Namespaces) {
+		return false
+	}
+	for i := range h.params {
+		if h.params[i] != request.Params[i] {
+			return false
+		}
+	}
+	for i := range h.namespaces {
+		if h.namespaces[i] != request.Namespaces[i] {
+			return false
+		}
+	}
+	for i := range h.policies {
+		if h.policies[i] != request.Policies[i] {
+			return false
+		}
+	}
+	for i := range h.bindings {
+		if h.bindings[i] != request.Bindings[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// stop stops the plugin and its informers
+func (h *harness) stop() {
+	h.cancel()
+}
+
+// attributes creates the admission attributes for the request
+// The request namespace is created first, since the plugin reads namespaces from its informer
+func (h *harness) attributes(ctx context.Context, request *engine.EvaluationRequest) (admission.Attributes, error) {
+	obj := request.Object
+	if obj == nil {
+		obj = request.OldObject
+	}
+	if obj == nil {
+		return nil, fmt.Errorf("request has no object")
+	}
+
+	resource := h.resourceFor(obj.GroupVersionKind(), obj.GetNamespace())
+
+	// Namespaced objects without a namespace are created in the default namespace, as kubectl does
+	namespace := obj.GetNamespace()
+	if resource.namespaced && namespace == "" {
+		namespace = metav1.NamespaceDefault
+	}
+	if !resource.namespaced {
+		namespace = ""
+	}
+	if namespace != "" {
+		if err := h.ensureNamespace(ctx, namespace); err != nil {
+			return nil, err
+		}
+	}
+
+	return newAttributes(request, resource, namespace, obj.GetName())
+}
+
+// resourceFor resolves the resource of a kind
+// Kinds unknown to the REST mapper (such as custom resources) use the guessed plural
+func (h *harness) resourceFor(gvk schema.GroupVersionKind, namespace string) resourceInfo {
+	mapping, err := h.restMapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if err == nil {
+		return resourceInfo{
+			kind:       gvk,
+			resource:   mapping.Resource,
+			namespaced: mapping.Scope.Name() == meta.RESTScopeNameNamespace,
+		}
+	}
+
+	plural, _ := meta.UnsafeGuessKindToResource(gvk)
+	return resourceInfo{
+		kind:       gvk,
+		resource:   plural,
+		namespaced: namespace != "",
+	}
+}
+
+// ensureNamespace creates the namespace and waits until the plugin's informer has seen it
+func (h *harness) ensureNamespace(ctx context.Context, name string) error {
+	if _, err := h.namespaceLister.Get(name); err == nil {
+		return nil
+	}
+
+	namespace := &corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   name,
+			Labels: map[string]string{corev1.LabelMetadataName: name},
+		},
+	}
+	if _, err := h.client.CoreV1().Namespaces().Create(ctx, namespace, metav1.CreateOptions{}); err != nil && !apierrors.IsAlreadyExists(err) {
+		return fmt.Errorf("failed to create namespace %s: %w", name, err)
+	}
+
+	err := wait.PollUntilContextTimeout(ctx, 10*time.Millisecond, syncTimeout, true, func(context.Context) (bool, error) {
+		_, err := h.namespaceLister.Get(name)
+		return err == nil, nil
+	})
+	if err != nil {
+		return fmt.Errorf("timed out waiting for namespace %s: %w", name, err)
+	}
+	return nil
+}
+
+// PolicyObjects returns copies of the policies and bindings with the defaults of the apiserver applied,
+// plus a binding for every policy without one
+// Unbound policies are evaluated against every object, as the native engine does
+func PolicyObjects(
+	policies []*admissionregistrationv1.ValidatingAdmissionPolicy,
+	bindings []*admissionregistrationv1.ValidatingAdmissionPolicyBinding,
+	param *unstructured.Unstructured,
+) ([]*admissionregistrationv1.ValidatingAdmissionPolicy, []*admissionregistrationv1.ValidatingAdmissionPolicyBinding) {
+	defaulted := make([]*admissionregistrationv1.ValidatingAdmissionPolicy, 0, len(policies))
+	for _, policy := range policies {
+		policy = policy.DeepCopy()
+		setPolicyDefaults(policy)
+		defaulted = append(defaulted, policy)
+	}
+
+	effective := effectiveBindings(policies, bindings, param)
+	for _, binding := range effective {
+		setBindingDefaults(binding)
+	}
+
+	return defaulted, effective
+}
+
+// effectiveBindings returns copies of the bindings, plus a binding for every policy without one
+func effectiveBindings(
+	policies []*admissionregistrationv1.ValidatingAdmissionPolicy,
+	bindings []*admissionregistrationv1.ValidatingAdmissionPolicyBinding,
+	param *unstructured.Unstructured,
+) []*admissionregistrationv1.ValidatingAdmissionPolicyBinding {
+	result := make([]*admissionregistrationv1.ValidatingAdmissionPolicyBinding, 0, len(policies))
+	bound := map[string]bool{}
+	names := map[string]bool{}
+	for _, binding := range bindings {
+		// Skip objects that are not bindings
+		if binding.Spec.PolicyName == "" || names[binding.Name] {
+			continue
+		}
+		bound[binding.Spec.PolicyName] = true
+		names[binding.Name] = true
+		result = append(result, binding.DeepCopy())
+	}
+
+	for _, policy := range policies {
+		if bound[policy.Name] {
+			continue
+		}
+
+		name := policy.Name
+		for i := 2; names[name]; i++ {
+			name = fmt.Sprintf("%s-%d", policy.Name, i)
+		}
+		names[name] = true
+
+		binding := &admissionregistrationv1.ValidatingAdmissionPolicyBinding{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Spec: admissionregistrationv1.ValidatingAdmissionPolicyBindingSpec{
+				PolicyName:        policy.Name,
+				ValidationActions: []admissionregistrationv1.ValidationAction{admissionregistrationv1.Deny},
+			},
+		}
+		if policy.Spec.ParamKind != nil && param != nil {
+			deny := admissionregistrationv1.DenyAction
+			binding.Spec.ParamRef = &admissionregistrationv1.ParamRef{
+				Name:                    param.GetName(),
+				Namespace:               param.GetNamespace(),
+				ParameterNotFoundAction: &deny,
+			}
+		}
+		result = append(result, binding)
+	}
+
+	return result
+}
+
+// allowAllAuthorizer returns an authorizer allowing every request
+func allowAllAuthorizer() authorizer.Authorizer {
+	return authorizer.AuthorizerFunc(func(ctx context.Context, a authorizer.Attributes) (authorizer.Decision, string, error) {
+		return authorizer.DecisionAllow, "", nil
+	})
+}
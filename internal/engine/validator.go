@@ -2,6 +2,7 @@ package engine
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"reflect"
 	"strings"
@@ -11,12 +12,33 @@ import (
 	"k8s.io/apimachinery/pkg/runtime"
 
 	"github.com/yashirook/kube-vap-test/internal/engine/cel"
+	"github.com/yashirook/kube-vap-test/internal/source"
+	kaptestv1 "github.com/yashirook/kube-vap-test/pkg/apis/admission/v1"
 )
 
 // PolicyValidator validates objects against policies
 type PolicyValidator struct {
 	celEvaluator *cel.Evaluator
 	contextVars  map[string]interface{}
+	// Positions of the policies in their files, by policy name
+	sources map[string]*source.Policy
+}
+
+// fieldError is an error of the expression at a field of a policy
+type fieldError struct {
+	field      string
+	expression string
+	err        error
+}
+
+// Error returns the expression error
+func (e *fieldError) Error() string {
+	return e.err.Error()
+}
+
+// Unwrap returns the expression error
+func (e *fieldError) Unwrap() error {
+	return e.err
 }
 
 // NewPolicyValidator creates a new policy validator
@@ -37,6 +59,47 @@ func (v *PolicyValidator) SetContextVariables(vars map[string]interface{}) {
 	v.contextVars = vars
 }
 
+// SetPolicySources sets the positions of the policies in their files, by policy name
+// Expression errors of these policies point to the file, line and column of the error
+func (v *PolicyValidator) SetPolicySources(sources map[string]*source.Policy) {
+	v.sources = sources
+}
+
+// expressionError returns the ExpressionError of a CEL error of a policy expression
+func (v *PolicyValidator) expressionError(policy *admissionregistrationv1.ValidatingAdmissionPolicy, field, expression string, err error) *kaptestv1.ExpressionError {
+	expressionErr := &kaptestv1.ExpressionError{
+		Policy:  policy.Name,
+		Field:   field,
+		Message: err.Error(),
+	}
+
+	var positionErr *cel.PositionError
+	if !errors.As(err, &positionErr) {
+		return expressionErr
+	}
+	if positionErr.Message != "" {
+		expressionErr.Message = positionErr.Message
+	}
+	if positionErr.Line == 0 {
+		return expressionErr
+	}
+
+	expressionErr.Excerpt = source.Excerpt(expression, positionErr.Line, positionErr.Column)
+	if policySource := v.sources[policy.Name]; policySource != nil {
+		location := policySource.Locate(field, positionErr.Line, positionErr.Column)
+		expressionErr.Location = &location
+	}
+	return expressionErr
+}
+
+// locatedMessage appends the position of an expression error in its policy file to a message
+func locatedMessage(message string, expressionErr *kaptestv1.ExpressionError) string {
+	if expressionErr == nil || expressionErr.Location == nil {
+		return message
+	}
+	return fmt.Sprintf("%s (%s)", message, source.Format(*expressionErr.Location))
+}
+
 // ValidatePolicy validates an object against a policy
 func (v *PolicyValidator) ValidatePolicy(
 	ctx context.Context,
@@ -47,10 +110,8 @@ func (v *PolicyValidator) ValidatePolicy(
 	if len(policy.Spec.MatchConditions) > 0 {
 		matches, err := v.evaluateMatchConditions(policy.Spec.MatchConditions)
 		if err != nil {
-			return NewValidationResult(false, []Violation{{
-				Reason:  "MatchConditionEvaluationError",
-				Message: fmt.Sprintf("Failed to evaluate matchConditions: %s", err.Error()),
-			}})
+			return NewValidationResult(false, []Violation{v.fieldViolation(policy, "MatchConditionEvaluationError",
+				fmt.Sprintf("Failed to evaluate matchConditions: %s", err.Error()), err)})
 		}
 		if !matches {
 			// Policy doesn't apply, allow the object
@@ -68,22 +129,25 @@ func (v *PolicyValidator) ValidatePolicy(
 		var err error
 		variableValues, err = v.evaluateVariables(policy)
 		if err != nil {
-			return NewValidationResult(false, []Violation{{
-				Reason:  "VariableEvaluationError",
-				Message: fmt.Sprintf("Variable evaluation error: %s", err.Error()),
-			}})
+			return NewValidationResult(false, []Violation{v.fieldViolation(policy, "VariableEvaluationError",
+				fmt.Sprintf("Variable evaluation error: %s", err.Error()), err)})
 		}
 	}
 
 	// Evaluate each validation expression
 	var violations []Violation
-	for _, validation := range policy.Spec.Validations {
+	for i, validation := range policy.Spec.Validations {
+		field := fmt.Sprintf("spec.validations[%d]", i)
 		result, err := v.evaluateValidation(validation, variableValues)
 		if err != nil {
+			expressionErr := v.expressionError(policy, field+".expression", validation.Expression, err)
 			violations = append(violations, Violation{
-				Expression: validation.Expression,
-				Reason:     "FailedValidation",
-				Message:    fmt.Sprintf("Expression evaluation error: %s", err.Error()),
+				Field:           field,
+				Expression:      validation.Expression,
+				Reason:          "FailedValidation",
+				Message:         locatedMessage(fmt.Sprintf("Expression evaluation error: %s", err.Error()), expressionErr),
+				Error:           expressionErr,
+				EvaluationError: true,
 			})
 			if !collectAllViolations {
 				break
@@ -95,9 +159,11 @@ func (v *PolicyValidator) ValidatePolicy(
 		allowed, ok := result.(bool)
 		if !ok {
 			violations = append(violations, Violation{
-				Expression: validation.Expression,
-				Reason:     "FailedValidation",
-				Message:    fmt.Sprintf("Expression did not return a boolean: %v (type: %s)", result, reflect.TypeOf(result)),
+				Field:           field,
+				Expression:      validation.Expression,
+				Reason:          "FailedValidation",
+				Message:         fmt.Sprintf("Expression did not return a boolean: %v (type: %s)", result, reflect.TypeOf(result)),
+				EvaluationError: true,
 			})
 			if !collectAllViolations {
 				break
@@ -113,10 +179,12 @@ func (v *PolicyValidator) ValidatePolicy(
 			}
 
 			// Evaluate messageExpression if present, otherwise use static message
+			var expressionErr *kaptestv1.ExpressionError
 			message, err := v.evaluateMessage(validation, variableValues)
 			if err != nil {
 				// If messageExpression evaluation fails, fall back to static message
 				// Note: verbose logging should be handled by the caller
+				expressionErr = v.expressionError(policy, field+".messageExpression", validation.MessageExpression, err)
 				message = validation.Message
 				if message == "" {
 					message = fmt.Sprintf("failed expression: %s", validation.Expression)
@@ -124,9 +192,11 @@ func (v *PolicyValidator) ValidatePolicy(
 			}
 
 			violations = append(violations, Violation{
+				Field:      field,
 				Expression: validation.Expression,
 				Reason:     reason,
 				Message:    message,
+				Error:      expressionErr,
 			})
 
 			if !collectAllViolations {
@@ -140,6 +210,20 @@ func (v *PolicyValidator) ValidatePolicy(
 	return NewValidationResult(allowed, violations)
 }
 
+// fieldViolation returns the violation of a policy whose variables or matchConditions failed to evaluate
+func (v *PolicyValidator) fieldViolation(policy *admissionregistrationv1.ValidatingAdmissionPolicy, reason, message string, err error) Violation {
+	violation := Violation{Reason: reason, Message: message, EvaluationError: true}
+
+	var fieldErr *fieldError
+	if errors.As(err, &fieldErr) {
+		violation.Field = strings.TrimSuffix(fieldErr.field, ".expression")
+		violation.Expression = fieldErr.expression
+		violation.Error = v.expressionError(policy, fieldErr.field, fieldErr.expression, fieldErr.err)
+		violation.Message = locatedMessage(message, violation.Error)
+	}
+	return violation
+}
+
 // evaluateVariables evaluates all variables defined in the policy
 func (v *PolicyValidator) evaluateVariables(policy *admissionregistrationv1.ValidatingAdmissionPolicy) (map[string]interface{}, error) {
 	if len(policy.Spec.Variables) == 0 {
@@ -149,7 +233,7 @@ func (v *PolicyValidator) evaluateVariables(policy *admissionregistrationv1.Vali
 	// Variables can reference other variables defined earlier, so we evaluate them in order
 	variableValues := make(map[string]interface{})
 	
-	for _, variable := range policy.Spec.Variables {
+	for i, variable := range policy.Spec.Variables {
 		// Prepare evaluation variables including context vars and previously evaluated variables
 		evalVars := make(map[string]interface{})
 		
@@ -164,7 +248,11 @@ func (v *PolicyValidator) evaluateVariables(policy *admissionregistrationv1.Vali
 		// Evaluate the variable expression
 		result, err := v.celEvaluator.Evaluate(variable.Expression, evalVars)
 		if err != nil {
-			return nil, fmt.Errorf("failed to evaluate variable %s: %w", variable.Name, err)
+			return nil, &fieldError{
+				field:      fmt.Sprintf("spec.variables[%d].expression", i),
+				expression: variable.Expression,
+				err:        fmt.Errorf("failed to evaluate variable %s: %w", variable.Name, err),
+			}
 		}
 
 		// Store the evaluated value
@@ -289,11 +377,15 @@ func (v *PolicyValidator) evaluateMessage(validation admissionregistrationv1.Val
 
 // evaluateMatchConditions evaluates all matchConditions for a policy
 func (v *PolicyValidator) evaluateMatchConditions(conditions []admissionregistrationv1.MatchCondition) (bool, error) {
-	for _, condition := range conditions {
+	for i, condition := range conditions {
 		// Evaluate the condition expression
 		result, err := v.celEvaluator.Evaluate(condition.Expression, v.contextVars)
 		if err != nil {
-			return false, fmt.Errorf("failed to evaluate matchCondition %s: %w", condition.Name, err)
+			return false, &fieldError{
+				field:      fmt.Sprintf("spec.matchConditions[%d].expression", i),
+				expression: condition.Expression,
+				err:        fmt.Errorf("failed to evaluate matchCondition %s: %w", condition.Name, err),
+			}
 		}
 
 		// Check if result is boolean
@@ -0,0 +1,272 @@
+// Package waiver applies PolicyWaiver manifests, which accept the violations of policies by
+// matching resources until they expire
+package waiver
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+
+	kaptestv1 "github.com/yashirook/kube-vap-test/pkg/apis/admission/v1"
+)
+
+const (
+	// APIVersion is the API version of waivers
+	APIVersion = "admission.k8s.io/v1"
+	// Kind is the kind of waivers
+	Kind = "PolicyWaiver"
+)
+
+// dateLayout is the layout of expiry dates
+const dateLayout = "2006-01-02"
+
+// Expiry parses the expiry of a waiver
+// A date expires at the end of the day in UTC, so that the waiver applies on that day
+func Expiry(value string) (time.Time, error) {
+	if date, err := time.Parse(dateLayout, value); err == nil {
+		return date.AddDate(0, 0, 1), nil
+	}
+	expiry, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid expiry %q (must be a date such as 2006-01-02 or an RFC 3339 time)", value)
+	}
+	return expiry, nil
+}
+
+// Validate checks that a waiver names its policies, resources and expiry
+func Validate(waiver *kaptestv1.PolicyWaiver) error {
+	if waiver.Name == "" {
+		return fmt.Errorf("waiver without metadata.name")
+	}
+	if len(waiver.Spec.Policies) == 0 {
+		return fmt.Errorf("waiver '%s' has no policies", waiver.Name)
+	}
+	for i, policy := range waiver.Spec.Policies {
+		if policy.Name == "" {
+			return fmt.Errorf("waiver '%s': spec.policies[%d] has no name", waiver.Name, i)
+		}
+		for _, index := range policy.Validations {
+			if index < 0 {
+				return fmt.Errorf("waiver '%s': spec.policies[%d] has negative validation index %d", waiver.Name, i, index)
+			}
+		}
+	}
+	if len(waiver.Spec.Resources) == 0 {
+		return fmt.Errorf("waiver '%s' has no resources", waiver.Name)
+	}
+	for i, resource := range waiver.Spec.Resources {
+		if resource.Selector == nil {
+			continue
+		}
+		if _, err := metav1.LabelSelectorAsSelector(resource.Selector); err != nil {
+			return fmt.Errorf("waiver '%s': invalid selector in spec.resources[%d]: %w", waiver.Name, i, err)
+		}
+	}
+	if waiver.Spec.Expires == "" {
+		return fmt.Errorf("waiver '%s' has no expiry", waiver.Name)
+	}
+	if _, err := Expiry(waiver.Spec.Expires); err != nil {
+		return fmt.Errorf("waiver '%s': %w", waiver.Name, err)
+	}
+	return nil
+}
+
+// Set is a set of waivers evaluated at a point in time
+type Set struct {
+	waivers []*entry
+}
+
+// entry is a validated waiver
+type entry struct {
+	waiver    *kaptestv1.PolicyWaiver
+	expired   bool
+	selectors []labels.Selector
+}
+
+// NewSet validates waivers and returns their set, with waivers expiring before now expired
+func NewSet(waivers []*kaptestv1.PolicyWaiver, now time.Time) (*Set, error) {
+	set := &Set{}
+	for _, waiver := range waivers {
+		if err := Validate(waiver); err != nil {
+			return nil, err
+		}
+		expiry, _ := Expiry(waiver.Spec.Expires)
+
+		e := &entry{waiver: waiver, expired: !now.Before(expiry)}
+		for _, resource := range waiver.Spec.Resources {
+			var selector labels.Selector
+			if resource.Selector != nil {
+				selector, _ = metav1.LabelSelectorAsSelector(resource.Selector)
+			}
+			e.selectors = append(e.selectors, selector)
+		}
+		set.waivers = append(set.waivers, e)
+	}
+	return set, nil
+}
+
+// Expired returns the expired waivers
+func (s *Set) Expired() []*kaptestv1.PolicyWaiver {
+	var expired []*kaptestv1.PolicyWaiver
+	for _, e := range s.waivers {
+		if e.expired {
+			expired = append(expired, e.waiver)
+		}
+	}
+	return expired
+}
+
+// Apply records the waivers of the denying policies of a result
+// When every denial is waived by an unexpired waiver the object is allowed
+// Expired waivers are recorded but waive nothing, so their violations fail again
+func (s *Set) Apply(obj *unstructured.Unstructured, result *kaptestv1.TestResult) {
+	if s == nil || len(s.waivers) == 0 || result.ActualResponse == nil || result.ActualResponse.Allowed {
+		return
+	}
+
+	denied, waived := false, true
+	for i := range result.PolicyResults {
+		policyResult := &result.PolicyResults[i]
+		if policyResult.Allowed {
+			continue
+		}
+		denied = true
+		if e := s.match(obj, *policyResult); e != nil {
+			policyResult.Waiver = e.reference()
+		}
+		if !Waived(*policyResult) {
+			waived = false
+		}
+	}
+
+	if denied && waived {
+		result.Waived = true
+		result.ActualResponse = &kaptestv1.ResponseDetails{Allowed: true}
+	}
+}
+
+// match returns the waiver covering every violation of a policy result for the object
+// Unexpired waivers take precedence over expired ones
+func (s *Set) match(obj *unstructured.Unstructured, policyResult kaptestv1.PolicyResult) *entry {
+	var expired *entry
+	for _, e := range s.waivers {
+		if !e.matchesResource(obj) || !e.coversPolicy(policyResult) {
+			continue
+		}
+		if !e.expired {
+			return e
+		}
+		if expired == nil {
+			expired = e
+		}
+	}
+	return expired
+}
+
+// matchesResource reports whether a resource selector of the waiver matches the object
+// Objects without a namespace are in the default namespace, as when they are applied with kubectl
+func (e *entry) matchesResource(obj *unstructured.Unstructured) bool {
+	namespace := obj.GetNamespace()
+	if namespace == "" {
+		namespace = metav1.NamespaceDefault
+	}
+
+	for i, resource := range e.waiver.Spec.Resources {
+		if resource.APIVersion != "" && resource.APIVersion != obj.GetAPIVersion() {
+			continue
+		}
+		if resource.Kind != "" && resource.Kind != obj.GetKind() {
+			continue
+		}
+		if resource.Namespace != "" && resource.Namespace != namespace {
+			continue
+		}
+		if resource.Name != "" && resource.Name != obj.GetName() {
+			continue
+		}
+		if e.selectors[i] != nil && !e.selectors[i].Matches(labels.Set(obj.GetLabels())) {
+			continue
+		}
+		return true
+	}
+	return false
+}
+
+// coversPolicy reports whether the waiver covers every violation of a policy result
+// Waivers limited to some validations do not cover violations of variables or match conditions,
+// nor results without violation details such as those of the upstream engine
+func (e *entry) coversPolicy(policyResult kaptestv1.PolicyResult) bool {
+	for _, policy := range e.waiver.Spec.Policies {
+		if policy.Name != policyResult.PolicyName {
+			continue
+		}
+		if len(policy.Validations) == 0 {
+			return true
+		}
+		if len(policyResult.Violations) == 0 {
+			continue
+		}
+		covered := true
+		for _, violation := range policyResult.Violations {
+			index, ok := validationIndex(violation.Field)
+			if !ok || !slices.Contains(policy.Validations, index) {
+				covered = false
+				break
+			}
+		}
+		if covered {
+			return true
+		}
+	}
+	return false
+}
+
+// reference returns the reference recorded in policy results
+func (e *entry) reference() *kaptestv1.WaiverReference {
+	return &kaptestv1.WaiverReference{
+		Name:    e.waiver.Name,
+		Expires: e.waiver.Spec.Expires,
+		Expired: e.expired,
+		Reason:  e.waiver.Spec.Reason,
+		Ticket:  e.waiver.Spec.Ticket,
+	}
+}
+
+// validationIndex returns the index of a spec.validations[i] field
+func validationIndex(field string) (int, bool) {
+	if !strings.HasPrefix(field, "spec.validations[") || !strings.HasSuffix(field, "]") {
+		return 0, false
+	}
+	index, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(field, "spec.validations["), "]"))
+	if err != nil {
+		return 0, false
+	}
+	return index, true
+}
+
+// Waived reports whether the violations of a policy result are waived by an unexpired waiver
+func Waived(policyResult kaptestv1.PolicyResult) bool {
+	return !policyResult.Allowed && policyResult.Waiver != nil && !policyResult.Waiver.Expired
+}
+
+// Describe describes the waiver of a policy result for reports, e.g.
+// "waived by 'legacy-apps' until 2026-12-31 (OPS-42): migration pending"
+func Describe(waiver *kaptestv1.WaiverReference) string {
+	description := fmt.Sprintf("waived by '%s' until %s", waiver.Name, waiver.Expires)
+	if waiver.Expired {
+		description = fmt.Sprintf("waiver '%s' expired on %s", waiver.Name, waiver.Expires)
+	}
+	if waiver.Ticket != "" {
+		description += fmt.Sprintf(" (%s)", waiver.Ticket)
+	}
+	if waiver.Reason != "" {
+		description += ": " + waiver.Reason
+	}
+	return description
+}
@@ -0,0 +1,221 @@
+package waiver
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	kaptestv1 "github.com/yashirook/kube-vap-test/pkg/apis/admission/v1"
+)
+
+func TestExpiry(t *testing.T) {
+	// Dates apply through the end of the day
+	expiry, err := Expiry("2026-12-31")
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC), expiry)
+
+	expiry, err = Expiry("2026-12-31T12:00:00+09:00")
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2026, 12, 31, 3, 0, 0, 0, time.UTC), expiry.UTC())
+
+	_, err = Expiry("next year")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "must be a date such as 2006-01-02 or an RFC 3339 time")
+}
+
+func newWaiver(name, expires string, policy kaptestv1.WaivedPolicy, resources ...kaptestv1.WaivedResource) *kaptestv1.PolicyWaiver {
+	return &kaptestv1.PolicyWaiver{
+		TypeMeta:   metav1.TypeMeta{APIVersion: APIVersion, Kind: Kind},
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec: kaptestv1.PolicyWaiverSpec{
+			Policies:  []kaptestv1.WaivedPolicy{policy},
+			Resources: resources,
+			Expires:   expires,
+			Ticket:    "OPS-1234",
+		},
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		waiver  *kaptestv1.PolicyWaiver
+		wantErr string
+	}{
+		{
+			name:   "valid",
+			waiver: newWaiver("legacy", "2026-12-31", kaptestv1.WaivedPolicy{Name: "no-latest-tag"}, kaptestv1.WaivedResource{Kind: "Pod"}),
+		},
+		{
+			name:    "no resources",
+			waiver:  newWaiver("legacy", "2026-12-31", kaptestv1.WaivedPolicy{Name: "no-latest-tag"}),
+			wantErr: "waiver 'legacy' has no resources",
+		},
+		{
+			name:    "negative validation",
+			waiver:  newWaiver("legacy", "2026-12-31", kaptestv1.WaivedPolicy{Name: "no-latest-tag", Validations: []int{-1}}, kaptestv1.WaivedResource{}),
+			wantErr: "negative validation index -1",
+		},
+		{
+			name:    "invalid expiry",
+			waiver:  newWaiver("legacy", "soon", kaptestv1.WaivedPolicy{Name: "no-latest-tag"}, kaptestv1.WaivedResource{}),
+			wantErr: `invalid expiry "soon"`,
+		},
+		{
+			name: "invalid selector",
+			waiver: newWaiver("legacy", "2026-12-31", kaptestv1.WaivedPolicy{Name: "no-latest-tag"}, kaptestv1.WaivedResource{
+				Selector: &metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{{Key: "team", Operator: "Near"}}},
+			}),
+			wantErr: "invalid selector in spec.resources[0]",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Validate(tt.waiver)
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+}
+
+func deployment(namespace, name string, labels map[string]string) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{}
+	obj.SetAPIVersion("apps/v1")
+	obj.SetKind("Deployment")
+	obj.SetNamespace(namespace)
+	obj.SetName(name)
+	obj.SetLabels(labels)
+	return obj
+}
+
+func deniedResult(policyResults ...kaptestv1.PolicyResult) *kaptestv1.TestResult {
+	return &kaptestv1.TestResult{
+		ActualResponse: &kaptestv1.ResponseDetails{Allowed: false, Reason: "Invalid", Message: "denied"},
+		PolicyResults:  policyResults,
+	}
+}
+
+func violation(field string) kaptestv1.PolicyViolation {
+	return kaptestv1.PolicyViolation{Field: field, Message: "violation of " + field}
+}
+
+func TestSetApply(t *testing.T) {
+	now := time.Date(2026, 6, 1, 0, 0, 0, 0, time.UTC)
+	payments := kaptestv1.WaivedResource{
+		APIVersion: "apps/v1",
+		Kind:       "Deployment",
+		Namespace:  "legacy",
+		Selector:   &metav1.LabelSelector{MatchLabels: map[string]string{"team": "payments"}},
+	}
+	set, err := NewSet([]*kaptestv1.PolicyWaiver{
+		newWaiver("replicas", "2026-12-31", kaptestv1.WaivedPolicy{Name: "replica-limit", Validations: []int{0, 2}}, payments),
+		newWaiver("labels", "2026-06-01", kaptestv1.WaivedPolicy{Name: "required-labels"}, kaptestv1.WaivedResource{Name: "web"}),
+		newWaiver("expired-replicas", "2026-05-31", kaptestv1.WaivedPolicy{Name: "replica-limit"}, kaptestv1.WaivedResource{Kind: "Deployment"}),
+	}, now)
+	require.NoError(t, err)
+
+	// Waivers expire at the end of their last day
+	require.Len(t, set.Expired(), 1)
+	assert.Equal(t, "expired-replicas", set.Expired()[0].Name)
+
+	tests := []struct {
+		name        string
+		obj         *unstructured.Unstructured
+		result      *kaptestv1.TestResult
+		wantWaived  bool
+		wantWaivers []string
+		wantExpired []bool
+	}{
+		{
+			name:        "waived validations",
+			obj:         deployment("legacy", "api", map[string]string{"team": "payments"}),
+			result:      deniedResult(kaptestv1.PolicyResult{PolicyName: "replica-limit", Violations: []kaptestv1.PolicyViolation{violation("spec.validations[0]"), violation("spec.validations[2]")}}),
+			wantWaived:  true,
+			wantWaivers: []string{"replicas"},
+			wantExpired: []bool{false},
+		},
+		{
+			name:        "validation not waived falls back to the expired waiver",
+			obj:         deployment("legacy", "api", map[string]string{"team": "payments"}),
+			result:      deniedResult(kaptestv1.PolicyResult{PolicyName: "replica-limit", Violations: []kaptestv1.PolicyViolation{violation("spec.validations[1]")}}),
+			wantWaivers: []string{"expired-replicas"},
+			wantExpired: []bool{true},
+		},
+		{
+			name:        "labels not selected",
+			obj:         deployment("legacy", "api", map[string]string{"team": "search"}),
+			result:      deniedResult(kaptestv1.PolicyResult{PolicyName: "replica-limit", Violations: []kaptestv1.PolicyViolation{violation("spec.validations[0]")}}),
+			wantWaivers: []string{"expired-replicas"},
+			wantExpired: []bool{true},
+		},
+		{
+			name:        "objects without namespace are in the default namespace",
+			obj:         deployment("", "api", map[string]string{"team": "payments"}),
+			result:      deniedResult(kaptestv1.PolicyResult{PolicyName: "replica-limit", Violations: []kaptestv1.PolicyViolation{violation("spec.validations[0]")}}),
+			wantWaivers: []string{"expired-replicas"},
+			wantExpired: []bool{true},
+		},
+		{
+			name:        "waivers apply on their last day",
+			obj:         deployment("default", "web", nil),
+			result:      deniedResult(kaptestv1.PolicyResult{PolicyName: "required-labels", Message: "labels are required"}),
+			wantWaived:  true,
+			wantWaivers: []string{"labels"},
+			wantExpired: []bool{false},
+		},
+		{
+			name: "every denial must be waived",
+			obj:  deployment("legacy", "web", map[string]string{"team": "payments"}),
+			result: deniedResult(
+				kaptestv1.PolicyResult{PolicyName: "required-labels"},
+				kaptestv1.PolicyResult{PolicyName: "no-latest-tag"},
+				kaptestv1.PolicyResult{PolicyName: "image-registry", Allowed: true},
+			),
+			wantWaivers: []string{"labels", ""},
+			wantExpired: []bool{false, false},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			set.Apply(tt.obj, tt.result)
+			assert.Equal(t, tt.wantWaived, tt.result.Waived)
+			assert.Equal(t, tt.wantWaived, tt.result.ActualResponse.Allowed)
+
+			var waivers []string
+			var expired []bool
+			for _, policyResult := range tt.result.PolicyResults {
+				if policyResult.Allowed {
+					assert.Nil(t, policyResult.Waiver)
+					continue
+				}
+				if policyResult.Waiver == nil {
+					waivers = append(waivers, "")
+					expired = append(expired, false)
+					continue
+				}
+				waivers = append(waivers, policyResult.Waiver.Name)
+				expired = append(expired, policyResult.Waiver.Expired)
+			}
+			assert.Equal(t, tt.wantWaivers, waivers)
+			assert.Equal(t, tt.wantExpired, expired)
+		})
+	}
+}
+
+func TestDescribe(t *testing.T) {
+	waiver := &kaptestv1.WaiverReference{Name: "replicas", Expires: "2026-12-31", Ticket: "OPS-1234", Reason: "migration pending"}
+	assert.Equal(t, "waived by 'replicas' until 2026-12-31 (OPS-1234): migration pending", Describe(waiver))
+
+	waiver.Expired = true
+	assert.Equal(t, "waiver 'replicas' expired on 2026-12-31 (OPS-1234): migration pending", Describe(waiver))
+}
@@ -0,0 +1,264 @@
+// Package gate decides whether check results fail a CI pipeline, and with which exit code
+package gate
+
+import (
+	"fmt"
+	"sort"
+
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+
+	"github.com/yashirook/kube-vap-test/internal/engine/waiver"
+	kaptestv1 "github.com/yashirook/kube-vap-test/pkg/apis/admission/v1"
+)
+
+// Level is the least severe kind of problem failing a check
+type Level string
+
+const (
+	// LevelNone never fails on check results, only on errors loading policies and on violations
+	// of expired waivers
+	LevelNone Level = ""
+	// LevelError fails on evaluation and load errors
+	LevelError Level = "error"
+	// LevelDeny also fails on policy denials beyond the violation thresholds
+	LevelDeny Level = "deny"
+	// LevelWarn also fails on denials of policies bound with the Warn action only
+	LevelWarn Level = "warn"
+)
+
+// Exit codes of failed checks
+// When several kinds of problems occur, load errors take precedence over evaluation errors,
+// then denials, then warnings
+const (
+	// ExitDenied is the exit code of policy denials beyond the violation thresholds
+	ExitDenied = 2
+	// ExitWarned is the exit code of warnings
+	ExitWarned = 3
+	// ExitEvaluationError is the exit code of policies that could not be evaluated
+	ExitEvaluationError = 4
+	// ExitLoadError is the exit code of policies, manifests or resources that could not be loaded
+	ExitLoadError = 5
+)
+
+// ParseLevel parses a --fail-on value
+func ParseLevel(value string) (Level, error) {
+	switch level := Level(value); level {
+	case LevelNone, LevelError, LevelDeny, LevelWarn:
+		return level, nil
+	}
+	return LevelNone, fmt.Errorf("invalid fail-on level %q (must be deny, warn or error)", value)
+}
+
+// Options are the failure thresholds of a check
+type Options struct {
+	// FailOn is the least severe kind of problem failing the check
+	FailOn Level
+	// MaxViolations is the number of denials allowed for policies without their own threshold
+	MaxViolations int
+	// PolicyMaxViolations is the number of denials allowed per policy
+	PolicyMaxViolations map[string]int
+}
+
+// Counts counts the problems of a check
+type Counts struct {
+	// Denied counts the resources each policy denied
+	Denied map[string]int
+	// Warned counts the resources denied by policies bound with the Warn action only
+	Warned int
+	// EvaluationErrors counts resources some policy could not be evaluated for
+	EvaluationErrors int
+	// LoadErrors counts manifests, documents and resources that could not be loaded
+	LoadErrors int
+	// ExpiredWaivers counts the denials that expired waivers no longer waive
+	ExpiredWaivers int
+	// Rejected counts the resources admission plugins rejected before the policies evaluated them
+	Rejected int
+}
+
+// Count counts the problems of check results
+// Bindings decide how denials are enforced, as in the apiserver: denials of policies whose bindings
+// only warn are warnings, and denials of policies whose bindings only audit are ignored
+// Policies without bindings deny, and waived violations do not count
+func Count(status *kaptestv1.ValidatingAdmissionPolicyTestStatus, bindings []*admissionregistrationv1.ValidatingAdmissionPolicyBinding) Counts {
+	counter := NewCounter(bindings)
+	for i := range status.Results {
+		counter.Add(&status.Results[i])
+	}
+	return counter.Counts()
+}
+
+// Counter counts the problems of check results one result at a time, as Count does, so that
+// results need not be kept until the check ends
+type Counter struct {
+	actions map[string]map[admissionregistrationv1.ValidationAction]bool
+	counts  Counts
+}
+
+// NewCounter creates a Counter enforcing denials as the bindings do
+func NewCounter(bindings []*admissionregistrationv1.ValidatingAdmissionPolicyBinding) *Counter {
+	return &Counter{
+		actions: bindingActions(bindings),
+		counts:  Counts{Denied: make(map[string]int)},
+	}
+}
+
+// Add counts the problems of a result
+func (c *Counter) Add(result *kaptestv1.TestResult) {
+	if result.RejectedBy != "" {
+		c.counts.Rejected++
+	}
+	evaluationError := len(result.ExpressionErrors) > 0
+	for _, policyResult := range result.PolicyResults {
+		if policyResult.Allowed || waiver.Waived(policyResult) {
+			continue
+		}
+		if policyResult.Waiver != nil && policyResult.Waiver.Expired {
+			c.counts.ExpiredWaivers++
+		}
+		// Violations accepted by the baseline do not count
+		if policyResult.Baselined {
+			continue
+		}
+		if onlyEvaluationErrors(policyResult.Violations) {
+			evaluationError = true
+			continue
+		}
+
+		policyActions, bound := c.actions[policyResult.PolicyName]
+		switch {
+		case !bound || policyActions[admissionregistrationv1.Deny]:
+			c.counts.Denied[policyResult.PolicyName]++
+		case policyActions[admissionregistrationv1.Warn]:
+			c.counts.Warned++
+		}
+	}
+	if evaluationError {
+		c.counts.EvaluationErrors++
+	}
+}
+
+// Counts returns the problems counted so far
+func (c *Counter) Counts() Counts {
+	return c.counts
+}
+
+// bindingActions returns the validation actions of the bindings of each policy
+func bindingActions(bindings []*admissionregistrationv1.ValidatingAdmissionPolicyBinding) map[string]map[admissionregistrationv1.ValidationAction]bool {
+	actions := make(map[string]map[admissionregistrationv1.ValidationAction]bool)
+	for _, binding := range bindings {
+		policyActions, ok := actions[binding.Spec.PolicyName]
+		if !ok {
+			policyActions = make(map[admissionregistrationv1.ValidationAction]bool)
+			actions[binding.Spec.PolicyName] = policyActions
+		}
+		if len(binding.Spec.ValidationActions) == 0 {
+			policyActions[admissionregistrationv1.Deny] = true
+		}
+		for _, action := range binding.Spec.ValidationActions {
+			policyActions[action] = true
+		}
+	}
+	return actions
+}
+
+// onlyEvaluationErrors reports whether a policy denied only because its expressions could not be evaluated
+func onlyEvaluationErrors(violations []kaptestv1.PolicyViolation) bool {
+	if len(violations) == 0 {
+		return false
+	}
+	for _, violation := range violations {
+		if !violation.EvaluationError {
+			return false
+		}
+	}
+	return true
+}
+
+// Verdict is the outcome of a check
+type Verdict struct {
+	// ExitCode is the exit code of the check, 0 when it passed
+	ExitCode int
+	// Reasons describe the problems failing the check
+	Reasons []string
+}
+
+// Failed reports whether the check failed
+func (v Verdict) Failed() bool {
+	return v.ExitCode != 0
+}
+
+// Evaluate returns the verdict of a check with problem counts
+func Evaluate(counts Counts, opts Options) Verdict {
+	var verdict Verdict
+	fail := func(code int, reason string) {
+		if verdict.ExitCode == 0 || precedence(code) > precedence(verdict.ExitCode) {
+			verdict.ExitCode = code
+		}
+		verdict.Reasons = append(verdict.Reasons, reason)
+	}
+	// Expired waivers fail whatever the level and the violation thresholds
+	if counts.ExpiredWaivers > 0 {
+		fail(ExitDenied, fmt.Sprintf("%d violations of expired waivers", counts.ExpiredWaivers))
+	}
+	if opts.FailOn == LevelNone {
+		return verdict
+	}
+
+	if counts.LoadErrors > 0 {
+		fail(ExitLoadError, fmt.Sprintf("%d manifests, documents or resources could not be loaded", counts.LoadErrors))
+	}
+	if counts.EvaluationErrors > 0 {
+		fail(ExitEvaluationError, fmt.Sprintf("%d resources could not be evaluated", counts.EvaluationErrors))
+	}
+
+	if opts.FailOn == LevelDeny || opts.FailOn == LevelWarn {
+		// The apiserver denies resources rejected by admission plugins, whatever the policies say
+		if counts.Rejected > 0 {
+			fail(ExitDenied, fmt.Sprintf("%d resources rejected by admission plugins", counts.Rejected))
+		}
+		denied := 0
+		for _, policy := range sortedPolicies(counts.Denied) {
+			limit, ok := opts.PolicyMaxViolations[policy]
+			if !ok {
+				denied += counts.Denied[policy]
+				continue
+			}
+			if counts.Denied[policy] > limit {
+				fail(ExitDenied, fmt.Sprintf("policy '%s' has %d violations (max %d)", policy, counts.Denied[policy], limit))
+			}
+		}
+		if denied > opts.MaxViolations {
+			fail(ExitDenied, fmt.Sprintf("%d violations (max %d)", denied, opts.MaxViolations))
+		}
+	}
+
+	if opts.FailOn == LevelWarn && counts.Warned > 0 {
+		fail(ExitWarned, fmt.Sprintf("%d warnings", counts.Warned))
+	}
+	return verdict
+}
+
+// precedence orders exit codes by the severity of their problems
+func precedence(code int) int {
+	switch code {
+	case ExitLoadError:
+		return 4
+	case ExitEvaluationError:
+		return 3
+	case ExitDenied:
+		return 2
+	case ExitWarned:
+		return 1
+	}
+	return 0
+}
+
+// sortedPolicies returns the policy names of counts in order
+func sortedPolicies(counts map[string]int) []string {
+	policies := make([]string, 0, len(counts))
+	for policy := range counts {
+		policies = append(policies, policy)
+	}
+	sort.Strings(policies)
+	return policies
+}
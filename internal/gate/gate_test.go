@@ -0,0 +1,204 @@
+package gate
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	kaptestv1 "github.com/yashirook/kube-vap-test/pkg/apis/admission/v1"
+)
+
+func TestParseLevel(t *testing.T) {
+	for _, value := range []string{"", "deny", "warn", "error"} {
+		level, err := ParseLevel(value)
+		require.NoError(t, err)
+		assert.Equal(t, Level(value), level)
+	}
+
+	_, err := ParseLevel("fatal")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "must be deny, warn or error")
+}
+
+func binding(policy string, actions ...admissionregistrationv1.ValidationAction) *admissionregistrationv1.ValidatingAdmissionPolicyBinding {
+	return &admissionregistrationv1.ValidatingAdmissionPolicyBinding{
+		ObjectMeta: metav1.ObjectMeta{Name: policy + "-binding"},
+		Spec: admissionregistrationv1.ValidatingAdmissionPolicyBindingSpec{
+			PolicyName:        policy,
+			ValidationActions: actions,
+		},
+	}
+}
+
+func TestCount(t *testing.T) {
+	denied := func(policy string) kaptestv1.PolicyResult {
+		return kaptestv1.PolicyResult{PolicyName: policy, Allowed: false}
+	}
+	status := &kaptestv1.ValidatingAdmissionPolicyTestStatus{
+		Results: []kaptestv1.TestResult{
+			{Name: "pod.v1/allowed", PolicyResults: []kaptestv1.PolicyResult{{PolicyName: "no-latest-tag", Allowed: true}}},
+			{Name: "pod.v1/latest", PolicyResults: []kaptestv1.PolicyResult{denied("no-latest-tag"), denied("labels-warned"), denied("audited")}},
+			{Name: "pod.v1/latest-too", PolicyResults: []kaptestv1.PolicyResult{denied("no-latest-tag"), denied("bound-twice")}},
+			{Name: "pod.v1/known", PolicyResults: []kaptestv1.PolicyResult{{PolicyName: "no-latest-tag", Allowed: false, Baselined: true}}},
+			{Name: "pod.v1/waived", PolicyResults: []kaptestv1.PolicyResult{{PolicyName: "no-latest-tag", Allowed: false, Waiver: &kaptestv1.WaiverReference{Name: "legacy"}}}},
+			{Name: "pod.v1/expired", PolicyResults: []kaptestv1.PolicyResult{{PolicyName: "bound-twice", Allowed: false, Waiver: &kaptestv1.WaiverReference{Name: "legacy", Expired: true}}}},
+			{
+				Name: "pod.v1/broken",
+				PolicyResults: []kaptestv1.PolicyResult{{
+					PolicyName: "replica-limit",
+					Allowed:    false,
+					Violations: []kaptestv1.PolicyViolation{{Field: "spec.validations[0]", Message: "no such key: replicas", EvaluationError: true}},
+				}},
+			},
+			{
+				Name:             "pod.v1/messages",
+				PolicyResults:    []kaptestv1.PolicyResult{{PolicyName: "no-latest-tag", Allowed: true}},
+				ExpressionErrors: []kaptestv1.ExpressionError{{Policy: "no-latest-tag", Field: "spec.validations[0].messageExpression"}},
+			},
+			{Name: "pod.v1/unknown-account", RejectedBy: "ServiceAccount", ActualResponse: &kaptestv1.ResponseDetails{Allowed: false, Reason: "Forbidden"}},
+		},
+	}
+	bindings := []*admissionregistrationv1.ValidatingAdmissionPolicyBinding{
+		binding("labels-warned", admissionregistrationv1.Warn),
+		binding("audited", admissionregistrationv1.Audit),
+		binding("bound-twice", admissionregistrationv1.Warn),
+		binding("bound-twice"),
+	}
+
+	counts := Count(status, bindings)
+	// Unbound policies deny, as do policies with one binding denying, and baselined or waived violations do not count
+	assert.Equal(t, map[string]int{"no-latest-tag": 2, "bound-twice": 2}, counts.Denied)
+	// Violations of expired waivers are also counted apart, as they fail regardless of thresholds
+	assert.Equal(t, 1, counts.ExpiredWaivers)
+	// Policies only warning are warnings, and policies only auditing are ignored
+	assert.Equal(t, 1, counts.Warned)
+	assert.Equal(t, 2, counts.EvaluationErrors)
+	// Resources rejected by admission plugins are denied without any policy
+	assert.Equal(t, 1, counts.Rejected)
+	assert.Zero(t, counts.LoadErrors)
+}
+
+func TestEvaluate(t *testing.T) {
+	counts := Counts{
+		Denied: map[string]int{"no-latest-tag": 3, "replica-limit": 1, "legacy-labels": 40},
+		Warned: 2,
+	}
+
+	tests := []struct {
+		name        string
+		counts      Counts
+		opts        Options
+		wantCode    int
+		wantReasons []string
+	}{
+		{
+			name:   "no level never fails",
+			counts: Counts{Denied: map[string]int{"no-latest-tag": 1}, EvaluationErrors: 1, LoadErrors: 1},
+		},
+		{
+			name:   "error ignores denials",
+			counts: counts,
+			opts:   Options{FailOn: LevelError},
+		},
+		{
+			name:        "deny fails on every violation",
+			counts:      counts,
+			opts:        Options{FailOn: LevelDeny},
+			wantCode:    ExitDenied,
+			wantReasons: []string{"44 violations (max 0)"},
+		},
+		{
+			name:     "deny within thresholds",
+			counts:   counts,
+			opts:     Options{FailOn: LevelDeny, MaxViolations: 4, PolicyMaxViolations: map[string]int{"legacy-labels": 40}},
+			wantCode: 0,
+		},
+		{
+			name:        "policy threshold exceeded",
+			counts:      counts,
+			opts:        Options{FailOn: LevelDeny, MaxViolations: 4, PolicyMaxViolations: map[string]int{"legacy-labels": 39}},
+			wantCode:    ExitDenied,
+			wantReasons: []string{"policy 'legacy-labels' has 40 violations (max 39)"},
+		},
+		{
+			name:        "policies without their own threshold share the total",
+			counts:      counts,
+			opts:        Options{FailOn: LevelDeny, MaxViolations: 3, PolicyMaxViolations: map[string]int{"legacy-labels": 40}},
+			wantCode:    ExitDenied,
+			wantReasons: []string{"4 violations (max 3)"},
+		},
+		{
+			name:        "expired waivers fail within thresholds",
+			counts:      Counts{Denied: map[string]int{"no-latest-tag": 1}, ExpiredWaivers: 1},
+			opts:        Options{FailOn: LevelDeny, MaxViolations: 10},
+			wantCode:    ExitDenied,
+			wantReasons: []string{"1 violations of expired waivers"},
+		},
+		{
+			name:        "rejections fail within thresholds",
+			counts:      Counts{Denied: map[string]int{}, Rejected: 2},
+			opts:        Options{FailOn: LevelDeny, MaxViolations: 10},
+			wantCode:    ExitDenied,
+			wantReasons: []string{"2 resources rejected by admission plugins"},
+		},
+		{
+			name:        "expired waivers fail without a level",
+			counts:      Counts{ExpiredWaivers: 1},
+			wantCode:    ExitDenied,
+			wantReasons: []string{"1 violations of expired waivers"},
+		},
+		{
+			name:        "expired waivers fail at the error level",
+			counts:      Counts{ExpiredWaivers: 1},
+			opts:        Options{FailOn: LevelError},
+			wantCode:    ExitDenied,
+			wantReasons: []string{"1 violations of expired waivers"},
+		},
+		{
+			name:     "deny ignores warnings",
+			counts:   Counts{Warned: 2},
+			opts:     Options{FailOn: LevelDeny},
+			wantCode: 0,
+		},
+		{
+			name:        "warn fails on warnings",
+			counts:      Counts{Warned: 2},
+			opts:        Options{FailOn: LevelWarn},
+			wantCode:    ExitWarned,
+			wantReasons: []string{"2 warnings"},
+		},
+		{
+			name:        "denials take precedence over warnings",
+			counts:      counts,
+			opts:        Options{FailOn: LevelWarn, MaxViolations: 4},
+			wantCode:    ExitDenied,
+			wantReasons: []string{"44 violations (max 4)", "2 warnings"},
+		},
+		{
+			name:        "evaluation errors take precedence over denials",
+			counts:      Counts{Denied: map[string]int{"no-latest-tag": 1}, EvaluationErrors: 2},
+			opts:        Options{FailOn: LevelDeny},
+			wantCode:    ExitEvaluationError,
+			wantReasons: []string{"2 resources could not be evaluated", "1 violations (max 0)"},
+		},
+		{
+			name:        "load errors take precedence over evaluation errors",
+			counts:      Counts{EvaluationErrors: 1, LoadErrors: 1},
+			opts:        Options{FailOn: LevelError},
+			wantCode:    ExitLoadError,
+			wantReasons: []string{"1 manifests, documents or resources could not be loaded", "1 resources could not be evaluated"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			verdict := Evaluate(tt.counts, tt.opts)
+			assert.Equal(t, tt.wantCode, verdict.ExitCode)
+			assert.Equal(t, tt.wantCode != 0, verdict.Failed())
+			assert.Equal(t, tt.wantReasons, verdict.Reasons)
+		})
+	}
+}
@@ -0,0 +1,153 @@
+// Package gitrev reads policy sources from revisions of the local git repository, such as
+// git:HEAD~1:policies/, by extracting the files of the revision to a directory
+package gitrev
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Prefix starts the sources read from a git revision
+const Prefix = "git:"
+
+// Source is a file or directory at a revision of the git repository
+type Source struct {
+	// Revision is the revision, e.g. HEAD~1, main or a commit
+	Revision string
+	// Path is the path of the file or directory in the revision, relative to the root of the
+	// repository, or to the working directory when it starts with ./ or ../ as with git show
+	// The whole tree of the revision when empty
+	Path string
+}
+
+// IsSource reports whether a source is read from a git revision
+func IsSource(spec string) bool {
+	return strings.HasPrefix(spec, Prefix)
+}
+
+// Parse parses a git:<revision>:<path> source, whose path may be left out
+func Parse(spec string) (Source, error) {
+	if !IsSource(spec) {
+		return Source{}, fmt.Errorf("%s is not a git source (%s<revision>:<path>)", spec, Prefix)
+	}
+	revision, filePath, _ := strings.Cut(strings.TrimPrefix(spec, Prefix), ":")
+	if revision == "" {
+		return Source{}, fmt.Errorf("git source %s has no revision (%s<revision>:<path>)", spec, Prefix)
+	}
+	return Source{Revision: revision, Path: filePath}, nil
+}
+
+// String returns the source as given on the command line
+func (s Source) String() string {
+	return Prefix + s.Revision + ":" + s.Path
+}
+
+// Extract writes the file or directory of the source into a directory, and returns the path of
+// the extracted file or directory
+// Git is run in the working directory, so the source is read from the repository it belongs to
+func (s Source) Extract(ctx context.Context, dir string) (string, error) {
+	// Objects are resolved in the working directory, which ./ paths are relative to
+	output, err := git(ctx, "", nil, "rev-parse", "--verify", s.Revision+":"+s.Path)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve %s: %w", s, err)
+	}
+	object := strings.TrimSpace(string(output))
+	objectType, err := git(ctx, "", nil, "cat-file", "-t", object)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve %s: %w", s, err)
+	}
+
+	switch strings.TrimSpace(string(objectType)) {
+	case "blob":
+		content, err := git(ctx, "", nil, "cat-file", "blob", object)
+		if err != nil {
+			return "", fmt.Errorf("failed to read %s: %w", s, err)
+		}
+		target := filepath.Join(dir, path.Base(s.Path))
+		if err := os.WriteFile(target, content, 0o644); err != nil {
+			return "", fmt.Errorf("failed to extract %s: %w", s, err)
+		}
+		return target, nil
+	case "tree":
+		// Archives made in subdirectories only hold the files under them, so the tree is
+		// archived from the top of the repository
+		top, err := git(ctx, "", nil, "rev-parse", "--show-toplevel")
+		if err != nil {
+			return "", fmt.Errorf("failed to read %s: %w", s, err)
+		}
+		var archive bytes.Buffer
+		if _, err := git(ctx, strings.TrimSpace(string(top)), &archive, "archive", "--format=tar", object); err != nil {
+			return "", fmt.Errorf("failed to read %s: %w", s, err)
+		}
+		if err := extractTar(&archive, dir); err != nil {
+			return "", fmt.Errorf("failed to extract %s: %w", s, err)
+		}
+		return dir, nil
+	default:
+		return "", fmt.Errorf("%s is not a file or directory", s)
+	}
+}
+
+// extractTar writes the regular files of a tar archive into a directory
+// Links are skipped, so that no file is written outside of the directory
+func extractTar(r io.Reader, dir string) error {
+	tarReader := tar.NewReader(r)
+	for {
+		header, err := tarReader.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if header.Typeflag != tar.TypeReg || !filepath.IsLocal(header.Name) {
+			continue
+		}
+
+		target := filepath.Join(dir, filepath.FromSlash(header.Name))
+		if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+			return err
+		}
+		file, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(file, tarReader); err != nil {
+			file.Close()
+			return err
+		}
+		if err := file.Close(); err != nil {
+			return err
+		}
+	}
+}
+
+// git runs a git command in a directory, the working directory when empty, writing its output to
+// stdout or returning it when stdout is nil
+// Errors carry the message git printed
+func git(ctx context.Context, dir string, stdout io.Writer, args ...string) ([]byte, error) {
+	var output, stderr bytes.Buffer
+	if stdout == nil {
+		stdout = &output
+	}
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	cmd.Stdout = stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if message := strings.TrimSpace(stderr.String()); message != "" {
+			return nil, fmt.Errorf("%w: %s", err, message)
+		}
+		return nil, err
+	}
+	return output.Bytes(), nil
+}
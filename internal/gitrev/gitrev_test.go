@@ -0,0 +1,144 @@
+package gitrev
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		spec    string
+		want    Source
+		wantErr string
+	}{
+		{name: "directory", spec: "git:HEAD~1:policies/", want: Source{Revision: "HEAD~1", Path: "policies/"}},
+		{name: "file", spec: "git:main:policies/policy.yaml", want: Source{Revision: "main", Path: "policies/policy.yaml"}},
+		{name: "whole tree", spec: "git:v1.0.0", want: Source{Revision: "v1.0.0"}},
+		{name: "no revision", spec: "git::policies/", wantErr: "has no revision"},
+		{name: "not a git source", spec: "policies/", wantErr: "is not a git source"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(tt.spec)
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestExtract(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	// Repository whose policies change in the second commit
+	repo := t.TempDir()
+	run := func(args ...string) {
+		cmd := exec.Command("git", append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+		cmd.Dir = repo
+		output, err := cmd.CombinedOutput()
+		require.NoError(t, err, string(output))
+	}
+	write := func(name, content string) {
+		require.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(repo, name)), 0o755))
+		require.NoError(t, os.WriteFile(filepath.Join(repo, name), []byte(content), 0o644))
+	}
+	run("init", "-q")
+	write("policies/policy.yaml", "old")
+	write("policies/nested/params.yaml", "params")
+	run("add", "-A")
+	run("commit", "-q", "-m", "old")
+	write("policies/policy.yaml", "new")
+	run("commit", "-q", "-a", "-m", "new")
+
+	workdir, err := os.Getwd()
+	require.NoError(t, err)
+	require.NoError(t, os.Chdir(filepath.Join(repo, "policies")))
+	t.Cleanup(func() { os.Chdir(workdir) })
+
+	tests := []struct {
+		name      string
+		source    Source
+		wantFiles map[string]string
+		wantErr   string
+	}{
+		{
+			name:      "directory",
+			source:    Source{Revision: "HEAD~1", Path: "policies"},
+			wantFiles: map[string]string{"policy.yaml": "old", "nested/params.yaml": "params"},
+		},
+		{
+			name:      "file",
+			source:    Source{Revision: "HEAD", Path: "policies/policy.yaml"},
+			wantFiles: map[string]string{"policy.yaml": "new"},
+		},
+		{
+			// Paths starting with ./ are relative to the working directory
+			name:      "relative path",
+			source:    Source{Revision: "HEAD~1", Path: "./policy.yaml"},
+			wantFiles: map[string]string{"policy.yaml": "old"},
+		},
+		{
+			name:      "whole tree",
+			source:    Source{Revision: "HEAD"},
+			wantFiles: map[string]string{"policies/policy.yaml": "new", "policies/nested/params.yaml": "params"},
+		},
+		{
+			name:    "unknown path",
+			source:  Source{Revision: "HEAD", Path: "missing"},
+			wantErr: "failed to resolve git:HEAD:missing",
+		},
+		{
+			name:    "unknown revision",
+			source:  Source{Revision: "unknown", Path: "policies"},
+			wantErr: "failed to resolve git:unknown:policies",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			extracted, err := tt.source.Extract(context.Background(), dir)
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+
+			got := make(map[string]string)
+			err = filepath.WalkDir(dir, func(path string, entry os.DirEntry, err error) error {
+				if err != nil || entry.IsDir() {
+					return err
+				}
+				content, err := os.ReadFile(path)
+				if err != nil {
+					return err
+				}
+				name, err := filepath.Rel(dir, path)
+				got[filepath.ToSlash(name)] = string(content)
+				return err
+			})
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantFiles, got)
+			if len(tt.wantFiles) == 1 {
+				assert.Equal(t, filepath.Join(dir, "policy.yaml"), extracted)
+			} else {
+				assert.Equal(t, dir, extracted)
+			}
+		})
+	}
+}
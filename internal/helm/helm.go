@@ -0,0 +1,196 @@
+// Package helm renders local Helm charts in-process, like helm template, and labels every rendered
+// object with the template it comes from
+package helm
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/cli/values"
+	"helm.sh/helm/v3/pkg/getter"
+	"helm.sh/helm/v3/pkg/release"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"github.com/yashirook/kube-vap-test/internal/engine/upstream"
+	manifestloader "github.com/yashirook/kube-vap-test/internal/loader"
+	kaptestv1 "github.com/yashirook/kube-vap-test/pkg/apis/admission/v1"
+)
+
+// ReleaseName is the name of the rendered release, as with helm template
+const ReleaseName = "release-name"
+
+// sourcePrefix starts the comment naming the template of each rendered document
+const sourcePrefix = "# Source: "
+
+// Options are the values and namespace of a release
+type Options struct {
+	// Namespace is the namespace of the release, and of the namespaced objects that do not set one
+	// The default namespace is used when it is empty
+	Namespace string
+	// ValueFiles are values files, later files taking precedence
+	ValueFiles []string
+	// Values are key=value pairs, as with helm --set, taking precedence over the files
+	Values []string
+}
+
+// Resource is an object rendered from a chart
+type Resource struct {
+	// Object is the rendered object
+	Object *unstructured.Unstructured
+	// Source is the template the object is rendered from
+	Source kaptestv1.SourceLocation
+}
+
+// Render renders a local chart directory or archive with the CRDs and hooks of the chart
+// Rendering is offline: charts, dependencies and values files are never fetched, and the
+// capabilities of the cluster are those of helm template. Test hooks are not rendered
+func Render(chartPath string, opts Options) ([]Resource, error) {
+	if _, err := os.Stat(chartPath); err != nil {
+		return nil, fmt.Errorf("chart %s is not a local chart directory or archive, repositories are not fetched: %w", chartPath, err)
+	}
+	chart, err := loader.Load(chartPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load chart: %w", err)
+	}
+	if err := action.CheckDependencies(chart, chart.Metadata.Dependencies); err != nil {
+		return nil, fmt.Errorf("failed to load chart dependencies: %w", err)
+	}
+
+	// Without providers values files are only read from disk
+	valueOpts := &values.Options{ValueFiles: opts.ValueFiles, Values: opts.Values}
+	vals, err := valueOpts.MergeValues(getter.Providers{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read values: %w", err)
+	}
+
+	namespace := opts.Namespace
+	if namespace == "" {
+		namespace = metav1.NamespaceDefault
+	}
+	install := action.NewInstall(&action.Configuration{Log: func(string, ...interface{}) {}})
+	install.DryRun = true
+	install.ClientOnly = true
+	install.Replace = true
+	install.IncludeCRDs = true
+	install.ReleaseName = ReleaseName
+	install.Namespace = namespace
+	rel, err := install.Run(chart, vals)
+	if err != nil {
+		return nil, fmt.Errorf("failed to render chart: %w", err)
+	}
+
+	resources, err := decode(chartPath, rel.Manifest)
+	if err != nil {
+		return nil, err
+	}
+	for _, hook := range rel.Hooks {
+		if isTestHook(hook) {
+			continue
+		}
+		hookResources, err := decode(chartPath, sourcePrefix+hook.Path+"\n"+hook.Manifest)
+		if err != nil {
+			return nil, err
+		}
+		resources = append(resources, hookResources...)
+	}
+
+	setNamespace(resources, namespace)
+	return resources, nil
+}
+
+// decode decodes the objects of a rendered manifest, located at the template named by the
+// source comment before each of them
+func decode(chartPath, manifest string) ([]Resource, error) {
+	templates := templateLines(manifest)
+
+	var resources []Resource
+	decoder := manifestloader.NewDocumentDecoder(strings.NewReader(manifest), chartPath)
+	for {
+		document, err := decoder.Next()
+		if errors.Is(err, io.EOF) {
+			return resources, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode rendered manifest: %w", err)
+		}
+
+		source := kaptestv1.SourceLocation{File: chartPath}
+		for line := document.Line; line > 0; line-- {
+			if template, ok := templates[line]; ok {
+				source.File = templateFile(chartPath, template)
+				break
+			}
+		}
+		resources = append(resources, Resource{Object: document.Object, Source: source})
+	}
+}
+
+// templateLines returns the templates named by the source comments of a manifest, by line
+func templateLines(manifest string) map[int]string {
+	templates := make(map[int]string)
+	scanner := bufio.NewScanner(strings.NewReader(manifest))
+	scanner.Buffer(make([]byte, 0, 64*1024), len(manifest)+1)
+	for line := 1; scanner.Scan(); line++ {
+		if template, ok := strings.CutPrefix(scanner.Text(), sourcePrefix); ok {
+			templates[line] = template
+		}
+	}
+	return templates
+}
+
+// templateFile returns the path of a template, named after the chart such as
+// mychart/templates/deployment.yaml, in the chart directory or archive
+func templateFile(chartPath, template string) string {
+	_, rest, ok := strings.Cut(template, "/")
+	if !ok {
+		return filepath.Join(chartPath, template)
+	}
+	return filepath.Join(chartPath, filepath.FromSlash(rest))
+}
+
+// isTestHook reports whether a hook only runs with helm test
+func isTestHook(hook *release.Hook) bool {
+	for _, event := range hook.Events {
+		if event == release.HookTest {
+			return true
+		}
+	}
+	return false
+}
+
+// setNamespace puts the namespaced objects without a namespace in the release namespace, as
+// helm install does
+// Kinds defined as cluster-scoped by CRDs of the chart are kept without a namespace
+func setNamespace(resources []Resource, namespace string) {
+	clusterScoped := make(map[schema.GroupKind]bool)
+	for _, resource := range resources {
+		obj := resource.Object
+		if obj.GroupVersionKind().GroupKind() != (schema.GroupKind{Group: "apiextensions.k8s.io", Kind: "CustomResourceDefinition"}) {
+			continue
+		}
+		scope, _, _ := unstructured.NestedString(obj.Object, "spec", "scope")
+		group, _, _ := unstructured.NestedString(obj.Object, "spec", "group")
+		kind, _, _ := unstructured.NestedString(obj.Object, "spec", "names", "kind")
+		if scope == "Cluster" {
+			clusterScoped[schema.GroupKind{Group: group, Kind: kind}] = true
+		}
+	}
+
+	for _, resource := range resources {
+		obj := resource.Object
+		groupKind := obj.GroupVersionKind().GroupKind()
+		if obj.GetNamespace() != "" || upstream.IsClusterScoped(groupKind) || clusterScoped[groupKind] {
+			continue
+		}
+		obj.SetNamespace(namespace)
+	}
+}
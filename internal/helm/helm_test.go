@@ -0,0 +1,122 @@
+package helm
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestRender(t *testing.T) {
+	type rendered struct {
+		kind      string
+		name      string
+		namespace string
+		file      string
+	}
+
+	tests := []struct {
+		name         string
+		opts         Options
+		want         []rendered
+		wantReplicas int64
+		wantImage    string
+	}{
+		{
+			name: "default values",
+			want: []rendered{
+				{kind: "Service", name: "release-name-web", namespace: "frontend", file: "test/web/templates/service.yaml"},
+				{kind: "Deployment", name: "release-name-web", namespace: "default", file: "test/web/templates/deployment.yaml"},
+				{kind: "Job", name: "release-name-web-migrate", namespace: "default", file: "test/web/templates/migrate.yaml"},
+			},
+			wantReplicas: 2,
+			wantImage:    "nginx:1.27",
+		},
+		{
+			name: "values files, set values and namespace",
+			opts: Options{
+				Namespace:  "prod",
+				ValueFiles: []string{"test/prod-values.yaml"},
+				Values:     []string{"image.tag=latest"},
+			},
+			want: []rendered{
+				{kind: "ServiceAccount", name: "release-name-web", namespace: "prod", file: "test/web/templates/rbac.yaml"},
+				// Cluster-scoped objects are not put in the namespace
+				{kind: "ClusterRole", name: "release-name-web", file: "test/web/templates/rbac.yaml"},
+				{kind: "Service", name: "release-name-web", namespace: "frontend", file: "test/web/templates/service.yaml"},
+				{kind: "Deployment", name: "release-name-web", namespace: "prod", file: "test/web/templates/deployment.yaml"},
+				{kind: "Job", name: "release-name-web-migrate", namespace: "prod", file: "test/web/templates/migrate.yaml"},
+			},
+			wantReplicas: 5,
+			wantImage:    "nginx:latest",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resources, err := Render("test/web", tt.opts)
+			require.NoError(t, err)
+
+			var got []rendered
+			for _, resource := range resources {
+				got = append(got, rendered{
+					kind:      resource.Object.GetKind(),
+					name:      resource.Object.GetName(),
+					namespace: resource.Object.GetNamespace(),
+					file:      resource.Source.File,
+				})
+				if resource.Object.GetKind() != "Deployment" {
+					continue
+				}
+				replicas, _, _ := unstructured.NestedInt64(resource.Object.Object, "spec", "replicas")
+				assert.Equal(t, tt.wantReplicas, replicas)
+				containers, _, _ := unstructured.NestedSlice(resource.Object.Object, "spec", "template", "spec", "containers")
+				require.Len(t, containers, 1)
+				assert.Equal(t, tt.wantImage, containers[0].(map[string]interface{})["image"])
+			}
+			// Test hooks and notes are not rendered
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestRenderErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		chart   string
+		opts    Options
+		wantErr string
+	}{
+		{
+			name:    "repository chart",
+			chart:   "bitnami/nginx",
+			wantErr: "chart bitnami/nginx is not a local chart directory or archive, repositories are not fetched",
+		},
+		{
+			name:    "missing dependency",
+			chart:   "test/missing-dependency",
+			wantErr: "found in Chart.yaml, but missing in charts/ directory: redis",
+		},
+		{
+			name:    "remote values file",
+			chart:   "test/web",
+			opts:    Options{ValueFiles: []string{"https://example.com/values.yaml"}},
+			wantErr: "failed to read values",
+		},
+		{
+			name:    "invalid set value",
+			chart:   "test/web",
+			opts:    Options{Values: []string{"replicas"}},
+			wantErr: "failed to read values",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Render(tt.chart, tt.opts)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+}
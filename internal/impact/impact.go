@@ -0,0 +1,127 @@
+// Package impact compares the admission of the same resources by two versions of the policies,
+// telling what a policy change newly denies or allows before it is merged
+package impact
+
+import (
+	"slices"
+
+	"github.com/yashirook/kube-vap-test/internal/engine/waiver"
+	kaptestv1 "github.com/yashirook/kube-vap-test/pkg/apis/admission/v1"
+)
+
+// Comparison collects the changes of the resources evaluated by both versions of the policies
+type Comparison struct {
+	report kaptestv1.ImpactReport
+	// Results of the new policies for the resources whose admission changes
+	results []kaptestv1.TestResult
+}
+
+// NewComparison creates a comparison of the versions of the policies read from the old and new
+// policy sources
+func NewComparison(oldSources, newSources []string) *Comparison {
+	return &Comparison{report: kaptestv1.ImpactReport{Old: oldSources, New: newSources}}
+}
+
+// Add compares the results of a resource evaluated by the old and new policies
+func (c *Comparison) Add(oldResult, newResult *kaptestv1.TestResult) {
+	c.report.Evaluated++
+	change, changed := Compare(oldResult, newResult)
+	if !changed {
+		return
+	}
+
+	switch change.Change {
+	case kaptestv1.ImpactNewlyDenied:
+		c.report.NewlyDenied++
+	case kaptestv1.ImpactNewlyAllowed:
+		c.report.NewlyAllowed++
+	case kaptestv1.ImpactMessageChanged:
+		c.report.MessageChanged++
+	}
+	c.report.Results = append(c.report.Results, change)
+	c.results = append(c.results, *newResult)
+}
+
+// Report returns the report of the comparison
+func (c *Comparison) Report() *kaptestv1.ImpactReport {
+	report := c.report
+	return &report
+}
+
+// Status returns the results of the new policies for the resources whose admission changes,
+// with the report of the comparison
+func (c *Comparison) Status() *kaptestv1.ValidatingAdmissionPolicyTestStatus {
+	status := &kaptestv1.ValidatingAdmissionPolicyTestStatus{
+		Results: c.results,
+		Impact:  c.Report(),
+	}
+	status.Summary.Total = len(c.results)
+	for _, result := range c.results {
+		if response(&result).Allowed {
+			status.Summary.Successful++
+		} else {
+			status.Summary.Failed++
+		}
+	}
+	return status
+}
+
+// Compare returns how the admission of a resource changes from its result with the old policies
+// to its result with the new policies, and whether it changes
+// Messages are only compared between denials, and waived denials allow the resource
+func Compare(oldResult, newResult *kaptestv1.TestResult) (kaptestv1.ImpactResult, bool) {
+	oldResponse := response(oldResult)
+	newResponse := response(newResult)
+
+	change := kaptestv1.ImpactResult{Old: oldResponse, New: newResponse, Source: newResult.Source}
+	if newResult.Resource != nil {
+		change.Resource = *newResult.Resource
+	}
+
+	switch {
+	case oldResponse.Allowed && newResponse.Allowed:
+		return change, false
+	case oldResponse.Allowed:
+		change.Change = kaptestv1.ImpactNewlyDenied
+	case newResponse.Allowed:
+		change.Change = kaptestv1.ImpactNewlyAllowed
+	case oldResponse.Message != newResponse.Message:
+		change.Change = kaptestv1.ImpactMessageChanged
+	default:
+		return change, false
+	}
+
+	oldDenials := denyingPolicies(oldResult)
+	newDenials := denyingPolicies(newResult)
+	for _, policy := range newDenials {
+		if !slices.Contains(oldDenials, policy) {
+			change.DeniedBy = append(change.DeniedBy, policy)
+		}
+	}
+	for _, policy := range oldDenials {
+		if !slices.Contains(newDenials, policy) {
+			change.NoLongerDeniedBy = append(change.NoLongerDeniedBy, policy)
+		}
+	}
+	return change, true
+}
+
+// response returns the admission response of a result
+// Results without a response, which no policy evaluated, are allowed
+func response(result *kaptestv1.TestResult) kaptestv1.ResponseDetails {
+	if result.ActualResponse == nil {
+		return kaptestv1.ResponseDetails{Allowed: true}
+	}
+	return *result.ActualResponse
+}
+
+// denyingPolicies returns the policies denying the resource of a result, without waived denials
+func denyingPolicies(result *kaptestv1.TestResult) []string {
+	var policies []string
+	for _, policyResult := range result.PolicyResults {
+		if !policyResult.Allowed && !waiver.Waived(policyResult) && !slices.Contains(policies, policyResult.PolicyName) {
+			policies = append(policies, policyResult.PolicyName)
+		}
+	}
+	return policies
+}
@@ -0,0 +1,148 @@
+package impact
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	kaptestv1 "github.com/yashirook/kube-vap-test/pkg/apis/admission/v1"
+)
+
+func pod(name string) *kaptestv1.ResourceReference {
+	return &kaptestv1.ResourceReference{APIVersion: "v1", Kind: "Pod", Namespace: "apps", Name: name}
+}
+
+// result returns the result of a pod denied by the policies mapped to their messages
+func result(name string, denials map[string]string) *kaptestv1.TestResult {
+	result := &kaptestv1.TestResult{
+		Name:           "pod.v1/" + name,
+		Resource:       pod(name),
+		ActualResponse: &kaptestv1.ResponseDetails{Allowed: true},
+	}
+	for _, policy := range []string{"label-required", "no-latest-tag"} {
+		message, denied := denials[policy]
+		result.PolicyResults = append(result.PolicyResults, kaptestv1.PolicyResult{PolicyName: policy, Allowed: !denied, Message: message})
+		if denied {
+			result.ActualResponse = &kaptestv1.ResponseDetails{Allowed: false, Reason: "Invalid", Message: message}
+		}
+	}
+	return result
+}
+
+func TestCompare(t *testing.T) {
+	labels := map[string]string{"label-required": "team label is required"}
+	tag := map[string]string{"no-latest-tag": "latest tag is not allowed"}
+
+	waived := result("web", labels)
+	waived.PolicyResults[0].Waiver = &kaptestv1.WaiverReference{Name: "legacy", Expires: "2099-12-31"}
+	waived.ActualResponse = &kaptestv1.ResponseDetails{Allowed: true}
+
+	tests := []struct {
+		name                 string
+		old                  *kaptestv1.TestResult
+		new                  *kaptestv1.TestResult
+		wantChange           kaptestv1.ImpactChange
+		wantDeniedBy         []string
+		wantNoLongerDeniedBy []string
+		wantChanged          bool
+	}{
+		{name: "allowed by both", old: result("web", nil), new: result("web", nil)},
+		{name: "denied by both alike", old: result("web", labels), new: result("web", labels)},
+		{
+			name:         "newly denied",
+			old:          result("web", nil),
+			new:          result("web", tag),
+			wantChange:   kaptestv1.ImpactNewlyDenied,
+			wantDeniedBy: []string{"no-latest-tag"},
+			wantChanged:  true,
+		},
+		{
+			name:                 "newly allowed",
+			old:                  result("web", labels),
+			new:                  result("web", nil),
+			wantChange:           kaptestv1.ImpactNewlyAllowed,
+			wantNoLongerDeniedBy: []string{"label-required"},
+			wantChanged:          true,
+		},
+		{
+			name:                 "denied by another policy",
+			old:                  result("web", labels),
+			new:                  result("web", tag),
+			wantChange:           kaptestv1.ImpactMessageChanged,
+			wantDeniedBy:         []string{"no-latest-tag"},
+			wantNoLongerDeniedBy: []string{"label-required"},
+			wantChanged:          true,
+		},
+		{
+			name:        "message changed",
+			old:         result("web", labels),
+			new:         result("web", map[string]string{"label-required": "team and owner labels are required"}),
+			wantChange:  kaptestv1.ImpactMessageChanged,
+			wantChanged: true,
+		},
+		{
+			// Waived denials allow the resource, and do not deny it
+			name:         "waived denial",
+			old:          waived,
+			new:          result("web", labels),
+			wantChange:   kaptestv1.ImpactNewlyDenied,
+			wantDeniedBy: []string{"label-required"},
+			wantChanged:  true,
+		},
+		{
+			name: "no response",
+			old:  &kaptestv1.TestResult{Name: "pod.v1/web", Resource: pod("web")},
+			new:  result("web", nil),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			change, changed := Compare(tt.old, tt.new)
+			assert.Equal(t, tt.wantChanged, changed)
+			if !changed {
+				return
+			}
+			assert.Equal(t, tt.wantChange, change.Change)
+			assert.Equal(t, *pod("web"), change.Resource)
+			assert.Equal(t, tt.wantDeniedBy, change.DeniedBy)
+			assert.Equal(t, tt.wantNoLongerDeniedBy, change.NoLongerDeniedBy)
+			assert.Equal(t, *tt.old.ActualResponse, change.Old)
+			assert.Equal(t, *tt.new.ActualResponse, change.New)
+		})
+	}
+}
+
+func TestComparison(t *testing.T) {
+	labels := map[string]string{"label-required": "team label is required"}
+	tag := map[string]string{"no-latest-tag": "latest tag is not allowed"}
+
+	comparison := NewComparison([]string{"git:HEAD:policies/"}, []string{"policies/"})
+	comparison.Add(result("unchanged", labels), result("unchanged", labels))
+	comparison.Add(result("denied", nil), result("denied", tag))
+	comparison.Add(result("allowed", labels), result("allowed", nil))
+	comparison.Add(result("changed", labels), result("changed", tag))
+	comparison.Add(result("still-allowed", nil), result("still-allowed", nil))
+
+	status := comparison.Status()
+	report := status.Impact
+	assert.Equal(t, []string{"git:HEAD:policies/"}, report.Old)
+	assert.Equal(t, []string{"policies/"}, report.New)
+	assert.Equal(t, 5, report.Evaluated)
+	assert.Equal(t, 1, report.NewlyDenied)
+	assert.Equal(t, 1, report.NewlyAllowed)
+	assert.Equal(t, 1, report.MessageChanged)
+
+	// Only the resources whose admission changes are reported, with their new results
+	var names []string
+	for _, change := range report.Results {
+		names = append(names, change.Resource.Name)
+	}
+	assert.Equal(t, []string{"denied", "allowed", "changed"}, names)
+	var resultNames []string
+	for _, result := range status.Results {
+		resultNames = append(resultNames, result.Name)
+	}
+	assert.Equal(t, []string{"pod.v1/denied", "pod.v1/allowed", "pod.v1/changed"}, resultNames)
+	assert.Equal(t, kaptestv1.TestSummary{Total: 3, Successful: 1, Failed: 2}, status.Summary)
+}
@@ -0,0 +1,390 @@
+// Package kustomize renders Kustomize overlays in-process, and maps every rendered resource back to
+// the file it originates from and the patches applied to it
+package kustomize
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/kustomize/api/konfig"
+	"sigs.k8s.io/kustomize/api/krusty"
+	"sigs.k8s.io/kustomize/api/resource"
+	"sigs.k8s.io/kustomize/api/types"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+	"sigs.k8s.io/kustomize/kyaml/resid"
+	sigsyaml "sigs.k8s.io/yaml"
+
+	"github.com/yashirook/kube-vap-test/internal/loader"
+	kaptestv1 "github.com/yashirook/kube-vap-test/pkg/apis/admission/v1"
+)
+
+const (
+	// originAnnotation records the file a rendered resource originates from
+	originAnnotation = "config.kubernetes.io/origin"
+	// transformationsAnnotation records the kustomizations whose transformers changed a resource
+	transformationsAnnotation = "alpha.config.kubernetes.io/transformations"
+)
+
+// patchTransformers are the kinds of the builtin transformers applying patches
+var patchTransformers = []string{"PatchTransformer", "PatchStrategicMergeTransformer", "PatchJson6902Transformer"}
+
+// Resource is a resource rendered by a kustomization
+type Resource struct {
+	// Object is the rendered resource, without the build metadata annotations added to map it back
+	Object *unstructured.Unstructured
+	// Source is the file the resource originates from, and the position of the resource in it
+	// Generated resources originate from the kustomization configuring the generator
+	Source kaptestv1.SourceLocation
+	// Patches are the patches of the kustomizations applied to the resource
+	Patches []kaptestv1.SourceLocation
+}
+
+// Build renders the kustomization of a directory
+// Builds are offline: plugins and Helm charts are disabled, and remote resources are refused
+// Paths of the resources are relative to the working directory, like the kustomization path
+func Build(path string) ([]Resource, error) {
+	fSys := filesys.MakeFsOnDisk()
+	root, _, err := fSys.CleanedAbs(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find directory: %w", err)
+	}
+
+	buildFS := &buildFileSystem{FileSystem: fSys, root: root.String()}
+	resources, err := krusty.MakeKustomizer(krusty.MakeDefaultOptions()).Run(buildFS, root.String())
+	if buildFS.err != nil {
+		// Kustomize looks for the kustomization file under other names when it cannot be read
+		err = buildFS.err
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	b := &builder{
+		path:           filepath.Clean(path),
+		keep:           buildFS.requested,
+		documents:      make(map[string][]loader.Document),
+		kustomizations: make(map[string]*types.Kustomization),
+	}
+	var rendered []Resource
+	for _, res := range resources.Resources() {
+		resource, err := b.resource(res)
+		if err != nil {
+			return nil, fmt.Errorf("failed to map %s to its files: %w", res.CurId(), err)
+		}
+		rendered = append(rendered, resource)
+	}
+	return rendered, nil
+}
+
+// buildFileSystem reads the files of a build from disk
+// The root kustomization gets the build metadata annotating resources with their origin, and
+// kustomizations with remote resources are refused, keeping the build offline
+type buildFileSystem struct {
+	filesys.FileSystem
+	// root is the absolute directory of the root kustomization
+	root string
+	// requested are the build metadata options of the root kustomization itself
+	requested []string
+	// err is the first kustomization refused
+	err error
+}
+
+// ReadFile reads a file, adding build metadata to the root kustomization
+func (f *buildFileSystem) ReadFile(path string) ([]byte, error) {
+	data, err := f.FileSystem.ReadFile(path)
+	if err != nil || !slices.Contains(konfig.RecognizedKustomizationFileNames(), filepath.Base(path)) {
+		return data, err
+	}
+
+	var kustomization map[string]interface{}
+	if err := sigsyaml.Unmarshal(data, &kustomization); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	if err := checkLocal(filepath.Dir(path), kustomization); err != nil {
+		if f.err == nil {
+			f.err = fmt.Errorf("%s: %w", path, err)
+		}
+		return nil, f.err
+	}
+	if filepath.Dir(path) != f.root {
+		return data, nil
+	}
+
+	metadata, _, err := unstructured.NestedStringSlice(kustomization, "buildMetadata")
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	f.requested = metadata
+	for _, option := range []string{types.OriginAnnotations, types.TransformerAnnotations} {
+		if !slices.Contains(metadata, option) {
+			metadata = append(metadata, option)
+		}
+	}
+	if kustomization == nil {
+		kustomization = make(map[string]interface{})
+	}
+	if err := unstructured.SetNestedStringSlice(kustomization, metadata, "buildMetadata"); err != nil {
+		return nil, err
+	}
+	return sigsyaml.Marshal(kustomization)
+}
+
+// checkLocal fails on resources and components of a kustomization that are not local files or
+// directories, which Kustomize would fetch over the network
+func checkLocal(dir string, kustomization map[string]interface{}) error {
+	for _, field := range []string{"resources", "bases", "components"} {
+		entries, _, _ := unstructured.NestedStringSlice(kustomization, field)
+		for _, entry := range entries {
+			if _, err := os.Stat(filepath.Join(dir, entry)); err != nil {
+				return fmt.Errorf("%s entry %q is not a local file or directory, remote resources are not fetched", field, entry)
+			}
+		}
+	}
+	return nil
+}
+
+// builder maps rendered resources back to their files
+type builder struct {
+	// path is the kustomization directory as given
+	path string
+	// keep are the build metadata options the root kustomization requested itself, whose
+	// annotations stay on the resources
+	keep []string
+	// documents caches the documents of source files
+	documents map[string][]loader.Document
+	// kustomizations caches the kustomizations applying patches
+	kustomizations map[string]*types.Kustomization
+}
+
+// resource maps a rendered resource back to its files
+func (b *builder) resource(res *resource.Resource) (Resource, error) {
+	origin, err := res.GetOrigin()
+	if err != nil {
+		return Resource{}, fmt.Errorf("invalid origin annotation: %w", err)
+	}
+	transformations, err := res.GetTransformations()
+	if err != nil {
+		return Resource{}, fmt.Errorf("invalid transformations annotation: %w", err)
+	}
+
+	// Objects are decoded from JSON like the manifests of files, with numbers as int64
+	content, err := res.MarshalJSON()
+	if err != nil {
+		return Resource{}, err
+	}
+	obj := &unstructured.Unstructured{}
+	if err := obj.UnmarshalJSON(content); err != nil {
+		return Resource{}, err
+	}
+	annotations := obj.GetAnnotations()
+	if !slices.Contains(b.keep, types.OriginAnnotations) {
+		delete(annotations, originAnnotation)
+	}
+	if !slices.Contains(b.keep, types.TransformerAnnotations) {
+		delete(annotations, transformationsAnnotation)
+	}
+	if len(annotations) == 0 {
+		annotations = nil
+	}
+	obj.SetAnnotations(annotations)
+
+	rendered := Resource{Object: obj, Source: kaptestv1.SourceLocation{File: b.path}}
+	original := obj
+	switch {
+	case origin == nil:
+	case origin.Repo != "":
+		rendered.Source.File = origin.Repo + "//" + origin.Path
+	case origin.ConfiguredIn != "":
+		rendered.Source.File = filepath.Join(b.path, origin.ConfiguredIn)
+	default:
+		rendered.Source.File = filepath.Join(b.path, origin.Path)
+		if document := b.document(rendered.Source.File, obj); document != nil {
+			rendered.Source.Line = document.Line
+			original = document.Object
+		}
+	}
+
+	for _, transformation := range transformations {
+		if transformation.ConfiguredIn == "" || !slices.Contains(patchTransformers, transformation.ConfiguredBy.Kind) {
+			continue
+		}
+		patches, err := b.patches(filepath.Join(b.path, transformation.ConfiguredIn), obj, original)
+		if err != nil {
+			return Resource{}, err
+		}
+		for _, patch := range patches {
+			if !slices.Contains(rendered.Patches, patch) {
+				rendered.Patches = append(rendered.Patches, patch)
+			}
+		}
+	}
+	return rendered, nil
+}
+
+// document returns the document of a file a rendered object originates from
+// Name prefixes and suffixes change names, so the document of the same kind whose name is part of
+// the rendered name is used when no name is equal
+func (b *builder) document(path string, obj *unstructured.Unstructured) *loader.Document {
+	var candidate *loader.Document
+	for i, document := range b.readDocuments(path) {
+		if document.Object.GetKind() != obj.GetKind() {
+			continue
+		}
+		if document.Object.GetName() == obj.GetName() {
+			return &b.documents[path][i]
+		}
+		if candidate == nil && document.Object.GetName() != "" && strings.Contains(obj.GetName(), document.Object.GetName()) {
+			candidate = &b.documents[path][i]
+		}
+	}
+	return candidate
+}
+
+// readDocuments reads the documents of a file once
+// Files that cannot be read have no documents, the build read them already
+func (b *builder) readDocuments(path string) []loader.Document {
+	documents, ok := b.documents[path]
+	if !ok {
+		documents, _ = loader.ReadDocuments(path)
+		b.documents[path] = documents
+	}
+	return documents
+}
+
+// patches returns the patches of a kustomization applied to an object
+// Patches with a target apply to the objects it selects, and patches without one to the objects
+// of the kind and name of their documents. Original is the object before the kustomizations
+// renamed it
+func (b *builder) patches(kustomizationPath string, obj, original *unstructured.Unstructured) ([]kaptestv1.SourceLocation, error) {
+	kustomization, err := b.kustomization(kustomizationPath)
+	if err != nil {
+		return nil, err
+	}
+
+	dir := filepath.Dir(kustomizationPath)
+	var applied []kaptestv1.SourceLocation
+	for _, patch := range kustomization.Patches {
+		location := kaptestv1.SourceLocation{File: kustomizationPath}
+		var documents []loader.Document
+		if patch.Path != "" {
+			location.File = filepath.Join(dir, patch.Path)
+			documents = b.readDocuments(location.File)
+		} else {
+			documents = decodeDocuments(patch.Patch, kustomizationPath)
+		}
+
+		if patch.Target != nil {
+			selected, err := selects(patch.Target, obj, original)
+			if err != nil {
+				return nil, fmt.Errorf("invalid patch target in %s: %w", kustomizationPath, err)
+			}
+			if selected {
+				applied = append(applied, location)
+			}
+			continue
+		}
+		for _, document := range documents {
+			if document.Object.GetKind() != obj.GetKind() {
+				continue
+			}
+			if name := document.Object.GetName(); name != obj.GetName() && name != original.GetName() {
+				continue
+			}
+			if patch.Path != "" {
+				location.Line = document.Line
+			}
+			applied = append(applied, location)
+			break
+		}
+	}
+	return applied, nil
+}
+
+// kustomization reads a kustomization file once, with deprecated patch fields moved to patches
+func (b *builder) kustomization(path string) (*types.Kustomization, error) {
+	if kustomization, ok := b.kustomizations[path]; ok {
+		return kustomization, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read kustomization: %w", err)
+	}
+	kustomization := &types.Kustomization{}
+	if err := sigsyaml.Unmarshal(data, kustomization); err != nil {
+		return nil, fmt.Errorf("failed to parse kustomization %s: %w", path, err)
+	}
+	kustomization.Patches = append(kustomization.Patches, kustomization.PatchesJson6902...)
+	for _, patch := range kustomization.PatchesStrategicMerge {
+		// Entries are file paths or inline patches
+		if _, err := os.Stat(filepath.Join(filepath.Dir(path), string(patch))); err == nil {
+			kustomization.Patches = append(kustomization.Patches, types.Patch{Path: string(patch)})
+		} else {
+			kustomization.Patches = append(kustomization.Patches, types.Patch{Patch: string(patch)})
+		}
+	}
+
+	b.kustomizations[path] = kustomization
+	return kustomization, nil
+}
+
+// decodeDocuments decodes the documents of an inline patch, skipping documents that are not objects
+func decodeDocuments(data, source string) []loader.Document {
+	var documents []loader.Document
+	decoder := loader.NewDocumentDecoder(strings.NewReader(data), source)
+	for {
+		document, err := decoder.Next()
+		if err != nil {
+			var documentErr *loader.DocumentError
+			if errors.As(err, &documentErr) {
+				continue
+			}
+			return documents
+		}
+		documents = append(documents, *document)
+	}
+}
+
+// selects reports whether a patch target selects an object, by its original or rendered name
+func selects(target *types.Selector, obj, original *unstructured.Unstructured) (bool, error) {
+	selector, err := types.NewSelectorRegex(target)
+	if err != nil {
+		return false, err
+	}
+
+	gvk := obj.GroupVersionKind()
+	if !selector.MatchGvk(resid.Gvk{Group: gvk.Group, Version: gvk.Version, Kind: gvk.Kind}) {
+		return false, nil
+	}
+	if !selector.MatchName(obj.GetName()) && !selector.MatchName(original.GetName()) {
+		return false, nil
+	}
+	if !selector.MatchNamespace(obj.GetNamespace()) && !selector.MatchNamespace(original.GetNamespace()) {
+		return false, nil
+	}
+	for _, s := range []struct {
+		expression string
+		values     map[string]string
+	}{
+		{target.LabelSelector, obj.GetLabels()},
+		{target.AnnotationSelector, obj.GetAnnotations()},
+	} {
+		if s.expression == "" {
+			continue
+		}
+		parsed, err := labels.Parse(s.expression)
+		if err != nil {
+			return false, err
+		}
+		if !parsed.Matches(labels.Set(s.values)) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
@@ -0,0 +1,108 @@
+package kustomize
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	kaptestv1 "github.com/yashirook/kube-vap-test/pkg/apis/admission/v1"
+)
+
+func TestBuild(t *testing.T) {
+	resources, err := Build("test/overlays/prod")
+	require.NoError(t, err)
+	require.Len(t, resources, 3)
+
+	tests := []struct {
+		kind        string
+		wantName    string
+		wantSource  kaptestv1.SourceLocation
+		wantPatches []kaptestv1.SourceLocation
+	}{
+		{
+			kind:       "Deployment",
+			wantName:   "prod-web",
+			wantSource: kaptestv1.SourceLocation{File: "test/base/deployment.yaml", Line: 2},
+			wantPatches: []kaptestv1.SourceLocation{
+				{File: "test/overlays/prod/replicas.yaml", Line: 1},
+				{File: "test/overlays/prod/image.yaml"},
+			},
+		},
+		{
+			kind:       "Service",
+			wantName:   "prod-web",
+			wantSource: kaptestv1.SourceLocation{File: "test/base/service.yaml", Line: 1},
+		},
+		{
+			// Generated resources originate from their kustomization
+			kind:       "ConfigMap",
+			wantSource: kaptestv1.SourceLocation{File: "test/overlays/prod/kustomization.yaml"},
+		},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.kind, func(t *testing.T) {
+			resource := resources[i]
+			assert.Equal(t, tt.kind, resource.Object.GetKind())
+			if tt.wantName != "" {
+				assert.Equal(t, tt.wantName, resource.Object.GetName())
+			}
+			assert.Equal(t, "prod", resource.Object.GetNamespace())
+			assert.Equal(t, tt.wantSource, resource.Source)
+			assert.Equal(t, tt.wantPatches, resource.Patches)
+			// Build metadata added to map resources back is removed
+			assert.Empty(t, resource.Object.GetAnnotations())
+		})
+	}
+
+	replicas, _, _ := unstructured.NestedInt64(resources[0].Object.Object, "spec", "replicas")
+	assert.Equal(t, int64(10), replicas)
+}
+
+func TestBuildKeepsRequestedBuildMetadata(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "kustomization.yaml"), []byte("buildMetadata: [originAnnotations]\nresources:\n- pod.yaml\n"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "pod.yaml"), []byte("apiVersion: v1\nkind: Pod\nmetadata:\n  name: web\n"), 0o644))
+
+	resources, err := Build(dir)
+	require.NoError(t, err)
+	require.Len(t, resources, 1)
+	assert.Equal(t, map[string]string{originAnnotation: "path: pod.yaml\n"}, resources[0].Object.GetAnnotations())
+	assert.Equal(t, kaptestv1.SourceLocation{File: filepath.Join(dir, "pod.yaml"), Line: 1}, resources[0].Source)
+}
+
+func TestBuildErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		path    string
+		wantErr string
+	}{
+		{
+			name:    "remote resources",
+			path:    "test/overlays/remote",
+			wantErr: `resources entry "https://github.com/example/manifests//base?ref=v1.0.0" is not a local file or directory, remote resources are not fetched`,
+		},
+		{
+			name:    "missing directory",
+			path:    "test/overlays/missing",
+			wantErr: "failed to find directory",
+		},
+		{
+			name:    "no kustomization",
+			path:    "test",
+			wantErr: "unable to find one of 'kustomization.yaml'",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Build(tt.path)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+}
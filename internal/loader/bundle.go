@@ -0,0 +1,206 @@
+package loader
+
+import (
+	"fmt"
+
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"github.com/yashirook/kube-vap-test/internal/engine/plugins"
+	"github.com/yashirook/kube-vap-test/internal/engine/waiver"
+	"github.com/yashirook/kube-vap-test/internal/source"
+	kaptestv1 "github.com/yashirook/kube-vap-test/pkg/apis/admission/v1"
+)
+
+// Bundle holds the documents of resource files sorted by kind
+type Bundle struct {
+	Policies []*admissionregistrationv1.ValidatingAdmissionPolicy
+	// PolicySources are the positions of the policies and their expressions, by policy name
+	PolicySources map[string]*source.Policy
+	Bindings      []*admissionregistrationv1.ValidatingAdmissionPolicyBinding
+	// Params are objects of a kind used as paramKind by a policy of the bundle,
+	// or defined by a CustomResourceDefinition of the bundle
+	Params     []*unstructured.Unstructured
+	Namespaces []*corev1.Namespace
+	CRDs       []*unstructured.Unstructured
+	// Fixtures are objects read by the emulated admission plugins
+	Fixtures *plugins.Fixtures
+	// Waivers accept violations of policies by matching resources
+	Waivers []*kaptestv1.PolicyWaiver
+	// Unknown lists the documents of any other kind
+	Unknown []UnknownDocument
+}
+
+// UnknownDocument is a document of a kind the loader does not classify
+type UnknownDocument struct {
+	// Source is the file and position of the document
+	Source     string
+	APIVersion string
+	Kind       string
+	Name       string
+	// Object is the decoded document
+	Object *unstructured.Unstructured
+}
+
+// String describes the unknown document
+func (d UnknownDocument) String() string {
+	if d.Kind == "" {
+		return fmt.Sprintf("%s: document without apiVersion or kind is not a policy, binding, parameter, namespace, CRD or waiver", d.Source)
+	}
+	return fmt.Sprintf("%s: %s %s '%s' is not a policy, binding, parameter, namespace, CRD or waiver", d.Source, d.APIVersion, d.Kind, d.Name)
+}
+
+// Parameter returns the parameter of the bundle
+// When several parameters are loaded the last one takes precedence
+func (b *Bundle) Parameter() runtime.Object {
+	if len(b.Params) == 0 {
+		return nil
+	}
+	return b.Params[len(b.Params)-1]
+}
+
+// LoadBundle loads every document of the source files sorted by kind
+func (l *LocalResourceLoader) LoadBundle(source ResourceSource) (*Bundle, error) {
+	if source.Type == SourceTypeCluster {
+		return nil, fmt.Errorf("local resource loader cannot load cluster bundles")
+	}
+	return l.readBundle(source.Files, source.Ignore)
+}
+
+// readBundle reads the documents of the files and sorts them by kind
+// Directories, glob patterns, multi-document files and List objects are expanded
+func (l *LocalResourceLoader) readBundle(paths []string, ignore []string) (*Bundle, error) {
+	filePaths, err := ExpandPaths(paths, ignore)
+	if err != nil {
+		return nil, err
+	}
+
+	bundle := &Bundle{
+		PolicySources: make(map[string]*source.Policy),
+		Fixtures:      &plugins.Fixtures{},
+	}
+
+	// Policies first, since they declare the parameter kinds, so the other documents are kept
+	// until every file is read
+	paramKinds := make(map[schema.GroupVersionKind]bool)
+	var rest []Document
+	for _, filePath := range filePaths {
+		err := VisitDocuments(filePath, func(document *Document) error {
+			if !isAdmissionRegistrationKind(document.Object, "ValidatingAdmissionPolicy") {
+				rest = append(rest, *document)
+				return nil
+			}
+			obj, err := l.decodeAdmissionRegistration(document.JSON, document.String(), "ValidatingAdmissionPolicy")
+			if err != nil {
+				return fmt.Errorf("failed to load policy (%s): %w", document.String(), err)
+			}
+			policy, err := convertPolicy(obj)
+			if err != nil {
+				return fmt.Errorf("failed to load policy (%s): %w", document.String(), err)
+			}
+			bundle.Policies = append(bundle.Policies, policy)
+			bundle.PolicySources[policy.Name] = policySource(*document)
+			if paramKind := policy.Spec.ParamKind; paramKind != nil {
+				paramKinds[schema.FromAPIVersionAndKind(paramKind.APIVersion, paramKind.Kind)] = true
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Kinds defined by CustomResourceDefinitions of the bundle are parameters as well
+	for _, document := range rest {
+		if isCRD(document.Object) {
+			bundle.CRDs = append(bundle.CRDs, document.Object)
+			for _, gvk := range crdKinds(document.Object) {
+				paramKinds[gvk] = true
+			}
+		}
+	}
+
+	for _, document := range rest {
+		obj := document.Object
+		gvk := obj.GroupVersionKind()
+
+		switch {
+		case isCRD(obj):
+			// Already collected
+		case isAdmissionRegistrationKind(obj, "ValidatingAdmissionPolicyBinding"):
+			decoded, err := l.decodeAdmissionRegistration(document.JSON, document.String(), "ValidatingAdmissionPolicyBinding")
+			if err != nil {
+				return nil, fmt.Errorf("failed to load policy binding (%s): %w", document.String(), err)
+			}
+			binding, err := convertPolicyBinding(decoded)
+			if err != nil {
+				return nil, fmt.Errorf("failed to load policy binding (%s): %w", document.String(), err)
+			}
+			bundle.Bindings = append(bundle.Bindings, binding)
+		case paramKinds[gvk]:
+			bundle.Params = append(bundle.Params, obj)
+		case gvk == corev1.SchemeGroupVersion.WithKind("Namespace"):
+			namespace := &corev1.Namespace{}
+			if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, namespace); err != nil {
+				return nil, fmt.Errorf("failed to load namespace (%s): %w", document.String(), err)
+			}
+			bundle.Namespaces = append(bundle.Namespaces, namespace)
+		case plugins.IsFixtureKind(obj.GetAPIVersion(), obj.GetKind()):
+			if _, err := bundle.Fixtures.Add(obj); err != nil {
+				return nil, fmt.Errorf("failed to load fixture (%s): %w", document.String(), err)
+			}
+		case obj.GetAPIVersion() == waiver.APIVersion && obj.GetKind() == waiver.Kind:
+			policyWaiver := &kaptestv1.PolicyWaiver{}
+			if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, policyWaiver); err != nil {
+				return nil, fmt.Errorf("failed to load waiver (%s): %w", document.String(), err)
+			}
+			if err := waiver.Validate(policyWaiver); err != nil {
+				return nil, fmt.Errorf("failed to load waiver (%s): %w", document.String(), err)
+			}
+			bundle.Waivers = append(bundle.Waivers, policyWaiver)
+		default:
+			bundle.Unknown = append(bundle.Unknown, UnknownDocument{
+				Source:     document.String(),
+				APIVersion: obj.GetAPIVersion(),
+				Kind:       obj.GetKind(),
+				Name:       obj.GetName(),
+				Object:     obj,
+			})
+		}
+	}
+
+	return bundle, nil
+}
+
+// isAdmissionRegistrationKind returns true for objects of the kind in any admissionregistration version
+func isAdmissionRegistrationKind(obj *unstructured.Unstructured, kind string) bool {
+	gvk := obj.GroupVersionKind()
+	return gvk.Group == admissionregistrationv1.GroupName && gvk.Kind == kind
+}
+
+// isCRD returns true for CustomResourceDefinitions
+func isCRD(obj *unstructured.Unstructured) bool {
+	gvk := obj.GroupVersionKind()
+	return gvk.Group == "apiextensions.k8s.io" && gvk.Kind == "CustomResourceDefinition"
+}
+
+// crdKinds returns the kinds a CustomResourceDefinition defines, one per served version
+func crdKinds(obj *unstructured.Unstructured) []schema.GroupVersionKind {
+	group, _, _ := unstructured.NestedString(obj.Object, "spec", "group")
+	kind, _, _ := unstructured.NestedString(obj.Object, "spec", "names", "kind")
+	versions, _, _ := unstructured.NestedSlice(obj.Object, "spec", "versions")
+
+	var kinds []schema.GroupVersionKind
+	for _, version := range versions {
+		versionMap, ok := version.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		name, _, _ := unstructured.NestedString(versionMap, "name")
+		kinds = append(kinds, schema.GroupVersionKind{Group: group, Version: name, Kind: kind})
+	}
+	return kinds
+}
@@ -0,0 +1,87 @@
+package loader
+
+import (
+	"context"
+	"fmt"
+
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// LoadNamespaces retrieves the namespaces of the cluster, whose labels namespace selectors match
+func (c *ClusterResourceLoader) LoadNamespaces(ctx context.Context) ([]*corev1.Namespace, error) {
+	var namespaces []*corev1.Namespace
+	err := listPages(ctx, c.dynamicClient.Resource(corev1.SchemeGroupVersion.WithResource("namespaces")), "", "", DefaultChunkSize, func(obj *unstructured.Unstructured) error {
+		namespace := &corev1.Namespace{}
+		// Only the metadata of namespaces is used
+		namespace.ObjectMeta = metav1.ObjectMeta{Name: obj.GetName(), Labels: obj.GetLabels()}
+		namespaces = append(namespaces, namespace)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list namespaces: %w", err)
+	}
+	return namespaces, nil
+}
+
+// LoadParams retrieves the parameters the paramRef of bindings select for their policies
+// Parameters are looked up by name or label selector, in the namespace of the paramRef or in
+// every namespace when it has none, since they are then read from the namespace of each object
+func (c *ClusterResourceLoader) LoadParams(ctx context.Context, policies []*admissionregistrationv1.ValidatingAdmissionPolicy, bindings []*admissionregistrationv1.ValidatingAdmissionPolicyBinding) ([]*unstructured.Unstructured, error) {
+	paramKinds := make(map[string]*admissionregistrationv1.ParamKind)
+	for _, policy := range policies {
+		if policy.Spec.ParamKind != nil {
+			paramKinds[policy.Name] = policy.Spec.ParamKind
+		}
+	}
+
+	var params []*unstructured.Unstructured
+	loaded := make(map[string]bool)
+	for _, binding := range bindings {
+		paramKind := paramKinds[binding.Spec.PolicyName]
+		paramRef := binding.Spec.ParamRef
+		if paramKind == nil || paramRef == nil {
+			continue
+		}
+
+		gv, err := schema.ParseGroupVersion(paramKind.APIVersion)
+		if err != nil {
+			return nil, fmt.Errorf("invalid paramKind of policy %s: %w", binding.Spec.PolicyName, err)
+		}
+		mapping, err := c.mapper.RESTMapping(schema.GroupKind{Group: gv.Group, Kind: paramKind.Kind}, gv.Version)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve paramKind %s of policy %s: %w", paramKind.Kind, binding.Spec.PolicyName, err)
+		}
+
+		opts := ListOptions{ChunkSize: DefaultChunkSize}
+		if paramRef.Namespace != "" {
+			opts.Namespaces = []string{paramRef.Namespace}
+		}
+		if paramRef.Name != "" {
+			opts.FieldSelector = fields.OneTermEqualSelector("metadata.name", paramRef.Name).String()
+		} else if paramRef.Selector != nil {
+			selector, err := metav1.LabelSelectorAsSelector(paramRef.Selector)
+			if err != nil {
+				return nil, fmt.Errorf("invalid paramRef selector of binding %s: %w", binding.Name, err)
+			}
+			opts.LabelSelector = selector.String()
+		}
+
+		err = c.VisitResources(ctx, mapping, opts, func(obj *unstructured.Unstructured) error {
+			key := fmt.Sprintf("%s/%s/%s", mapping.Resource, obj.GetNamespace(), obj.GetName())
+			if !loaded[key] {
+				loaded[key] = true
+				params = append(params, obj)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to load parameters of binding %s: %w", binding.Name, err)
+		}
+	}
+	return params, nil
+}
@@ -0,0 +1,80 @@
+package loader
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestLoadParams(t *testing.T) {
+	widget := func(namespace, name string, labels map[string]string) runtime.Object {
+		obj := &unstructured.Unstructured{}
+		obj.SetAPIVersion("example.com/v1")
+		obj.SetKind("Widget")
+		obj.SetNamespace(namespace)
+		obj.SetName(name)
+		obj.SetLabels(labels)
+		return obj
+	}
+	clusterLoader := newFakeClusterLoader(
+		widget("team-a", "gold", map[string]string{"tier": "gold"}),
+		widget("team-b", "gold", map[string]string{"tier": "gold"}),
+		widget("team-b", "plain", nil),
+	)
+
+	paramPolicy := rulesPolicy("limits")
+	paramPolicy.Spec.ParamKind = &admissionregistrationv1.ParamKind{APIVersion: "example.com/v1", Kind: "Widget"}
+	gold := &metav1.LabelSelector{MatchLabels: map[string]string{"tier": "gold"}}
+	binding := func(name, policyName string, paramRef *admissionregistrationv1.ParamRef) *admissionregistrationv1.ValidatingAdmissionPolicyBinding {
+		return &admissionregistrationv1.ValidatingAdmissionPolicyBinding{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Spec:       admissionregistrationv1.ValidatingAdmissionPolicyBindingSpec{PolicyName: policyName, ParamRef: paramRef},
+		}
+	}
+
+	params, err := clusterLoader.LoadParams(context.Background(),
+		[]*admissionregistrationv1.ValidatingAdmissionPolicy{paramPolicy, rulesPolicy("no-params")},
+		[]*admissionregistrationv1.ValidatingAdmissionPolicyBinding{
+			binding("team-a", "limits", &admissionregistrationv1.ParamRef{Namespace: "team-a", Selector: gold}),
+			// Parameters of every namespace, the one of team-a is loaded once
+			binding("all", "limits", &admissionregistrationv1.ParamRef{Selector: gold}),
+			binding("no-param-ref", "limits", nil),
+			// Policies without paramKind have no parameters
+			binding("no-param-kind", "no-params", &admissionregistrationv1.ParamRef{Name: "gold"}),
+		})
+	require.NoError(t, err)
+
+	var got []string
+	for _, param := range params {
+		got = append(got, param.GetNamespace()+"/"+param.GetName())
+	}
+	assert.Equal(t, []string{"team-a/gold", "team-b/gold"}, got)
+
+	// Parameter kinds not served by the cluster cannot be loaded
+	paramPolicy.Spec.ParamKind = &admissionregistrationv1.ParamKind{APIVersion: "example.com/v1", Kind: "Sprocket"}
+	_, err = clusterLoader.LoadParams(context.Background(),
+		[]*admissionregistrationv1.ValidatingAdmissionPolicy{paramPolicy},
+		[]*admissionregistrationv1.ValidatingAdmissionPolicyBinding{binding("all", "limits", &admissionregistrationv1.ParamRef{Selector: gold})})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to resolve paramKind Sprocket of policy limits")
+}
+
+func TestLoadNamespaces(t *testing.T) {
+	namespace := &unstructured.Unstructured{}
+	namespace.SetAPIVersion("v1")
+	namespace.SetKind("Namespace")
+	namespace.SetName("team-a")
+	namespace.SetLabels(map[string]string{"env": "prod"})
+
+	namespaces, err := newFakeClusterLoader(namespace).LoadNamespaces(context.Background())
+	require.NoError(t, err)
+	require.Len(t, namespaces, 1)
+	assert.Equal(t, "team-a", namespaces[0].Name)
+	assert.Equal(t, map[string]string{"env": "prod"}, namespaces[0].Labels)
+}
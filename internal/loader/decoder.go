@@ -0,0 +1,332 @@
+package loader
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+
+	"gopkg.in/yaml.v3"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	utiljson "k8s.io/apimachinery/pkg/util/json"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	sigsyaml "sigs.k8s.io/yaml"
+
+	kaptestv1 "github.com/yashirook/kube-vap-test/pkg/apis/admission/v1"
+)
+
+// Document is a single object read from a YAML or JSON stream
+type Document struct {
+	// Source is the name of the stream, usually a file path
+	Source string
+	// Index is the position of the document in the stream, starting at 1
+	Index int
+	// Item is the position of the object in the List it was expanded from, starting at 1
+	// It is 0 for documents that are not List items
+	Item int
+	// Line is the line of the stream the object starts at
+	Line int
+	// JSON is the document converted to JSON
+	JSON []byte
+	// Object is the decoded document
+	Object *unstructured.Unstructured
+
+	// YAML text of the document, or of the List holding the item, and the line it starts at
+	raw     []byte
+	rawLine int
+}
+
+// String returns the position of the document, e.g. pods.yaml:12 (document 2)
+// Documents of standard input are numbered instead, e.g. <stdin>:doc2
+func (d Document) String() string {
+	if d.Source == StdinSource {
+		if d.Item > 0 {
+			return fmt.Sprintf("%s:doc%d (item %d)", d.Source, d.Index, d.Item)
+		}
+		return fmt.Sprintf("%s:doc%d", d.Source, d.Index)
+	}
+	if d.Item > 0 {
+		return fmt.Sprintf("%s:%d (document %d, item %d)", d.Source, d.Line, d.Index, d.Item)
+	}
+	return fmt.Sprintf("%s:%d (document %d)", d.Source, d.Line, d.Index)
+}
+
+// Location returns the position of the document in results
+// Documents of standard input are located by their number, e.g. <stdin>:doc2
+func (d Document) Location() kaptestv1.SourceLocation {
+	if d.Source == StdinSource {
+		return kaptestv1.SourceLocation{File: d.Source, Document: d.Index}
+	}
+	return kaptestv1.SourceLocation{File: d.Source, Line: d.Line}
+}
+
+// DocumentError is an error decoding a single document
+// The decoder can continue with the next document after a DocumentError
+type DocumentError struct {
+	Source string
+	Index  int
+	Line   int
+	Err    error
+}
+
+// Error returns the error with the position of the document
+func (e *DocumentError) Error() string {
+	return fmt.Sprintf("failed to decode %s:%d (document %d): %v", e.Source, e.Line, e.Index, e.Err)
+}
+
+// Unwrap returns the decoding error
+func (e *DocumentError) Unwrap() error {
+	return e.Err
+}
+
+// DocumentDecoder reads the documents of a YAML or JSON stream one at a time
+// Documents are split by the YAML reader of apimachinery, as kubectl does: they are separated by
+// --- lines, which may carry a comment, and the items of v1 List objects are returned as
+// separate documents. Empty documents are skipped
+type DocumentDecoder struct {
+	reader *utilyaml.YAMLReader
+	lines  *lineCounter
+	source string
+	// Index of the last document read
+	index int
+	// List items not returned yet
+	pending []Document
+}
+
+// NewDocumentDecoder creates a DocumentDecoder reading the stream named source
+func NewDocumentDecoder(reader io.Reader, source string) *DocumentDecoder {
+	lines := &lineCounter{reader: bufio.NewReader(reader)}
+	return &DocumentDecoder{
+		reader: utilyaml.NewYAMLReader(bufio.NewReader(lines)),
+		lines:  lines,
+		source: source,
+	}
+}
+
+// Next returns the next document, or io.EOF at the end of the stream
+func (d *DocumentDecoder) Next() (*Document, error) {
+	for {
+		if len(d.pending) > 0 {
+			document := d.pending[0]
+			d.pending = d.pending[1:]
+			return &document, nil
+		}
+
+		data, firstLine, err := d.readDocument()
+		if err != nil {
+			return nil, err
+		}
+
+		contentLine := firstContentLine(data, firstLine)
+		if contentLine == 0 {
+			// Only blank lines and comments, such as after a trailing separator
+			continue
+		}
+		d.index++
+
+		jsonData, err := sigsyaml.YAMLToJSON(data)
+		if err != nil {
+			return nil, d.documentError(contentLine, err)
+		}
+		if trimmed := bytes.TrimSpace(jsonData); len(trimmed) == 0 || bytes.Equal(trimmed, []byte("null")) {
+			d.index--
+			continue
+		}
+
+		object := map[string]interface{}{}
+		if err := utiljson.Unmarshal(jsonData, &object); err != nil {
+			return nil, d.documentError(contentLine, fmt.Errorf("document is not an object: %w", err))
+		}
+		obj := &unstructured.Unstructured{Object: object}
+		document := Document{Source: d.source, Index: d.index, Line: contentLine, JSON: jsonData, Object: obj, raw: data, rawLine: firstLine}
+
+		if !obj.IsList() || obj.GetAPIVersion() != "v1" || obj.GetKind() != "List" {
+			return &document, nil
+		}
+		items, err := expandList(document, data, firstLine)
+		if err != nil {
+			return nil, d.documentError(contentLine, err)
+		}
+		d.pending = items
+	}
+}
+
+// documentError returns a DocumentError for the current document
+func (d *DocumentDecoder) documentError(line int, err error) error {
+	return &DocumentError{Source: d.source, Index: d.index, Line: line, Err: err}
+}
+
+// readDocument reads the next document of the YAML reader
+// It returns the document and the line of the stream it starts at
+func (d *DocumentDecoder) readDocument() ([]byte, int, error) {
+	before := d.lines.lines
+	data, err := d.reader.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, 0, io.EOF
+	}
+	var syntaxErr utilyaml.YAMLSyntaxError
+	if errors.As(err, &syntaxErr) {
+		return nil, 0, fmt.Errorf("invalid document separator at %s:%d: only comments may follow ---", d.source, d.lines.lines)
+	}
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to read %s: %w", d.source, err)
+	}
+
+	// Separators before the content are part of the document, the YAML reader only drops the one
+	// ending it
+	return data, before + 1, nil
+}
+
+// lineCounter passes a stream to the YAML reader one line per read, counting the lines
+// The buffered reader in between then never reads ahead of the line the YAML reader asks for,
+// so the lines counted are those the YAML reader consumed
+type lineCounter struct {
+	reader *bufio.Reader
+	// lines counts the lines read so far
+	lines int
+	// rest is the part of the last line not read yet
+	rest []byte
+}
+
+// Read reads the rest of the current line, or the next line
+func (c *lineCounter) Read(p []byte) (int, error) {
+	if len(c.rest) == 0 {
+		line, err := c.reader.ReadBytes('\n')
+		if len(line) == 0 {
+			return 0, err
+		}
+		// Errors other than io.EOF are returned again by the next read
+		c.lines++
+		c.rest = line
+	}
+	n := copy(p, c.rest)
+	c.rest = c.rest[n:]
+	return n, nil
+}
+
+// firstContentLine returns the line of the first line that is neither blank, a comment nor a
+// --- separator, or 0 when there is none
+func firstContentLine(data []byte, firstLine int) int {
+	for i, line := range bytes.Split(data, []byte("\n")) {
+		trimmed := bytes.TrimSpace(line)
+		if len(trimmed) > 0 && trimmed[0] != '#' && !bytes.HasPrefix(line, []byte("---")) {
+			return firstLine + i
+		}
+	}
+	return 0
+}
+
+// expandList returns the items of a List document
+// Item lines are taken from the YAML node tree, or the List line when it cannot be parsed
+func expandList(list Document, data []byte, firstLine int) ([]Document, error) {
+	items, _, err := unstructured.NestedSlice(list.Object.Object, "items")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read List items: %w", err)
+	}
+	lines := listItemLines(data)
+
+	var documents []Document
+	for i, item := range items {
+		object, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("List item %d is not an object", i+1)
+		}
+		itemJSON, err := utiljson.Marshal(object)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode List item %d: %w", i+1, err)
+		}
+
+		line := list.Line
+		if i < len(lines) {
+			line = firstLine + lines[i] - 1
+		}
+		documents = append(documents, Document{
+			Source:  list.Source,
+			Index:   list.Index,
+			Item:    i + 1,
+			Line:    line,
+			JSON:    itemJSON,
+			Object:  &unstructured.Unstructured{Object: object},
+			raw:     data,
+			rawLine: firstLine,
+		})
+	}
+	return documents, nil
+}
+
+// listItemLines returns the lines of the items of a List, relative to the document
+func listItemLines(data []byte) []int {
+	var lines []int
+	for _, item := range listItemNodes(parseNode(data)) {
+		lines = append(lines, item.Line)
+	}
+	return lines
+}
+
+// parseNode returns the top-level node of a YAML document, or nil when it cannot be parsed
+func parseNode(data []byte) *yaml.Node {
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil || len(root.Content) == 0 {
+		return nil
+	}
+	return root.Content[0]
+}
+
+// listItemNodes returns the item nodes of a List node
+func listItemNodes(list *yaml.Node) []*yaml.Node {
+	if items := mappingValue(list, "items"); items != nil && items.Kind == yaml.SequenceNode {
+		return items.Content
+	}
+	return nil
+}
+
+// mappingValue returns the value of a key of a mapping node, or nil
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// ReadDocuments reads every document of a file, or of standard input for -
+func ReadDocuments(filePath string) ([]Document, error) {
+	var documents []Document
+	err := VisitDocuments(filePath, func(document *Document) error {
+		documents = append(documents, *document)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return documents, nil
+}
+
+// VisitDocuments calls visit with every document of a file, or of standard input for -, as they
+// are read, stopping at the first error
+func VisitDocuments(filePath string, visit func(*Document) error) error {
+	file, err := Open(filePath)
+	if err != nil {
+		return fmt.Errorf("failed to read file (%s): %w", SourceName(filePath), err)
+	}
+	defer file.Close()
+
+	decoder := NewDocumentDecoder(file, SourceName(filePath))
+	for {
+		document, err := decoder.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := visit(document); err != nil {
+			return err
+		}
+	}
+}
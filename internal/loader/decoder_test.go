@@ -0,0 +1,152 @@
+package loader
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// decodeAll reads every document of the input, collecting document errors
+func decodeAll(t *testing.T, input string) ([]Document, []error) {
+	t.Helper()
+	var documents []Document
+	var documentErrors []error
+	decoder := NewDocumentDecoder(strings.NewReader(input), "test.yaml")
+	for {
+		document, err := decoder.Next()
+		if errors.Is(err, io.EOF) {
+			return documents, documentErrors
+		}
+		var documentErr *DocumentError
+		if errors.As(err, &documentErr) {
+			documentErrors = append(documentErrors, err)
+			continue
+		}
+		require.NoError(t, err)
+		documents = append(documents, *document)
+	}
+}
+
+func TestDocumentDecoder(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		// Names and lines of the decoded documents
+		names []string
+		lines []int
+	}{
+		{
+			name:  "single document",
+			input: "apiVersion: v1\nkind: Pod\nmetadata:\n  name: a\n",
+			names: []string{"a"},
+			lines: []int{1},
+		},
+		{
+			name:  "leading and trailing separators",
+			input: "---\napiVersion: v1\nkind: Pod\nmetadata:\n  name: a\n---\n",
+			names: []string{"a"},
+			lines: []int{2},
+		},
+		{
+			name:  "CRLF line endings",
+			input: "apiVersion: v1\r\nkind: Pod\r\nmetadata:\r\n  name: a\r\n---\r\napiVersion: v1\r\nkind: Pod\r\nmetadata:\r\n  name: b\r\n",
+			names: []string{"a", "b"},
+			lines: []int{1, 6},
+		},
+		{
+			name:  "separator with comment and trailing spaces",
+			input: "kind: Pod\nmetadata:\n  name: a\n--- # second pod\nkind: Pod\nmetadata:\n  name: b\n---   \nkind: Pod\nmetadata:\n  name: c\n",
+			names: []string{"a", "b", "c"},
+			lines: []int{1, 5, 9},
+		},
+		{
+			name:  "separator inside block scalar",
+			input: "kind: ConfigMap\nmetadata:\n  name: a\ndata:\n  script: |\n    echo start\n    ---\n    echo end\n",
+			names: []string{"a"},
+			lines: []int{1},
+		},
+		{
+			name:  "document end markers",
+			input: "kind: Pod\nmetadata:\n  name: a\n...\n---\nkind: Pod\nmetadata:\n  name: b\n...\n",
+			names: []string{"a", "b"},
+			lines: []int{1, 6},
+		},
+		{
+			name:  "markers inside block scalar",
+			input: "kind: ConfigMap\nmetadata:\n  name: a\ndata:\n  script: |\n    ---\n    ...\n    echo end\n---\nkind: ConfigMap\nmetadata:\n  name: b\n",
+			names: []string{"a", "b"},
+			lines: []int{1, 10},
+		},
+		{
+			name:  "lines longer than the read buffer",
+			input: "kind: ConfigMap\nmetadata:\n  name: a\ndata:\n  key: " + strings.Repeat("x", 10000) + "\n---\nkind: ConfigMap\nmetadata:\n  name: b\n",
+			names: []string{"a", "b"},
+			lines: []int{1, 7},
+		},
+		{
+			name:  "comments and empty documents are skipped",
+			input: "# header\n---\n---\n# only a comment\n---\n\n# pod\nkind: Pod\nmetadata:\n  name: a\n---\nnull\n",
+			names: []string{"a"},
+			lines: []int{8},
+		},
+		{
+			name:  "JSON document",
+			input: "{\n  \"kind\": \"Pod\",\n  \"metadata\": {\"name\": \"a\"}\n}\n",
+			names: []string{"a"},
+			lines: []int{1},
+		},
+		{
+			name:  "List items",
+			input: "kind: Pod\nmetadata:\n  name: a\n---\napiVersion: v1\nkind: List\nitems:\n- kind: Pod\n  metadata:\n    name: b\n- kind: Pod\n  metadata:\n    name: c\n",
+			names: []string{"a", "b", "c"},
+			lines: []int{1, 8, 11},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			documents, documentErrors := decodeAll(t, tt.input)
+			require.Empty(t, documentErrors)
+
+			var names []string
+			var lines []int
+			for _, document := range documents {
+				names = append(names, document.Object.GetName())
+				lines = append(lines, document.Line)
+			}
+			assert.Equal(t, tt.names, names)
+			assert.Equal(t, tt.lines, lines)
+		})
+	}
+}
+
+func TestDocumentDecoderPositions(t *testing.T) {
+	input := "kind: Pod\nmetadata:\n  name: a\n---\napiVersion: v1\nkind: List\nitems:\n- kind: Pod\n  metadata:\n    name: b\n"
+	documents, _ := decodeAll(t, input)
+	require.Len(t, documents, 2)
+
+	assert.Equal(t, "test.yaml:1 (document 1)", documents[0].String())
+	assert.Equal(t, "test.yaml:8 (document 2, item 1)", documents[1].String())
+	assert.JSONEq(t, `{"kind":"Pod","metadata":{"name":"b"}}`, string(documents[1].JSON))
+}
+
+func TestDocumentDecoderErrors(t *testing.T) {
+	// Invalid documents are reported and the following documents are still read
+	input := "kind: Pod\nmetadata:\n  name: a\n---\nkind: [Pod\n---\nkind: Pod\nmetadata:\n  name: c\n"
+	documents, documentErrors := decodeAll(t, input)
+	require.Len(t, documents, 2)
+	assert.Equal(t, "c", documents[1].Object.GetName())
+	assert.Equal(t, 3, documents[1].Index)
+	require.Len(t, documentErrors, 1)
+	assert.Contains(t, documentErrors[0].Error(), "test.yaml:5 (document 2)")
+
+	// Content after a separator ends the stream
+	decoder := NewDocumentDecoder(strings.NewReader("kind: Pod\n--- kind: Pod\n"), "test.yaml")
+	_, err := decoder.Next()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid document separator at test.yaml:2")
+}
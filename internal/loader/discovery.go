@@ -0,0 +1,186 @@
+package loader
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/restmapper"
+)
+
+// ResourceType returns the name of the resources of a mapping in results, e.g. deployments.apps/v1
+func ResourceType(mapping *meta.RESTMapping) string {
+	return fmt.Sprintf("%s.%s", mapping.Resource.Resource, mapping.Resource.GroupVersion().String())
+}
+
+// ResolveResources maps resource arguments to the resources served by the cluster, as kubectl
+// does: resources may be plural, singular or short names, qualified by a group and a version
+// such as deploy, deployments.apps or deployments.v1.apps
+func (c *ClusterResourceLoader) ResolveResources(args []string) ([]*meta.RESTMapping, error) {
+	var mappings []*meta.RESTMapping
+	seen := make(map[schema.GroupVersionResource]bool)
+	for _, arg := range args {
+		mapping, err := c.resolveResource(arg)
+		if err != nil {
+			return nil, err
+		}
+		if !seen[mapping.Resource] {
+			seen[mapping.Resource] = true
+			mappings = append(mappings, mapping)
+		}
+	}
+	return mappings, nil
+}
+
+// resolveResource maps a resource argument to a resource served by the cluster
+func (c *ClusterResourceLoader) resolveResource(arg string) (*meta.RESTMapping, error) {
+	fullySpecified, groupResource := schema.ParseResourceArg(strings.ToLower(arg))
+	var gvr schema.GroupVersionResource
+	var err error
+	if fullySpecified != nil {
+		gvr, err = c.mapper.ResourceFor(*fullySpecified)
+	}
+	if fullySpecified == nil || err != nil {
+		gvr, err = c.mapper.ResourceFor(groupResource.WithVersion(""))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unknown resource type %q: %w", arg, err)
+	}
+
+	gvk, err := c.mapper.KindFor(gvr)
+	if err != nil {
+		return nil, fmt.Errorf("unknown resource type %q: %w", arg, err)
+	}
+	mapping, err := c.mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if err != nil {
+		return nil, fmt.Errorf("unknown resource type %q: %w", arg, err)
+	}
+	return mapping, nil
+}
+
+// ResolvePolicyResources returns the resources served by the cluster that the resource rules
+// of policies intercept, custom resources included
+func (c *ClusterResourceLoader) ResolvePolicyResources(policies []*admissionregistrationv1.ValidatingAdmissionPolicy) ([]*meta.RESTMapping, error) {
+	groups, err := restmapper.GetAPIGroupResources(c.discovery)
+	if err != nil {
+		return nil, fmt.Errorf("failed to discover API resources: %w", err)
+	}
+	return policyResources(groups, policies), nil
+}
+
+// policyResources returns the discovered resources intercepted by the policies
+// Resources are listed once, at the first version a policy matches in the priority order of
+// their group, since the apiserver converts objects to that version for the policy
+// Subresources and resources that cannot be listed are left out
+func policyResources(groups []*restmapper.APIGroupResources, policies []*admissionregistrationv1.ValidatingAdmissionPolicy) []*meta.RESTMapping {
+	var mappings []*meta.RESTMapping
+	matched := make(map[schema.GroupResource]bool)
+	for _, group := range groups {
+		for _, version := range groupVersions(group) {
+			for _, resource := range group.VersionedResources[version] {
+				if strings.Contains(resource.Name, "/") || !slices.Contains(resource.Verbs, "list") {
+					continue
+				}
+				groupResource := schema.GroupResource{Group: group.Group.Name, Resource: resource.Name}
+				if matched[groupResource] {
+					continue
+				}
+				gvr := groupResource.WithVersion(version)
+				if !slices.ContainsFunc(policies, func(policy *admissionregistrationv1.ValidatingAdmissionPolicy) bool {
+					return interceptsResource(policy, gvr, resource.Namespaced)
+				}) {
+					continue
+				}
+
+				matched[groupResource] = true
+				mappings = append(mappings, resourceMapping(gvr, resource))
+			}
+		}
+	}
+
+	sort.Slice(mappings, func(i, j int) bool {
+		return ResourceType(mappings[i]) < ResourceType(mappings[j])
+	})
+	return mappings
+}
+
+// groupVersions returns the versions of a group, the preferred version first
+func groupVersions(group *restmapper.APIGroupResources) []string {
+	versions := []string{group.Group.PreferredVersion.Version}
+	for _, version := range group.Group.Versions {
+		if !slices.Contains(versions, version.Version) {
+			versions = append(versions, version.Version)
+		}
+	}
+	return versions
+}
+
+// resourceMapping returns the mapping of a discovered resource
+func resourceMapping(gvr schema.GroupVersionResource, resource metav1.APIResource) *meta.RESTMapping {
+	gvk := gvr.GroupVersion().WithKind(resource.Kind)
+	if resource.Group != "" || resource.Version != "" {
+		gvk = schema.GroupVersionKind{Group: resource.Group, Version: resource.Version, Kind: resource.Kind}
+	}
+	scope := meta.RESTScopeRoot
+	if resource.Namespaced {
+		scope = meta.RESTScopeNamespace
+	}
+	return &meta.RESTMapping{Resource: gvr, GroupVersionKind: gvk, Scope: scope}
+}
+
+// interceptsResource reports whether the match constraints of a policy intercept requests for a
+// resource
+// Exclude rules only leave the resource out when they apply to every name
+func interceptsResource(policy *admissionregistrationv1.ValidatingAdmissionPolicy, gvr schema.GroupVersionResource, namespaced bool) bool {
+	constraints := policy.Spec.MatchConstraints
+	if constraints == nil {
+		return false
+	}
+	for _, rule := range constraints.ExcludeResourceRules {
+		if len(rule.ResourceNames) == 0 && ruleMatches(rule.RuleWithOperations.Rule, gvr, namespaced) {
+			return false
+		}
+	}
+	for _, rule := range constraints.ResourceRules {
+		if ruleMatches(rule.RuleWithOperations.Rule, gvr, namespaced) {
+			return true
+		}
+	}
+	return false
+}
+
+// ruleMatches reports whether a rule matches a resource, with * matching any group, version and
+// resource, and */* any resource with its subresources
+func ruleMatches(rule admissionregistrationv1.Rule, gvr schema.GroupVersionResource, namespaced bool) bool {
+	if !matchesValue(rule.APIGroups, gvr.Group) || !matchesValue(rule.APIVersions, gvr.Version) {
+		return false
+	}
+	if !slices.ContainsFunc(rule.Resources, func(resource string) bool {
+		return resource == "*" || resource == "*/*" || resource == gvr.Resource
+	}) {
+		return false
+	}
+
+	scope := admissionregistrationv1.AllScopes
+	if rule.Scope != nil {
+		scope = *rule.Scope
+	}
+	switch scope {
+	case admissionregistrationv1.ClusterScope:
+		return !namespaced
+	case admissionregistrationv1.NamespacedScope:
+		return namespaced
+	default:
+		return true
+	}
+}
+
+// matchesValue reports whether values hold the value or *
+func matchesValue(values []string, value string) bool {
+	return slices.Contains(values, "*") || slices.Contains(values, value)
+}
@@ -0,0 +1,236 @@
+package loader
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery/cached/memory"
+	discoveryfake "k8s.io/client-go/discovery/fake"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/restmapper"
+	clienttesting "k8s.io/client-go/testing"
+)
+
+// listVerbs are the verbs of listable resources
+var listVerbs = metav1.Verbs{"get", "list", "watch"}
+
+// newFakeClusterLoader returns a cluster loader serving core, apps and a custom resource group
+func newFakeClusterLoader(objects ...runtime.Object) *ClusterResourceLoader {
+	fakeDiscovery := &discoveryfake.FakeDiscovery{Fake: &clienttesting.Fake{}}
+	fakeDiscovery.Resources = []*metav1.APIResourceList{
+		{
+			GroupVersion: "v1",
+			APIResources: []metav1.APIResource{
+				{Name: "pods", Kind: "Pod", Namespaced: true, Verbs: listVerbs, ShortNames: []string{"po"}},
+				{Name: "pods/status", Kind: "Pod", Namespaced: true, Verbs: metav1.Verbs{"get"}},
+				{Name: "namespaces", Kind: "Namespace", Verbs: listVerbs, ShortNames: []string{"ns"}},
+				{Name: "bindings", Kind: "Binding", Namespaced: true, Verbs: metav1.Verbs{"create"}},
+			},
+		},
+		{
+			GroupVersion: "apps/v1",
+			APIResources: []metav1.APIResource{
+				{Name: "deployments", Kind: "Deployment", Namespaced: true, Verbs: listVerbs, ShortNames: []string{"deploy"}},
+				{Name: "deployments/scale", Kind: "Scale", Group: "autoscaling", Version: "v1", Namespaced: true, Verbs: metav1.Verbs{"get"}},
+			},
+		},
+		{
+			GroupVersion: "example.com/v1",
+			APIResources: []metav1.APIResource{
+				{Name: "widgets", Kind: "Widget", Namespaced: true, Verbs: listVerbs},
+			},
+		},
+		{
+			GroupVersion: "example.com/v1beta1",
+			APIResources: []metav1.APIResource{
+				{Name: "widgets", Kind: "Widget", Namespaced: true, Verbs: listVerbs},
+				{Name: "gadgets", Kind: "Gadget", Verbs: listVerbs},
+			},
+		},
+	}
+
+	cachedDiscovery := memory.NewMemCacheClient(fakeDiscovery)
+	scheme := runtime.NewScheme()
+	return &ClusterResourceLoader{
+		dynamicClient: dynamicfake.NewSimpleDynamicClientWithCustomListKinds(scheme, map[schema.GroupVersionResource]string{
+			{Version: "v1", Resource: "pods"}:                          "PodList",
+			{Version: "v1", Resource: "namespaces"}:                    "NamespaceList",
+			{Group: "example.com", Version: "v1", Resource: "widgets"}: "WidgetList",
+		}, objects...),
+		discovery: cachedDiscovery,
+		mapper:    restmapper.NewShortcutExpander(restmapper.NewDeferredDiscoveryRESTMapper(cachedDiscovery), cachedDiscovery, nil),
+		scheme:    scheme,
+	}
+}
+
+// rulesPolicy returns a policy matching the resource rules
+func rulesPolicy(name string, rules ...admissionregistrationv1.NamedRuleWithOperations) *admissionregistrationv1.ValidatingAdmissionPolicy {
+	return &admissionregistrationv1.ValidatingAdmissionPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec: admissionregistrationv1.ValidatingAdmissionPolicySpec{
+			MatchConstraints: &admissionregistrationv1.MatchResources{ResourceRules: rules},
+		},
+	}
+}
+
+// rule returns a resource rule for CREATE and UPDATE requests
+func rule(groups, versions, resources []string, scope admissionregistrationv1.ScopeType) admissionregistrationv1.NamedRuleWithOperations {
+	return admissionregistrationv1.NamedRuleWithOperations{
+		RuleWithOperations: admissionregistrationv1.RuleWithOperations{
+			Operations: []admissionregistrationv1.OperationType{admissionregistrationv1.Create, admissionregistrationv1.Update},
+			Rule: admissionregistrationv1.Rule{
+				APIGroups:   groups,
+				APIVersions: versions,
+				Resources:   resources,
+				Scope:       &scope,
+			},
+		},
+	}
+}
+
+func TestResolvePolicyResources(t *testing.T) {
+	all := []string{"*"}
+	tests := []struct {
+		name     string
+		policies []*admissionregistrationv1.ValidatingAdmissionPolicy
+		want     []string
+	}{
+		{
+			name:     "named resources",
+			policies: []*admissionregistrationv1.ValidatingAdmissionPolicy{rulesPolicy("pods", rule([]string{""}, []string{"v1"}, []string{"pods"}, admissionregistrationv1.AllScopes))},
+			want:     []string{"pods.v1"},
+		},
+		{
+			// Subresources and resources that cannot be listed are left out
+			name:     "wildcards",
+			policies: []*admissionregistrationv1.ValidatingAdmissionPolicy{rulesPolicy("all", rule(all, all, []string{"*/*"}, admissionregistrationv1.AllScopes))},
+			want:     []string{"deployments.apps/v1", "gadgets.example.com/v1beta1", "namespaces.v1", "pods.v1", "widgets.example.com/v1"},
+		},
+		{
+			name:     "scope",
+			policies: []*admissionregistrationv1.ValidatingAdmissionPolicy{rulesPolicy("cluster", rule(all, all, all, admissionregistrationv1.ClusterScope))},
+			want:     []string{"gadgets.example.com/v1beta1", "namespaces.v1"},
+		},
+		{
+			name:     "groups",
+			policies: []*admissionregistrationv1.ValidatingAdmissionPolicy{rulesPolicy("apps", rule([]string{"apps"}, all, all, admissionregistrationv1.AllScopes))},
+			want:     []string{"deployments.apps/v1"},
+		},
+		{
+			// Custom resources are listed at the version the policy matches
+			name:     "custom resources",
+			policies: []*admissionregistrationv1.ValidatingAdmissionPolicy{rulesPolicy("widgets", rule([]string{"example.com"}, []string{"v1beta1"}, []string{"widgets"}, admissionregistrationv1.AllScopes))},
+			want:     []string{"widgets.example.com/v1beta1"},
+		},
+		{
+			name:     "versions not served",
+			policies: []*admissionregistrationv1.ValidatingAdmissionPolicy{rulesPolicy("v2", rule(all, []string{"v2"}, all, admissionregistrationv1.AllScopes))},
+		},
+		{
+			name: "excluded resources",
+			policies: []*admissionregistrationv1.ValidatingAdmissionPolicy{func() *admissionregistrationv1.ValidatingAdmissionPolicy {
+				policy := rulesPolicy("core", rule([]string{""}, all, all, admissionregistrationv1.AllScopes))
+				named := rule([]string{""}, all, []string{"pods"}, admissionregistrationv1.AllScopes)
+				named.ResourceNames = []string{"kube-proxy"}
+				policy.Spec.MatchConstraints.ExcludeResourceRules = []admissionregistrationv1.NamedRuleWithOperations{
+					rule([]string{""}, all, []string{"namespaces"}, admissionregistrationv1.AllScopes),
+					// Exclusions of some names keep the resource
+					named,
+				}
+				return policy
+			}()},
+			want: []string{"pods.v1"},
+		},
+		{
+			name: "several policies",
+			policies: []*admissionregistrationv1.ValidatingAdmissionPolicy{
+				rulesPolicy("pods", rule([]string{""}, []string{"v1"}, []string{"pods"}, admissionregistrationv1.AllScopes)),
+				rulesPolicy("deployments", rule([]string{"apps"}, []string{"v1"}, []string{"deployments"}, admissionregistrationv1.NamespacedScope)),
+				{ObjectMeta: metav1.ObjectMeta{Name: "no-constraints"}},
+			},
+			want: []string{"deployments.apps/v1", "pods.v1"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mappings, err := newFakeClusterLoader().ResolvePolicyResources(tt.policies)
+			require.NoError(t, err)
+
+			var got []string
+			for _, mapping := range mappings {
+				got = append(got, ResourceType(mapping))
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestResolveResources(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		want     []string
+		wantKind string
+		wantErr  string
+	}{
+		{name: "plural", args: []string{"pods"}, want: []string{"pods.v1"}, wantKind: "Pod"},
+		{name: "short name", args: []string{"deploy"}, want: []string{"deployments.apps/v1"}, wantKind: "Deployment"},
+		{name: "kind", args: []string{"Deployment"}, want: []string{"deployments.apps/v1"}, wantKind: "Deployment"},
+		{name: "group", args: []string{"widgets.example.com"}, want: []string{"widgets.example.com/v1"}, wantKind: "Widget"},
+		{name: "version and group", args: []string{"widgets.v1beta1.example.com"}, want: []string{"widgets.example.com/v1beta1"}, wantKind: "Widget"},
+		{name: "duplicates", args: []string{"po", "pods"}, want: []string{"pods.v1"}, wantKind: "Pod"},
+		{name: "unknown", args: []string{"sprockets"}, wantErr: `unknown resource type "sprockets"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mappings, err := newFakeClusterLoader().ResolveResources(tt.args)
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+
+			var got []string
+			for _, mapping := range mappings {
+				got = append(got, ResourceType(mapping))
+			}
+			assert.Equal(t, tt.want, got)
+			assert.Equal(t, tt.wantKind, mappings[0].GroupVersionKind.Kind)
+		})
+	}
+}
+
+func TestGetResources(t *testing.T) {
+	widget := func(namespace, name string) *unstructured.Unstructured {
+		obj := &unstructured.Unstructured{}
+		obj.SetAPIVersion("example.com/v1")
+		obj.SetKind("Widget")
+		obj.SetNamespace(namespace)
+		obj.SetName(name)
+		return obj
+	}
+	clusterLoader := newFakeClusterLoader(widget("team-a", "first"), widget("team-b", "second"))
+
+	// Custom resources are retrieved like built-in ones
+	resources, err := clusterLoader.GetResources(context.Background(), "widgets", ResourceSource{Type: SourceTypeCluster})
+	require.NoError(t, err)
+	assert.Len(t, resources, 2)
+
+	resources, err = clusterLoader.GetResources(context.Background(), "widgets", ResourceSource{Type: SourceTypeCluster, Namespace: "team-b"})
+	require.NoError(t, err)
+	require.Len(t, resources, 1)
+	assert.Equal(t, "second", resources[0].(*unstructured.Unstructured).GetName())
+
+	_, err = clusterLoader.GetResources(context.Background(), "sprockets", ResourceSource{Type: SourceTypeCluster})
+	require.Error(t, err)
+}
@@ -0,0 +1,183 @@
+package loader
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/bmatcuk/doublestar/v4"
+)
+
+// manifestExtensions are the extensions of files found by directory and glob expansion
+var manifestExtensions = map[string]bool{
+	".yaml": true,
+	".yml":  true,
+	".json": true,
+}
+
+// ExpandPaths expands the directories and glob patterns of paths to the files they hold
+// Directories are walked recursively and glob patterns support ** (e.g. policies/**/*.yaml).
+// Both only yield .yaml, .yml and .json files and skip hidden files and directories.
+// Files named explicitly are kept whatever their extension, and each file is returned once.
+// - stands for standard input and is kept as is
+func ExpandPaths(paths []string, ignore []string) ([]string, error) {
+	for _, pattern := range ignore {
+		if !doublestar.ValidatePattern(filepath.ToSlash(pattern)) {
+			return nil, fmt.Errorf("invalid ignore pattern %q", pattern)
+		}
+	}
+
+	var files []string
+	seen := make(map[string]bool)
+	for _, entry := range paths {
+		// Standard input is read as a single file
+		if entry == StdinPath {
+			if !seen[entry] {
+				seen[entry] = true
+				files = append(files, entry)
+			}
+			continue
+		}
+		expanded, err := expandPath(entry, ignore)
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range expanded {
+			if !seen[file] {
+				seen[file] = true
+				files = append(files, file)
+			}
+		}
+	}
+	return files, nil
+}
+
+// expandPath expands a single file, directory or glob pattern
+func expandPath(entry string, ignore []string) ([]string, error) {
+	if isGlobPattern(entry) {
+		return expandGlob(entry, ignore)
+	}
+
+	info, err := os.Stat(entry)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file (%s): %w", entry, err)
+	}
+	if !info.IsDir() {
+		return []string{filepath.Clean(entry)}, nil
+	}
+	return expandDirectory(entry, ignore)
+}
+
+// expandDirectory returns the manifest files under a directory
+func expandDirectory(root string, ignore []string) ([]string, error) {
+	root = filepath.Clean(root)
+
+	var files []string
+	err := filepath.WalkDir(root, func(filePath string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if filePath == root {
+			return nil
+		}
+
+		rel, err := filepath.Rel(root, filePath)
+		if err != nil {
+			return err
+		}
+		if isHidden(d.Name()) || isIgnored(filePath, rel, ignore) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.IsDir() && manifestExtensions[strings.ToLower(filepath.Ext(filePath))] {
+			files = append(files, filePath)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read directory (%s): %w", root, err)
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no YAML or JSON files found in directory %s", root)
+	}
+	return files, nil
+}
+
+// expandGlob returns the manifest files matching a doublestar glob pattern
+func expandGlob(pattern string, ignore []string) ([]string, error) {
+	slashPattern := filepath.ToSlash(pattern)
+	if !doublestar.ValidatePattern(slashPattern) {
+		return nil, fmt.Errorf("invalid glob pattern %q", pattern)
+	}
+	// Match below the static part of the pattern, which is also the root of relative paths
+	base, relPattern := doublestar.SplitPattern(slashPattern)
+
+	matches, err := doublestar.Glob(os.DirFS(filepath.FromSlash(base)), relPattern, doublestar.WithFilesOnly())
+	if err != nil {
+		return nil, fmt.Errorf("failed to expand glob pattern %q: %w", pattern, err)
+	}
+
+	var files []string
+	for _, rel := range matches {
+		if hasHiddenElement(rel) || !manifestExtensions[strings.ToLower(path.Ext(rel))] {
+			continue
+		}
+		filePath := filepath.FromSlash(path.Join(base, rel))
+		if isIgnored(filePath, filepath.FromSlash(rel), ignore) {
+			continue
+		}
+		files = append(files, filePath)
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no YAML or JSON files match %q", pattern)
+	}
+	return files, nil
+}
+
+// isGlobPattern returns true if the path holds glob metacharacters
+func isGlobPattern(entry string) bool {
+	return strings.ContainsAny(entry, "*?[{")
+}
+
+// isHidden returns true for dot files and directories
+func isHidden(name string) bool {
+	return strings.HasPrefix(name, ".") && name != "." && name != ".."
+}
+
+// hasHiddenElement returns true if any element of a slash separated path is hidden
+func hasHiddenElement(slashPath string) bool {
+	for _, element := range strings.Split(slashPath, "/") {
+		if isHidden(element) {
+			return true
+		}
+	}
+	return false
+}
+
+// isIgnored returns true if an ignore pattern matches the path, the path relative to
+// the expanded directory or glob, or, for patterns without a slash, any file or directory name
+// of the relative path
+func isIgnored(filePath, rel string, ignore []string) bool {
+	slashPath := filepath.ToSlash(filePath)
+	slashRel := filepath.ToSlash(rel)
+	for _, pattern := range ignore {
+		pattern = strings.TrimSuffix(filepath.ToSlash(pattern), "/")
+		if doublestar.MatchUnvalidated(pattern, slashPath) || doublestar.MatchUnvalidated(pattern, slashRel) {
+			return true
+		}
+		if strings.Contains(pattern, "/") {
+			continue
+		}
+		for _, name := range strings.Split(slashRel, "/") {
+			if doublestar.MatchUnvalidated(pattern, name) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,140 @@
+package loader
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeTree creates empty files below root
+func writeTree(t *testing.T, root string, files ...string) {
+	t.Helper()
+	for _, file := range files {
+		path := filepath.Join(root, filepath.FromSlash(file))
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, []byte("{}"), 0o644))
+	}
+}
+
+func TestExpandPaths(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root,
+		"policies/a.yaml",
+		"policies/b.yml",
+		"policies/c.json",
+		"policies/README.md",
+		"policies/.hidden.yaml",
+		"policies/.git/config.yaml",
+		"policies/nested/d.yaml",
+		"policies/nested/testdata/e.yaml",
+		"policies/notes.txt",
+	)
+	in := func(files ...string) []string {
+		var paths []string
+		for _, file := range files {
+			paths = append(paths, filepath.Join(root, filepath.FromSlash(file)))
+		}
+		return paths
+	}
+
+	tests := []struct {
+		name    string
+		paths   []string
+		ignore  []string
+		want    []string
+		wantErr string
+	}{
+		{
+			name:  "directory is walked recursively",
+			paths: in("policies"),
+			want:  in("policies/a.yaml", "policies/b.yml", "policies/c.json", "policies/nested/d.yaml", "policies/nested/testdata/e.yaml"),
+		},
+		{
+			name:  "explicit file is kept whatever its extension",
+			paths: in("policies/notes.txt"),
+			want:  in("policies/notes.txt"),
+		},
+		{
+			name:  "doublestar glob",
+			paths: in("policies/**/*.yaml"),
+			want:  in("policies/a.yaml", "policies/nested/d.yaml", "policies/nested/testdata/e.yaml"),
+		},
+		{
+			name:  "files are returned once",
+			paths: in("policies/a.yaml", "policies/*.yaml", "policies/nested"),
+			want:  in("policies/a.yaml", "policies/nested/d.yaml", "policies/nested/testdata/e.yaml"),
+		},
+		{
+			name:   "name pattern skips directories at any depth",
+			paths:  in("policies"),
+			ignore: []string{"testdata", "*.json"},
+			want:   in("policies/a.yaml", "policies/b.yml", "policies/nested/d.yaml"),
+		},
+		{
+			name:   "pattern relative to the expanded directory",
+			paths:  in("policies"),
+			ignore: []string{"nested/**"},
+			want:   in("policies/a.yaml", "policies/b.yml", "policies/c.json"),
+		},
+		{
+			name:   "ignore applies to globs",
+			paths:  in("policies/**/*.yaml"),
+			ignore: []string{"testdata/"},
+			want:   in("policies/a.yaml", "policies/nested/d.yaml"),
+		},
+		{
+			name:    "glob without matches",
+			paths:   in("policies/**/*.toml"),
+			wantErr: "no YAML or JSON files match",
+		},
+		{
+			name:    "directory without manifests",
+			paths:   in("policies/nested/testdata"),
+			ignore:  []string{"e.yaml"},
+			wantErr: "no YAML or JSON files found in directory",
+		},
+		{
+			name:    "missing file",
+			paths:   in("missing.yaml"),
+			wantErr: "failed to read file",
+		},
+		{
+			name:    "invalid ignore pattern",
+			paths:   in("policies"),
+			ignore:  []string{"[a-"},
+			wantErr: "invalid ignore pattern",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files, err := ExpandPaths(tt.paths, tt.ignore)
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, files)
+		})
+	}
+}
+
+func TestLoadBundleDirectory(t *testing.T) {
+	localLoader, err := NewLocalResourceLoader()
+	require.NoError(t, err, "Failed to create local resource loader")
+
+	// Policies, bindings and fixtures of a directory are loaded together
+	bundle, err := localLoader.LoadBundle(ResourceSource{
+		Type:   SourceTypeLocal,
+		Files:  []string{"test"},
+		Ignore: []string{"unknown-field-policy.yaml", "v1*"},
+	})
+	require.NoError(t, err, "Failed to load bundle")
+	assert.Len(t, bundle.Policies, 2, "Number of loaded policies is different")
+	assert.Len(t, bundle.Bindings, 2, "Number of loaded bindings is different")
+	assert.Len(t, bundle.Fixtures.LimitRanges, 2, "Number of loaded LimitRanges is different")
+}
@@ -0,0 +1,117 @@
+package loader
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// DefaultChunkSize is the number of objects retrieved per list request, as kubectl does
+const DefaultChunkSize int64 = 500
+
+// ListOptions selects the objects listed from cluster
+type ListOptions struct {
+	// Namespaces to list the objects of namespaced resources from, all namespaces when empty
+	Namespaces []string
+	// Namespaces whose objects are left out
+	ExcludeNamespaces []string
+	// Label and field selectors of the objects
+	LabelSelector string
+	FieldSelector string
+	// Number of objects retrieved per request with limit and continue, all objects at once when 0
+	ChunkSize int64
+}
+
+// Validate checks the selectors of the options
+func (o ListOptions) Validate() error {
+	if _, err := labels.Parse(o.LabelSelector); err != nil {
+		return fmt.Errorf("invalid label selector %q: %w", o.LabelSelector, err)
+	}
+	if _, err := fields.ParseSelector(o.FieldSelector); err != nil {
+		return fmt.Errorf("invalid field selector %q: %w", o.FieldSelector, err)
+	}
+	if o.ChunkSize < 0 {
+		return fmt.Errorf("invalid chunk size %d", o.ChunkSize)
+	}
+	return nil
+}
+
+// lister lists the objects of a resource, in a namespace or in all namespaces
+type lister interface {
+	List(ctx context.Context, opts metav1.ListOptions) (*unstructured.UnstructuredList, error)
+}
+
+// VisitResources lists the objects of a resource from cluster and passes them to visit one at a
+// time, retrieving them in chunks so that the objects of a single chunk are held at once
+// Objects of cluster-scoped resources are listed whatever the namespaces
+// Listing stops at the first error of visit, which is returned
+func (c *ClusterResourceLoader) VisitResources(ctx context.Context, mapping *meta.RESTMapping, opts ListOptions, visit func(*unstructured.Unstructured) error) error {
+	resource := c.dynamicClient.Resource(mapping.Resource)
+	if mapping.Scope.Name() != meta.RESTScopeNameNamespace {
+		return listPages(ctx, resource, opts.LabelSelector, opts.FieldSelector, opts.ChunkSize, visit)
+	}
+
+	if len(opts.Namespaces) == 0 {
+		// Excluded namespaces are filtered by the apiserver when listing all namespaces
+		fieldSelector := opts.FieldSelector
+		for _, namespace := range opts.ExcludeNamespaces {
+			fieldSelector = joinSelectors(fieldSelector, fields.OneTermNotEqualSelector("metadata.namespace", namespace).String())
+		}
+		return listPages(ctx, resource, opts.LabelSelector, fieldSelector, opts.ChunkSize, visit)
+	}
+
+	listed := make(map[string]bool)
+	for _, namespace := range opts.Namespaces {
+		if listed[namespace] || slices.Contains(opts.ExcludeNamespaces, namespace) {
+			continue
+		}
+		listed[namespace] = true
+		if err := listPages(ctx, resource.Namespace(namespace), opts.LabelSelector, opts.FieldSelector, opts.ChunkSize, visit); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// listPages lists objects chunk by chunk, following the continue token of each chunk
+func listPages(ctx context.Context, client lister, labelSelector, fieldSelector string, chunkSize int64, visit func(*unstructured.Unstructured) error) error {
+	listOptions := metav1.ListOptions{
+		LabelSelector: labelSelector,
+		FieldSelector: fieldSelector,
+		Limit:         chunkSize,
+	}
+	for {
+		list, err := client.List(ctx, listOptions)
+		if err != nil {
+			return fmt.Errorf("failed to get resources: %w", err)
+		}
+		for i := range list.Items {
+			if err := visit(&list.Items[i]); err != nil {
+				return err
+			}
+		}
+
+		listOptions.Continue = list.GetContinue()
+		if listOptions.Continue == "" {
+			return nil
+		}
+	}
+}
+
+// joinSelectors returns the conjunction of field selectors
+func joinSelectors(selectors ...string) string {
+	var terms []string
+	for _, selector := range selectors {
+		if selector != "" {
+			terms = append(terms, selector)
+		}
+	}
+	return strings.Join(terms, ",")
+}
@@ -0,0 +1,202 @@
+package loader
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	clienttesting "k8s.io/client-go/testing"
+)
+
+// pagedLister serves objects in chunks of the requested limit, recording the requests
+type pagedLister struct {
+	names    []string
+	requests []metav1.ListOptions
+}
+
+// List returns the chunk of objects starting at the continue token
+func (l *pagedLister) List(ctx context.Context, opts metav1.ListOptions) (*unstructured.UnstructuredList, error) {
+	l.requests = append(l.requests, opts)
+	start := 0
+	if opts.Continue != "" {
+		start, _ = strconv.Atoi(opts.Continue)
+	}
+	end := len(l.names)
+	if opts.Limit > 0 && start+int(opts.Limit) < end {
+		end = start + int(opts.Limit)
+	}
+
+	list := &unstructured.UnstructuredList{}
+	for _, name := range l.names[start:end] {
+		obj := unstructured.Unstructured{}
+		obj.SetName(name)
+		list.Items = append(list.Items, obj)
+	}
+	if end < len(l.names) {
+		list.SetContinue(strconv.Itoa(end))
+	}
+	return list, nil
+}
+
+func TestListPages(t *testing.T) {
+	tests := []struct {
+		name         string
+		chunkSize    int64
+		wantRequests []metav1.ListOptions
+	}{
+		{
+			name:      "chunks",
+			chunkSize: 2,
+			wantRequests: []metav1.ListOptions{
+				{LabelSelector: "app=web", FieldSelector: "status.phase=Running", Limit: 2},
+				{LabelSelector: "app=web", FieldSelector: "status.phase=Running", Limit: 2, Continue: "2"},
+				{LabelSelector: "app=web", FieldSelector: "status.phase=Running", Limit: 2, Continue: "4"},
+			},
+		},
+		{
+			name:         "no chunks",
+			wantRequests: []metav1.ListOptions{{LabelSelector: "app=web", FieldSelector: "status.phase=Running"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &pagedLister{names: []string{"a", "b", "c", "d", "e"}}
+			var got []string
+			err := listPages(context.Background(), client, "app=web", "status.phase=Running", tt.chunkSize, func(obj *unstructured.Unstructured) error {
+				got = append(got, obj.GetName())
+				return nil
+			})
+			require.NoError(t, err)
+			assert.Equal(t, []string{"a", "b", "c", "d", "e"}, got)
+			assert.Equal(t, tt.wantRequests, client.requests)
+		})
+	}
+
+	// Listing stops at the first error of visit
+	client := &pagedLister{names: []string{"a", "b", "c"}}
+	err := listPages(context.Background(), client, "", "", 1, func(obj *unstructured.Unstructured) error {
+		return fmt.Errorf("stop at %s", obj.GetName())
+	})
+	assert.EqualError(t, err, "stop at a")
+	assert.Len(t, client.requests, 1)
+}
+
+func TestVisitResources(t *testing.T) {
+	object := func(apiVersion, kind, namespace, name string, labels map[string]string) runtime.Object {
+		obj := &unstructured.Unstructured{}
+		obj.SetAPIVersion(apiVersion)
+		obj.SetKind(kind)
+		obj.SetNamespace(namespace)
+		obj.SetName(name)
+		obj.SetLabels(labels)
+		return obj
+	}
+	objects := []runtime.Object{
+		object("v1", "Pod", "team-a", "web", map[string]string{"app": "web"}),
+		object("v1", "Pod", "team-b", "db", map[string]string{"app": "db"}),
+		object("v1", "Pod", "kube-system", "dns", nil),
+		object("v1", "Namespace", "", "team-a", nil),
+	}
+
+	tests := []struct {
+		name              string
+		resource          string
+		opts              ListOptions
+		want              []string
+		wantFieldSelector string
+	}{
+		{
+			name:     "all namespaces",
+			resource: "pods",
+			want:     []string{"kube-system/dns", "team-a/web", "team-b/db"},
+		},
+		{
+			name:     "namespaces",
+			resource: "pods",
+			opts:     ListOptions{Namespaces: []string{"team-b", "team-a", "team-b"}},
+			want:     []string{"team-b/db", "team-a/web"},
+		},
+		{
+			name:     "excluded namespaces of namespaces",
+			resource: "pods",
+			opts:     ListOptions{Namespaces: []string{"team-a", "team-b"}, ExcludeNamespaces: []string{"team-b"}},
+			want:     []string{"team-a/web"},
+		},
+		{
+			// The fake client does not filter fields, the apiserver leaves kube-system out
+			name:              "excluded namespaces of all namespaces",
+			resource:          "pods",
+			opts:              ListOptions{ExcludeNamespaces: []string{"kube-system"}, FieldSelector: "status.phase=Running"},
+			want:              []string{"kube-system/dns", "team-a/web", "team-b/db"},
+			wantFieldSelector: "metadata.namespace!=kube-system,status.phase=Running",
+		},
+		{
+			name:     "label selector",
+			resource: "pods",
+			opts:     ListOptions{LabelSelector: "app in (web,db)", Namespaces: []string{"team-a", "team-b"}},
+			want:     []string{"team-a/web", "team-b/db"},
+		},
+		{
+			// Objects of cluster-scoped resources are in no namespace
+			name:     "cluster-scoped resources",
+			resource: "namespaces",
+			opts:     ListOptions{Namespaces: []string{"team-b"}, ExcludeNamespaces: []string{"team-a"}},
+			want:     []string{"/team-a"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clusterLoader := newFakeClusterLoader(objects...)
+			mappings, err := clusterLoader.ResolveResources([]string{tt.resource})
+			require.NoError(t, err)
+
+			var got []string
+			err = clusterLoader.VisitResources(context.Background(), mappings[0], tt.opts, func(obj *unstructured.Unstructured) error {
+				got = append(got, obj.GetNamespace()+"/"+obj.GetName())
+				return nil
+			})
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+
+			if tt.wantFieldSelector != "" {
+				actions := clusterLoader.dynamicClient.(*dynamicfake.FakeDynamicClient).Actions()
+				require.Len(t, actions, 1)
+				assert.Equal(t, tt.wantFieldSelector, actions[0].(clienttesting.ListAction).GetListRestrictions().Fields.String())
+			}
+		})
+	}
+}
+
+func TestListOptionsValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    ListOptions
+		wantErr string
+	}{
+		{name: "selectors", opts: ListOptions{LabelSelector: "app=web,tier notin (cache)", FieldSelector: "status.phase!=Failed", ChunkSize: 100}},
+		{name: "invalid label selector", opts: ListOptions{LabelSelector: "app=(web"}, wantErr: "invalid label selector"},
+		{name: "invalid field selector", opts: ListOptions{FieldSelector: "status.phase"}, wantErr: "invalid field selector"},
+		{name: "negative chunk size", opts: ListOptions{ChunkSize: -1}, wantErr: "invalid chunk size -1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.opts.Validate()
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+}
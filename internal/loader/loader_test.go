@@ -1,6 +1,7 @@
 package loader
 
 import (
+	"os"
 	"path/filepath"
 	"testing"
 
@@ -74,3 +75,203 @@ func TestLoadPolicyBindingsFileNotFound(t *testing.T) {
 	// Assertions
 	assert.Error(t, err, "Loading policy binding from non-existent file did not return an error")
 }
+
+func TestLoadAdmissionFixtures(t *testing.T) {
+	// Create local resource loader
+	localLoader, err := NewLocalResourceLoader()
+	require.NoError(t, err, "Failed to create local resource loader")
+
+	resourceSource := ResourceSource{
+		Type: SourceTypeLocal,
+		Files: []string{
+			filepath.Join("test", "policy-binding-test.yaml"),
+			filepath.Join("test", "limit-range-fixture.yaml"),
+		},
+	}
+
+	// Fixtures are collected and other files are ignored
+	fixtures, err := localLoader.LoadAdmissionFixtures(resourceSource)
+	require.NoError(t, err, "Failed to load admission fixtures")
+	require.Len(t, fixtures.LimitRanges, 1, "Number of loaded LimitRanges is different")
+	assert.Equal(t, "default-limits", fixtures.LimitRanges[0].Name, "LimitRange name is different")
+
+	// Fixture files are not treated as bindings
+	bindings, err := localLoader.LoadPolicyBindings(resourceSource)
+	require.NoError(t, err, "Failed to load policy binding")
+	assert.Len(t, bindings, 1, "Fixture file should not be loaded as a binding")
+}
+
+// recordWarnings collects loader warnings until the test ends
+func recordWarnings(t *testing.T) *[]string {
+	t.Helper()
+	warnings := &[]string{}
+	SetWarningHandler(func(message string) {
+		*warnings = append(*warnings, message)
+	})
+	t.Cleanup(func() { SetWarningHandler(nil) })
+	return warnings
+}
+
+func TestLoadOlderAPIVersions(t *testing.T) {
+	warnings := recordWarnings(t)
+
+	localLoader, err := NewLocalResourceLoader()
+	require.NoError(t, err, "Failed to create local resource loader")
+
+	resourceSource := ResourceSource{
+		Type: SourceTypeLocal,
+		Files: []string{
+			filepath.Join("test", "v1beta1-policy.yaml"),
+			filepath.Join("test", "v1alpha1-binding.yaml"),
+		},
+	}
+
+	// v1beta1 policies are converted to v1 without losing fields
+	policies, err := localLoader.LoadPolicies(resourceSource)
+	require.NoError(t, err, "Failed to load v1beta1 policy")
+	require.Len(t, policies, 1, "Binding file should not be loaded as a policy")
+	policy := policies[0]
+	assert.Equal(t, "admissionregistration.k8s.io/v1", policy.APIVersion)
+	assert.Equal(t, "beta-policy", policy.Name)
+	require.Len(t, policy.Spec.Variables, 1)
+	assert.Equal(t, "containers", policy.Spec.Variables[0].Name)
+	require.Len(t, policy.Spec.Validations, 1)
+	assert.Equal(t, "'latest tag is not allowed in ' + object.metadata.name", policy.Spec.Validations[0].MessageExpression)
+	require.NotNil(t, policy.Spec.MatchConstraints)
+	assert.Equal(t, []string{"pods"}, policy.Spec.MatchConstraints.ResourceRules[0].Resources)
+
+	// v1alpha1 bindings without validationActions deny as in Kubernetes 1.26
+	bindings, err := localLoader.LoadPolicyBindings(resourceSource)
+	require.NoError(t, err, "Failed to load v1alpha1 binding")
+	require.Len(t, bindings, 1, "Policy file should not be loaded as a binding")
+	assert.Equal(t, "beta-policy", bindings[0].Spec.PolicyName)
+	assert.Equal(t, []admissionregistrationv1.ValidationAction{admissionregistrationv1.Deny}, bindings[0].Spec.ValidationActions)
+	assert.Equal(t, "production", bindings[0].Spec.MatchResources.NamespaceSelector.MatchLabels["environment"])
+
+	// Both deprecated versions are reported once
+	require.Len(t, *warnings, 2)
+	assert.Contains(t, (*warnings)[0], "ValidatingAdmissionPolicy 'beta-policy'")
+	assert.Contains(t, (*warnings)[0], "admissionregistration.k8s.io/v1beta1 ValidatingAdmissionPolicy is deprecated in v1.31+, unavailable in v1.34+; use admissionregistration.k8s.io/v1 ValidatingAdmissionPolicy")
+	assert.Contains(t, (*warnings)[1], "admissionregistration.k8s.io/v1alpha1 ValidatingAdmissionPolicyBinding is deprecated in v1.29+")
+}
+
+func TestLoadPolicyUnknownFields(t *testing.T) {
+	warnings := recordWarnings(t)
+
+	localLoader, err := NewLocalResourceLoader()
+	require.NoError(t, err, "Failed to create local resource loader")
+
+	// Unknown fields are reported instead of being dropped silently
+	policies, err := localLoader.LoadPolicies(ResourceSource{
+		Type:  SourceTypeLocal,
+		Files: []string{filepath.Join("test", "unknown-field-policy.yaml")},
+	})
+	require.NoError(t, err, "Unknown fields should not fail loading")
+	require.Len(t, policies, 1)
+	assert.Equal(t, "typo-policy", policies[0].Name)
+	require.Len(t, *warnings, 1)
+	assert.Contains(t, (*warnings)[0], `unknown field "spec.validations[0].mesage"`)
+}
+
+func TestLoadBundle(t *testing.T) {
+	localLoader, err := NewLocalResourceLoader()
+	require.NoError(t, err, "Failed to create local resource loader")
+
+	bundle, err := localLoader.LoadBundle(ResourceSource{
+		Type:  SourceTypeLocal,
+		Files: []string{filepath.Join("test", "policy-bundle.yaml")},
+	})
+	require.NoError(t, err, "Failed to load bundle")
+
+	require.Len(t, bundle.Policies, 1, "Number of loaded policies is different")
+	assert.Equal(t, "replica-limit-policy", bundle.Policies[0].Name)
+	require.Len(t, bundle.Bindings, 1, "Number of loaded bindings is different")
+	assert.Equal(t, "replica-limit-binding", bundle.Bindings[0].Name)
+	require.Len(t, bundle.CRDs, 1, "Number of loaded CRDs is different")
+	require.Len(t, bundle.Namespaces, 1, "Number of loaded namespaces is different")
+	assert.Equal(t, "production", bundle.Namespaces[0].Name)
+
+	// Objects of a kind defined by a CRD of the bundle are parameters
+	require.Len(t, bundle.Params, 1, "Number of loaded parameters is different")
+	assert.Equal(t, "replica-limit", bundle.Params[0].GetName())
+	assert.Equal(t, bundle.Params[0], bundle.Parameter())
+
+	// Other documents are reported with their position
+	require.Len(t, bundle.Unknown, 1, "Number of unknown documents is different")
+	unknown := bundle.Unknown[0]
+	assert.Equal(t, "Deployment", unknown.Kind)
+	assert.Equal(t, filepath.Join("test", "policy-bundle.yaml")+":62 (document 6)", unknown.Source)
+	assert.Contains(t, unknown.String(), "apps/v1 Deployment 'not-a-policy' is not a policy")
+}
+
+func TestLoadBundleList(t *testing.T) {
+	localLoader, err := NewLocalResourceLoader()
+	require.NoError(t, err, "Failed to create local resource loader")
+
+	resourceSource := ResourceSource{
+		Type:  SourceTypeLocal,
+		Files: []string{filepath.Join("test", "policy-list.yaml")},
+	}
+	bundle, err := localLoader.LoadBundle(resourceSource)
+	require.NoError(t, err, "Failed to load bundle")
+
+	// List items are classified like separate documents
+	require.Len(t, bundle.Policies, 1, "Number of loaded policies is different")
+	assert.Equal(t, "list-policy", bundle.Policies[0].Name)
+	require.Len(t, bundle.Params, 1, "ConfigMap used as paramKind should be a parameter")
+	assert.Equal(t, "list-params", bundle.Params[0].GetName())
+	require.Len(t, bundle.Fixtures.LimitRanges, 1, "Number of loaded LimitRanges is different")
+	assert.Empty(t, bundle.Unknown, "No document should be unknown")
+
+	param, err := localLoader.LoadParameter(resourceSource)
+	require.NoError(t, err, "Failed to load parameter")
+	assert.Equal(t, bundle.Parameter(), param)
+}
+
+func TestLoadParameterWithoutPolicy(t *testing.T) {
+	localLoader, err := NewLocalResourceLoader()
+	require.NoError(t, err, "Failed to create local resource loader")
+
+	// A parameter file without policy is used as is
+	param, err := localLoader.LoadParameter(ResourceSource{
+		Type:  SourceTypeLocal,
+		Files: []string{filepath.Join("..", "..", "examples", "parameters", "allowed-registries.yaml")},
+	})
+	require.NoError(t, err, "Failed to load parameter")
+	require.NotNil(t, param, "Parameter is nil")
+	assert.Equal(t, "ConfigMap", param.GetObjectKind().GroupVersionKind().Kind)
+}
+
+func TestLoadBundleWaivers(t *testing.T) {
+	localLoader, err := NewLocalResourceLoader()
+	require.NoError(t, err, "Failed to create local resource loader")
+
+	bundle, err := localLoader.LoadBundle(ResourceSource{
+		Type:  SourceTypeLocal,
+		Files: []string{filepath.Join("test", "waivers.yaml")},
+	})
+	require.NoError(t, err, "Failed to load bundle")
+	require.Len(t, bundle.Waivers, 1, "Number of loaded waivers is different")
+	waiver := bundle.Waivers[0]
+	assert.Equal(t, "legacy-apps", waiver.Name)
+	assert.Equal(t, []int{0}, waiver.Spec.Policies[0].Validations)
+	assert.Equal(t, "payments", waiver.Spec.Resources[0].Selector.MatchLabels["team"])
+	assert.Equal(t, "OPS-1234", waiver.Spec.Ticket)
+	assert.Empty(t, bundle.Unknown, "Waivers should not be unknown")
+
+	// Waivers without an expiry are rejected
+	invalid := filepath.Join(t.TempDir(), "waiver.yaml")
+	require.NoError(t, os.WriteFile(invalid, []byte(`apiVersion: admission.k8s.io/v1
+kind: PolicyWaiver
+metadata:
+  name: forever
+spec:
+  policies:
+  - name: replica-limit-policy
+  resources:
+  - kind: Deployment
+`), 0o644))
+	_, err = localLoader.LoadBundle(ResourceSource{Type: SourceTypeLocal, Files: []string{invalid}})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "waiver 'forever' has no expiry")
+}
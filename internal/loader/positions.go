@@ -0,0 +1,97 @@
+package loader
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/yashirook/kube-vap-test/internal/source"
+)
+
+// policyExpressionFields are the expression fields of the policy list fields
+var policyExpressionFields = []struct {
+	list   string
+	fields []string
+}{
+	{list: "variables", fields: []string{"expression"}},
+	{list: "matchConditions", fields: []string{"expression"}},
+	{list: "validations", fields: []string{"expression", "messageExpression"}},
+	{list: "auditAnnotations", fields: []string{"valueExpression"}},
+}
+
+// policySource returns the positions of a policy document and of its expressions
+func policySource(document Document) *source.Policy {
+	policy := &source.Policy{
+		File:        document.Source,
+		Line:        document.Line,
+		Expressions: make(map[string]source.Scalar),
+	}
+
+	node := parseNode(document.raw)
+	if document.Item > 0 {
+		items := listItemNodes(node)
+		if document.Item > len(items) {
+			return policy
+		}
+		node = items[document.Item-1]
+	}
+
+	lines := bytes.Split(document.raw, []byte("\n"))
+	spec := mappingValue(node, "spec")
+	for _, list := range policyExpressionFields {
+		entries := mappingValue(spec, list.list)
+		if entries == nil || entries.Kind != yaml.SequenceNode {
+			continue
+		}
+		for i, entry := range entries.Content {
+			for _, field := range list.fields {
+				value := mappingValue(entry, field)
+				if value == nil || value.Kind != yaml.ScalarNode {
+					continue
+				}
+				scalar := scalarPosition(value, lines)
+				scalar.File = document.Source
+				scalar.Line += document.rawLine - 1
+				policy.Expressions[fmt.Sprintf("spec.%s[%d].%s", list.list, i, field)] = scalar
+			}
+		}
+	}
+	return policy
+}
+
+// scalarPosition returns the position of the first character of a string node, relative to the document
+func scalarPosition(node *yaml.Node, lines [][]byte) source.Scalar {
+	switch {
+	case node.Style&(yaml.LiteralStyle|yaml.FoldedStyle) != 0:
+		// Block scalars start on the line after the indicator, at the block indentation
+		scalar := source.Scalar{Line: node.Line + 1, Column: node.Column, Exact: node.Style&yaml.LiteralStyle != 0}
+		if node.Line < len(lines) {
+			content := strings.TrimRight(string(lines[node.Line]), "\r")
+			scalar.Column = len(content) - len(strings.TrimLeft(content, " ")) + 1
+		}
+		return scalar
+	case node.Style&(yaml.SingleQuotedStyle|yaml.DoubleQuotedStyle) != 0:
+		// The string starts after the quote
+		scalar := source.Scalar{Line: node.Line, Column: node.Column + 1}
+		scalar.Exact = startsLine(lines, node.Line, node.Column, "'"+node.Value+"'") ||
+			startsLine(lines, node.Line, node.Column, `"`+node.Value+`"`)
+		return scalar
+	default:
+		return source.Scalar{Line: node.Line, Column: node.Column, Exact: startsLine(lines, node.Line, node.Column, node.Value)}
+	}
+}
+
+// startsLine reports whether the text is found as is at a line and column of the document,
+// which is false for strings spanning several lines or holding escape sequences
+func startsLine(lines [][]byte, line, column int, text string) bool {
+	if line < 1 || line > len(lines) || strings.Contains(text, "\n") {
+		return false
+	}
+	runes := []rune(strings.TrimRight(string(lines[line-1]), "\r"))
+	if column < 1 || column > len(runes)+1 {
+		return false
+	}
+	return strings.HasPrefix(string(runes[column-1:]), text)
+}
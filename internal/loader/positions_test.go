@@ -0,0 +1,65 @@
+package loader
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/yashirook/kube-vap-test/internal/source"
+)
+
+const positionsPolicy = `# replica limit
+apiVersion: admissionregistration.k8s.io/v1
+kind: ValidatingAdmissionPolicy
+metadata:
+  name: replica-limit
+spec:
+  matchConstraints:
+    resourceRules:
+    - apiGroups: ["apps"]
+      apiVersions: ["v1"]
+      operations: ["CREATE"]
+      resources: ["deployments"]
+  variables:
+  - name: replicas
+    expression: object.spec.replicas
+  validations:
+  - expression: |
+      variables.replicas <= 5 &&
+        object.metadata.name != ''
+    messageExpression: "'too many replicas: ' + string(variables.replicas)"
+  - expression: >
+      variables.replicas > 0
+`
+
+func TestPolicySources(t *testing.T) {
+	policyFile := filepath.Join(t.TempDir(), "policy.yaml")
+	require.NoError(t, os.WriteFile(policyFile, []byte("---\n"+positionsPolicy), 0o644))
+
+	localLoader, err := NewLocalResourceLoader()
+	require.NoError(t, err, "Failed to create local resource loader")
+	bundle, err := localLoader.LoadBundle(ResourceSource{Type: SourceTypeLocal, Files: []string{policyFile}})
+	require.NoError(t, err, "Failed to load bundle")
+
+	policy := bundle.PolicySources["replica-limit"]
+	require.NotNil(t, policy)
+	assert.Equal(t, policyFile, policy.File)
+	assert.Equal(t, 3, policy.Line)
+	assert.Equal(t, map[string]source.Scalar{
+		// Plain scalar
+		"spec.variables[0].expression": {File: policyFile, Line: 16, Column: 17, Exact: true},
+		// Literal block, starting on the line after the indicator
+		"spec.validations[0].expression": {File: policyFile, Line: 19, Column: 7, Exact: true},
+		// Quoted string, starting after the quote
+		"spec.validations[0].messageExpression": {File: policyFile, Line: 21, Column: 25, Exact: true},
+		// Folded block, whose lines are joined
+		"spec.validations[1].expression": {File: policyFile, Line: 23, Column: 7},
+	}, policy.Expressions)
+
+	// Positions in the literal block keep their line and column
+	assert.Equal(t, 20, policy.Locate("spec.validations[0].expression", 2, 2).Line)
+	assert.Equal(t, 9, policy.Locate("spec.validations[0].expression", 2, 2).Column)
+}
@@ -1,21 +1,27 @@
 package loader
 
 import (
-	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"sync"
 
+	"github.com/yashirook/kube-vap-test/internal/engine/plugins"
 	kaptestv1 "github.com/yashirook/kube-vap-test/pkg/apis/admission/v1"
 	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
-	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/runtime/serializer"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/discovery/cached/memory"
 	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/restmapper"
 	"k8s.io/client-go/tools/clientcmd"
 	"sigs.k8s.io/yaml"
 )
@@ -35,7 +41,10 @@ type ResourceSource struct {
 	// Type of source
 	Type SourceType
 	// File paths for local mode
+	// Directories and glob patterns are expanded to the YAML and JSON files they hold
 	Files []string
+	// Glob patterns of files and directories to skip when expanding Files
+	Ignore []string
 	// Reference for cluster mode
 	KubeconfigPath string
 	// Namespace (for cluster mode)
@@ -62,24 +71,39 @@ type ResourceLoader interface {
 	// GetResources retrieves resources
 	// Loads from local files or cluster based on source configuration
 	GetResources(ctx context.Context, resourceType string, source ResourceSource) ([]runtime.Object, error)
+
+	// LoadAdmissionFixtures loads objects read by the emulated admission plugins
+	// (LimitRanges, StorageClasses and ServiceAccounts)
+	LoadAdmissionFixtures(source ResourceSource) (*plugins.Fixtures, error)
+
+	// LoadBundle loads policies, bindings, parameters, namespaces, CRDs and fixtures at once
+	// Documents of other kinds are listed in the bundle instead of failing the load
+	LoadBundle(source ResourceSource) (*Bundle, error)
 }
 
 // LocalResourceLoader loads resources from local files
 type LocalResourceLoader struct {
 	scheme *runtime.Scheme
 	codecs serializer.CodecFactory
+	// Codecs reporting fields unknown to the decoded API version
+	strictCodecs serializer.CodecFactory
+	// Warnings already passed to the warning handler
+	warnedMu sync.Mutex
+	warned   map[string]bool
 }
 
 // NewLocalResourceLoader creates a new LocalResourceLoader
 func NewLocalResourceLoader() (*LocalResourceLoader, error) {
 	scheme := runtime.NewScheme()
-	if err := admissionregistrationv1.AddToScheme(scheme); err != nil {
-		return nil, fmt.Errorf("failed to add admissionregistrationv1 schema: %w", err)
+	if err := addPolicyAPIVersions(scheme); err != nil {
+		return nil, fmt.Errorf("failed to add admissionregistration schema: %w", err)
 	}
 
 	return &LocalResourceLoader{
-		scheme: scheme,
-		codecs: serializer.NewCodecFactory(scheme),
+		scheme:       scheme,
+		codecs:       serializer.NewCodecFactory(scheme),
+		strictCodecs: serializer.NewCodecFactory(scheme, serializer.EnableStrict),
+		warned:       make(map[string]bool),
 	}, nil
 }
 
@@ -104,53 +128,13 @@ func (l *LocalResourceLoader) LoadPolicyTest(filePath string, runMode bool) (*ka
 		if testCase.ObjectFile != "" {
 			// Resolve path relative to test file directory
 			objectPath := filepath.Join(filepath.Dir(filePath), testCase.ObjectFile)
-			objectData, err := os.ReadFile(objectPath)
-			if err != nil {
-				return nil, fmt.Errorf("failed to read object file (%s): %w", objectPath, err)
-			}
-
-			// Check for multiple resources in run command
-			if runMode {
-				// Check if there are multiple YAML documents
-				objectDocs := bytes.Split(objectData, []byte("---\n"))
-				validDocs := 0
-				for _, doc := range objectDocs {
-					if len(bytes.TrimSpace(doc)) > 0 {
-						validDocs++
-					}
-				}
-
-				// Error if there are multiple valid documents
-				if validDocs > 1 {
-					return nil, fmt.Errorf("manifest file contains multiple resources. run command only supports single resource (%s)", objectPath)
-				}
-			}
-
-			// Use the first valid YAML document
-			var docToUse []byte
-			if bytes.Contains(objectData, []byte("---\n")) {
-				// May be split into multiple documents
-				objectDocs := bytes.Split(objectData, []byte("---\n"))
-				for _, doc := range objectDocs {
-					trimmed := bytes.TrimSpace(doc)
-					if len(trimmed) > 0 {
-						docToUse = trimmed
-						break
-					}
-				}
-			} else {
-				// Single document case
-				docToUse = objectData
-			}
-
-			// Convert YAML to JSON
-			jsonData, err := yaml.YAMLToJSON(docToUse)
+			object, err := readObjectFile(objectPath, runMode)
 			if err != nil {
-				return nil, fmt.Errorf("failed to convert object file to JSON (%s): %w", objectPath, err)
+				return nil, err
 			}
 
 			testCase.Object = runtime.RawExtension{
-				Raw: jsonData,
+				Raw: object.JSON,
 			}
 		}
 
@@ -158,19 +142,13 @@ func (l *LocalResourceLoader) LoadPolicyTest(filePath string, runMode bool) (*ka
 		if testCase.OldObjectFile != "" {
 			// Resolve path relative to test file directory
 			oldObjectPath := filepath.Join(filepath.Dir(filePath), testCase.OldObjectFile)
-			oldObjectData, err := os.ReadFile(oldObjectPath)
+			oldObject, err := readObjectFile(oldObjectPath, false)
 			if err != nil {
-				return nil, fmt.Errorf("failed to read old object file (%s): %w", oldObjectPath, err)
-			}
-
-			// Convert YAML to JSON
-			jsonData, err := yaml.YAMLToJSON(oldObjectData)
-			if err != nil {
-				return nil, fmt.Errorf("failed to convert old object file to JSON (%s): %w", oldObjectPath, err)
+				return nil, err
 			}
 
 			testCase.OldObject = &runtime.RawExtension{
-				Raw: jsonData,
+				Raw: oldObject.JSON,
 			}
 		}
 	}
@@ -178,11 +156,38 @@ func (l *LocalResourceLoader) LoadPolicyTest(filePath string, runMode bool) (*ka
 	return test, nil
 }
 
+// readObjectFile returns the first document of a test case object file
+// When single is true, files holding several resources are rejected
+func readObjectFile(objectPath string, single bool) (*Document, error) {
+	file, err := os.Open(objectPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read object file (%s): %w", objectPath, err)
+	}
+	defer file.Close()
+
+	decoder := NewDocumentDecoder(file, objectPath)
+	object, err := decoder.Next()
+	if errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("object file contains no resource (%s)", objectPath)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert object file to JSON (%s): %w", objectPath, err)
+	}
+
+	// Error if there are multiple valid documents
+	if single {
+		if _, err := decoder.Next(); !errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("manifest file contains multiple resources. run command only supports single resource (%s)", objectPath)
+		}
+	}
+	return object, nil
+}
+
 // LoadPolicies loads policies
 func (l *LocalResourceLoader) LoadPolicies(source ResourceSource) ([]*admissionregistrationv1.ValidatingAdmissionPolicy, error) {
 	if source.Type == SourceTypeLocal {
 		// Load policies from local files
-		return l.loadLocalPolicies(source.Files)
+		return l.loadLocalPolicies(source.Files, source.Ignore)
 	} else if source.Type == SourceTypeCluster {
 		// Local loader does not support loading from cluster
 		return nil, fmt.Errorf("local resource loader cannot load cluster policies")
@@ -191,42 +196,20 @@ func (l *LocalResourceLoader) LoadPolicies(source ResourceSource) ([]*admissionr
 }
 
 // loadLocalPolicies loads policies from a list of local file paths (internal method)
-func (l *LocalResourceLoader) loadLocalPolicies(filePaths []string) ([]*admissionregistrationv1.ValidatingAdmissionPolicy, error) {
-	policies := make([]*admissionregistrationv1.ValidatingAdmissionPolicy, 0, len(filePaths))
-
-	for _, filePath := range filePaths {
-		policy, err := l.loadPolicyFromFile(filePath)
-		if err != nil {
-			return nil, fmt.Errorf("failed to load policy (%s): %w", filePath, err)
-		}
-		policies = append(policies, policy)
-	}
-
-	return policies, nil
-}
-
-// loadPolicyFromFile loads a policy directly from file path (internal method)
-func (l *LocalResourceLoader) loadPolicyFromFile(filePath string) (*admissionregistrationv1.ValidatingAdmissionPolicy, error) {
-	data, err := os.ReadFile(filePath)
+// Policies of every served API version are converted to v1
+func (l *LocalResourceLoader) loadLocalPolicies(filePaths []string, ignore []string) ([]*admissionregistrationv1.ValidatingAdmissionPolicy, error) {
+	bundle, err := l.readBundle(filePaths, ignore)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read policy file: %w", err)
-	}
-
-	// Parse YAML
-	policy := &admissionregistrationv1.ValidatingAdmissionPolicy{}
-	decoder := serializer.NewCodecFactory(l.scheme).UniversalDeserializer()
-	if _, _, err := decoder.Decode(data, nil, policy); err != nil {
-		return nil, fmt.Errorf("failed to decode YAML: %w", err)
+		return nil, err
 	}
-
-	return policy, nil
+	return bundle.Policies, nil
 }
 
 // LoadPolicyBindings loads policy bindings
 func (l *LocalResourceLoader) LoadPolicyBindings(source ResourceSource) ([]*admissionregistrationv1.ValidatingAdmissionPolicyBinding, error) {
 	if source.Type == SourceTypeLocal {
 		// Load policy bindings from local files
-		return l.loadLocalPolicyBindings(source.Files)
+		return l.loadLocalPolicyBindings(source.Files, source.Ignore)
 	} else if source.Type == SourceTypeCluster {
 		// Local loader does not support loading from cluster
 		return nil, fmt.Errorf("local resource loader cannot load cluster policy bindings")
@@ -235,79 +218,51 @@ func (l *LocalResourceLoader) LoadPolicyBindings(source ResourceSource) ([]*admi
 }
 
 // loadLocalPolicyBindings loads policy bindings from a list of local file paths (internal method)
-func (l *LocalResourceLoader) loadLocalPolicyBindings(filePaths []string) ([]*admissionregistrationv1.ValidatingAdmissionPolicyBinding, error) {
-	bindings := make([]*admissionregistrationv1.ValidatingAdmissionPolicyBinding, 0, len(filePaths))
-
-	for _, path := range filePaths {
-		binding, err := l.loadPolicyBindingFromFile(path)
-		if err != nil {
-			return nil, fmt.Errorf("failed to load policy binding (%s): %w", path, err)
-		}
-		bindings = append(bindings, binding)
-	}
-
-	return bindings, nil
-}
-
-// loadPolicyBindingFromFile loads a policy binding directly from file path (internal method)
-func (l *LocalResourceLoader) loadPolicyBindingFromFile(filePath string) (*admissionregistrationv1.ValidatingAdmissionPolicyBinding, error) {
-	data, err := os.ReadFile(filePath)
+// Bindings of every served API version are converted to v1
+func (l *LocalResourceLoader) loadLocalPolicyBindings(filePaths []string, ignore []string) ([]*admissionregistrationv1.ValidatingAdmissionPolicyBinding, error) {
+	bundle, err := l.readBundle(filePaths, ignore)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read policy binding file: %w", err)
-	}
-
-	// Parse YAML
-	binding := &admissionregistrationv1.ValidatingAdmissionPolicyBinding{}
-	decoder := serializer.NewCodecFactory(l.scheme).UniversalDeserializer()
-	if _, _, err := decoder.Decode(data, nil, binding); err != nil {
-		return nil, fmt.Errorf("failed to decode YAML: %w", err)
+		return nil, err
 	}
-
-	return binding, nil
+	return bundle.Bindings, nil
 }
 
 // LoadParameter loads parameters
+// Parameter files may hold objects of any kind, so documents the bundle does not classify are parameters too
+// When several parameters are loaded the last one takes precedence
 func (l *LocalResourceLoader) LoadParameter(source ResourceSource) (runtime.Object, error) {
-	// Load from source files
-	if source.Type == SourceTypeLocal && len(source.Files) > 0 {
-		// Load and merge multiple parameter files
-		var result runtime.Object
-		for i, file := range source.Files {
-			param, err := l.loadParameterFromFile(file)
-			if err != nil {
-				// Skip if not a parameter file
-				continue
-			}
+	if source.Type != SourceTypeLocal || len(source.Files) == 0 {
+		// No parameter source specified
+		return nil, nil
+	}
 
-			if i == 0 {
-				// Use the first file as base
-				result = param
-			} else {
-				// TODO: Add implementation to merge multiple parameters in the future
-				// Currently the last loaded file takes precedence
-				result = param
-			}
+	bundle, err := l.readBundle(source.Files, source.Ignore)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load parameters: %w", err)
+	}
+	if param := bundle.Parameter(); param != nil {
+		return param, nil
+	}
+	for i := len(bundle.Unknown) - 1; i >= 0; i-- {
+		if bundle.Unknown[i].Kind != "" {
+			return bundle.Unknown[i].Object, nil
 		}
-		return result, nil
 	}
-
-	// No parameter source specified
 	return nil, nil
 }
 
-// loadParameterFromFile loads parameters directly from file path (internal method)
-func (l *LocalResourceLoader) loadParameterFromFile(filePath string) (runtime.Object, error) {
-	data, err := os.ReadFile(filePath)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read parameter file: %w", err)
+// LoadAdmissionFixtures loads admission plugin fixtures from local files
+// Files that do not contain fixture objects are skipped
+func (l *LocalResourceLoader) LoadAdmissionFixtures(source ResourceSource) (*plugins.Fixtures, error) {
+	if source.Type == SourceTypeCluster {
+		return nil, fmt.Errorf("local resource loader cannot load cluster admission fixtures")
 	}
 
-	obj, err := l.parseYAML(data)
+	bundle, err := l.readBundle(source.Files, source.Ignore)
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse parameter file: %w", err)
+		return nil, err
 	}
-
-	return obj, nil
+	return bundle.Fixtures, nil
 }
 
 // GetResources retrieves resources
@@ -324,89 +279,90 @@ func (l *LocalResourceLoader) parsePolicy(data []byte) (*admissionregistrationv1
 	return policy, nil
 }
 
-// parseYAML parses runtime object from byte data
-func (l *LocalResourceLoader) parseYAML(data []byte) (runtime.Object, error) {
-	obj := &runtime.Unknown{}
-	if err := yaml.Unmarshal(data, obj); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal object: %w", err)
-	}
-	return obj, nil
-}
-
 // ClusterResourceLoader loads resources from cluster
 type ClusterResourceLoader struct {
-	clientset      *kubernetes.Clientset
-	dynamicClient  dynamic.Interface
+	clientset     *kubernetes.Clientset
+	dynamicClient dynamic.Interface
+	// discovery caches the API resources of the cluster, which mapper resolves resource names with
+	discovery      discovery.CachedDiscoveryInterface
+	mapper         meta.RESTMapper
 	scheme         *runtime.Scheme
 	codecs         serializer.CodecFactory
 	kubeconfigPath string
 }
 
+// DynamicClient returns the dynamic client of the cluster
+func (c *ClusterResourceLoader) DynamicClient() dynamic.Interface {
+	return c.dynamicClient
+}
+
+// Discovery returns the cached discovery client of the cluster
+func (c *ClusterResourceLoader) Discovery() discovery.CachedDiscoveryInterface {
+	return c.discovery
+}
+
+// RESTMapper returns the mapper resolving the kinds and resources the cluster serves
+func (c *ClusterResourceLoader) RESTMapper() meta.RESTMapper {
+	return c.mapper
+}
+
 // GetResources retrieves resources of specified type from cluster
+// Any resource served by the cluster can be retrieved, see ResolveResources for the names
 func (c *ClusterResourceLoader) GetResources(ctx context.Context, resourceType string, source ResourceSource) ([]runtime.Object, error) {
-	// Get resources from dynamic client
-	var gvr schema.GroupVersionResource
-
-	// Set GVR based on resource type
-	switch resourceType {
-	case "pods":
-		gvr = schema.GroupVersionResource{Group: "", Version: "v1", Resource: "pods"}
-	case "deployments":
-		gvr = schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "deployments"}
-	case "statefulsets":
-		gvr = schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "statefulsets"}
-	case "daemonsets":
-		gvr = schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "daemonsets"}
-	case "replicasets":
-		gvr = schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "replicasets"}
-	case "cronjobs":
-		gvr = schema.GroupVersionResource{Group: "batch", Version: "v1", Resource: "cronjobs"}
-	case "jobs":
-		gvr = schema.GroupVersionResource{Group: "batch", Version: "v1", Resource: "jobs"}
-	case "services":
-		gvr = schema.GroupVersionResource{Group: "", Version: "v1", Resource: "services"}
-	case "configmaps":
-		gvr = schema.GroupVersionResource{Group: "", Version: "v1", Resource: "configmaps"}
-	case "secrets":
-		gvr = schema.GroupVersionResource{Group: "", Version: "v1", Resource: "secrets"}
-	case "ingresses":
-		gvr = schema.GroupVersionResource{Group: "networking.k8s.io", Version: "v1", Resource: "ingresses"}
-	default:
-		return nil, fmt.Errorf("unsupported resource type: %s", resourceType)
-	}
-
-	// Target all namespaces if namespace is not specified
-	var list *unstructured.UnstructuredList
-	var err error
-
-	listOptions := metav1.ListOptions{}
-
-	if source.Namespace != "" {
-		list, err = c.dynamicClient.Resource(gvr).Namespace(source.Namespace).List(ctx, listOptions)
-	} else {
-		list, err = c.dynamicClient.Resource(gvr).List(ctx, listOptions)
-	}
-
+	mapping, err := c.resolveResource(resourceType)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get resources: %w", err)
+		return nil, err
 	}
+	return c.ListResources(ctx, mapping, source.Namespace)
+}
 
-	// Convert Unstructured list to slice of runtime.Object
-	result := make([]runtime.Object, 0, len(list.Items))
-	for i := range list.Items {
-		result = append(result, &list.Items[i])
+// ListResources retrieves the objects of a resource from cluster
+// Objects of namespaced resources are retrieved from all namespaces when namespace is empty,
+// and objects of cluster-scoped resources are retrieved whatever the namespace
+func (c *ClusterResourceLoader) ListResources(ctx context.Context, mapping *meta.RESTMapping, namespace string) ([]runtime.Object, error) {
+	opts := ListOptions{ChunkSize: DefaultChunkSize}
+	if namespace != "" {
+		opts.Namespaces = []string{namespace}
 	}
 
+	var result []runtime.Object
+	err := c.VisitResources(ctx, mapping, opts, func(obj *unstructured.Unstructured) error {
+		result = append(result, obj)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
 	return result, nil
 }
 
+// ClientOptions configures the client of the cluster
+type ClientOptions struct {
+	// Maximum requests per second and burst of requests to the apiserver, the client-go
+	// defaults when 0
+	QPS   float32
+	Burst int
+}
+
 // NewClusterResourceLoader creates a new ClusterResourceLoader
 func NewClusterResourceLoader(kubeconfigPath string) (*ClusterResourceLoader, error) {
+	return NewClusterResourceLoaderWithOptions(kubeconfigPath, ClientOptions{})
+}
+
+// NewClusterResourceLoaderWithOptions creates a new ClusterResourceLoader with a client limited
+// to the rate of the options
+func NewClusterResourceLoaderWithOptions(kubeconfigPath string, opts ClientOptions) (*ClusterResourceLoader, error) {
 	// Initialize Kubernetes client using kubeconfig
 	config, err := clientcmd.BuildConfigFromFlags("", kubeconfigPath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to load kubeconfig: %w", err)
 	}
+	if opts.QPS > 0 {
+		config.QPS = opts.QPS
+	}
+	if opts.Burst > 0 {
+		config.Burst = opts.Burst
+	}
 
 	// Create clientset
 	clientset, err := kubernetes.NewForConfig(config)
@@ -420,18 +376,35 @@ func NewClusterResourceLoader(kubeconfigPath string) (*ClusterResourceLoader, er
 		return nil, fmt.Errorf("failed to create dynamic client: %w", err)
 	}
 
+	clusterLoader, err := NewClusterResourceLoaderForClients(dynamicClient, clientset.Discovery())
+	if err != nil {
+		return nil, err
+	}
+	clusterLoader.clientset = clientset
+	clusterLoader.kubeconfigPath = kubeconfigPath
+	return clusterLoader, nil
+}
+
+// NewClusterResourceLoaderForClients creates a new ClusterResourceLoader reading the cluster
+// through a dynamic client and a discovery client, such as those serving a snapshot
+// Admission fixtures are read with the typed clients of a kubeconfig and cannot be loaded
+func NewClusterResourceLoaderForClients(dynamicClient dynamic.Interface, discoveryClient discovery.DiscoveryInterface) (*ClusterResourceLoader, error) {
 	// Initialize schema
 	scheme := runtime.NewScheme()
-	if err := admissionregistrationv1.AddToScheme(scheme); err != nil {
-		return nil, fmt.Errorf("failed to add admissionregistrationv1 schema: %w", err)
+	if err := addPolicyAPIVersions(scheme); err != nil {
+		return nil, fmt.Errorf("failed to add admissionregistration schema: %w", err)
 	}
 
+	// Resource names are resolved as kubectl does, short names included
+	cachedDiscovery := memory.NewMemCacheClient(discoveryClient)
+	mapper := restmapper.NewShortcutExpander(restmapper.NewDeferredDiscoveryRESTMapper(cachedDiscovery), cachedDiscovery, nil)
+
 	return &ClusterResourceLoader{
-		clientset:      clientset,
-		dynamicClient:  dynamicClient,
-		scheme:         scheme,
-		codecs:         serializer.NewCodecFactory(scheme),
-		kubeconfigPath: kubeconfigPath,
+		dynamicClient: dynamicClient,
+		discovery:     cachedDiscovery,
+		mapper:        mapper,
+		scheme:        scheme,
+		codecs:        serializer.NewCodecFactory(scheme),
 	}, nil
 }
 
@@ -456,16 +429,16 @@ func (c *ClusterResourceLoader) LoadPolicies(source ResourceSource) ([]*admissio
 		return localLoader.LoadPolicies(source)
 	} else if source.Type == SourceTypeCluster {
 		// Get all ValidatingAdmissionPolicies from cluster
-		policies, err := c.clientset.AdmissionregistrationV1().ValidatingAdmissionPolicies().List(context.Background(), metav1.ListOptions{})
+		var result []*admissionregistrationv1.ValidatingAdmissionPolicy
+		err := c.listClusterObjects("validatingadmissionpolicies", func(obj *unstructured.Unstructured) error {
+			policy := &admissionregistrationv1.ValidatingAdmissionPolicy{}
+			result = append(result, policy)
+			return runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, policy)
+		})
 		if err != nil {
 			return nil, fmt.Errorf("failed to list ValidatingAdmissionPolicies: %w", err)
 		}
 
-		result := make([]*admissionregistrationv1.ValidatingAdmissionPolicy, len(policies.Items))
-		for i := range policies.Items {
-			result[i] = &policies.Items[i]
-		}
-
 		return result, nil
 	}
 	return nil, fmt.Errorf("unknown source type: %s", source.Type)
@@ -482,21 +455,28 @@ func (c *ClusterResourceLoader) LoadPolicyBindings(source ResourceSource) ([]*ad
 		return localLoader.LoadPolicyBindings(source)
 	} else if source.Type == SourceTypeCluster {
 		// Get all policy bindings from cluster
-		bindings, err := c.clientset.AdmissionregistrationV1().ValidatingAdmissionPolicyBindings().List(context.Background(), metav1.ListOptions{})
+		var result []*admissionregistrationv1.ValidatingAdmissionPolicyBinding
+		err := c.listClusterObjects("validatingadmissionpolicybindings", func(obj *unstructured.Unstructured) error {
+			binding := &admissionregistrationv1.ValidatingAdmissionPolicyBinding{}
+			result = append(result, binding)
+			return runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, binding)
+		})
 		if err != nil {
 			return nil, fmt.Errorf("failed to get policy bindings from cluster: %w", err)
 		}
 
-		result := make([]*admissionregistrationv1.ValidatingAdmissionPolicyBinding, 0, len(bindings.Items))
-		for i := range bindings.Items {
-			result = append(result, &bindings.Items[i])
-		}
-
 		return result, nil
 	}
 	return nil, fmt.Errorf("unknown source type: %s", source.Type)
 }
 
+// listClusterObjects lists the v1 objects of an admissionregistration resource in chunks
+// The dynamic client lists them, so that loaders serving a snapshot load them as well
+func (c *ClusterResourceLoader) listClusterObjects(resource string, visit func(*unstructured.Unstructured) error) error {
+	client := c.dynamicClient.Resource(admissionregistrationv1.SchemeGroupVersion.WithResource(resource))
+	return listPages(context.Background(), client, "", "", DefaultChunkSize, visit)
+}
+
 // LoadParameter loads parameters
 func (c *ClusterResourceLoader) LoadParameter(source ResourceSource) (runtime.Object, error) {
 	if source.Type == SourceTypeLocal {
@@ -512,3 +492,72 @@ func (c *ClusterResourceLoader) LoadParameter(source ResourceSource) (runtime.Ob
 	// In the future, we could load ConfigMaps or other parameter resources from cluster
 	return nil, nil
 }
+
+// LoadBundle loads policies, bindings, parameters, namespaces, CRDs and fixtures at once
+// Cluster bundles hold the policies and bindings of the cluster
+func (c *ClusterResourceLoader) LoadBundle(source ResourceSource) (*Bundle, error) {
+	if source.Type == SourceTypeLocal {
+		// Load the bundle from local files - delegation pattern
+		localLoader, err := NewLocalResourceLoader()
+		if err != nil {
+			return nil, err
+		}
+		return localLoader.LoadBundle(source)
+	} else if source.Type == SourceTypeCluster {
+		policies, err := c.LoadPolicies(source)
+		if err != nil {
+			return nil, err
+		}
+		bindings, err := c.LoadPolicyBindings(source)
+		if err != nil {
+			return nil, err
+		}
+		return &Bundle{Policies: policies, Bindings: bindings, Fixtures: &plugins.Fixtures{}}, nil
+	}
+	return nil, fmt.Errorf("unknown source type: %s", source.Type)
+}
+
+// LoadAdmissionFixtures loads admission plugin fixtures
+func (c *ClusterResourceLoader) LoadAdmissionFixtures(source ResourceSource) (*plugins.Fixtures, error) {
+	if source.Type == SourceTypeLocal {
+		// Load fixtures from local files - delegation pattern
+		localLoader, err := NewLocalResourceLoader()
+		if err != nil {
+			return nil, err
+		}
+		return localLoader.LoadAdmissionFixtures(source)
+	} else if source.Type == SourceTypeCluster {
+		if c.clientset == nil {
+			return nil, fmt.Errorf("admission fixtures can only be loaded from the cluster of a kubeconfig")
+		}
+		ctx := context.Background()
+		fixtures := &plugins.Fixtures{}
+
+		limitRanges, err := c.clientset.CoreV1().LimitRanges(source.Namespace).List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list LimitRanges: %w", err)
+		}
+		for i := range limitRanges.Items {
+			fixtures.LimitRanges = append(fixtures.LimitRanges, &limitRanges.Items[i])
+		}
+
+		storageClasses, err := c.clientset.StorageV1().StorageClasses().List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list StorageClasses: %w", err)
+		}
+		for i := range storageClasses.Items {
+			fixtures.StorageClasses = append(fixtures.StorageClasses, &storageClasses.Items[i])
+		}
+
+		serviceAccounts, err := c.clientset.CoreV1().ServiceAccounts(source.Namespace).List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list ServiceAccounts: %w", err)
+		}
+		for i := range serviceAccounts.Items {
+			fixtures.ServiceAccounts = append(fixtures.ServiceAccounts, &serviceAccounts.Items[i])
+		}
+
+		return fixtures, nil
+	}
+	return nil, fmt.Errorf("unknown source type: %s", source.Type)
+}
@@ -0,0 +1,65 @@
+package loader
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+const (
+	// StdinPath is the path of standard input in file arguments
+	StdinPath = "-"
+	// StdinSource is the source of documents read from standard input
+	StdinSource = "<stdin>"
+)
+
+// stdin caches standard input, which policies and manifests may read more than once
+var stdin = &stdinCache{reader: os.Stdin}
+
+// stdinCache reads a stream once and keeps its content
+type stdinCache struct {
+	reader io.Reader
+	once   sync.Once
+	data   []byte
+	err    error
+}
+
+// read returns the content of the stream, reading it the first time
+func (c *stdinCache) read() ([]byte, error) {
+	c.once.Do(func() {
+		c.data, c.err = io.ReadAll(c.reader)
+	})
+	return c.data, c.err
+}
+
+// StdinPiped reports whether standard input is redirected from a pipe or a file rather than
+// attached to a terminal, so that it can be read without waiting for a user
+func StdinPiped() bool {
+	info, err := os.Stdin.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice == 0
+}
+
+// SourceName returns the name of a file argument in messages, <stdin> for standard input
+func SourceName(path string) string {
+	if path == StdinPath {
+		return StdinSource
+	}
+	return path
+}
+
+// Open opens a file argument, or standard input for -
+func Open(path string) (io.ReadCloser, error) {
+	if path != StdinPath {
+		return os.Open(path)
+	}
+	data, err := stdin.read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read standard input: %w", err)
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
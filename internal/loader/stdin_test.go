@@ -0,0 +1,71 @@
+package loader
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	kaptestv1 "github.com/yashirook/kube-vap-test/pkg/apis/admission/v1"
+)
+
+// setStdin replaces standard input with content for the test
+func setStdin(t *testing.T, content string) {
+	t.Helper()
+	original := stdin
+	stdin = &stdinCache{reader: strings.NewReader(content)}
+	t.Cleanup(func() { stdin = original })
+}
+
+func TestReadDocumentsStdin(t *testing.T) {
+	setStdin(t, `apiVersion: v1
+kind: Pod
+metadata:
+  name: first
+---
+apiVersion: v1
+kind: Pod
+metadata:
+  name: second
+`)
+
+	documents, err := ReadDocuments(StdinPath)
+	require.NoError(t, err)
+	require.Len(t, documents, 2)
+	assert.Equal(t, "second", documents[1].Object.GetName())
+	// Documents of standard input are numbered
+	assert.Equal(t, "<stdin>:doc2", documents[1].String())
+	assert.Equal(t, kaptestv1.SourceLocation{File: StdinSource, Document: 2}, documents[1].Location())
+
+	// Standard input is read once and kept for later reads
+	again, err := ReadDocuments(StdinPath)
+	require.NoError(t, err)
+	assert.Len(t, again, 2)
+}
+
+func TestLoadBundleStdin(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("test", "policy-bundle.yaml"))
+	require.NoError(t, err)
+	setStdin(t, string(data))
+
+	localLoader, err := NewLocalResourceLoader()
+	require.NoError(t, err)
+	bundle, err := localLoader.LoadBundle(ResourceSource{Type: SourceTypeLocal, Files: []string{StdinPath}})
+	require.NoError(t, err)
+	require.Len(t, bundle.Policies, 1)
+	assert.Equal(t, StdinSource, bundle.PolicySources["replica-limit-policy"].File)
+	require.Len(t, bundle.Unknown, 1)
+	assert.Equal(t, "<stdin>:doc6", bundle.Unknown[0].Source)
+}
+
+func TestExpandPathsStdin(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, "a.yaml")
+
+	files, err := ExpandPaths([]string{StdinPath, root, StdinPath}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{StdinPath, filepath.Join(root, "a.yaml")}, files)
+}
@@ -0,0 +1,156 @@
+package loader
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	admissionregistrationv1alpha1 "k8s.io/api/admissionregistration/v1alpha1"
+	admissionregistrationv1beta1 "k8s.io/api/admissionregistration/v1beta1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apiserver/pkg/endpoints/deprecation"
+)
+
+// WarningHandler receives warnings about loaded resources, such as deprecated API versions
+type WarningHandler func(message string)
+
+var (
+	warningHandlerMu sync.RWMutex
+	warningHandler   WarningHandler = func(string) {}
+)
+
+// SetWarningHandler sets the handler receiving loader warnings
+// Warnings are discarded when handler is nil
+func SetWarningHandler(handler WarningHandler) {
+	if handler == nil {
+		handler = func(string) {}
+	}
+
+	warningHandlerMu.Lock()
+	defer warningHandlerMu.Unlock()
+	warningHandler = handler
+}
+
+// warn passes a warning to the registered handler
+// Each warning is passed once per loader, even when files are read again
+func (l *LocalResourceLoader) warn(message string) {
+	l.warnedMu.Lock()
+	if l.warned[message] {
+		l.warnedMu.Unlock()
+		return
+	}
+	l.warned[message] = true
+	l.warnedMu.Unlock()
+
+	warningHandlerMu.RLock()
+	defer warningHandlerMu.RUnlock()
+	warningHandler(message)
+}
+
+// addPolicyAPIVersions registers every served version of the admissionregistration API
+// Policies and bindings of older versions are converted to v1 after decoding
+func addPolicyAPIVersions(scheme *runtime.Scheme) error {
+	for _, addToScheme := range []func(*runtime.Scheme) error{
+		admissionregistrationv1.AddToScheme,
+		admissionregistrationv1beta1.AddToScheme,
+		admissionregistrationv1alpha1.AddToScheme,
+	} {
+		if err := addToScheme(scheme); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// decodeAdmissionRegistration decodes an admissionregistration object of any served version
+// Fields unknown to the decoded version are reported as warnings instead of being dropped silently
+func (l *LocalResourceLoader) decodeAdmissionRegistration(data []byte, source string, kind string) (runtime.Object, error) {
+	obj, gvk, err := l.strictCodecs.UniversalDeserializer().Decode(data, nil, nil)
+	if err != nil {
+		if obj == nil || !runtime.IsStrictDecodingError(err) {
+			return nil, fmt.Errorf("failed to decode YAML: %w", err)
+		}
+		l.warn(fmt.Sprintf("%s %s in %s: %s", gvk.Kind, objectName(obj), source, err.Error()))
+	}
+
+	if gvk.Kind == kind && gvk.Version != admissionregistrationv1.SchemeGroupVersion.Version {
+		if message := deprecationWarning(obj, gvk); message != "" {
+			l.warn(fmt.Sprintf("%s %s in %s: %s", gvk.Kind, objectName(obj), source, message))
+		}
+	}
+
+	return obj, nil
+}
+
+// deprecationWarning returns the warning the apiserver sends for a deprecated API version
+func deprecationWarning(obj runtime.Object, gvk *schema.GroupVersionKind) string {
+	obj.GetObjectKind().SetGroupVersionKind(*gvk)
+	message := deprecation.WarningMessage(obj)
+	if message != "" && !strings.Contains(message, "; use ") {
+		message += fmt.Sprintf("; use %s %s", admissionregistrationv1.SchemeGroupVersion.String(), gvk.Kind)
+	}
+	return message
+}
+
+// objectName returns the quoted name of a decoded object
+func objectName(obj runtime.Object) string {
+	if named, ok := obj.(interface{ GetName() string }); ok && named.GetName() != "" {
+		return fmt.Sprintf("'%s'", named.GetName())
+	}
+	return "<unnamed>"
+}
+
+// convertPolicy converts a ValidatingAdmissionPolicy of any served version to v1
+// It returns nil for other objects
+func convertPolicy(obj runtime.Object) (*admissionregistrationv1.ValidatingAdmissionPolicy, error) {
+	switch typed := obj.(type) {
+	case *admissionregistrationv1.ValidatingAdmissionPolicy:
+		return typed, nil
+	case *admissionregistrationv1beta1.ValidatingAdmissionPolicy, *admissionregistrationv1alpha1.ValidatingAdmissionPolicy:
+		policy := &admissionregistrationv1.ValidatingAdmissionPolicy{}
+		if err := convertToV1(obj, policy, "ValidatingAdmissionPolicy"); err != nil {
+			return nil, fmt.Errorf("failed to convert ValidatingAdmissionPolicy to v1: %w", err)
+		}
+		return policy, nil
+	}
+	return nil, nil
+}
+
+// convertPolicyBinding converts a ValidatingAdmissionPolicyBinding of any served version to v1
+// It returns nil for other objects
+func convertPolicyBinding(obj runtime.Object) (*admissionregistrationv1.ValidatingAdmissionPolicyBinding, error) {
+	switch typed := obj.(type) {
+	case *admissionregistrationv1.ValidatingAdmissionPolicyBinding:
+		return typed, nil
+	case *admissionregistrationv1beta1.ValidatingAdmissionPolicyBinding, *admissionregistrationv1alpha1.ValidatingAdmissionPolicyBinding:
+		binding := &admissionregistrationv1.ValidatingAdmissionPolicyBinding{}
+		if err := convertToV1(obj, binding, "ValidatingAdmissionPolicyBinding"); err != nil {
+			return nil, fmt.Errorf("failed to convert ValidatingAdmissionPolicyBinding to v1: %w", err)
+		}
+		// v1alpha1 bindings written for Kubernetes 1.26 predate validationActions and always deny
+		if _, ok := obj.(*admissionregistrationv1alpha1.ValidatingAdmissionPolicyBinding); ok && len(binding.Spec.ValidationActions) == 0 {
+			binding.Spec.ValidationActions = []admissionregistrationv1.ValidationAction{admissionregistrationv1.Deny}
+		}
+		return binding, nil
+	}
+	return nil, nil
+}
+
+// convertToV1 converts an object of an older admissionregistration version to its v1 counterpart
+// The policy and binding types have the same fields in every served version,
+// so the JSON representation is converted without loss
+func convertToV1(in runtime.Object, out runtime.Object, kind string) error {
+	data, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return err
+	}
+
+	out.GetObjectKind().SetGroupVersionKind(admissionregistrationv1.SchemeGroupVersion.WithKind(kind))
+	return nil
+}
@@ -0,0 +1,323 @@
+// Package policyreport builds wgpolicyk8s.io/v1alpha2 PolicyReport and ClusterPolicyReport objects
+// from check results, as read by Policy Reporter and other tools of the Kubernetes Policy WG
+package policyreport
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
+
+	"github.com/yashirook/kube-vap-test/internal/engine/waiver"
+	"github.com/yashirook/kube-vap-test/internal/source"
+	kaptestv1 "github.com/yashirook/kube-vap-test/pkg/apis/admission/v1"
+)
+
+const (
+	// APIVersion is the API version of the reports
+	APIVersion = "wgpolicyk8s.io/v1alpha2"
+	// ReportName is the name of the reports, one per namespace and one for cluster-scoped objects
+	ReportName = "kube-vap-test"
+	// Source is the source of the report results
+	Source = "kube-vap-test"
+	// SeverityAnnotation is the policy annotation setting the severity of its results
+	// (critical, high, medium, low, info)
+	SeverityAnnotation = "kube-vap-test/severity"
+	// DefaultSeverity is the severity of the results of policies without the annotation
+	DefaultSeverity = "medium"
+	// ManagedByLabel marks the reports written by kube-vap-test
+	ManagedByLabel = "app.kubernetes.io/managed-by"
+)
+
+// Result values of report entries
+const (
+	ResultPass  = "pass"
+	ResultFail  = "fail"
+	ResultError = "error"
+	ResultSkip  = "skip"
+)
+
+var (
+	// PolicyReportResource is the resource of namespaced reports
+	PolicyReportResource = schema.GroupVersionResource{Group: "wgpolicyk8s.io", Version: "v1alpha2", Resource: "policyreports"}
+	// ClusterPolicyReportResource is the resource of reports for cluster-scoped objects
+	ClusterPolicyReportResource = schema.GroupVersionResource{Group: "wgpolicyk8s.io", Version: "v1alpha2", Resource: "clusterpolicyreports"}
+)
+
+// Report is a PolicyReport, or a ClusterPolicyReport when it has no namespace
+type Report struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Summary Summary  `json:"summary"`
+	Results []Result `json:"results,omitempty"`
+}
+
+// Summary counts the results of a report by result value
+type Summary struct {
+	Pass  int `json:"pass"`
+	Fail  int `json:"fail"`
+	Warn  int `json:"warn"`
+	Error int `json:"error"`
+	Skip  int `json:"skip"`
+}
+
+// Result is the result of a policy validation for a resource
+type Result struct {
+	Source     string                   `json:"source"`
+	Policy     string                   `json:"policy"`
+	Rule       string                   `json:"rule,omitempty"`
+	Severity   string                   `json:"severity,omitempty"`
+	Timestamp  metav1.Timestamp         `json:"timestamp"`
+	Result     string                   `json:"result"`
+	Scored     bool                     `json:"scored"`
+	Message    string                   `json:"message,omitempty"`
+	Resources  []corev1.ObjectReference `json:"resources,omitempty"`
+	Properties map[string]string        `json:"properties,omitempty"`
+}
+
+// Build returns the reports of check results, a ClusterPolicyReport for cluster-scoped objects
+// followed by a PolicyReport per namespace
+// Every validation of the policies evaluated for an object gets a result entry
+// Waived violations are skipped, with the waiver in the properties of the entry
+func Build(status *kaptestv1.ValidatingAdmissionPolicyTestStatus, policies []*admissionregistrationv1.ValidatingAdmissionPolicy, now time.Time) []*Report {
+	builder := NewBuilder(policies, now)
+	for i := range status.Results {
+		builder.Add(&status.Results[i])
+	}
+	return builder.Reports()
+}
+
+// Builder builds reports one check result at a time, as Build does, so that results need not be
+// kept until the check ends
+type Builder struct {
+	policiesByName map[string]*admissionregistrationv1.ValidatingAdmissionPolicy
+	timestamp      metav1.Timestamp
+	reports        map[string]*Report
+}
+
+// NewBuilder creates a Builder of reports on the policies, with results timestamped now
+func NewBuilder(policies []*admissionregistrationv1.ValidatingAdmissionPolicy, now time.Time) *Builder {
+	policiesByName := make(map[string]*admissionregistrationv1.ValidatingAdmissionPolicy)
+	for _, policy := range policies {
+		policiesByName[policy.Name] = policy
+	}
+	return &Builder{
+		policiesByName: policiesByName,
+		timestamp:      metav1.Timestamp{Seconds: now.Unix()},
+		reports:        make(map[string]*Report),
+	}
+}
+
+// Add adds the entries of a check result to the report of its namespace
+func (b *Builder) Add(result *kaptestv1.TestResult) {
+	namespace := ""
+	if result.Resource != nil {
+		namespace = result.Resource.Namespace
+	}
+	report, ok := b.reports[namespace]
+	if !ok {
+		report = newReport(namespace)
+		b.reports[namespace] = report
+	}
+
+	for _, policyResult := range result.PolicyResults {
+		for _, entry := range policyEntries(policyResult, b.policiesByName[policyResult.PolicyName]) {
+			entry.Source = Source
+			entry.Timestamp = b.timestamp
+			entry.Scored = true
+			entry.Resources = resourceReferences(*result)
+			if result.Source != nil && result.Source.File != "" {
+				entry.Properties = map[string]string{"manifest": source.Format(*result.Source)}
+			}
+			if len(result.Patches) > 0 {
+				if entry.Properties == nil {
+					entry.Properties = make(map[string]string)
+				}
+				entry.Properties["patches"] = patchList(result.Patches)
+			}
+			if policyResult.Waiver != nil && entry.Result != ResultPass {
+				if entry.Properties == nil {
+					entry.Properties = make(map[string]string)
+				}
+				entry.Properties["waiver"] = policyResult.Waiver.Name
+				entry.Properties["waiverExpires"] = policyResult.Waiver.Expires
+				if policyResult.Waiver.Ticket != "" {
+					entry.Properties["waiverTicket"] = policyResult.Waiver.Ticket
+				}
+				if waiver.Waived(policyResult) {
+					entry.Result = ResultSkip
+				}
+			}
+			report.add(entry)
+		}
+	}
+}
+
+// Reports returns the reports of the results added so far, a ClusterPolicyReport for
+// cluster-scoped objects followed by a PolicyReport per namespace
+func (b *Builder) Reports() []*Report {
+	namespaces := make([]string, 0, len(b.reports))
+	for namespace := range b.reports {
+		namespaces = append(namespaces, namespace)
+	}
+	sort.Strings(namespaces)
+
+	sorted := make([]*Report, 0, len(b.reports))
+	for _, namespace := range namespaces {
+		sorted = append(sorted, b.reports[namespace])
+	}
+	return sorted
+}
+
+// newReport creates the report of a namespace, or the cluster report for an empty namespace
+func newReport(namespace string) *Report {
+	kind := "PolicyReport"
+	if namespace == "" {
+		kind = "ClusterPolicyReport"
+	}
+	return &Report{
+		TypeMeta: metav1.TypeMeta{APIVersion: APIVersion, Kind: kind},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      ReportName,
+			Namespace: namespace,
+			Labels:    map[string]string{ManagedByLabel: Source},
+		},
+	}
+}
+
+// add adds a result to the report and its summary
+func (r *Report) add(result Result) {
+	switch result.Result {
+	case ResultPass:
+		r.Summary.Pass++
+	case ResultFail:
+		r.Summary.Fail++
+	case ResultError:
+		r.Summary.Error++
+	case ResultSkip:
+		r.Summary.Skip++
+	}
+	r.Results = append(r.Results, result)
+}
+
+// policyEntries returns the results of the validations of a policy
+// Validations without a violation pass. Policies that could not be evaluated, and results without
+// violation details such as those of the upstream engine, have a single entry for the policy
+func policyEntries(policyResult kaptestv1.PolicyResult, policy *admissionregistrationv1.ValidatingAdmissionPolicy) []Result {
+	severity := DefaultSeverity
+	if policy != nil && policy.Annotations[SeverityAnnotation] != "" {
+		severity = policy.Annotations[SeverityAnnotation]
+	}
+
+	violations := make(map[string]kaptestv1.PolicyViolation)
+	for _, violation := range policyResult.Violations {
+		if !strings.HasPrefix(violation.Field, "spec.validations[") {
+			// Variables or matchConditions failed, so no validation was evaluated
+			return []Result{{Policy: policyResult.PolicyName, Rule: rule(violation.Field), Severity: severity, Result: ResultError, Message: violation.Message}}
+		}
+		violations[violation.Field] = violation
+	}
+
+	if policy == nil || (!policyResult.Allowed && len(violations) == 0) {
+		result := ResultPass
+		if !policyResult.Allowed {
+			result = ResultFail
+		}
+		return []Result{{Policy: policyResult.PolicyName, Severity: severity, Result: result, Message: policyResult.Message}}
+	}
+
+	var entries []Result
+	for i, validation := range policy.Spec.Validations {
+		field := fmt.Sprintf("spec.validations[%d]", i)
+		entry := Result{Policy: policy.Name, Rule: rule(field), Severity: severity, Result: ResultPass, Message: validation.Message}
+		if violation, ok := violations[field]; ok {
+			entry.Result = ResultFail
+			if violation.EvaluationError {
+				entry.Result = ResultError
+			}
+			entry.Message = violation.Message
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// rule returns the rule name of a policy field, e.g. validations[0]
+func rule(field string) string {
+	return strings.TrimPrefix(field, "spec.")
+}
+
+// resourceReferences returns the reference of the object of a result
+func resourceReferences(result kaptestv1.TestResult) []corev1.ObjectReference {
+	if result.Resource == nil {
+		return nil
+	}
+	return []corev1.ObjectReference{{
+		APIVersion: result.Resource.APIVersion,
+		Kind:       result.Resource.Kind,
+		Namespace:  result.Resource.Namespace,
+		Name:       result.Resource.Name,
+		UID:        types.UID(result.Resource.UID),
+	}}
+}
+
+// patchList returns the Kustomize patches of a result as a comma separated list of file:line
+func patchList(patches []kaptestv1.SourceLocation) string {
+	formatted := make([]string, len(patches))
+	for i, patch := range patches {
+		formatted[i] = source.Format(patch)
+	}
+	return strings.Join(formatted, ",")
+}
+
+// Apply creates the reports in a cluster, or replaces the reports written by an earlier run
+func Apply(ctx context.Context, client dynamic.Interface, reports []*Report) error {
+	for _, report := range reports {
+		content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(report)
+		if err != nil {
+			return fmt.Errorf("failed to convert %s %s: %w", report.Kind, reportName(report), err)
+		}
+		object := &unstructured.Unstructured{Object: content}
+
+		var resource dynamic.ResourceInterface = client.Resource(ClusterPolicyReportResource)
+		if report.Namespace != "" {
+			resource = client.Resource(PolicyReportResource).Namespace(report.Namespace)
+		}
+
+		existing, err := resource.Get(ctx, report.Name, metav1.GetOptions{})
+		switch {
+		case apierrors.IsNotFound(err):
+			_, err = resource.Create(ctx, object, metav1.CreateOptions{})
+		case err == nil:
+			if existing.GetLabels()[ManagedByLabel] != Source {
+				return fmt.Errorf("%s %s exists and was not written by %s", report.Kind, reportName(report), Source)
+			}
+			object.SetResourceVersion(existing.GetResourceVersion())
+			_, err = resource.Update(ctx, object, metav1.UpdateOptions{})
+		}
+		if err != nil {
+			return fmt.Errorf("failed to apply %s %s: %w", report.Kind, reportName(report), err)
+		}
+	}
+	return nil
+}
+
+// reportName returns the namespace and name of a report
+func reportName(report *Report) string {
+	if report.Namespace == "" {
+		return report.Name
+	}
+	return report.Namespace + "/" + report.Name
+}
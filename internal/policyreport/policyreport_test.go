@@ -0,0 +1,224 @@
+package policyreport
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+
+	kaptestv1 "github.com/yashirook/kube-vap-test/pkg/apis/admission/v1"
+)
+
+var now = time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+
+func testPolicies() []*admissionregistrationv1.ValidatingAdmissionPolicy {
+	return []*admissionregistrationv1.ValidatingAdmissionPolicy{
+		{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "no-latest-tag",
+				Annotations: map[string]string{SeverityAnnotation: "high"},
+			},
+			Spec: admissionregistrationv1.ValidatingAdmissionPolicySpec{
+				Validations: []admissionregistrationv1.Validation{
+					{Expression: "has(object.spec.containers)", Message: "containers are required"},
+					{Expression: "!object.spec.containers.exists(c, c.image.endsWith(':latest'))", Message: "latest tag is not allowed"},
+				},
+			},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "label-required"},
+			Spec: admissionregistrationv1.ValidatingAdmissionPolicySpec{
+				Validations: []admissionregistrationv1.Validation{
+					{Expression: "has(object.metadata.labels.team)", Message: "team label is required"},
+				},
+			},
+		},
+	}
+}
+
+func testStatus() *kaptestv1.ValidatingAdmissionPolicyTestStatus {
+	return &kaptestv1.ValidatingAdmissionPolicyTestStatus{
+		Results: []kaptestv1.TestResult{
+			{
+				Name:     "pod.v1/web",
+				Resource: &kaptestv1.ResourceReference{APIVersion: "v1", Kind: "Pod", Namespace: "apps", Name: "web"},
+				Source:   &kaptestv1.SourceLocation{File: "manifests/pods.yaml", Line: 12},
+				PolicyResults: []kaptestv1.PolicyResult{
+					{
+						PolicyName: "no-latest-tag",
+						Allowed:    false,
+						Violations: []kaptestv1.PolicyViolation{
+							{Field: "spec.validations[1]", Reason: "Invalid", Message: "latest tag is not allowed"},
+						},
+					},
+					{
+						PolicyName: "label-required",
+						Allowed:    false,
+						Violations: []kaptestv1.PolicyViolation{
+							{Field: "spec.validations[0]", Message: "no such key: team", EvaluationError: true},
+						},
+					},
+				},
+			},
+			{
+				Name:     "namespace.v1/apps",
+				Resource: &kaptestv1.ResourceReference{APIVersion: "v1", Kind: "Namespace", Name: "apps", UID: "1234"},
+				PolicyResults: []kaptestv1.PolicyResult{
+					{PolicyName: "label-required", Allowed: true},
+				},
+			},
+			{
+				Name:     "pod.v1/api",
+				Resource: &kaptestv1.ResourceReference{APIVersion: "v1", Kind: "Pod", Namespace: "apps", Name: "api"},
+				PolicyResults: []kaptestv1.PolicyResult{
+					{
+						PolicyName: "no-latest-tag",
+						Allowed:    false,
+						Violations: []kaptestv1.PolicyViolation{
+							{Field: "spec.variables[0].expression", Message: "no such key: spec", EvaluationError: true},
+						},
+					},
+					// Results of the upstream engine have no violation details
+					{PolicyName: "label-required", Allowed: false, Message: "team label is required"},
+				},
+			},
+		},
+	}
+}
+
+func TestBuild(t *testing.T) {
+	reports := Build(testStatus(), testPolicies(), now)
+	require.Len(t, reports, 2)
+
+	// Cluster-scoped objects are reported in a ClusterPolicyReport first
+	cluster := reports[0]
+	assert.Equal(t, "ClusterPolicyReport", cluster.Kind)
+	assert.Equal(t, APIVersion, cluster.APIVersion)
+	assert.Equal(t, ReportName, cluster.Name)
+	assert.Empty(t, cluster.Namespace)
+	assert.Equal(t, Summary{Pass: 1}, cluster.Summary)
+	require.Len(t, cluster.Results, 1)
+	assert.Equal(t, "validations[0]", cluster.Results[0].Rule)
+	assert.Equal(t, DefaultSeverity, cluster.Results[0].Severity)
+	assert.Equal(t, "1234", string(cluster.Results[0].Resources[0].UID))
+
+	namespaced := reports[1]
+	assert.Equal(t, "PolicyReport", namespaced.Kind)
+	assert.Equal(t, "apps", namespaced.Namespace)
+	assert.Equal(t, Source, namespaced.Labels[ManagedByLabel])
+	assert.Equal(t, Summary{Pass: 1, Fail: 2, Error: 2}, namespaced.Summary)
+	require.Len(t, namespaced.Results, 5)
+
+	tests := []struct {
+		policy   string
+		rule     string
+		severity string
+		result   string
+		message  string
+		resource string
+	}{
+		{policy: "no-latest-tag", rule: "validations[0]", severity: "high", result: ResultPass, message: "containers are required", resource: "web"},
+		{policy: "no-latest-tag", rule: "validations[1]", severity: "high", result: ResultFail, message: "latest tag is not allowed", resource: "web"},
+		{policy: "label-required", rule: "validations[0]", severity: DefaultSeverity, result: ResultError, message: "no such key: team", resource: "web"},
+		{policy: "no-latest-tag", rule: "variables[0].expression", severity: "high", result: ResultError, message: "no such key: spec", resource: "api"},
+		{policy: "label-required", severity: DefaultSeverity, result: ResultFail, message: "team label is required", resource: "api"},
+	}
+	for i, tt := range tests {
+		result := namespaced.Results[i]
+		assert.Equal(t, tt.policy, result.Policy, "result %d", i)
+		assert.Equal(t, tt.rule, result.Rule, "result %d", i)
+		assert.Equal(t, tt.severity, result.Severity, "result %d", i)
+		assert.Equal(t, tt.result, result.Result, "result %d", i)
+		assert.Equal(t, tt.message, result.Message, "result %d", i)
+		assert.Equal(t, Source, result.Source, "result %d", i)
+		assert.Equal(t, now.Unix(), result.Timestamp.Seconds, "result %d", i)
+		require.Len(t, result.Resources, 1, "result %d", i)
+		assert.Equal(t, tt.resource, result.Resources[0].Name, "result %d", i)
+		assert.Equal(t, "Pod", result.Resources[0].Kind, "result %d", i)
+	}
+	assert.Equal(t, map[string]string{"manifest": "manifests/pods.yaml:12"}, namespaced.Results[0].Properties)
+	assert.Nil(t, namespaced.Results[3].Properties)
+}
+
+func TestBuildWaived(t *testing.T) {
+	status := testStatus()
+	status.Results[0].PolicyResults[0].Waiver = &kaptestv1.WaiverReference{Name: "latest-tags", Expires: "2027-03-31", Ticket: "OPS-1234"}
+	status.Results[2].PolicyResults[1].Waiver = &kaptestv1.WaiverReference{Name: "team-labels", Expires: "2025-01-31", Expired: true}
+
+	reports := Build(status, testPolicies(), now)
+	namespaced := reports[1]
+	// Waived violations are skipped, and violations of expired waivers still fail
+	assert.Equal(t, Summary{Pass: 1, Fail: 1, Error: 2, Skip: 1}, namespaced.Summary)
+	assert.Equal(t, ResultPass, namespaced.Results[0].Result)
+	assert.Equal(t, ResultSkip, namespaced.Results[1].Result)
+	assert.Equal(t, map[string]string{
+		"manifest":      "manifests/pods.yaml:12",
+		"waiver":        "latest-tags",
+		"waiverExpires": "2027-03-31",
+		"waiverTicket":  "OPS-1234",
+	}, namespaced.Results[1].Properties)
+	assert.Equal(t, ResultFail, namespaced.Results[4].Result)
+	assert.Equal(t, map[string]string{"waiver": "team-labels", "waiverExpires": "2025-01-31"}, namespaced.Results[4].Properties)
+}
+
+func TestBuildPatches(t *testing.T) {
+	status := testStatus()
+	status.Results[0].Patches = []kaptestv1.SourceLocation{{File: "overlays/prod/image.yaml", Line: 1}, {File: "overlays/prod/kustomization.yaml"}}
+
+	reports := Build(status, testPolicies(), now)
+	assert.Equal(t, map[string]string{
+		"manifest": "manifests/pods.yaml:12",
+		"patches":  "overlays/prod/image.yaml:1,overlays/prod/kustomization.yaml",
+	}, reports[1].Results[1].Properties)
+}
+
+func newFakeClient(objects ...runtime.Object) *dynamicfake.FakeDynamicClient {
+	return dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		PolicyReportResource:        "PolicyReportList",
+		ClusterPolicyReportResource: "ClusterPolicyReportList",
+	}, objects...)
+}
+
+func TestApply(t *testing.T) {
+	ctx := context.Background()
+	client := newFakeClient()
+	reports := Build(testStatus(), testPolicies(), now)
+
+	// Reports are created, then updated by later runs
+	require.NoError(t, Apply(ctx, client, reports))
+	require.NoError(t, Apply(ctx, client, reports))
+
+	object, err := client.Resource(PolicyReportResource).Namespace("apps").Get(ctx, ReportName, metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "PolicyReport", object.GetKind())
+	fail, _, err := unstructured.NestedInt64(object.Object, "summary", "fail")
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), fail)
+	results, _, err := unstructured.NestedSlice(object.Object, "results")
+	require.NoError(t, err)
+	assert.Len(t, results, 5)
+
+	_, err = client.Resource(ClusterPolicyReportResource).Get(ctx, ReportName, metav1.GetOptions{})
+	assert.NoError(t, err)
+}
+
+func TestApplyUnmanagedReport(t *testing.T) {
+	existing := &unstructured.Unstructured{}
+	existing.SetAPIVersion(APIVersion)
+	existing.SetKind("ClusterPolicyReport")
+	existing.SetName(ReportName)
+	client := newFakeClient(existing)
+
+	// Reports written by other tools are not replaced
+	err := Apply(context.Background(), client, Build(testStatus(), testPolicies(), now))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "was not written by kube-vap-test")
+}
@@ -0,0 +1,260 @@
+package reporter
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strings"
+
+	"github.com/yashirook/kube-vap-test/internal/baseline"
+	"github.com/yashirook/kube-vap-test/internal/engine/waiver"
+	kaptestv1 "github.com/yashirook/kube-vap-test/pkg/apis/admission/v1"
+)
+
+// defaultSuiteName is the name of the test suite of results without a test or manifest file
+const defaultSuiteName = "kube-vap-test"
+
+// junitTestSuites is the root element of a JUnit XML report
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Errors   int              `xml:"errors,attr"`
+	Skipped  int              `xml:"skipped,attr,omitempty"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+// junitTestSuite is the test suite of a test definition or manifest file
+type junitTestSuite struct {
+	Name       string          `xml:"name,attr"`
+	Tests      int             `xml:"tests,attr"`
+	Failures   int             `xml:"failures,attr"`
+	Errors     int             `xml:"errors,attr"`
+	Skipped    int             `xml:"skipped,attr,omitempty"`
+	Properties []junitProperty `xml:"properties>property,omitempty"`
+	TestCases  []junitTestCase `xml:"testcase"`
+}
+
+// junitProperty is a property of a test suite
+type junitProperty struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+// junitTestCase is the result of a single test case
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	File      string        `xml:"file,attr,omitempty"`
+	Line      int           `xml:"line,attr,omitempty"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	Error     *junitFailure `xml:"error,omitempty"`
+	Skipped   *junitSkipped `xml:"skipped,omitempty"`
+	SystemOut *junitOutput  `xml:"system-out,omitempty"`
+}
+
+// junitSkipped marks a test case whose violations are waived
+type junitSkipped struct {
+	Message string `xml:"message,attr"`
+}
+
+// junitOutput is text written as CDATA, keeping line breaks readable
+type junitOutput struct {
+	Content string `xml:",cdata"`
+}
+
+// junitFailure describes why a test case failed, written as a failure or an error element
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Content string `xml:",cdata"`
+}
+
+// JUnitReporter outputs reports in JUnit XML format
+// Results are buffered and written as a single document by Flush, with one test suite
+// per test definition file, or per manifest file for the check command
+type JUnitReporter struct {
+	baseReporter
+	pendingResults
+	suites []junitTestSuite
+}
+
+// Report adds test results to the report
+func (r *JUnitReporter) Report(results *kaptestv1.ValidatingAdmissionPolicyTestStatus) error {
+	results = r.take(results)
+	for _, result := range results.Results {
+		name := results.TestFile
+		if name == "" && result.Source != nil {
+			name = result.Source.File
+		}
+		if name == "" {
+			name = defaultSuiteName
+		}
+
+		suite := r.suite(name, results.Engine)
+		suite.Tests++
+		testCase := junitTestCase{
+			Name:      result.Name,
+			ClassName: name,
+		}
+		if output := junitPolicyOutput(result.PolicyResults); output != "" {
+			testCase.SystemOut = &junitOutput{Content: output}
+		}
+		if result.Source != nil {
+			testCase.File = result.Source.File
+			testCase.Line = result.Source.Line
+		}
+		// Waived violations are skipped, and violations accepted by the baseline do not fail
+		if result.Waived {
+			suite.Skipped++
+			testCase.Skipped = &junitSkipped{Message: "WAIVED: " + strings.Join(waiverNotes(result), "; ")}
+		} else if !result.Success && !baseline.Known(result) {
+			// Policy expressions that do not compile or evaluate are errors rather than failures
+			if junitExpressionFailed(result) {
+				suite.Errors++
+				testCase.Error = junitTestError(result)
+			} else {
+				suite.Failures++
+				testCase.Failure = junitTestFailure(result)
+			}
+		}
+		suite.TestCases = append(suite.TestCases, testCase)
+	}
+	return nil
+}
+
+// suite returns the test suite of a name, creating it on first use
+func (r *JUnitReporter) suite(name, engine string) *junitTestSuite {
+	for i := range r.suites {
+		if r.suites[i].Name == name {
+			return &r.suites[i]
+		}
+	}
+	suite := junitTestSuite{Name: name}
+	if engine != "" {
+		suite.Properties = []junitProperty{{Name: "engine", Value: engine}}
+	}
+	r.suites = append(r.suites, suite)
+	return &r.suites[len(r.suites)-1]
+}
+
+// Flush writes the JUnit XML document of all results reported so far
+func (r *JUnitReporter) Flush() error {
+	report := junitTestSuites{Name: defaultSuiteName, Suites: r.suites}
+	for _, suite := range r.suites {
+		report.Tests += suite.Tests
+		report.Failures += suite.Failures
+		report.Errors += suite.Errors
+		report.Skipped += suite.Skipped
+	}
+
+	data, err := xml.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal results to JUnit XML: %w", err)
+	}
+
+	_, err = fmt.Fprintf(r.writer, "%s%s\n", xml.Header, data)
+	return err
+}
+
+// junitTestFailure returns the failure element of a failed test case,
+// carrying the details and the expected and actual responses
+func junitTestFailure(result kaptestv1.TestResult) *junitFailure {
+	failure := &junitFailure{Message: result.Details, Type: "AssertionFailure"}
+	if result.ActualResponse != nil && !result.ActualResponse.Allowed {
+		if result.ActualResponse.Reason != "" {
+			failure.Type = result.ActualResponse.Reason
+		}
+		if failure.Message == "" {
+			failure.Message = result.ActualResponse.Message
+		}
+	}
+
+	var content strings.Builder
+	if result.Details != "" {
+		fmt.Fprintf(&content, "%s\n", result.Details)
+	}
+	if expected := result.ExpectedResponse; expected != nil {
+		fmt.Fprintf(&content, "Expected: %s", verdict(expected.Allowed))
+		if expected.Reason != "" {
+			fmt.Fprintf(&content, ", reason: %s", expected.Reason)
+		}
+		if expected.Message != "" {
+			fmt.Fprintf(&content, ", message: %s", expected.Message)
+		}
+		if expected.MessageContains != "" {
+			fmt.Fprintf(&content, ", message contains: %s", expected.MessageContains)
+		}
+		content.WriteString("\n")
+	}
+	if actual := result.ActualResponse; actual != nil {
+		fmt.Fprintf(&content, "Actual: %s", verdict(actual.Allowed))
+		if actual.Reason != "" {
+			fmt.Fprintf(&content, ", reason: %s", actual.Reason)
+		}
+		if actual.Message != "" {
+			fmt.Fprintf(&content, ", message: %s", actual.Message)
+		}
+		content.WriteString("\n")
+	}
+	failure.Content = content.String()
+	return failure
+}
+
+// junitExpressionFailed reports whether a result failed on the policy expressions rather than on
+// the object: expressions do not compile, or every violation is an expression failing to evaluate
+func junitExpressionFailed(result kaptestv1.TestResult) bool {
+	if len(result.ExpressionErrors) > 0 {
+		return true
+	}
+	violations := 0
+	for _, policyResult := range result.PolicyResults {
+		for _, violation := range policyResult.Violations {
+			if !violation.EvaluationError {
+				return false
+			}
+			violations++
+		}
+	}
+	return violations > 0
+}
+
+// junitTestError returns the error element of a test case failed by the policy expressions,
+// carrying the expression errors next to the failure details
+func junitTestError(result kaptestv1.TestResult) *junitFailure {
+	testError := junitTestFailure(result)
+	testError.Type = "EvaluationError"
+	if len(result.ExpressionErrors) == 0 {
+		return testError
+	}
+
+	testError.Type = "ExpressionError"
+	var content strings.Builder
+	for _, expressionErr := range result.ExpressionErrors {
+		fmt.Fprintf(&content, "%s: %s: %s\n", expressionErr.Policy, expressionErr.Field, expressionErr.Message)
+	}
+	testError.Content = content.String() + testError.Content
+	return testError
+}
+
+// junitPolicyOutput returns the verdict of each policy, one per line
+func junitPolicyOutput(policyResults []kaptestv1.PolicyResult) string {
+	var output strings.Builder
+	for _, policyResult := range policyResults {
+		fmt.Fprintf(&output, "%s: %s", policyResult.PolicyName, verdict(policyResult.Allowed))
+		if policyResult.Reason != "" {
+			fmt.Fprintf(&output, " (%s)", policyResult.Reason)
+		}
+		if policyResult.Message != "" {
+			fmt.Fprintf(&output, ": %s", policyResult.Message)
+		}
+		if policyResult.Baselined {
+			output.WriteString(" [known violation in baseline]")
+		}
+		if !policyResult.Allowed && policyResult.Waiver != nil {
+			fmt.Fprintf(&output, " [%s]", waiver.Describe(policyResult.Waiver))
+		}
+		output.WriteString("\n")
+	}
+	return output.String()
+}
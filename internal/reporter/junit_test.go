@@ -0,0 +1,264 @@
+package reporter
+
+import (
+	"bytes"
+	"encoding/xml"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	kaptestv1 "github.com/yashirook/kube-vap-test/pkg/apis/admission/v1"
+)
+
+func TestJUnitReporter_Report(t *testing.T) {
+	buf := &bytes.Buffer{}
+	reporter := &JUnitReporter{
+		baseReporter: baseReporter{
+			writer:  buf,
+			verbose: false,
+		},
+	}
+
+	// Results of two test files are written as one document
+	require.NoError(t, reporter.Report(&kaptestv1.ValidatingAdmissionPolicyTestStatus{
+		TestFile: "tests/replicas.yaml",
+		Engine:   "native",
+		Results: []kaptestv1.TestResult{
+			{
+				Name:             "allowed",
+				Success:          true,
+				ActualResponse:   &kaptestv1.ResponseDetails{Allowed: true},
+				ExpectedResponse: &kaptestv1.ExpectedResult{Allowed: true},
+				PolicyResults: []kaptestv1.PolicyResult{
+					{PolicyName: "replica-limit", Allowed: true},
+				},
+			},
+			{
+				Name:    "denied",
+				Success: false,
+				Details: "expected result (allowed=true) and actual result (allowed=false) does not match",
+				ActualResponse: &kaptestv1.ResponseDetails{
+					Allowed: false,
+					Reason:  "Invalid",
+					Message: "too many <replicas>",
+				},
+				ExpectedResponse: &kaptestv1.ExpectedResult{Allowed: true},
+				PolicyResults: []kaptestv1.PolicyResult{
+					{PolicyName: "replica-limit", Allowed: false, Reason: "Invalid", Message: "too many <replicas>"},
+				},
+			},
+		},
+	}))
+	require.NoError(t, reporter.Report(&kaptestv1.ValidatingAdmissionPolicyTestStatus{
+		TestFile: "tests/labels.yaml",
+		Results: []kaptestv1.TestResult{
+			{Name: "labeled", Success: true, ActualResponse: &kaptestv1.ResponseDetails{Allowed: true}},
+		},
+	}))
+	assert.Empty(t, buf.String(), "Nothing is written before Flush")
+	require.NoError(t, Flush(reporter))
+
+	output := buf.String()
+	assert.True(t, strings.HasPrefix(output, xml.Header))
+
+	var report junitTestSuites
+	require.NoError(t, xml.Unmarshal(buf.Bytes(), &report))
+	assert.Equal(t, 3, report.Tests)
+	assert.Equal(t, 1, report.Failures)
+	require.Len(t, report.Suites, 2)
+
+	suite := report.Suites[0]
+	assert.Equal(t, "tests/replicas.yaml", suite.Name)
+	assert.Equal(t, 2, suite.Tests)
+	assert.Equal(t, 1, suite.Failures)
+	assert.Equal(t, []junitProperty{{Name: "engine", Value: "native"}}, suite.Properties)
+	require.Len(t, suite.TestCases, 2)
+	assert.Nil(t, suite.TestCases[0].Failure)
+	assert.Equal(t, "replica-limit: allowed\n", suite.TestCases[0].SystemOut.Content)
+
+	failed := suite.TestCases[1]
+	assert.Equal(t, "denied", failed.Name)
+	assert.Equal(t, "tests/replicas.yaml", failed.ClassName)
+	require.NotNil(t, failed.Failure)
+	assert.Equal(t, "Invalid", failed.Failure.Type)
+	assert.Contains(t, failed.Failure.Message, "does not match")
+	assert.Contains(t, failed.Failure.Content, "Expected: allowed\n")
+	assert.Contains(t, failed.Failure.Content, "Actual: denied, reason: Invalid, message: too many <replicas>\n")
+	assert.Equal(t, "replica-limit: denied (Invalid): too many <replicas>\n", failed.SystemOut.Content)
+
+	assert.Equal(t, "tests/labels.yaml", report.Suites[1].Name)
+	assert.Equal(t, 1, report.Suites[1].Tests)
+}
+
+func TestJUnitReporter_ManifestSuites(t *testing.T) {
+	buf := &bytes.Buffer{}
+	reporter := &JUnitReporter{baseReporter: baseReporter{writer: buf}}
+
+	// check results are grouped by manifest file
+	require.NoError(t, reporter.Report(&kaptestv1.ValidatingAdmissionPolicyTestStatus{
+		Results: []kaptestv1.TestResult{
+			{Name: "pod.v1/a", Success: true, Source: &kaptestv1.SourceLocation{File: "pods.yaml", Line: 1}},
+			{Name: "deployment.apps/v1/b", Success: true, Source: &kaptestv1.SourceLocation{File: "deployments.yaml", Line: 1}},
+			{Name: "pod.v1/c", Success: true, Source: &kaptestv1.SourceLocation{File: "pods.yaml", Line: 12}},
+			{Name: "pod.v1/d", Success: true},
+		},
+	}))
+	require.NoError(t, reporter.Flush())
+
+	var report junitTestSuites
+	require.NoError(t, xml.Unmarshal(buf.Bytes(), &report))
+	require.Len(t, report.Suites, 3)
+	assert.Equal(t, "pods.yaml", report.Suites[0].Name)
+	assert.Equal(t, 2, report.Suites[0].Tests)
+	assert.Equal(t, 12, report.Suites[0].TestCases[1].Line)
+	assert.Equal(t, "deployments.yaml", report.Suites[1].Name)
+	assert.Equal(t, defaultSuiteName, report.Suites[2].Name)
+}
+
+func TestJUnitReporter_Baseline(t *testing.T) {
+	buf := &bytes.Buffer{}
+	reporter := &JUnitReporter{baseReporter: baseReporter{writer: buf}}
+
+	// Violations accepted by the baseline do not fail
+	require.NoError(t, reporter.Report(&kaptestv1.ValidatingAdmissionPolicyTestStatus{
+		Results: []kaptestv1.TestResult{
+			{
+				Name:           "pod.v1/known",
+				Success:        false,
+				ActualResponse: &kaptestv1.ResponseDetails{Allowed: false},
+				PolicyResults:  []kaptestv1.PolicyResult{{PolicyName: "no-latest-tag", Allowed: false, Baselined: true}},
+			},
+			{
+				Name:           "pod.v1/new",
+				Success:        false,
+				ActualResponse: &kaptestv1.ResponseDetails{Allowed: false},
+				PolicyResults: []kaptestv1.PolicyResult{
+					{PolicyName: "no-latest-tag", Allowed: false, Baselined: true},
+					{PolicyName: "replica-limit", Allowed: false},
+				},
+			},
+		},
+		Baseline: &kaptestv1.BaselineReport{File: "baseline.json", New: 1, Known: 2},
+	}))
+	require.NoError(t, reporter.Flush())
+
+	var report junitTestSuites
+	require.NoError(t, xml.Unmarshal(buf.Bytes(), &report))
+	assert.Equal(t, 1, report.Failures)
+	known := report.Suites[0].TestCases[0]
+	assert.Nil(t, known.Failure)
+	assert.Equal(t, "no-latest-tag: denied [known violation in baseline]\n", known.SystemOut.Content)
+	assert.NotNil(t, report.Suites[0].TestCases[1].Failure)
+}
+
+func TestJUnitReporter_Waived(t *testing.T) {
+	buf := &bytes.Buffer{}
+	reporter := &JUnitReporter{baseReporter: baseReporter{writer: buf}}
+
+	// Waived violations are skipped rather than dropped, and expired waivers fail
+	require.NoError(t, reporter.Report(&kaptestv1.ValidatingAdmissionPolicyTestStatus{
+		Results: []kaptestv1.TestResult{
+			{
+				Name:           "deployment.apps/v1/api",
+				Success:        true,
+				Waived:         true,
+				ActualResponse: &kaptestv1.ResponseDetails{Allowed: true},
+				PolicyResults: []kaptestv1.PolicyResult{{
+					PolicyName: "replica-limit",
+					Allowed:    false,
+					Waiver:     &kaptestv1.WaiverReference{Name: "legacy-apps", Expires: "2027-03-31"},
+				}},
+			},
+			{
+				Name:           "pod.v1/web",
+				Success:        false,
+				ActualResponse: &kaptestv1.ResponseDetails{Allowed: false},
+				PolicyResults: []kaptestv1.PolicyResult{{
+					PolicyName: "no-latest-tag",
+					Allowed:    false,
+					Waiver:     &kaptestv1.WaiverReference{Name: "latest-tags", Expires: "2026-01-31", Expired: true},
+				}},
+			},
+		},
+	}))
+	require.NoError(t, reporter.Flush())
+
+	var report junitTestSuites
+	require.NoError(t, xml.Unmarshal(buf.Bytes(), &report))
+	assert.Equal(t, 1, report.Skipped)
+	assert.Equal(t, 1, report.Failures)
+	waived := report.Suites[0].TestCases[0]
+	require.NotNil(t, waived.Skipped)
+	assert.Equal(t, "WAIVED: policy 'replica-limit' waived by 'legacy-apps' until 2027-03-31", waived.Skipped.Message)
+	assert.Nil(t, waived.Failure)
+	expired := report.Suites[0].TestCases[1]
+	assert.NotNil(t, expired.Failure)
+	assert.Equal(t, "no-latest-tag: denied [waiver 'latest-tags' expired on 2026-01-31]\n", expired.SystemOut.Content)
+}
+
+func TestJUnitReporter_Errors(t *testing.T) {
+	buf := &bytes.Buffer{}
+	reporter := &JUnitReporter{baseReporter: baseReporter{writer: buf}}
+
+	// Expressions that do not compile or evaluate are errors, while denials are failures
+	require.NoError(t, reporter.Report(&kaptestv1.ValidatingAdmissionPolicyTestStatus{
+		Results: []kaptestv1.TestResult{
+			{
+				Name:           "pod.v1/compile",
+				Success:        false,
+				ActualResponse: &kaptestv1.ResponseDetails{Allowed: false},
+				ExpressionErrors: []kaptestv1.ExpressionError{
+					{Policy: "label-required", Field: "spec.validations[0].expression", Message: "undeclared reference to 'obj'"},
+				},
+			},
+			{
+				Name:           "pod.v1/evaluate",
+				Success:        false,
+				ActualResponse: &kaptestv1.ResponseDetails{Allowed: false, Reason: "Invalid", Message: "no such key: team"},
+				PolicyResults: []kaptestv1.PolicyResult{{
+					PolicyName: "label-required",
+					Allowed:    false,
+					Violations: []kaptestv1.PolicyViolation{{Field: "spec.validations[0]", Message: "no such key: team", EvaluationError: true}},
+				}},
+			},
+			{
+				Name:           "pod.v1/denied",
+				Success:        false,
+				ActualResponse: &kaptestv1.ResponseDetails{Allowed: false, Reason: "Invalid"},
+				PolicyResults: []kaptestv1.PolicyResult{{
+					PolicyName: "label-required",
+					Allowed:    false,
+					Violations: []kaptestv1.PolicyViolation{
+						{Field: "spec.validations[0]", Message: "no such key: team", EvaluationError: true},
+						{Field: "spec.validations[1]", Message: "owner label is required"},
+					},
+				}},
+			},
+		},
+	}))
+	require.NoError(t, reporter.Flush())
+
+	var report junitTestSuites
+	require.NoError(t, xml.Unmarshal(buf.Bytes(), &report))
+	assert.Equal(t, 2, report.Errors)
+	assert.Equal(t, 1, report.Failures)
+	assert.Equal(t, 2, report.Suites[0].Errors)
+
+	compile := report.Suites[0].TestCases[0]
+	assert.Nil(t, compile.Failure)
+	require.NotNil(t, compile.Error)
+	assert.Equal(t, "ExpressionError", compile.Error.Type)
+	assert.Contains(t, compile.Error.Content, "label-required: spec.validations[0].expression: undeclared reference to 'obj'\n")
+
+	evaluate := report.Suites[0].TestCases[1]
+	assert.Nil(t, evaluate.Failure)
+	require.NotNil(t, evaluate.Error)
+	assert.Equal(t, "EvaluationError", evaluate.Error.Type)
+	assert.Equal(t, "no such key: team", evaluate.Error.Message)
+
+	denied := report.Suites[0].TestCases[2]
+	assert.Nil(t, denied.Error)
+	assert.NotNil(t, denied.Failure)
+}
@@ -0,0 +1,109 @@
+package reporter
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+
+	kaptestv1 "github.com/yashirook/kube-vap-test/pkg/apis/admission/v1"
+)
+
+// ReportTarget is a report written to a file in a format
+type ReportTarget struct {
+	Format OutputFormat
+	Path   string
+}
+
+// ParseReportTarget parses a report option of the form format=path
+func ParseReportTarget(spec string) (ReportTarget, error) {
+	format, path, ok := strings.Cut(spec, "=")
+	if !ok || format == "" || path == "" {
+		return ReportTarget{}, fmt.Errorf("invalid report %q (must be format=path)", spec)
+	}
+	return ReportTarget{Format: OutputFormat(format), Path: path}, nil
+}
+
+// MultiReporter reports test results to several reporters, such as a table on standard output
+// and JUnit and JSON reports in files
+// It must be closed to close the report files
+type MultiReporter struct {
+	reporters []Reporter
+	files     []*os.File
+}
+
+// NewMultiReporter creates a MultiReporter reporting to the given reporters
+func NewMultiReporter(reporters ...Reporter) *MultiReporter {
+	return &MultiReporter{reporters: reporters}
+}
+
+// AddFile creates the file of a report target, with its parent directories, and reports to it
+func (m *MultiReporter) AddFile(target ReportTarget, verbose bool) error {
+	if dir := filepath.Dir(target.Path); dir != "." {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return fmt.Errorf("failed to create report directory (%s): %w", dir, err)
+		}
+	}
+	file, err := os.Create(target.Path)
+	if err != nil {
+		return fmt.Errorf("failed to create report file (%s): %w", target.Path, err)
+	}
+	m.files = append(m.files, file)
+	m.reporters = append(m.reporters, NewWriterReporter(target.Format, file, verbose))
+	return nil
+}
+
+// Report outputs test results with every reporter
+func (m *MultiReporter) Report(results *kaptestv1.ValidatingAdmissionPolicyTestStatus) error {
+	var errs []error
+	for _, reporter := range m.reporters {
+		if err := reporter.Report(results); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// ReportResult passes the result of a resource to every reporter
+func (m *MultiReporter) ReportResult(result *kaptestv1.TestResult) error {
+	var errs []error
+	for _, reporter := range m.reporters {
+		if err := ReportResult(reporter, result); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Flush writes the reports of the reporters buffering results
+func (m *MultiReporter) Flush() error {
+	var errs []error
+	for _, reporter := range m.reporters {
+		if err := Flush(reporter); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// SetPolicies passes the evaluated policies to the reporters describing them
+func (m *MultiReporter) SetPolicies(policies []*admissionregistrationv1.ValidatingAdmissionPolicy) {
+	for _, reporter := range m.reporters {
+		SetPolicies(reporter, policies)
+	}
+}
+
+// Close closes the report files
+func (m *MultiReporter) Close() error {
+	var errs []error
+	for _, file := range m.files {
+		if err := file.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("failed to close report file (%s): %w", file.Name(), err))
+		}
+	}
+	m.files = nil
+	return errors.Join(errs...)
+}
@@ -0,0 +1,101 @@
+package reporter
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	kaptestv1 "github.com/yashirook/kube-vap-test/pkg/apis/admission/v1"
+)
+
+func TestParseReportTarget(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    ReportTarget
+		wantErr bool
+	}{
+		{spec: "junit=reports/junit.xml", want: ReportTarget{Format: OutputFormatJUnit, Path: "reports/junit.xml"}},
+		{spec: "json=out=1.json", want: ReportTarget{Format: OutputFormatJSON, Path: "out=1.json"}},
+		{spec: "junit", wantErr: true},
+		{spec: "=report.xml", wantErr: true},
+		{spec: "json=", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			target, err := ParseReportTarget(tt.spec)
+			if tt.wantErr {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), "must be format=path")
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, target)
+		})
+	}
+}
+
+func TestMultiReporter(t *testing.T) {
+	dir := t.TempDir()
+	console := &bytes.Buffer{}
+	rep := NewMultiReporter(&TableReporter{baseReporter: baseReporter{writer: console}})
+	require.NoError(t, rep.AddFile(ReportTarget{Format: OutputFormatJUnit, Path: filepath.Join(dir, "reports", "junit.xml")}, false))
+	require.NoError(t, rep.AddFile(ReportTarget{Format: OutputFormatJSON, Path: filepath.Join(dir, "results.json")}, false))
+
+	results := &kaptestv1.ValidatingAdmissionPolicyTestStatus{
+		TestFile: "tests/replicas.yaml",
+		Results: []kaptestv1.TestResult{
+			{Name: "test1", Success: true, ActualResponse: &kaptestv1.ResponseDetails{Allowed: true}},
+		},
+		Summary: kaptestv1.TestSummary{Total: 1, Successful: 1},
+	}
+	require.NoError(t, rep.Report(results))
+	require.NoError(t, Flush(rep))
+	require.NoError(t, rep.Close())
+
+	// Every reporter received the results
+	assert.Contains(t, console.String(), "test1")
+
+	data, err := os.ReadFile(filepath.Join(dir, "reports", "junit.xml"))
+	require.NoError(t, err)
+	var junit junitTestSuites
+	require.NoError(t, xml.Unmarshal(data, &junit))
+	assert.Equal(t, 1, junit.Tests)
+
+	data, err = os.ReadFile(filepath.Join(dir, "results.json"))
+	require.NoError(t, err)
+	var status kaptestv1.ValidatingAdmissionPolicyTestStatus
+	require.NoError(t, json.Unmarshal(data, &status))
+	assert.Equal(t, "test1", status.Results[0].Name)
+
+	// Report files are closed
+	assert.NoError(t, rep.Close())
+}
+
+func TestMultiReporterFileError(t *testing.T) {
+	dir := t.TempDir()
+	blocker := filepath.Join(dir, "file")
+	require.NoError(t, os.WriteFile(blocker, nil, 0o644))
+
+	rep := NewMultiReporter()
+	err := rep.AddFile(ReportTarget{Format: OutputFormatJSON, Path: filepath.Join(blocker, "results.json")}, false)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to create report directory")
+}
+
+func TestSetMessageOutput(t *testing.T) {
+	buf := &bytes.Buffer{}
+	SetMessageOutput(buf)
+	defer SetMessageOutput(nil)
+
+	PrintInfo("information message")
+	PrintWarning("warning message")
+	assert.Contains(t, buf.String(), "information message")
+	assert.Contains(t, buf.String(), "warning message")
+}
@@ -10,7 +10,11 @@ import (
 	"github.com/fatih/color"
 	"golang.org/x/term"
 	"gopkg.in/yaml.v2"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
 
+	"github.com/yashirook/kube-vap-test/internal/baseline"
+	"github.com/yashirook/kube-vap-test/internal/engine/waiver"
+	"github.com/yashirook/kube-vap-test/internal/source"
 	kaptestv1 "github.com/yashirook/kube-vap-test/pkg/apis/admission/v1"
 )
 
@@ -24,6 +28,12 @@ const (
 	OutputFormatJSON OutputFormat = "json"
 	// OutputFormatYAML represents YAML format output
 	OutputFormatYAML OutputFormat = "yaml"
+	// OutputFormatJUnit represents JUnit XML format output
+	OutputFormatJUnit OutputFormat = "junit"
+	// OutputFormatSARIF represents SARIF 2.1.0 format output, available for the check command
+	OutputFormatSARIF OutputFormat = "sarif"
+	// OutputFormatPolicyReport represents wgpolicyk8s.io PolicyReport output, available for the check command
+	OutputFormatPolicyReport OutputFormat = "policyreport"
 )
 
 // Reporter outputs test results report
@@ -32,20 +42,143 @@ type Reporter interface {
 	Report(results *kaptestv1.ValidatingAdmissionPolicyTestStatus) error
 }
 
+// Flusher is implemented by reporters that write the report of all results at once
+type Flusher interface {
+	// Flush writes the report of the results reported so far
+	Flush() error
+}
+
+// Flush writes the report of reporters buffering results, and does nothing for other reporters
+func Flush(r Reporter) error {
+	if flusher, ok := r.(Flusher); ok {
+		return flusher.Flush()
+	}
+	return nil
+}
+
+// ResultReporter is implemented by reporters taking results one at a time, as the resources of a
+// cluster are checked, so that the check need not keep them
+// The results reported one at a time precede those of the next reported status, which reports
+// the summary of them all
+type ResultReporter interface {
+	// ReportResult adds the result of a resource to the report
+	ReportResult(result *kaptestv1.TestResult) error
+}
+
+// ReportResult passes the result of a resource to a reporter taking results one at a time, and
+// reports it as a status of its own to other reporters
+func ReportResult(r Reporter, result *kaptestv1.TestResult) error {
+	if resultReporter, ok := r.(ResultReporter); ok {
+		return resultReporter.ReportResult(result)
+	}
+	status := &kaptestv1.ValidatingAdmissionPolicyTestStatus{
+		Results: []kaptestv1.TestResult{*result},
+		Summary: kaptestv1.TestSummary{Total: 1},
+	}
+	if result.Success {
+		status.Summary.Successful++
+	} else {
+		status.Summary.Failed++
+	}
+	return r.Report(status)
+}
+
+// pendingResults keeps the results reported one at a time by reporters writing a single document,
+// until the status they belong to is reported
+type pendingResults struct {
+	results []kaptestv1.TestResult
+}
+
+// ReportResult keeps the result of a resource until the status is reported
+func (p *pendingResults) ReportResult(result *kaptestv1.TestResult) error {
+	p.results = append(p.results, *result)
+	return nil
+}
+
+// take returns the status with the pending results before its own, and forgets them
+func (p *pendingResults) take(results *kaptestv1.ValidatingAdmissionPolicyTestStatus) *kaptestv1.ValidatingAdmissionPolicyTestStatus {
+	if len(p.results) == 0 {
+		return results
+	}
+	status := *results
+	status.Results = append(p.results, results.Results...)
+	p.results = nil
+	return &status
+}
+
+// PolicyReporter is implemented by reporters describing the evaluated policies
+type PolicyReporter interface {
+	// SetPolicies sets the evaluated policies
+	SetPolicies(policies []*admissionregistrationv1.ValidatingAdmissionPolicy)
+}
+
+// SetPolicies passes the evaluated policies to reporters describing them
+func SetPolicies(r Reporter, policies []*admissionregistrationv1.ValidatingAdmissionPolicy) {
+	if policyReporter, ok := r.(PolicyReporter); ok {
+		policyReporter.SetPolicies(policies)
+	}
+}
+
 // baseReporter provides common functionality
 type baseReporter struct {
 	writer  io.Writer
 	verbose bool
 }
 
+// statusList is the document of the results of several test files
+type statusList struct {
+	// Items are the results of each test file, in the order they were reported
+	Items []kaptestv1.ValidatingAdmissionPolicyTestStatus `json:"items" yaml:"items"`
+
+	// Summary sums up the summaries of the test files
+	Summary kaptestv1.TestSummary `json:"summary" yaml:"summary"`
+}
+
+// statusBuffer collects the results reported so far, so they are written as a single document
+type statusBuffer struct {
+	statuses []kaptestv1.ValidatingAdmissionPolicyTestStatus
+}
+
+// add buffers the results of a test file
+func (b *statusBuffer) add(results *kaptestv1.ValidatingAdmissionPolicyTestStatus) {
+	b.statuses = append(b.statuses, *results)
+}
+
+// document returns the results reported so far, as they are when a single test file or check
+// was reported, and as a list of the test files otherwise
+func (b *statusBuffer) document() interface{} {
+	if len(b.statuses) == 1 {
+		return b.statuses[0]
+	}
+	list := statusList{Items: b.statuses}
+	if list.Items == nil {
+		list.Items = []kaptestv1.ValidatingAdmissionPolicyTestStatus{}
+	}
+	for _, status := range b.statuses {
+		list.Summary.Total += status.Summary.Total
+		list.Summary.Successful += status.Summary.Successful
+		list.Summary.Failed += status.Summary.Failed
+	}
+	return list
+}
+
 // JSONReporter outputs reports in JSON format
+// Results are buffered and written as a single document by Flush
 type JSONReporter struct {
 	baseReporter
+	pendingResults
+	buffer statusBuffer
 }
 
-// Report outputs test results in JSON format
+// Report adds test results to the report
 func (r *JSONReporter) Report(results *kaptestv1.ValidatingAdmissionPolicyTestStatus) error {
-	data, err := json.MarshalIndent(results, "", "  ")
+	r.buffer.add(r.take(results))
+	return nil
+}
+
+// Flush writes the JSON document of all results reported so far
+func (r *JSONReporter) Flush() error {
+	data, err := json.MarshalIndent(r.buffer.document(), "", "  ")
 	if err != nil {
 		return fmt.Errorf("failed to marshal results to JSON: %w", err)
 	}
@@ -55,13 +188,22 @@ func (r *JSONReporter) Report(results *kaptestv1.ValidatingAdmissionPolicyTestSt
 }
 
 // YAMLReporter outputs reports in YAML format
+// Results are buffered and written as a single document by Flush
 type YAMLReporter struct {
 	baseReporter
+	pendingResults
+	buffer statusBuffer
 }
 
-// Report outputs test results in YAML format
+// Report adds test results to the report
 func (r *YAMLReporter) Report(results *kaptestv1.ValidatingAdmissionPolicyTestStatus) error {
-	data, err := yaml.Marshal(results)
+	r.buffer.add(r.take(results))
+	return nil
+}
+
+// Flush writes the YAML document of all results reported so far
+func (r *YAMLReporter) Flush() error {
+	data, err := yaml.Marshal(r.buffer.document())
 	if err != nil {
 		return fmt.Errorf("failed to marshal results to YAML: %w", err)
 	}
@@ -71,25 +213,155 @@ func (r *YAMLReporter) Report(results *kaptestv1.ValidatingAdmissionPolicyTestSt
 }
 
 // TableReporter outputs reports in table format
+// Results reported one at a time are output as rows as they come, and only those listed again
+// after the summary are kept until the status is reported
 type TableReporter struct {
 	baseReporter
+	// layout is the layout of the rows output one at a time, nil until the first of them
+	layout *tableLayout
+	// streamed are the results output one at a time that are listed again after the summary
+	streamed []kaptestv1.TestResult
+	// streamedAgreements counts the other results output one at a time whose evaluation engines agree
+	streamedAgreements int
+}
+
+// tableLayout is the width of the table and of its columns
+type tableLayout struct {
+	termWidth    int
+	nameWidth    int
+	reasonWidth  int
+	messageWidth int
+}
+
+// ReportResult outputs the result of a resource as a row of the table
+func (r *TableReporter) ReportResult(result *kaptestv1.TestResult) error {
+	if r.layout == nil {
+		// Names and reasons of the rows to come are unknown, so their columns get the widest width
+		r.layout = r.newLayout(50, 25)
+		r.writeHeader(r.layout)
+	}
+	r.writeRow(r.layout, *result)
+
+	if listedAfterSummary(*result) {
+		r.streamed = append(r.streamed, *result)
+	} else if result.Differential != nil {
+		r.streamedAgreements++
+	}
+	return nil
 }
 
 // Report outputs test results in table format
 func (r *TableReporter) Report(results *kaptestv1.ValidatingAdmissionPolicyTestStatus) error {
-	// Get terminal width
-	termWidth := 120 // Default width
-	if width, _, err := term.GetSize(int(os.Stdout.Fd())); err == nil && width > 0 {
-		termWidth = width
+	layout := r.layout
+	if layout == nil {
+		layout = r.fitLayout(results.Results)
+		r.writeHeader(layout)
+	}
+	for _, result := range results.Results {
+		r.writeRow(layout, result)
 	}
+	if r.layout != nil {
+		// The rows output one at a time belong to this status
+		status := *results
+		status.Results = append(r.streamed, results.Results...)
+		results = &status
+	}
+	agreements := r.streamedAgreements
+	r.layout, r.streamed, r.streamedAgreements = nil, nil, 0
+
+	termWidth := layout.termWidth
+	successColor := r.colorFunc(color.FgGreen)
+	failColor := r.colorFunc(color.FgRed)
+	headerColor := r.colorFunc(color.Bold)
 
+	// Summary
+	fmt.Fprintln(r.writer, strings.Repeat("=", termWidth))
+	summaryStr := fmt.Sprintf("Total: %d | Passed: %s | Failed: %s",
+		results.Summary.Total,
+		successColor(fmt.Sprintf("%d", results.Summary.Successful)),
+		failColor(fmt.Sprintf("%d", results.Summary.Failed)))
+	
+	// Center the summary
+	padding := (termWidth - len("Total: XX | Passed: XX | Failed: XX")) / 2
+	if padding > 0 {
+		fmt.Fprintf(r.writer, "%*s%s\n", padding, "", summaryStr)
+	} else {
+		fmt.Fprintln(r.writer, summaryStr)
+	}
+
+	// Pod Security Admission comparison
+	if results.PodSecurity != nil {
+		r.reportPodSecurity(results, termWidth)
+	}
+
+	// Differential evaluation
+	r.reportDifferential(results, agreements, termWidth)
+
+	// CEL errors of the policy expressions
+	r.reportExpressionErrors(results, termWidth)
+
+	// Waived violations and expired waivers
+	r.reportWaivers(results, termWidth)
+
+	// Comparison with the baseline of accepted violations
+	if results.Baseline != nil {
+		r.reportBaseline(results.Baseline, termWidth)
+	}
+
+	// Comparison with the results of another version of the policies
+	if results.Impact != nil {
+		r.reportImpact(results.Impact, termWidth)
+	}
+
+	// Policy API versions on the target Kubernetes version
+	if results.APIVersions != nil {
+		r.reportAPIVersions(results.APIVersions, termWidth)
+	}
+
+	// Detailed display (verbose mode)
+	if r.verbose && results.Summary.Failed > 0 {
+		fmt.Fprintln(r.writer)
+		fmt.Fprintln(r.writer, headerColor("Failed Test Details:"))
+		fmt.Fprintln(r.writer, strings.Repeat("-", termWidth))
+		for _, result := range results.Results {
+			if !result.Success {
+				fmt.Fprintf(r.writer, "\n%s: %s\n", headerColor("Test"), result.Name)
+				if result.Source != nil {
+					fmt.Fprintf(r.writer, "%s: %s\n", headerColor("Source"), source.Format(*result.Source))
+				}
+				if len(result.Patches) > 0 {
+					patches := make([]string, len(result.Patches))
+					for i, patch := range result.Patches {
+						patches[i] = source.Format(patch)
+					}
+					fmt.Fprintf(r.writer, "%s: %s\n", headerColor("Patches"), strings.Join(patches, ", "))
+				}
+				if result.Details != "" {
+					fmt.Fprintf(r.writer, "%s: %s\n", headerColor("Details"), result.Details)
+				}
+				if result.ActualResponse != nil {
+					if result.ActualResponse.Reason != "" {
+						fmt.Fprintf(r.writer, "%s: %s\n", headerColor("Reason"), result.ActualResponse.Reason)
+					}
+					if result.ActualResponse.Message != "" {
+						fmt.Fprintf(r.writer, "%s: %s\n", headerColor("Message"), result.ActualResponse.Message)
+					}
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// fitLayout returns the layout fitting the names and reasons of results in the terminal
+func (r *TableReporter) fitLayout(results []kaptestv1.TestResult) *tableLayout {
 	// Calculate dynamic column widths
 	maxNameLen := len("Test Name")
 	maxReasonLen := len("Reason")
-	maxMessageLen := len("Message")
 
 	// Find maximum lengths in data
-	for _, result := range results.Results {
+	for _, result := range results {
 		if len(result.Name) > maxNameLen {
 			maxNameLen = len(result.Name)
 		}
@@ -97,9 +369,6 @@ func (r *TableReporter) Report(results *kaptestv1.ValidatingAdmissionPolicyTestS
 			if len(result.ActualResponse.Reason) > maxReasonLen {
 				maxReasonLen = len(result.ActualResponse.Reason)
 			}
-			if len(result.ActualResponse.Message) > maxMessageLen {
-				maxMessageLen = len(result.ActualResponse.Message)
-			}
 		}
 	}
 
@@ -110,124 +379,432 @@ func (r *TableReporter) Report(results *kaptestv1.ValidatingAdmissionPolicyTestS
 	if maxReasonLen > 25 {
 		maxReasonLen = 25
 	}
+	return r.newLayout(maxNameLen, maxReasonLen)
+}
+
+// newLayout returns the layout of name and reason columns, leaving the rest of the terminal to messages
+func (r *TableReporter) newLayout(nameWidth, reasonWidth int) *tableLayout {
+	// Get terminal width
+	termWidth := 120 // Default width
+	if r.toStdout() {
+		if width, _, err := term.GetSize(int(os.Stdout.Fd())); err == nil && width > 0 {
+			termWidth = width
+		}
+	}
 
 	// Calculate remaining width for message column
 	// Format: name + status(6) + reason + message + separators(12)
 	minMessageWidth := 40
-	messageWidth := termWidth - maxNameLen - 6 - maxReasonLen - 12
+	messageWidth := termWidth - nameWidth - 6 - reasonWidth - 12
 	if messageWidth < minMessageWidth {
 		messageWidth = minMessageWidth
 	}
+	return &tableLayout{termWidth: termWidth, nameWidth: nameWidth, reasonWidth: reasonWidth, messageWidth: messageWidth}
+}
 
-	// Colors
-	successColor := color.New(color.FgGreen).SprintFunc()
-	failColor := color.New(color.FgRed).SprintFunc()
-	headerColor := color.New(color.Bold).SprintFunc()
+// writeHeader outputs the header of the table
+func (r *TableReporter) writeHeader(layout *tableLayout) {
+	headerColor := r.colorFunc(color.Bold)
 
 	// Header with separators
-	fmt.Fprintln(r.writer, strings.Repeat("=", termWidth))
+	fmt.Fprintln(r.writer, strings.Repeat("=", layout.termWidth))
 	fmt.Fprintf(r.writer, "%-*s  %-6s  %-*s  %s\n",
-		maxNameLen, headerColor("Test Name"),
+		layout.nameWidth, headerColor("Test Name"),
 		headerColor("Status"),
-		maxReasonLen, headerColor("Reason"),
+		layout.reasonWidth, headerColor("Reason"),
 		headerColor("Message"))
+	fmt.Fprintln(r.writer, strings.Repeat("-", layout.termWidth))
+}
+
+// writeRow outputs the row of a result
+func (r *TableReporter) writeRow(layout *tableLayout, result kaptestv1.TestResult) {
+	successColor := r.colorFunc(color.FgGreen)
+	failColor := r.colorFunc(color.FgRed)
+	knownColor := r.colorFunc(color.FgYellow)
+	maxNameLen, maxReasonLen, messageWidth := layout.nameWidth, layout.reasonWidth, layout.messageWidth
+
+	statusDisplay := failColor("FAIL")
+	if result.Waived {
+		// Allowed only because every denial is waived
+		statusDisplay = knownColor("WAIVED")
+	} else if result.Success {
+		statusDisplay = successColor("PASS")
+	} else if baseline.Known(result) {
+		// Denied only by violations accepted in the baseline
+		statusDisplay = knownColor("KNOWN")
+	}
+
+	reason := ""
+	message := ""
+
+	if result.ActualResponse != nil {
+		reason = result.ActualResponse.Reason
+		message = result.ActualResponse.Message
+	}
+	if result.Waived {
+		message = strings.Join(waiverNotes(result), "; ")
+	}
+
+	// Format name
+	name := result.Name
+	if !r.verbose && len(name) > maxNameLen {
+		name = name[:maxNameLen-3] + "..."
+	}
+
+	// Format reason
+	if len(reason) > maxReasonLen {
+		reason = reason[:maxReasonLen-3] + "..."
+	}
+
+	// Format message - wrap or truncate
+	if r.verbose && len(message) > messageWidth {
+		// In verbose mode, wrap long messages
+		lines := wrapText(message, messageWidth)
+		fmt.Fprintf(r.writer, "%-*s  %-6s  %-*s  %s\n",
+			maxNameLen, name,
+			statusDisplay,
+			maxReasonLen, reason,
+			lines[0])
+		// Print wrapped lines
+		for i := 1; i < len(lines); i++ {
+			fmt.Fprintf(r.writer, "%-*s  %-6s  %-*s  %s\n",
+				maxNameLen, "",
+				"",
+				maxReasonLen, "",
+				lines[i])
+		}
+	} else {
+		// In normal mode, truncate
+		if len(message) > messageWidth {
+			message = message[:messageWidth-3] + "..."
+		}
+		fmt.Fprintf(r.writer, "%-*s  %-6s  %-*s  %s\n",
+			maxNameLen, name,
+			statusDisplay,
+			maxReasonLen, reason,
+			message)
+	}
+}
+
+// listedAfterSummary reports whether a result is listed again after the summary of the table, as
+// a failure, a waiver, an expression error or a divergence from Pod Security Admission or the
+// other evaluation engine
+func listedAfterSummary(result kaptestv1.TestResult) bool {
+	if !result.Success || result.Waived || len(result.ExpressionErrors) > 0 {
+		return true
+	}
+	if result.PodSecurity != nil && result.PodSecurity.Divergence != kaptestv1.PodSecurityAgree {
+		return true
+	}
+	if result.Differential != nil && !result.Differential.Agree {
+		return true
+	}
+	for _, policyResult := range result.PolicyResults {
+		if !policyResult.Allowed && policyResult.Waiver != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// reportPodSecurity outputs how policy verdicts compare with Pod Security Admission
+// Only divergent test cases are listed
+func (r *TableReporter) reportPodSecurity(results *kaptestv1.ValidatingAdmissionPolicyTestStatus, termWidth int) {
+	headerColor := r.colorFunc(color.Bold)
+	stricterColor := r.colorFunc(color.FgYellow)
+	looserColor := r.colorFunc(color.FgRed)
+
+	summary := results.PodSecurity
+	fmt.Fprintln(r.writer)
+	fmt.Fprintln(r.writer, headerColor(fmt.Sprintf("Pod Security Admission (%s):", summary.Policy)))
 	fmt.Fprintln(r.writer, strings.Repeat("-", termWidth))
+	fmt.Fprintf(r.writer, "Evaluated: %d | Agree: %d | VAP stricter: %s | VAP looser: %s\n",
+		summary.Evaluated,
+		summary.Agree,
+		stricterColor(fmt.Sprintf("%d", summary.VAPStricter)),
+		looserColor(fmt.Sprintf("%d", summary.VAPLooser)))
 
-	// Detail rows
 	for _, result := range results.Results {
-		statusDisplay := failColor("FAIL")
-		if result.Success {
-			statusDisplay = successColor("PASS")
+		if result.PodSecurity == nil {
+			continue
 		}
 
-		reason := ""
-		message := ""
+		switch result.PodSecurity.Divergence {
+		case kaptestv1.PodSecurityVAPStricter:
+			message := ""
+			if result.ActualResponse != nil {
+				message = result.ActualResponse.Message
+			}
+			fmt.Fprintf(r.writer, "%s  %s: denied by policies, allowed by Pod Security Admission (%s)\n",
+				stricterColor("STRICTER"), result.Name, message)
+		case kaptestv1.PodSecurityVAPLooser:
+			fmt.Fprintf(r.writer, "%s  %s: allowed by policies, denied by Pod Security Admission (%s)\n",
+				looserColor("LOOSER  "), result.Name, result.PodSecurity.ForbiddenReason)
+			if r.verbose && result.PodSecurity.ForbiddenDetail != "" {
+				fmt.Fprintf(r.writer, "          %s: %s\n", headerColor("Details"), result.PodSecurity.ForbiddenDetail)
+			}
+		}
+	}
+}
+
+// reportDifferential outputs the test cases where the evaluation engines disagree, counting
+// agreements more test cases the engines agree on
+// Nothing is output unless differential evaluation was enabled
+func (r *TableReporter) reportDifferential(results *kaptestv1.ValidatingAdmissionPolicyTestStatus, agreements int, termWidth int) {
+	headerColor := r.colorFunc(color.Bold)
+	disagreeColor := r.colorFunc(color.FgRed)
 
+	evaluated, disagreements := agreements, 0
+	for _, result := range results.Results {
+		if result.Differential == nil {
+			continue
+		}
+		evaluated++
+		if !result.Differential.Agree {
+			disagreements++
+		}
+	}
+	if evaluated == 0 {
+		return
+	}
+
+	fmt.Fprintln(r.writer)
+	fmt.Fprintln(r.writer, headerColor(fmt.Sprintf("Differential evaluation (%s):", results.Engine)))
+	fmt.Fprintln(r.writer, strings.Repeat("-", termWidth))
+	fmt.Fprintf(r.writer, "Evaluated: %d | Agree: %d | Disagree: %s\n",
+		evaluated,
+		evaluated-disagreements,
+		disagreeColor(fmt.Sprintf("%d", disagreements)))
+
+	for _, result := range results.Results {
+		if result.Differential == nil || result.Differential.Agree {
+			continue
+		}
+
+		allowed := false
+		message := ""
 		if result.ActualResponse != nil {
-			reason = result.ActualResponse.Reason
+			allowed = result.ActualResponse.Allowed
 			message = result.ActualResponse.Message
 		}
+		if result.Differential.Error != "" {
+			fmt.Fprintf(r.writer, "%s  %s: %s engine failed: %s\n",
+				disagreeColor("ERROR   "), result.Name, result.Differential.Engine, result.Differential.Error)
+			continue
+		}
+		fmt.Fprintf(r.writer, "%s  %s: %s %s, %s %s\n",
+			disagreeColor("DISAGREE"), result.Name,
+			results.Engine, verdict(allowed),
+			result.Differential.Engine, verdict(result.Differential.Allowed))
+		if r.verbose {
+			fmt.Fprintf(r.writer, "          %s: %s\n", headerColor(results.Engine), message)
+			fmt.Fprintf(r.writer, "          %s: %s\n", headerColor(result.Differential.Engine), result.Differential.Message)
+		}
+	}
+}
+
+// reportExpressionErrors outputs the CEL errors of the policy expressions with their position
+// Errors repeated for several test cases are output once
+func (r *TableReporter) reportExpressionErrors(results *kaptestv1.ValidatingAdmissionPolicyTestStatus, termWidth int) {
+	headerColor := r.colorFunc(color.Bold)
+	errorColor := r.colorFunc(color.FgRed)
 
-		// Format name
-		name := result.Name
-		if !r.verbose && len(name) > maxNameLen {
-			name = name[:maxNameLen-3] + "..."
+	type entry struct {
+		err   kaptestv1.ExpressionError
+		count int
+	}
+	var entries []*entry
+	seen := make(map[string]*entry)
+	for _, result := range results.Results {
+		for _, expressionErr := range result.ExpressionErrors {
+			key := fmt.Sprintf("%s/%s/%s", expressionErr.Policy, expressionErr.Field, expressionErr.Message)
+			if existing, ok := seen[key]; ok {
+				existing.count++
+				continue
+			}
+			seen[key] = &entry{err: expressionErr, count: 1}
+			entries = append(entries, seen[key])
 		}
+	}
+	if len(entries) == 0 {
+		return
+	}
 
-		// Format reason
-		if len(reason) > maxReasonLen {
-			reason = reason[:maxReasonLen-3] + "..."
+	fmt.Fprintln(r.writer)
+	fmt.Fprintln(r.writer, headerColor("Expression errors:"))
+	fmt.Fprintln(r.writer, strings.Repeat("-", termWidth))
+	for _, entry := range entries {
+		expressionErr := entry.err
+		position := fmt.Sprintf("policy '%s'", expressionErr.Policy)
+		if expressionErr.Location != nil {
+			position = fmt.Sprintf("%s: policy '%s'", source.Format(*expressionErr.Location), expressionErr.Policy)
+		}
+		occurrences := ""
+		if entry.count > 1 {
+			occurrences = fmt.Sprintf(" (%d test cases)", entry.count)
+		}
+		fmt.Fprintf(r.writer, "%s %s %s: %s%s\n", errorColor("ERROR"), position, expressionErr.Field, expressionErr.Message, occurrences)
+		if expressionErr.Excerpt == "" {
+			continue
+		}
+		for _, line := range strings.Split(expressionErr.Excerpt, "\n") {
+			fmt.Fprintf(r.writer, "    | %s\n", line)
 		}
+	}
+}
 
-		// Format message - wrap or truncate
-		if r.verbose && len(message) > messageWidth {
-			// In verbose mode, wrap long messages
-			lines := wrapText(message, messageWidth)
-			fmt.Fprintf(r.writer, "%-*s  %-6s  %-*s  %s\n",
-				maxNameLen, name,
-				statusDisplay,
-				maxReasonLen, reason,
-				lines[0])
-			// Print wrapped lines
-			for i := 1; i < len(lines); i++ {
-				fmt.Fprintf(r.writer, "%-*s  %-6s  %-*s  %s\n",
-					maxNameLen, "",
-					"",
-					maxReasonLen, "",
-					lines[i])
+// reportWaivers outputs the waived violations and the violations of expired waivers
+func (r *TableReporter) reportWaivers(results *kaptestv1.ValidatingAdmissionPolicyTestStatus, termWidth int) {
+	headerColor := r.colorFunc(color.Bold)
+	waivedColor := r.colorFunc(color.FgYellow)
+	expiredColor := r.colorFunc(color.FgRed)
+
+	header := false
+	for _, result := range results.Results {
+		for _, policyResult := range result.PolicyResults {
+			if policyResult.Allowed || policyResult.Waiver == nil {
+				continue
 			}
-		} else {
-			// In normal mode, truncate
-			if len(message) > messageWidth {
-				message = message[:messageWidth-3] + "..."
+			if !header {
+				fmt.Fprintln(r.writer)
+				fmt.Fprintln(r.writer, headerColor("Waivers:"))
+				fmt.Fprintln(r.writer, strings.Repeat("-", termWidth))
+				header = true
 			}
-			fmt.Fprintf(r.writer, "%-*s  %-6s  %-*s  %s\n",
-				maxNameLen, name,
-				statusDisplay,
-				maxReasonLen, reason,
-				message)
+			status := waivedColor("WAIVED")
+			if policyResult.Waiver.Expired {
+				status = expiredColor("EXPIRED")
+			}
+			fmt.Fprintf(r.writer, "%s %s policy '%s' %s\n", status, result.Name, policyResult.PolicyName, waiver.Describe(policyResult.Waiver))
 		}
 	}
+}
 
-	// Summary
-	fmt.Fprintln(r.writer, strings.Repeat("=", termWidth))
-	summaryStr := fmt.Sprintf("Total: %d | Passed: %s | Failed: %s",
-		results.Summary.Total,
-		successColor(fmt.Sprintf("%d", results.Summary.Successful)),
-		failColor(fmt.Sprintf("%d", results.Summary.Failed)))
-	
-	// Center the summary
-	padding := (termWidth - len("Total: XX | Passed: XX | Failed: XX")) / 2
-	if padding > 0 {
-		fmt.Fprintf(r.writer, "%*s%s\n", padding, "", summaryStr)
-	} else {
-		fmt.Fprintln(r.writer, summaryStr)
-	}
+// reportBaseline outputs how violations compare with the baseline, listing the fixed violations
+func (r *TableReporter) reportBaseline(report *kaptestv1.BaselineReport, termWidth int) {
+	headerColor := r.colorFunc(color.Bold)
+	newColor := r.colorFunc(color.FgRed)
+	fixedColor := r.colorFunc(color.FgGreen)
 
-	// Detailed display (verbose mode)
-	if r.verbose && results.Summary.Failed > 0 {
+	fmt.Fprintln(r.writer)
+	fmt.Fprintln(r.writer, headerColor(fmt.Sprintf("Baseline (%s):", report.File)))
+	fmt.Fprintln(r.writer, strings.Repeat("-", termWidth))
+	fmt.Fprintf(r.writer, "New: %s | Known: %d | Fixed: %s\n",
+		newColor(fmt.Sprintf("%d", report.New)),
+		report.Known,
+		fixedColor(fmt.Sprintf("%d", len(report.Fixed))))
+	for _, violation := range report.Fixed {
+		resource := violation.Resource.Name
+		if violation.Resource.Namespace != "" {
+			resource = violation.Resource.Namespace + "/" + resource
+		}
+		fmt.Fprintf(r.writer, "%s %s %s policy '%s'", fixedColor("FIXED"), violation.Resource.Kind, resource, violation.Policy)
+		if violation.Validation != "" {
+			fmt.Fprintf(r.writer, " %s", violation.Validation)
+		}
 		fmt.Fprintln(r.writer)
-		fmt.Fprintln(r.writer, headerColor("Failed Test Details:"))
-		fmt.Fprintln(r.writer, strings.Repeat("-", termWidth))
-		for _, result := range results.Results {
-			if !result.Success {
-				fmt.Fprintf(r.writer, "\n%s: %s\n", headerColor("Test"), result.Name)
-				if result.Details != "" {
-					fmt.Fprintf(r.writer, "%s: %s\n", headerColor("Details"), result.Details)
-				}
-				if result.ActualResponse != nil {
-					if result.ActualResponse.Reason != "" {
-						fmt.Fprintf(r.writer, "%s: %s\n", headerColor("Reason"), result.ActualResponse.Reason)
-					}
-					if result.ActualResponse.Message != "" {
-						fmt.Fprintf(r.writer, "%s: %s\n", headerColor("Message"), result.ActualResponse.Message)
-					}
-				}
-			}
+	}
+}
+
+// reportImpact outputs how the admission of resources changes between two versions of the policies,
+// listing the resources whose admission changes
+func (r *TableReporter) reportImpact(report *kaptestv1.ImpactReport, termWidth int) {
+	headerColor := r.colorFunc(color.Bold)
+	deniedColor := r.colorFunc(color.FgRed)
+	allowedColor := r.colorFunc(color.FgGreen)
+	changedColor := r.colorFunc(color.FgYellow)
+
+	fmt.Fprintln(r.writer)
+	fmt.Fprintln(r.writer, headerColor(fmt.Sprintf("Impact (%s -> %s):", strings.Join(report.Old, ", "), strings.Join(report.New, ", "))))
+	fmt.Fprintln(r.writer, strings.Repeat("-", termWidth))
+	fmt.Fprintf(r.writer, "Evaluated: %d | Newly denied: %s | Newly allowed: %s | Message changed: %s\n",
+		report.Evaluated,
+		deniedColor(fmt.Sprintf("%d", report.NewlyDenied)),
+		allowedColor(fmt.Sprintf("%d", report.NewlyAllowed)),
+		changedColor(fmt.Sprintf("%d", report.MessageChanged)))
+	for _, result := range report.Results {
+		resource := result.Resource.Name
+		if result.Resource.Namespace != "" {
+			resource = result.Resource.Namespace + "/" + resource
+		}
+		resource = result.Resource.Kind + " " + resource
+
+		switch result.Change {
+		case kaptestv1.ImpactNewlyDenied:
+			fmt.Fprintf(r.writer, "%s %s%s: %s\n", deniedColor("NEWLY DENIED"), resource, policyList(" by", result.DeniedBy), result.New.Message)
+		case kaptestv1.ImpactNewlyAllowed:
+			fmt.Fprintf(r.writer, "%s %s%s\n", allowedColor("NEWLY ALLOWED"), resource, policyList(" no longer denied by", result.NoLongerDeniedBy))
+		default:
+			fmt.Fprintf(r.writer, "%s %s: %s -> %s\n", changedColor("CHANGED"), resource, result.Old.Message, result.New.Message)
 		}
 	}
+}
 
-	return nil
+// policyList lists policy names after a prefix, nothing without policies
+func policyList(prefix string, policies []string) string {
+	if len(policies) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%s '%s'", prefix, strings.Join(policies, "', '"))
+}
+
+// reportAPIVersions outputs the policy API version each policy needs on the target Kubernetes version
+func (r *TableReporter) reportAPIVersions(report *kaptestv1.APIVersionReport, termWidth int) {
+	headerColor := r.colorFunc(color.Bold)
+	unsupportedColor := r.colorFunc(color.FgRed)
+
+	fmt.Fprintln(r.writer)
+	fmt.Fprintln(r.writer, headerColor(fmt.Sprintf("Policy API versions (Kubernetes %s):", report.KubernetesVersion)))
+	fmt.Fprintln(r.writer, strings.Repeat("-", termWidth))
+
+	for _, policy := range report.Policies {
+		apiVersion := policy.APIVersion
+		if apiVersion == "" {
+			apiVersion = "-"
+		}
+		if policy.Supported {
+			fmt.Fprintf(r.writer, "%s: %s\n", policy.Policy, apiVersion)
+		} else {
+			fmt.Fprintf(r.writer, "%s: %s %s\n", policy.Policy, apiVersion, unsupportedColor("(unsupported)"))
+		}
+		for _, note := range policy.Notes {
+			fmt.Fprintf(r.writer, "  - %s\n", note)
+		}
+	}
+}
+
+// toStdout reports whether the table is written to standard output
+func (r *TableReporter) toStdout() bool {
+	file, ok := r.writer.(*os.File)
+	return ok && file == os.Stdout
+}
+
+// colorFunc returns a function coloring text, which leaves text as is in report files
+func (r *TableReporter) colorFunc(attributes ...color.Attribute) func(a ...interface{}) string {
+	c := color.New(attributes...)
+	if !r.toStdout() {
+		c.DisableColor()
+	}
+	return c.SprintFunc()
+}
+
+// verdict returns the verdict of an admission response
+func verdict(allowed bool) string {
+	if allowed {
+		return "allowed"
+	}
+	return "denied"
+}
+
+// waiverNotes describes the waivers of the denying policies of a result
+func waiverNotes(result kaptestv1.TestResult) []string {
+	var notes []string
+	for _, policyResult := range result.PolicyResults {
+		if !policyResult.Allowed && policyResult.Waiver != nil {
+			notes = append(notes, fmt.Sprintf("policy '%s' %s", policyResult.PolicyName, waiver.Describe(policyResult.Waiver)))
+		}
+	}
+	return notes
 }
 
 // wrapText wraps text to specified width
@@ -258,22 +835,48 @@ func wrapText(text string, width int) []string {
 	return lines
 }
 
-// NewReporter creates a new Reporter
+// NewReporter creates a new Reporter writing to standard output
 func NewReporter(format OutputFormat, verbose bool) Reporter {
+	return NewWriterReporter(format, os.Stdout, verbose)
+}
+
+// NewWriterReporter creates a new Reporter writing to writer
+func NewWriterReporter(format OutputFormat, writer io.Writer, verbose bool) Reporter {
 	var reporter Reporter
 
 	switch format {
 	case OutputFormatJSON:
 		reporter = &JSONReporter{
 			baseReporter: baseReporter{
-				writer:  os.Stdout,
+				writer:  writer,
 				verbose: verbose,
 			},
 		}
 	case OutputFormatYAML:
 		reporter = &YAMLReporter{
 			baseReporter: baseReporter{
-				writer:  os.Stdout,
+				writer:  writer,
+				verbose: verbose,
+			},
+		}
+	case OutputFormatJUnit:
+		reporter = &JUnitReporter{
+			baseReporter: baseReporter{
+				writer:  writer,
+				verbose: verbose,
+			},
+		}
+	case OutputFormatSARIF:
+		reporter = &SARIFReporter{
+			baseReporter: baseReporter{
+				writer:  writer,
+				verbose: verbose,
+			},
+		}
+	case OutputFormatPolicyReport:
+		reporter = &PolicyReportReporter{
+			baseReporter: baseReporter{
+				writer:  writer,
 				verbose: verbose,
 			},
 		}
@@ -282,7 +885,7 @@ func NewReporter(format OutputFormat, verbose bool) Reporter {
 	default:
 		reporter = &TableReporter{
 			baseReporter: baseReporter{
-				writer:  os.Stdout,
+				writer:  writer,
 				verbose: verbose,
 			},
 		}
@@ -297,20 +900,37 @@ func PrintError(err error) {
 	fmt.Fprintf(os.Stderr, "%s: %s\n", errColor("Error"), err.Error())
 }
 
+// messageOutput receives success, info and warning messages, standard output when nil
+var messageOutput io.Writer
+
+// SetMessageOutput sets where success, info and warning messages are written
+// Commands writing a machine-readable report to standard output send them to standard error
+func SetMessageOutput(writer io.Writer) {
+	messageOutput = writer
+}
+
+// messageWriter returns the writer of success, info and warning messages
+func messageWriter() io.Writer {
+	if messageOutput != nil {
+		return messageOutput
+	}
+	return os.Stdout
+}
+
 // PrintSuccess outputs success message
 func PrintSuccess(message string) {
 	successColor := color.New(color.FgGreen).SprintFunc()
-	fmt.Fprintf(os.Stdout, "%s: %s\n", successColor("Success"), message)
+	fmt.Fprintf(messageWriter(), "%s: %s\n", successColor("Success"), message)
 }
 
 // PrintInfo outputs info message
 func PrintInfo(message string) {
 	infoColor := color.New(color.FgBlue).SprintFunc()
-	fmt.Fprintf(os.Stdout, "%s: %s\n", infoColor("Info"), message)
+	fmt.Fprintf(messageWriter(), "%s: %s\n", infoColor("Info"), message)
 }
 
 // PrintWarning outputs warning message
 func PrintWarning(message string) {
 	warnColor := color.New(color.FgYellow).SprintFunc()
-	fmt.Fprintf(os.Stdout, "%s: %s\n", warnColor("Warning"), message)
+	fmt.Fprintf(messageWriter(), "%s: %s\n", warnColor("Warning"), message)
 }
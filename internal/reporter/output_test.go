@@ -21,6 +21,9 @@ func TestOutputFormat(t *testing.T) {
 	assert.Equal(t, OutputFormat("table"), OutputFormatTable)
 	assert.Equal(t, OutputFormat("json"), OutputFormatJSON)
 	assert.Equal(t, OutputFormat("yaml"), OutputFormatYAML)
+	assert.Equal(t, OutputFormat("junit"), OutputFormatJUnit)
+	assert.Equal(t, OutputFormat("sarif"), OutputFormatSARIF)
+	assert.Equal(t, OutputFormat("policyreport"), OutputFormatPolicyReport)
 }
 
 func TestNewReporter(t *testing.T) {
@@ -48,6 +51,24 @@ func TestNewReporter(t *testing.T) {
 			verbose:  false,
 			wantType: "*reporter.YAMLReporter",
 		},
+		{
+			name:     "junit reporter",
+			format:   OutputFormatJUnit,
+			verbose:  false,
+			wantType: "*reporter.JUnitReporter",
+		},
+		{
+			name:     "sarif reporter",
+			format:   OutputFormatSARIF,
+			verbose:  false,
+			wantType: "*reporter.SARIFReporter",
+		},
+		{
+			name:     "policyreport reporter",
+			format:   OutputFormatPolicyReport,
+			verbose:  false,
+			wantType: "*reporter.PolicyReportReporter",
+		},
 		{
 			name:     "default reporter",
 			format:   OutputFormat("unknown"),
@@ -102,6 +123,8 @@ func TestJSONReporter_Report(t *testing.T) {
 
 	err := reporter.Report(results)
 	require.NoError(t, err)
+	assert.Empty(t, buf.String(), "Nothing is written before Flush")
+	require.NoError(t, reporter.Flush())
 
 	// Verify JSON output
 	var output kaptestv1.ValidatingAdmissionPolicyTestStatus
@@ -144,6 +167,7 @@ func TestYAMLReporter_Report(t *testing.T) {
 
 	err := reporter.Report(results)
 	require.NoError(t, err)
+	require.NoError(t, reporter.Flush())
 
 	// Verify YAML output
 	var output kaptestv1.ValidatingAdmissionPolicyTestStatus
@@ -155,6 +179,53 @@ func TestYAMLReporter_Report(t *testing.T) {
 	assert.True(t, output.Results[0].Success)
 }
 
+func TestJSONReporter_SeveralTestFiles(t *testing.T) {
+	buf := &bytes.Buffer{}
+	reporter := &JSONReporter{baseReporter: baseReporter{writer: buf}}
+
+	// Results of several test files are written as one document
+	require.NoError(t, reporter.Report(&kaptestv1.ValidatingAdmissionPolicyTestStatus{
+		TestFile: "tests/replicas.yaml",
+		Results:  []kaptestv1.TestResult{{Name: "allowed", Success: true}, {Name: "denied", Success: false}},
+		Summary:  kaptestv1.TestSummary{Total: 2, Successful: 1, Failed: 1},
+	}))
+	require.NoError(t, reporter.Report(&kaptestv1.ValidatingAdmissionPolicyTestStatus{
+		TestFile: "tests/labels.yaml",
+		Results:  []kaptestv1.TestResult{{Name: "labeled", Success: true}},
+		Summary:  kaptestv1.TestSummary{Total: 1, Successful: 1},
+	}))
+	require.NoError(t, reporter.Flush())
+
+	var output statusList
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &output))
+	require.Len(t, output.Items, 2)
+	assert.Equal(t, "tests/replicas.yaml", output.Items[0].TestFile)
+	assert.Equal(t, "tests/labels.yaml", output.Items[1].TestFile)
+	assert.Equal(t, "labeled", output.Items[1].Results[0].Name)
+	assert.Equal(t, kaptestv1.TestSummary{Total: 3, Successful: 2, Failed: 1}, output.Summary)
+}
+
+func TestYAMLReporter_SeveralTestFiles(t *testing.T) {
+	buf := &bytes.Buffer{}
+	reporter := &YAMLReporter{baseReporter: baseReporter{writer: buf}}
+
+	require.NoError(t, reporter.Report(&kaptestv1.ValidatingAdmissionPolicyTestStatus{
+		Results: []kaptestv1.TestResult{{Name: "allowed", Success: true}},
+		Summary: kaptestv1.TestSummary{Total: 1, Successful: 1},
+	}))
+	require.NoError(t, reporter.Report(&kaptestv1.ValidatingAdmissionPolicyTestStatus{
+		Results: []kaptestv1.TestResult{{Name: "denied", Success: false}},
+		Summary: kaptestv1.TestSummary{Total: 1, Failed: 1},
+	}))
+	require.NoError(t, reporter.Flush())
+
+	var output statusList
+	require.NoError(t, yaml.Unmarshal(buf.Bytes(), &output))
+	require.Len(t, output.Items, 2)
+	assert.Equal(t, "denied", output.Items[1].Results[0].Name)
+	assert.Equal(t, kaptestv1.TestSummary{Total: 2, Successful: 1, Failed: 1}, output.Summary)
+}
+
 func TestTableReporter_Report(t *testing.T) {
 	buf := &bytes.Buffer{}
 	reporter := &TableReporter{
@@ -206,6 +277,214 @@ func TestTableReporter_Report(t *testing.T) {
 	assert.Contains(t, output, "...")  // Should have truncation
 }
 
+func TestTableReporter_ReportResult(t *testing.T) {
+	buf := &bytes.Buffer{}
+	reporter := &TableReporter{baseReporter: baseReporter{writer: buf}}
+
+	// Rows are output as the results come, before the status summarizing them
+	require.NoError(t, ReportResult(reporter, &kaptestv1.TestResult{
+		Name:           "pods/web",
+		Success:        true,
+		ActualResponse: &kaptestv1.ResponseDetails{Allowed: true},
+	}))
+	require.NoError(t, ReportResult(reporter, &kaptestv1.TestResult{
+		Name:           "pods/db",
+		Success:        false,
+		Details:        "expected result (allowed=true) and actual result (allowed=false) does not match",
+		ActualResponse: &kaptestv1.ResponseDetails{Allowed: false, Reason: "Invalid", Message: "team label is required"},
+	}))
+	assert.Contains(t, buf.String(), "pods/web")
+	assert.Contains(t, buf.String(), "pods/db")
+	assert.NotContains(t, buf.String(), "Total:")
+
+	// Only the failed result is kept for the details after the summary
+	assert.Len(t, reporter.streamed, 1)
+
+	reporter.verbose = true
+	require.NoError(t, reporter.Report(&kaptestv1.ValidatingAdmissionPolicyTestStatus{
+		Summary: kaptestv1.TestSummary{Total: 2, Successful: 1, Failed: 1},
+	}))
+
+	output := buf.String()
+	assert.Equal(t, 1, strings.Count(output, "Test Name"))
+	assert.Contains(t, output, "Total: 2")
+	assert.Contains(t, output, "Failed Test Details:")
+	assert.Contains(t, output, "Test: pods/db")
+	assert.NotContains(t, output, "Test: pods/web")
+	assert.Nil(t, reporter.streamed)
+}
+
+func TestJSONReporter_ReportResult(t *testing.T) {
+	buf := &bytes.Buffer{}
+	reporter := &JSONReporter{baseReporter: baseReporter{writer: buf}}
+
+	// Results reported one at a time belong to the next status
+	require.NoError(t, ReportResult(reporter, &kaptestv1.TestResult{Name: "pods/web", Success: true}))
+	require.NoError(t, ReportResult(reporter, &kaptestv1.TestResult{Name: "pods/db"}))
+	require.NoError(t, reporter.Report(&kaptestv1.ValidatingAdmissionPolicyTestStatus{
+		Engine:  "native",
+		Summary: kaptestv1.TestSummary{Total: 2, Successful: 1, Failed: 1},
+	}))
+	require.NoError(t, reporter.Flush())
+
+	var output kaptestv1.ValidatingAdmissionPolicyTestStatus
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &output))
+	require.Len(t, output.Results, 2)
+	assert.Equal(t, "pods/web", output.Results[0].Name)
+	assert.Equal(t, "pods/db", output.Results[1].Name)
+	assert.Equal(t, "native", output.Engine)
+	assert.Equal(t, kaptestv1.TestSummary{Total: 2, Successful: 1, Failed: 1}, output.Summary)
+}
+
+func TestTableReporter_ReportBaseline(t *testing.T) {
+	buf := &bytes.Buffer{}
+	reporter := &TableReporter{
+		baseReporter: baseReporter{
+			writer:  buf,
+			verbose: false,
+		},
+	}
+
+	results := &kaptestv1.ValidatingAdmissionPolicyTestStatus{
+		Results: []kaptestv1.TestResult{
+			{
+				Name:           "pod.v1/known",
+				Success:        false,
+				ActualResponse: &kaptestv1.ResponseDetails{Allowed: false},
+				PolicyResults:  []kaptestv1.PolicyResult{{PolicyName: "no-latest-tag", Allowed: false, Baselined: true}},
+			},
+			{
+				Name:           "pod.v1/new",
+				Success:        false,
+				ActualResponse: &kaptestv1.ResponseDetails{Allowed: false},
+				PolicyResults:  []kaptestv1.PolicyResult{{PolicyName: "no-latest-tag", Allowed: false}},
+			},
+		},
+		Summary: kaptestv1.TestSummary{Total: 2, Failed: 2},
+		Baseline: &kaptestv1.BaselineReport{
+			File:  "baseline.json",
+			New:   1,
+			Known: 1,
+			Fixed: []kaptestv1.BaselineViolation{{
+				Policy:     "no-latest-tag",
+				Validation: "spec.validations[0]",
+				Resource:   kaptestv1.ResourceReference{APIVersion: "v1", Kind: "Pod", Namespace: "apps", Name: "web"},
+			}},
+		},
+	}
+	require.NoError(t, reporter.Report(results))
+
+	output := buf.String()
+	assert.Regexp(t, `pod\.v1/known\s+KNOWN`, output)
+	assert.Regexp(t, `pod\.v1/new\s+FAIL`, output)
+	assert.Contains(t, output, "Baseline (baseline.json):")
+	assert.Contains(t, output, "New: 1 | Known: 1 | Fixed: 1")
+	assert.Contains(t, output, "FIXED Pod apps/web policy 'no-latest-tag' spec.validations[0]")
+}
+
+func TestTableReporter_ReportImpact(t *testing.T) {
+	buf := &bytes.Buffer{}
+	reporter := &TableReporter{
+		baseReporter: baseReporter{
+			writer:  buf,
+			verbose: false,
+		},
+	}
+
+	pod := func(name string) kaptestv1.ResourceReference {
+		return kaptestv1.ResourceReference{APIVersion: "v1", Kind: "Pod", Namespace: "apps", Name: name}
+	}
+	results := &kaptestv1.ValidatingAdmissionPolicyTestStatus{
+		Results: []kaptestv1.TestResult{
+			{Name: "pod.v1/web", ActualResponse: &kaptestv1.ResponseDetails{Allowed: false, Message: "latest tag is not allowed"}},
+			{Name: "pod.v1/api", Success: true, ActualResponse: &kaptestv1.ResponseDetails{Allowed: true}},
+		},
+		Summary: kaptestv1.TestSummary{Total: 2, Successful: 1, Failed: 1},
+		Impact: &kaptestv1.ImpactReport{
+			Old:          []string{"git:HEAD~1:policies/"},
+			New:          []string{"policies/"},
+			Evaluated:    10,
+			NewlyDenied:  1,
+			NewlyAllowed: 1,
+			Results: []kaptestv1.ImpactResult{
+				{
+					Change:   kaptestv1.ImpactNewlyDenied,
+					Resource: pod("web"),
+					Old:      kaptestv1.ResponseDetails{Allowed: true},
+					New:      kaptestv1.ResponseDetails{Allowed: false, Message: "latest tag is not allowed"},
+					DeniedBy: []string{"no-latest-tag"},
+				},
+				{
+					Change:           kaptestv1.ImpactNewlyAllowed,
+					Resource:         pod("api"),
+					Old:              kaptestv1.ResponseDetails{Allowed: false, Message: "team label is required"},
+					New:              kaptestv1.ResponseDetails{Allowed: true},
+					NoLongerDeniedBy: []string{"label-required"},
+				},
+				{
+					Change:   kaptestv1.ImpactMessageChanged,
+					Resource: pod("db"),
+					Old:      kaptestv1.ResponseDetails{Allowed: false, Message: "team label is required"},
+					New:      kaptestv1.ResponseDetails{Allowed: false, Message: "team and owner labels are required"},
+				},
+			},
+		},
+	}
+	require.NoError(t, reporter.Report(results))
+
+	output := buf.String()
+	assert.Contains(t, output, "Impact (git:HEAD~1:policies/ -> policies/):")
+	assert.Contains(t, output, "Evaluated: 10 | Newly denied: 1 | Newly allowed: 1 | Message changed: 0")
+	assert.Contains(t, output, "NEWLY DENIED Pod apps/web by 'no-latest-tag': latest tag is not allowed")
+	assert.Contains(t, output, "NEWLY ALLOWED Pod apps/api no longer denied by 'label-required'")
+	assert.Contains(t, output, "CHANGED Pod apps/db: team label is required -> team and owner labels are required")
+}
+
+func TestTableReporter_ReportWaivers(t *testing.T) {
+	buf := &bytes.Buffer{}
+	reporter := &TableReporter{
+		baseReporter: baseReporter{
+			writer:  buf,
+			verbose: false,
+		},
+	}
+
+	results := &kaptestv1.ValidatingAdmissionPolicyTestStatus{
+		Results: []kaptestv1.TestResult{
+			{
+				Name:           "deployment.apps/v1/api",
+				Success:        true,
+				Waived:         true,
+				ActualResponse: &kaptestv1.ResponseDetails{Allowed: true},
+				PolicyResults: []kaptestv1.PolicyResult{{
+					PolicyName: "replica-limit",
+					Allowed:    false,
+					Waiver:     &kaptestv1.WaiverReference{Name: "legacy-apps", Expires: "2027-03-31", Ticket: "OPS-1234"},
+				}},
+			},
+			{
+				Name:           "pod.v1/web",
+				Success:        false,
+				ActualResponse: &kaptestv1.ResponseDetails{Allowed: false, Message: "latest tag is not allowed"},
+				PolicyResults: []kaptestv1.PolicyResult{{
+					PolicyName: "no-latest-tag",
+					Allowed:    false,
+					Waiver:     &kaptestv1.WaiverReference{Name: "latest-tags", Expires: "2026-01-31", Expired: true},
+				}},
+			},
+		},
+		Summary: kaptestv1.TestSummary{Total: 2, Successful: 1, Failed: 1},
+	}
+	require.NoError(t, reporter.Report(results))
+
+	output := buf.String()
+	assert.Regexp(t, `deployment\.apps/v1/api\s+WAIVED\s+policy 'replica-limit' waived by 'legacy-apps' until 2027-03-31 \(OPS-1234\)`, output)
+	assert.Regexp(t, `pod\.v1/web\s+FAIL`, output)
+	assert.Contains(t, output, "Waivers:")
+	assert.Contains(t, output, "WAIVED deployment.apps/v1/api policy 'replica-limit' waived by 'legacy-apps' until 2027-03-31 (OPS-1234)")
+	assert.Contains(t, output, "EXPIRED pod.v1/web policy 'no-latest-tag' waiver 'latest-tags' expired on 2026-01-31")
+}
+
 func TestTableReporter_ReportVerbose(t *testing.T) {
 	buf := &bytes.Buffer{}
 	reporter := &TableReporter{
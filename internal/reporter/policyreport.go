@@ -0,0 +1,71 @@
+package reporter
+
+import (
+	"fmt"
+	"time"
+
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	sigsyaml "sigs.k8s.io/yaml"
+
+	"github.com/yashirook/kube-vap-test/internal/policyreport"
+	kaptestv1 "github.com/yashirook/kube-vap-test/pkg/apis/admission/v1"
+)
+
+// PolicyReportReporter outputs wgpolicyk8s.io/v1alpha2 PolicyReport and ClusterPolicyReport objects,
+// one per namespace of the checked resources, as a multi-document YAML stream
+type PolicyReportReporter struct {
+	baseReporter
+	policies []*admissionregistrationv1.ValidatingAdmissionPolicy
+	// now returns the timestamp of the report results
+	now func() time.Time
+	// builder builds the reports of the results reported one at a time
+	builder *policyreport.Builder
+}
+
+// SetPolicies sets the evaluated policies, whose validations become the rules of the results
+func (r *PolicyReportReporter) SetPolicies(policies []*admissionregistrationv1.ValidatingAdmissionPolicy) {
+	r.policies = policies
+}
+
+// ReportResult adds the result of a resource to the policy reports
+func (r *PolicyReportReporter) ReportResult(result *kaptestv1.TestResult) error {
+	r.reportBuilder().Add(result)
+	return nil
+}
+
+// Report outputs test results as policy reports
+func (r *PolicyReportReporter) Report(results *kaptestv1.ValidatingAdmissionPolicyTestStatus) error {
+	builder := r.reportBuilder()
+	r.builder = nil
+	for i := range results.Results {
+		builder.Add(&results.Results[i])
+	}
+
+	for i, report := range builder.Reports() {
+		data, err := sigsyaml.Marshal(report)
+		if err != nil {
+			return fmt.Errorf("failed to marshal %s: %w", report.Kind, err)
+		}
+		if i > 0 {
+			if _, err := fmt.Fprintln(r.writer, "---"); err != nil {
+				return err
+			}
+		}
+		if _, err := r.writer.Write(data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// reportBuilder returns the builder of the reports of the next status, creating it on first use
+func (r *PolicyReportReporter) reportBuilder() *policyreport.Builder {
+	if r.builder == nil {
+		now := time.Now
+		if r.now != nil {
+			now = r.now
+		}
+		r.builder = policyreport.NewBuilder(r.policies, now())
+	}
+	return r.builder
+}
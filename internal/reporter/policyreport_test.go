@@ -0,0 +1,100 @@
+package reporter
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	sigsyaml "sigs.k8s.io/yaml"
+
+	"github.com/yashirook/kube-vap-test/internal/policyreport"
+	kaptestv1 "github.com/yashirook/kube-vap-test/pkg/apis/admission/v1"
+)
+
+func TestPolicyReportReporter_Report(t *testing.T) {
+	buf := &bytes.Buffer{}
+	reporter := &PolicyReportReporter{
+		baseReporter: baseReporter{
+			writer:  buf,
+			verbose: false,
+		},
+		now: func() time.Time { return time.Unix(1740830400, 0) },
+	}
+	SetPolicies(reporter, []*admissionregistrationv1.ValidatingAdmissionPolicy{
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "label-required"},
+			Spec: admissionregistrationv1.ValidatingAdmissionPolicySpec{
+				Validations: []admissionregistrationv1.Validation{
+					{Expression: "has(object.metadata.labels.team)", Message: "team label is required"},
+				},
+			},
+		},
+	})
+
+	results := &kaptestv1.ValidatingAdmissionPolicyTestStatus{
+		Results: []kaptestv1.TestResult{
+			{
+				Name:          "namespace.v1/apps",
+				Resource:      &kaptestv1.ResourceReference{APIVersion: "v1", Kind: "Namespace", Name: "apps"},
+				PolicyResults: []kaptestv1.PolicyResult{{PolicyName: "label-required", Allowed: true}},
+			},
+			{
+				Name:     "pod.v1/web",
+				Resource: &kaptestv1.ResourceReference{APIVersion: "v1", Kind: "Pod", Namespace: "apps", Name: "web"},
+				PolicyResults: []kaptestv1.PolicyResult{
+					{
+						PolicyName: "label-required",
+						Allowed:    false,
+						Violations: []kaptestv1.PolicyViolation{{Field: "spec.validations[0]", Message: "team label is required"}},
+					},
+				},
+			},
+		},
+	}
+	require.NoError(t, reporter.Report(results))
+
+	// Reports are YAML documents, the ClusterPolicyReport first
+	documents := strings.Split(buf.String(), "---\n")
+	require.Len(t, documents, 2)
+
+	var cluster, namespaced policyreport.Report
+	require.NoError(t, sigsyaml.Unmarshal([]byte(documents[0]), &cluster))
+	require.NoError(t, sigsyaml.Unmarshal([]byte(documents[1]), &namespaced))
+	assert.Equal(t, "ClusterPolicyReport", cluster.Kind)
+	assert.Equal(t, "wgpolicyk8s.io/v1alpha2", cluster.APIVersion)
+	assert.Equal(t, policyreport.Summary{Pass: 1}, cluster.Summary)
+
+	assert.Equal(t, "PolicyReport", namespaced.Kind)
+	assert.Equal(t, "apps", namespaced.Namespace)
+	assert.Equal(t, policyreport.Summary{Fail: 1}, namespaced.Summary)
+	require.Len(t, namespaced.Results, 1)
+	assert.Equal(t, "fail", namespaced.Results[0].Result)
+	assert.Equal(t, int64(1740830400), namespaced.Results[0].Timestamp.Seconds)
+}
+
+func TestPolicyReportReporter_ReportResult(t *testing.T) {
+	buf := &bytes.Buffer{}
+	reporter := &PolicyReportReporter{baseReporter: baseReporter{writer: buf}}
+
+	// Results reported one at a time are added to the reports of the next status
+	for _, name := range []string{"web", "db"} {
+		require.NoError(t, ReportResult(reporter, &kaptestv1.TestResult{
+			Name:          "pod.v1/" + name,
+			Resource:      &kaptestv1.ResourceReference{APIVersion: "v1", Kind: "Pod", Namespace: "apps", Name: name},
+			PolicyResults: []kaptestv1.PolicyResult{{PolicyName: "label-required", Allowed: name == "web"}},
+		}))
+	}
+	assert.Empty(t, buf.String())
+	require.NoError(t, reporter.Report(&kaptestv1.ValidatingAdmissionPolicyTestStatus{}))
+
+	var report policyreport.Report
+	require.NoError(t, sigsyaml.Unmarshal(buf.Bytes(), &report))
+	assert.Equal(t, "apps", report.Namespace)
+	assert.Equal(t, policyreport.Summary{Pass: 1, Fail: 1}, report.Summary)
+	assert.Nil(t, reporter.builder)
+}
@@ -0,0 +1,285 @@
+package reporter
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+
+	"github.com/yashirook/kube-vap-test/internal/engine/waiver"
+	kaptestv1 "github.com/yashirook/kube-vap-test/pkg/apis/admission/v1"
+)
+
+const (
+	sarifVersion = "2.1.0"
+	sarifSchema  = "https://json.schemastore.org/sarif-2.1.0.json"
+	// sarifInformationURI is the home page of the tool in SARIF reports
+	sarifInformationURI = "https://github.com/yashirook/kube-vap-test"
+)
+
+// sarifLog is the root object of a SARIF report
+type sarifLog struct {
+	Version string     `json:"version"`
+	Schema  string     `json:"$schema"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+// sarifRun is a single run of the tool
+type sarifRun struct {
+	Tool sarifTool `json:"tool"`
+	// Columns are counted in characters, like CEL source positions
+	ColumnKind string        `json:"columnKind"`
+	Results    []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+// sarifRule describes a policy
+type sarifRule struct {
+	ID                   string                 `json:"id"`
+	Name                 string                 `json:"name"`
+	ShortDescription     sarifMessage           `json:"shortDescription"`
+	FullDescription      sarifMessage           `json:"fullDescription"`
+	DefaultConfiguration sarifRuleConfiguration `json:"defaultConfiguration"`
+}
+
+type sarifRuleConfiguration struct {
+	Level string `json:"level"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+// sarifResult is a policy violation or expression error
+type sarifResult struct {
+	RuleID    string          `json:"ruleId,omitempty"`
+	RuleIndex *int            `json:"ruleIndex,omitempty"`
+	Level     string          `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations,omitempty"`
+	// RelatedLocations are the Kustomize patches applied to the resource
+	RelatedLocations []sarifRelatedLocation `json:"relatedLocations,omitempty"`
+	// BaselineState tells new violations from violations in the baseline, when comparing with one
+	BaselineState string `json:"baselineState,omitempty"`
+	// Suppressions mark waived violations
+	Suppressions []sarifSuppression `json:"suppressions,omitempty"`
+}
+
+// sarifSuppression is a waiver accepting a violation
+type sarifSuppression struct {
+	Kind          string `json:"kind"`
+	Status        string `json:"status"`
+	Justification string `json:"justification,omitempty"`
+}
+
+// sarifRelatedLocation is a location related to a result, such as a patch changing the resource
+type sarifRelatedLocation struct {
+	ID               int                    `json:"id"`
+	PhysicalLocation *sarifPhysicalLocation `json:"physicalLocation"`
+	Message          sarifMessage           `json:"message"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation *sarifPhysicalLocation `json:"physicalLocation,omitempty"`
+	LogicalLocations []sarifLogicalLocation `json:"logicalLocations,omitempty"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           *sarifRegion          `json:"region,omitempty"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+type sarifRegion struct {
+	StartLine   int `json:"startLine"`
+	StartColumn int `json:"startColumn,omitempty"`
+}
+
+type sarifLogicalLocation struct {
+	FullyQualifiedName string `json:"fullyQualifiedName"`
+	Kind               string `json:"kind"`
+}
+
+// SARIFReporter outputs reports in SARIF 2.1.0 format for code scanning
+// Every policy is a rule, and every policy denying a resource is a result located at the
+// manifest of the resource. CEL expression errors are results located at the policy
+type SARIFReporter struct {
+	baseReporter
+	pendingResults
+	policies []*admissionregistrationv1.ValidatingAdmissionPolicy
+}
+
+// SetPolicies sets the evaluated policies, which become the rules of the report
+func (r *SARIFReporter) SetPolicies(policies []*admissionregistrationv1.ValidatingAdmissionPolicy) {
+	r.policies = policies
+}
+
+// Report outputs test results in SARIF format
+func (r *SARIFReporter) Report(results *kaptestv1.ValidatingAdmissionPolicyTestStatus) error {
+	results = r.take(results)
+	run := sarifRun{
+		Tool: sarifTool{Driver: sarifDriver{
+			Name:           defaultSuiteName,
+			InformationURI: sarifInformationURI,
+			Rules:          []sarifRule{},
+		}},
+		ColumnKind: "unicodeCodePoints",
+		Results:    []sarifResult{},
+	}
+
+	ruleIndexes := make(map[string]int)
+	for _, policy := range r.policies {
+		ruleIndexes[policy.Name] = len(run.Tool.Driver.Rules)
+		run.Tool.Driver.Rules = append(run.Tool.Driver.Rules, sarifPolicyRule(policy))
+	}
+	newResult := func(policyName string, message string, location sarifLocation) sarifResult {
+		result := sarifResult{RuleID: policyName, Level: "error", Message: sarifMessage{Text: message}}
+		if location.PhysicalLocation != nil || len(location.LogicalLocations) > 0 {
+			result.Locations = []sarifLocation{location}
+		}
+		if index, ok := ruleIndexes[policyName]; ok {
+			result.RuleIndex = &index
+		}
+		return result
+	}
+
+	reportedErrors := make(map[string]bool)
+	for _, result := range results.Results {
+		location := sarifResourceLocation(result)
+		for _, policyResult := range result.PolicyResults {
+			if policyResult.Allowed {
+				continue
+			}
+			message := policyResult.Message
+			if message == "" {
+				message = fmt.Sprintf("%s denied by policy '%s'", result.Name, policyResult.PolicyName)
+			}
+			sarifResult := newResult(policyResult.PolicyName, message, location)
+			for i, patch := range result.Patches {
+				sarifResult.RelatedLocations = append(sarifResult.RelatedLocations, sarifRelatedLocation{
+					ID:               i,
+					PhysicalLocation: sarifFileLocation(patch),
+					Message:          sarifMessage{Text: "Kustomize patch"},
+				})
+			}
+			if results.Baseline != nil {
+				sarifResult.BaselineState = "new"
+				if policyResult.Baselined {
+					sarifResult.BaselineState = "unchanged"
+				}
+			}
+			// Waived violations are suppressed rather than dropped, so code scanning shows them as dismissed
+			if waiver.Waived(policyResult) {
+				sarifResult.Suppressions = []sarifSuppression{{
+					Kind:          "external",
+					Status:        "accepted",
+					Justification: "WAIVED: " + waiver.Describe(policyResult.Waiver),
+				}}
+			}
+			run.Results = append(run.Results, sarifResult)
+		}
+
+		// Expression errors are reported once, at the expression in the policy file
+		for _, expressionErr := range result.ExpressionErrors {
+			key := fmt.Sprintf("%s/%s/%s", expressionErr.Policy, expressionErr.Field, expressionErr.Message)
+			if reportedErrors[key] {
+				continue
+			}
+			reportedErrors[key] = true
+
+			location := sarifLocation{}
+			if expressionErr.Location != nil {
+				location.PhysicalLocation = sarifFileLocation(*expressionErr.Location)
+			}
+			message := fmt.Sprintf("%s: %s", expressionErr.Field, expressionErr.Message)
+			run.Results = append(run.Results, newResult(expressionErr.Policy, message, location))
+		}
+	}
+
+	data, err := json.MarshalIndent(sarifLog{Version: sarifVersion, Schema: sarifSchema, Runs: []sarifRun{run}}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal results to SARIF: %w", err)
+	}
+
+	_, err = fmt.Fprintln(r.writer, string(data))
+	return err
+}
+
+// sarifPolicyRule returns the rule of a policy, described by the messages of its validations
+func sarifPolicyRule(policy *admissionregistrationv1.ValidatingAdmissionPolicy) sarifRule {
+	var messages []string
+	for _, validation := range policy.Spec.Validations {
+		message := validation.Message
+		if message == "" {
+			// The default message of the apiserver
+			message = fmt.Sprintf("failed expression: %s", strings.TrimSpace(validation.Expression))
+		}
+		messages = append(messages, message)
+	}
+	description := fmt.Sprintf("ValidatingAdmissionPolicy %s", policy.Name)
+	if len(messages) > 0 {
+		description = messages[0]
+	}
+
+	fullDescription := description
+	if len(messages) > 1 {
+		fullDescription = strings.Join(messages, "\n")
+	}
+	return sarifRule{
+		ID:                   policy.Name,
+		Name:                 policy.Name,
+		ShortDescription:     sarifMessage{Text: description},
+		FullDescription:      sarifMessage{Text: fullDescription},
+		DefaultConfiguration: sarifRuleConfiguration{Level: "error"},
+	}
+}
+
+// sarifResourceLocation returns the location of the resource of a result, in its manifest
+// file when known
+func sarifResourceLocation(result kaptestv1.TestResult) sarifLocation {
+	location := sarifLocation{
+		LogicalLocations: []sarifLogicalLocation{{FullyQualifiedName: result.Name, Kind: "resource"}},
+	}
+	// Documents of standard input have no file to locate
+	if result.Source != nil && result.Source.Document == 0 {
+		location.PhysicalLocation = sarifFileLocation(*result.Source)
+	}
+	return location
+}
+
+// sarifFileLocation returns the physical location of a position in a file
+func sarifFileLocation(source kaptestv1.SourceLocation) *sarifPhysicalLocation {
+	location := &sarifPhysicalLocation{ArtifactLocation: sarifArtifactLocation{URI: sarifURI(source.File)}}
+	if source.Line > 0 {
+		location.Region = &sarifRegion{StartLine: source.Line, StartColumn: source.Column}
+	}
+	return location
+}
+
+// sarifURI returns the URI of a file, relative to the working directory when the path is relative,
+// which code scanning resolves against the repository root
+func sarifURI(path string) string {
+	if filepath.IsAbs(path) {
+		path = filepath.ToSlash(path)
+		if !strings.HasPrefix(path, "/") {
+			// Windows drive letters
+			path = "/" + path
+		}
+		return "file://" + path
+	}
+	return filepath.ToSlash(filepath.Clean(path))
+}
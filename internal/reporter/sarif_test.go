@@ -0,0 +1,215 @@
+package reporter
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	kaptestv1 "github.com/yashirook/kube-vap-test/pkg/apis/admission/v1"
+)
+
+func TestSARIFReporter_Report(t *testing.T) {
+	buf := &bytes.Buffer{}
+	reporter := &SARIFReporter{
+		baseReporter: baseReporter{
+			writer:  buf,
+			verbose: false,
+		},
+	}
+	SetPolicies(reporter, []*admissionregistrationv1.ValidatingAdmissionPolicy{
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "no-latest-tag"},
+			Spec: admissionregistrationv1.ValidatingAdmissionPolicySpec{
+				Validations: []admissionregistrationv1.Validation{
+					{Expression: "true", Message: "latest tag is not allowed"},
+					{Expression: "object.spec.replicas <= 5"},
+				},
+			},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "replica-limit"},
+		},
+	})
+
+	expressionError := kaptestv1.ExpressionError{
+		Policy:   "replica-limit",
+		Field:    "spec.validations[0].expression",
+		Message:  "no such key: replicas",
+		Location: &kaptestv1.SourceLocation{File: "policies/replicas.yaml", Line: 18, Column: 20},
+	}
+	results := &kaptestv1.ValidatingAdmissionPolicyTestStatus{
+		Results: []kaptestv1.TestResult{
+			{
+				Name:           "pod.v1/allowed",
+				Success:        true,
+				ActualResponse: &kaptestv1.ResponseDetails{Allowed: true},
+				PolicyResults:  []kaptestv1.PolicyResult{{PolicyName: "no-latest-tag", Allowed: true}},
+				Source:         &kaptestv1.SourceLocation{File: "manifests/pods.yaml", Line: 1},
+			},
+			{
+				Name:           "pod.v1/denied",
+				Success:        false,
+				ActualResponse: &kaptestv1.ResponseDetails{Allowed: false},
+				PolicyResults: []kaptestv1.PolicyResult{
+					{PolicyName: "no-latest-tag", Allowed: false, Message: "latest tag is not allowed"},
+					{PolicyName: "replica-limit", Allowed: false},
+				},
+				Source:           &kaptestv1.SourceLocation{File: "manifests/pods.yaml", Line: 12},
+				ExpressionErrors: []kaptestv1.ExpressionError{expressionError},
+			},
+			{
+				Name:             "pod.v1/also-denied",
+				Success:          false,
+				ActualResponse:   &kaptestv1.ResponseDetails{Allowed: false},
+				PolicyResults:    []kaptestv1.PolicyResult{{PolicyName: "replica-limit", Allowed: false}},
+				ExpressionErrors: []kaptestv1.ExpressionError{expressionError},
+			},
+		},
+	}
+	require.NoError(t, reporter.Report(results))
+
+	var log sarifLog
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &log))
+	assert.Equal(t, "2.1.0", log.Version)
+	require.Len(t, log.Runs, 1)
+	run := log.Runs[0]
+
+	// Policies are rules described by their validation messages
+	require.Len(t, run.Tool.Driver.Rules, 2)
+	rule := run.Tool.Driver.Rules[0]
+	assert.Equal(t, "no-latest-tag", rule.ID)
+	assert.Equal(t, "latest tag is not allowed", rule.ShortDescription.Text)
+	assert.Equal(t, "latest tag is not allowed\nfailed expression: object.spec.replicas <= 5", rule.FullDescription.Text)
+	assert.Equal(t, "ValidatingAdmissionPolicy replica-limit", run.Tool.Driver.Rules[1].ShortDescription.Text)
+
+	// Denials are located at the manifest, expression errors at the policy, once
+	require.Len(t, run.Results, 4)
+	denied := run.Results[0]
+	assert.Equal(t, "no-latest-tag", denied.RuleID)
+	require.NotNil(t, denied.RuleIndex)
+	assert.Equal(t, 0, *denied.RuleIndex)
+	assert.Equal(t, "error", denied.Level)
+	assert.Equal(t, "latest tag is not allowed", denied.Message.Text)
+	require.Len(t, denied.Locations, 1)
+	assert.Equal(t, "manifests/pods.yaml", denied.Locations[0].PhysicalLocation.ArtifactLocation.URI)
+	assert.Equal(t, 12, denied.Locations[0].PhysicalLocation.Region.StartLine)
+	assert.Equal(t, "pod.v1/denied", denied.Locations[0].LogicalLocations[0].FullyQualifiedName)
+
+	assert.Equal(t, "pod.v1/denied denied by policy 'replica-limit'", run.Results[1].Message.Text)
+	assert.Equal(t, 1, *run.Results[1].RuleIndex)
+
+	expression := run.Results[2]
+	assert.Equal(t, "replica-limit", expression.RuleID)
+	assert.Equal(t, "spec.validations[0].expression: no such key: replicas", expression.Message.Text)
+	assert.Equal(t, "policies/replicas.yaml", expression.Locations[0].PhysicalLocation.ArtifactLocation.URI)
+	assert.Equal(t, &sarifRegion{StartLine: 18, StartColumn: 20}, expression.Locations[0].PhysicalLocation.Region)
+
+	// Resources without a manifest only have a logical location
+	assert.Nil(t, run.Results[3].Locations[0].PhysicalLocation)
+}
+
+func TestSARIFReporter_Baseline(t *testing.T) {
+	buf := &bytes.Buffer{}
+	reporter := &SARIFReporter{baseReporter: baseReporter{writer: buf}}
+
+	require.NoError(t, reporter.Report(&kaptestv1.ValidatingAdmissionPolicyTestStatus{
+		Results: []kaptestv1.TestResult{
+			{
+				Name:           "pod.v1/denied",
+				ActualResponse: &kaptestv1.ResponseDetails{Allowed: false},
+				PolicyResults: []kaptestv1.PolicyResult{
+					{PolicyName: "no-latest-tag", Allowed: false, Baselined: true},
+					{PolicyName: "replica-limit", Allowed: false},
+				},
+			},
+		},
+		Baseline: &kaptestv1.BaselineReport{File: "baseline.json", New: 1, Known: 1},
+	}))
+
+	var log sarifLog
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &log))
+	results := log.Runs[0].Results
+	require.Len(t, results, 2)
+	assert.Equal(t, "unchanged", results[0].BaselineState)
+	assert.Equal(t, "new", results[1].BaselineState)
+}
+
+func TestSARIFReporter_Waived(t *testing.T) {
+	buf := &bytes.Buffer{}
+	reporter := &SARIFReporter{baseReporter: baseReporter{writer: buf}}
+
+	require.NoError(t, reporter.Report(&kaptestv1.ValidatingAdmissionPolicyTestStatus{
+		Results: []kaptestv1.TestResult{
+			{
+				Name:           "deployment.apps/v1/api",
+				Waived:         true,
+				ActualResponse: &kaptestv1.ResponseDetails{Allowed: true},
+				PolicyResults: []kaptestv1.PolicyResult{
+					{PolicyName: "replica-limit", Allowed: false, Waiver: &kaptestv1.WaiverReference{Name: "legacy-apps", Expires: "2027-03-31", Reason: "migration pending"}},
+					{PolicyName: "no-latest-tag", Allowed: false, Waiver: &kaptestv1.WaiverReference{Name: "latest-tags", Expires: "2026-01-31", Expired: true}},
+				},
+			},
+		},
+	}))
+
+	var log sarifLog
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &log))
+	results := log.Runs[0].Results
+	require.Len(t, results, 2)
+	assert.Equal(t, []sarifSuppression{{
+		Kind:          "external",
+		Status:        "accepted",
+		Justification: "WAIVED: waived by 'legacy-apps' until 2027-03-31: migration pending",
+	}}, results[0].Suppressions)
+	// Expired waivers no longer suppress their violations
+	assert.Empty(t, results[1].Suppressions)
+}
+
+func TestSARIFReporter_Patches(t *testing.T) {
+	buf := &bytes.Buffer{}
+	reporter := &SARIFReporter{baseReporter: baseReporter{writer: buf}}
+
+	require.NoError(t, reporter.Report(&kaptestv1.ValidatingAdmissionPolicyTestStatus{
+		Results: []kaptestv1.TestResult{
+			{
+				Name:           "deployment.apps/v1/prod-web",
+				ActualResponse: &kaptestv1.ResponseDetails{Allowed: false},
+				Source:         &kaptestv1.SourceLocation{File: "base/deployment.yaml", Line: 2},
+				Patches:        []kaptestv1.SourceLocation{{File: "overlays/prod/replicas.yaml", Line: 1}, {File: "overlays/prod/kustomization.yaml"}},
+				PolicyResults:  []kaptestv1.PolicyResult{{PolicyName: "replica-limit", Allowed: false}},
+			},
+		},
+	}))
+
+	var log sarifLog
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &log))
+	results := log.Runs[0].Results
+	require.Len(t, results, 1)
+	assert.Equal(t, "base/deployment.yaml", results[0].Locations[0].PhysicalLocation.ArtifactLocation.URI)
+	// Patches are related locations
+	assert.Equal(t, []sarifRelatedLocation{
+		{
+			ID: 0,
+			PhysicalLocation: &sarifPhysicalLocation{
+				ArtifactLocation: sarifArtifactLocation{URI: "overlays/prod/replicas.yaml"},
+				Region:           &sarifRegion{StartLine: 1},
+			},
+			Message: sarifMessage{Text: "Kustomize patch"},
+		},
+		{
+			ID:               1,
+			PhysicalLocation: &sarifPhysicalLocation{ArtifactLocation: sarifArtifactLocation{URI: "overlays/prod/kustomization.yaml"}},
+			Message:          sarifMessage{Text: "Kustomize patch"},
+		},
+	}, results[0].RelatedLocations)
+}
+
+func TestSARIFURI(t *testing.T) {
+	assert.Equal(t, "manifests/pods.yaml", sarifURI("./manifests/pods.yaml"))
+	assert.Equal(t, "file:///tmp/pods.yaml", sarifURI("/tmp/pods.yaml"))
+}
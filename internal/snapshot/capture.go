@@ -0,0 +1,328 @@
+package snapshot
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+
+	"github.com/yashirook/kube-vap-test/internal/loader"
+)
+
+// Options selects the objects a snapshot captures next to the policies, bindings, parameters
+// and namespaces of the cluster
+type Options struct {
+	// Resource arguments of the objects, resolved as check does; the resources intercepted by
+	// the policies of the cluster when empty
+	Resources []string
+	// List selects the objects of the resources
+	List loader.ListOptions
+}
+
+// Capture writes a snapshot of the cluster as a gzipped tar archive
+// Objects are collected in temporary files while they are listed, so only a chunk of them is
+// held at once
+func Capture(ctx context.Context, clusterLoader *loader.ClusterResourceLoader, opts Options, w io.Writer) (*Manifest, error) {
+	manifest := &Manifest{APIVersion: APIVersion, Kind: Kind, CreatedAt: metav1.NewTime(time.Now().UTC())}
+
+	data, unavailable, err := captureDiscovery(clusterLoader.Discovery())
+	if err != nil {
+		return nil, err
+	}
+	manifest.UnavailableGroupVersions = unavailable
+	manifest.ServerVersion, err = clusterLoader.Discovery().ServerVersion()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get server version: %w", err)
+	}
+
+	dir, err := os.MkdirTemp("", "vaptest-snapshot-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+	defer os.RemoveAll(dir)
+	objects := &objectWriter{dir: dir, files: make(map[schema.GroupVersionResource]*objectFile)}
+	defer objects.close()
+
+	mapper := clusterLoader.RESTMapper()
+	mapping := func(group, kind string) (*meta.RESTMapping, error) {
+		mapping, err := mapper.RESTMapping(schema.GroupKind{Group: group, Kind: kind}, "v1")
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve %s: %w", kind, err)
+		}
+		return mapping, nil
+	}
+	all := loader.ListOptions{ChunkSize: opts.List.ChunkSize}
+
+	// Policies and bindings, which select the parameters and objects to capture
+	policyMapping, err := mapping(admissionregistrationv1.GroupName, "ValidatingAdmissionPolicy")
+	if err != nil {
+		return nil, err
+	}
+	var policies []*admissionregistrationv1.ValidatingAdmissionPolicy
+	err = clusterLoader.VisitResources(ctx, policyMapping, all, func(obj *unstructured.Unstructured) error {
+		policy := &admissionregistrationv1.ValidatingAdmissionPolicy{}
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, policy); err != nil {
+			return fmt.Errorf("failed to convert policy %s: %w", obj.GetName(), err)
+		}
+		policies = append(policies, policy)
+		return objects.add(policyMapping, obj)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to capture policies: %w", err)
+	}
+
+	bindingMapping, err := mapping(admissionregistrationv1.GroupName, "ValidatingAdmissionPolicyBinding")
+	if err != nil {
+		return nil, err
+	}
+	var bindings []*admissionregistrationv1.ValidatingAdmissionPolicyBinding
+	err = clusterLoader.VisitResources(ctx, bindingMapping, all, func(obj *unstructured.Unstructured) error {
+		binding := &admissionregistrationv1.ValidatingAdmissionPolicyBinding{}
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, binding); err != nil {
+			return fmt.Errorf("failed to convert policy binding %s: %w", obj.GetName(), err)
+		}
+		bindings = append(bindings, binding)
+		return objects.add(bindingMapping, obj)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to capture policy bindings: %w", err)
+	}
+
+	// Parameters and namespaces are captured whatever the selected objects, since every object
+	// is evaluated with them
+	params, err := clusterLoader.LoadParams(ctx, policies, bindings)
+	if err != nil {
+		return nil, err
+	}
+	for _, param := range params {
+		gvk := param.GroupVersionKind()
+		paramMapping, err := mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve parameter kind %s: %w", gvk.Kind, err)
+		}
+		if err := objects.add(paramMapping, param); err != nil {
+			return nil, err
+		}
+	}
+
+	namespaceMapping, err := mapping(corev1.GroupName, "Namespace")
+	if err != nil {
+		return nil, err
+	}
+	err = clusterLoader.VisitResources(ctx, namespaceMapping, all, func(obj *unstructured.Unstructured) error {
+		return objects.add(namespaceMapping, obj)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to capture namespaces: %w", err)
+	}
+
+	// Objects to check, selected as check selects them
+	var mappings []*meta.RESTMapping
+	if len(opts.Resources) > 0 {
+		mappings, err = clusterLoader.ResolveResources(opts.Resources)
+	} else {
+		mappings, err = clusterLoader.ResolvePolicyResources(policies)
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, mapping := range mappings {
+		// Objects of cluster-scoped resources are in no namespace
+		if len(opts.List.Namespaces) > 0 && mapping.Scope.Name() != meta.RESTScopeNameNamespace {
+			continue
+		}
+		if _, err := objects.touch(mapping); err != nil {
+			return nil, err
+		}
+		err := clusterLoader.VisitResources(ctx, mapping, opts.List, func(obj *unstructured.Unstructured) error {
+			return objects.add(mapping, obj)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to capture %s: %w", loader.ResourceType(mapping), err)
+		}
+	}
+
+	manifest.Resources = objects.resources()
+	if err := writeArchive(w, manifest, data, objects); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// captureDiscovery returns the API groups and resources the cluster serves
+// Group versions whose discovery fails, such as those of unavailable aggregated APIs, are left
+// out and returned
+func captureDiscovery(client discovery.DiscoveryInterface) (*discoveryData, []string, error) {
+	groups, err := client.ServerGroups()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to discover API groups: %w", err)
+	}
+
+	data := &discoveryData{Groups: groups}
+	var unavailable []string
+	for _, group := range groups.Groups {
+		for _, version := range group.Versions {
+			resources, err := client.ServerResourcesForGroupVersion(version.GroupVersion)
+			if err != nil {
+				unavailable = append(unavailable, version.GroupVersion)
+				continue
+			}
+			data.Resources = append(data.Resources, resources)
+		}
+	}
+	return data, unavailable, nil
+}
+
+// objectWriter collects the objects of a snapshot in a temporary list file per resource
+type objectWriter struct {
+	dir   string
+	files map[schema.GroupVersionResource]*objectFile
+	order []schema.GroupVersionResource
+}
+
+// objectFile is the list file of the objects of a resource
+type objectFile struct {
+	resource Resource
+	file     *os.File
+	// Objects captured, which are written once when selected several times
+	seen map[string]bool
+}
+
+// touch creates the list file of a resource, so that resources without objects are captured
+func (w *objectWriter) touch(mapping *meta.RESTMapping) (*objectFile, error) {
+	gvr := mapping.Resource
+	if file, ok := w.files[gvr]; ok {
+		return file, nil
+	}
+
+	file, err := os.CreateTemp(w.dir, "objects-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	if _, err := io.WriteString(file, `{"apiVersion":"v1","kind":"List","items":[`); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to write temporary file: %w", err)
+	}
+
+	objects := &objectFile{
+		resource: Resource{Group: gvr.Group, Version: gvr.Version, Resource: gvr.Resource, File: objectsFile(gvr)},
+		file:     file,
+		seen:     make(map[string]bool),
+	}
+	w.files[gvr] = objects
+	w.order = append(w.order, gvr)
+	return objects, nil
+}
+
+// add writes an object to the list file of its resource
+func (w *objectWriter) add(mapping *meta.RESTMapping, obj *unstructured.Unstructured) error {
+	objects, err := w.touch(mapping)
+	if err != nil {
+		return err
+	}
+	key := obj.GetNamespace() + "/" + obj.GetName()
+	if objects.seen[key] {
+		return nil
+	}
+	objects.seen[key] = true
+
+	// Items of list responses may leave their kind to the list
+	if obj.GetKind() == "" {
+		obj.SetGroupVersionKind(mapping.GroupVersionKind)
+	}
+	data, err := json.Marshal(obj.Object)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s/%s: %w", obj.GetNamespace(), obj.GetName(), err)
+	}
+	if objects.resource.Count > 0 {
+		data = append([]byte(","), data...)
+	}
+	if _, err := objects.file.Write(data); err != nil {
+		return fmt.Errorf("failed to write temporary file: %w", err)
+	}
+	objects.resource.Count++
+	return nil
+}
+
+// resources returns the resources captured, in the order they were first captured
+func (w *objectWriter) resources() []Resource {
+	resources := make([]Resource, len(w.order))
+	for i, gvr := range w.order {
+		resources[i] = w.files[gvr].resource
+	}
+	return resources
+}
+
+// close closes the list files
+func (w *objectWriter) close() {
+	for _, objects := range w.files {
+		objects.file.Close()
+	}
+}
+
+// writeArchive writes the manifest, the discovery data and the list files as a gzipped tar archive
+func writeArchive(w io.Writer, manifest *Manifest, data *discoveryData, objects *objectWriter) error {
+	gzipWriter := gzip.NewWriter(w)
+	tarWriter := tar.NewWriter(gzipWriter)
+	modTime := manifest.CreatedAt.Time
+
+	for _, entry := range []struct {
+		name  string
+		value interface{}
+	}{{manifestFile, manifest}, {discoveryFile, data}} {
+		content, err := json.MarshalIndent(entry.value, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to encode %s: %w", entry.name, err)
+		}
+		header := &tar.Header{Name: entry.name, Mode: 0o644, Size: int64(len(content)), ModTime: modTime}
+		if err := tarWriter.WriteHeader(header); err != nil {
+			return fmt.Errorf("failed to write snapshot: %w", err)
+		}
+		if _, err := tarWriter.Write(content); err != nil {
+			return fmt.Errorf("failed to write snapshot: %w", err)
+		}
+	}
+
+	for _, gvr := range objects.order {
+		objectFile := objects.files[gvr]
+		if _, err := io.WriteString(objectFile.file, "]}\n"); err != nil {
+			return fmt.Errorf("failed to write temporary file: %w", err)
+		}
+		info, err := objectFile.file.Stat()
+		if err != nil {
+			return fmt.Errorf("failed to write snapshot: %w", err)
+		}
+		if _, err := objectFile.file.Seek(0, io.SeekStart); err != nil {
+			return fmt.Errorf("failed to write snapshot: %w", err)
+		}
+
+		header := &tar.Header{Name: objectFile.resource.File, Mode: 0o644, Size: info.Size(), ModTime: modTime}
+		if err := tarWriter.WriteHeader(header); err != nil {
+			return fmt.Errorf("failed to write snapshot: %w", err)
+		}
+		if _, err := io.Copy(tarWriter, objectFile.file); err != nil {
+			return fmt.Errorf("failed to write snapshot: %w", err)
+		}
+	}
+
+	if err := tarWriter.Close(); err != nil {
+		return fmt.Errorf("failed to write snapshot: %w", err)
+	}
+	if err := gzipWriter.Close(); err != nil {
+		return fmt.Errorf("failed to write snapshot: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,223 @@
+package snapshot
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	discoveryfake "k8s.io/client-go/discovery/fake"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	clienttesting "k8s.io/client-go/testing"
+
+	"github.com/yashirook/kube-vap-test/internal/loader"
+)
+
+// Snapshot is a cluster captured in a snapshot archive
+type Snapshot struct {
+	Manifest  Manifest
+	discovery discoveryData
+	// Objects of each resource of the manifest
+	objects map[schema.GroupVersionResource][]*unstructured.Unstructured
+}
+
+// Open reads the snapshot archive of a file
+func Open(path string) (*Snapshot, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open snapshot: %w", err)
+	}
+	defer file.Close()
+	return Read(file)
+}
+
+// Read reads a snapshot archive
+func Read(r io.Reader) (*Snapshot, error) {
+	gzipReader, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read snapshot: %w", err)
+	}
+	defer gzipReader.Close()
+
+	entries := make(map[string][]byte)
+	tarReader := tar.NewReader(gzipReader)
+	for {
+		header, err := tarReader.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read snapshot: %w", err)
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		content, err := io.ReadAll(tarReader)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read snapshot entry %s: %w", header.Name, err)
+		}
+		entries[header.Name] = content
+	}
+
+	snapshot := &Snapshot{objects: make(map[schema.GroupVersionResource][]*unstructured.Unstructured)}
+	content, ok := entries[manifestFile]
+	if !ok {
+		return nil, fmt.Errorf("not a snapshot archive: %s is missing", manifestFile)
+	}
+	if err := json.Unmarshal(content, &snapshot.Manifest); err != nil {
+		return nil, fmt.Errorf("failed to decode %s: %w", manifestFile, err)
+	}
+	if err := validateManifest(&snapshot.Manifest); err != nil {
+		return nil, err
+	}
+
+	content, ok = entries[discoveryFile]
+	if !ok {
+		return nil, fmt.Errorf("not a snapshot archive: %s is missing", discoveryFile)
+	}
+	if err := json.Unmarshal(content, &snapshot.discovery); err != nil {
+		return nil, fmt.Errorf("failed to decode %s: %w", discoveryFile, err)
+	}
+	if snapshot.discovery.Groups == nil {
+		snapshot.discovery.Groups = &metav1.APIGroupList{}
+	}
+
+	for _, resource := range snapshot.Manifest.Resources {
+		content, ok := entries[resource.File]
+		if !ok {
+			return nil, fmt.Errorf("snapshot entry %s is missing", resource.File)
+		}
+		list := &unstructured.UnstructuredList{}
+		if err := list.UnmarshalJSON(content); err != nil {
+			return nil, fmt.Errorf("failed to decode %s: %w", resource.File, err)
+		}
+		gvr := resource.GroupVersionResource()
+		for i := range list.Items {
+			snapshot.objects[gvr] = append(snapshot.objects[gvr], &list.Items[i])
+		}
+	}
+	return snapshot, nil
+}
+
+// Captured reports whether the snapshot holds the objects of a resource
+// The cluster served by the snapshot has no objects of the other resources
+func (s *Snapshot) Captured(gvr schema.GroupVersionResource) bool {
+	for _, resource := range s.Manifest.Resources {
+		if resource.GroupVersionResource() == gvr {
+			return true
+		}
+	}
+	return false
+}
+
+// Loader returns a loader serving the snapshot as a cluster
+// Resources are discovered and resolved as they were in the cluster, and objects are listed with
+// label and field selectors, in chunks of any size
+func (s *Snapshot) Loader() (*loader.ClusterResourceLoader, error) {
+	discoveryClient := &discoveryClient{
+		FakeDiscovery: &discoveryfake.FakeDiscovery{
+			Fake:               &clienttesting.Fake{Resources: s.discovery.Resources},
+			FakedServerVersion: s.Manifest.ServerVersion,
+		},
+		groups: s.discovery.Groups,
+	}
+
+	// Every listable resource can be listed, those without objects in the snapshot list none
+	listKinds := make(map[schema.GroupVersionResource]string)
+	for _, resources := range s.discovery.Resources {
+		gv, err := schema.ParseGroupVersion(resources.GroupVersion)
+		if err != nil {
+			return nil, fmt.Errorf("invalid group version %s in snapshot: %w", resources.GroupVersion, err)
+		}
+		for _, resource := range resources.APIResources {
+			if !strings.Contains(resource.Name, "/") {
+				listKinds[gv.WithResource(resource.Name)] = resource.Kind + "List"
+			}
+		}
+	}
+
+	dynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), listKinds)
+	tracker := dynamicClient.Tracker()
+	for gvr, objects := range s.objects {
+		if _, ok := listKinds[gvr]; !ok {
+			return nil, fmt.Errorf("resource %s of snapshot is not discovered", gvr.String())
+		}
+		for _, obj := range objects {
+			if err := tracker.Create(gvr, obj, obj.GetNamespace()); err != nil {
+				return nil, fmt.Errorf("failed to add %s %s/%s: %w", gvr.Resource, obj.GetNamespace(), obj.GetName(), err)
+			}
+		}
+	}
+	// The fake client selects labels only
+	dynamicClient.PrependReactor("list", "*", selectFields(tracker))
+
+	return loader.NewClusterResourceLoaderForClients(dynamicClient, discoveryClient)
+}
+
+// discoveryClient serves the discovery data of a snapshot, with the API groups in the priority
+// order of the cluster rather than in the random order of the fake
+type discoveryClient struct {
+	*discoveryfake.FakeDiscovery
+	groups *metav1.APIGroupList
+}
+
+// ServerGroups returns the API groups of the snapshot
+func (d *discoveryClient) ServerGroups() (*metav1.APIGroupList, error) {
+	return d.groups, nil
+}
+
+// selectFields returns a reactor listing the objects of the tracker that match the field selector
+// of list requests, reading the fields of the selector from the objects
+func selectFields(tracker clienttesting.ObjectTracker) clienttesting.ReactionFunc {
+	return func(action clienttesting.Action) (bool, runtime.Object, error) {
+		listAction, ok := action.(clienttesting.ListActionImpl)
+		if !ok {
+			return false, nil, nil
+		}
+		selector := listAction.GetListRestrictions().Fields
+		if selector == nil || selector.Empty() {
+			return false, nil, nil
+		}
+
+		list, err := tracker.List(listAction.GetResource(), listAction.GetKind(), listAction.GetNamespace())
+		if err != nil {
+			return true, nil, err
+		}
+		items, err := meta.ExtractList(list)
+		if err != nil {
+			return true, nil, err
+		}
+		var selected []runtime.Object
+		for _, item := range items {
+			obj, ok := item.(*unstructured.Unstructured)
+			if ok && selector.Matches(objectFields(obj, selector)) {
+				selected = append(selected, item)
+			}
+		}
+		return true, list, meta.SetList(list, selected)
+	}
+}
+
+// objectFields returns the values of the fields of a selector in an object, empty when unset
+func objectFields(obj *unstructured.Unstructured, selector fields.Selector) fields.Set {
+	set := fields.Set{}
+	for _, requirement := range selector.Requirements() {
+		value, found, err := unstructured.NestedFieldNoCopy(obj.Object, strings.Split(requirement.Field, ".")...)
+		if found && err == nil && value != nil {
+			set[requirement.Field] = fmt.Sprint(value)
+		} else {
+			set[requirement.Field] = ""
+		}
+	}
+	return set
+}
@@ -0,0 +1,84 @@
+// Package snapshot captures the state of a cluster a check audits in a portable archive: the
+// policies, bindings, parameters and namespaces of the cluster, the objects to check, and the
+// discovery data the resources are resolved with. The archive is then served as a cluster, so
+// that the audit can be reproduced offline without credentials
+package snapshot
+
+import (
+	"fmt"
+	"path"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/version"
+)
+
+const (
+	// APIVersion is the API version of snapshot manifests
+	APIVersion = "admission.k8s.io/v1"
+	// Kind is the kind of snapshot manifests
+	Kind = "ClusterSnapshot"
+
+	// manifestFile is the archive entry of the manifest
+	manifestFile = "snapshot.json"
+	// discoveryFile is the archive entry of the discovery data
+	discoveryFile = "discovery.json"
+	// objectsDir is the archive directory of the object lists, one per resource
+	objectsDir = "objects"
+)
+
+// Manifest describes the contents of a snapshot archive
+type Manifest struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	// CreatedAt is the time the snapshot was taken
+	CreatedAt metav1.Time `json:"createdAt"`
+	// ServerVersion is the version of the apiserver of the cluster
+	ServerVersion *version.Info `json:"serverVersion,omitempty"`
+	// UnavailableGroupVersions lists the API group versions whose discovery failed, whose
+	// resources the snapshot does not serve
+	UnavailableGroupVersions []string `json:"unavailableGroupVersions,omitempty"`
+	// Resources lists the resources whose objects the snapshot holds
+	Resources []Resource `json:"resources"`
+}
+
+// Resource is a resource whose objects a snapshot holds
+type Resource struct {
+	Group    string `json:"group,omitempty"`
+	Version  string `json:"version"`
+	Resource string `json:"resource"`
+	// File is the archive entry of the list of objects
+	File string `json:"file"`
+	// Count is the number of objects
+	Count int `json:"count"`
+}
+
+// GroupVersionResource returns the group, version and resource of the objects
+func (r Resource) GroupVersionResource() schema.GroupVersionResource {
+	return schema.GroupVersionResource{Group: r.Group, Version: r.Version, Resource: r.Resource}
+}
+
+// discoveryData holds the API groups and resources the cluster serves, which RESTMappers are
+// built from
+type discoveryData struct {
+	// Groups are in the priority order of the cluster, preferred versions first
+	Groups    *metav1.APIGroupList      `json:"groups"`
+	Resources []*metav1.APIResourceList `json:"resources"`
+}
+
+// objectsFile returns the archive entry of the objects of a resource
+func objectsFile(gvr schema.GroupVersionResource) string {
+	group := gvr.Group
+	if group == "" {
+		group = "core"
+	}
+	return path.Join(objectsDir, group, gvr.Version, gvr.Resource+".json")
+}
+
+// validateManifest checks that a manifest describes a snapshot this version can read
+func validateManifest(manifest *Manifest) error {
+	if manifest.APIVersion != APIVersion || manifest.Kind != Kind {
+		return fmt.Errorf("unsupported snapshot %s %s (must be %s %s)", manifest.APIVersion, manifest.Kind, APIVersion, Kind)
+	}
+	return nil
+}
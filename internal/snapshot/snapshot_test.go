@@ -0,0 +1,268 @@
+package snapshot
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/version"
+	discoveryfake "k8s.io/client-go/discovery/fake"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	clienttesting "k8s.io/client-go/testing"
+
+	"github.com/yashirook/kube-vap-test/internal/loader"
+)
+
+var listVerbs = metav1.Verbs{"get", "list"}
+
+// object returns an object of a kind
+func object(apiVersion, kind, namespace, name string, labels map[string]string) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{Object: map[string]interface{}{}}
+	obj.SetAPIVersion(apiVersion)
+	obj.SetKind(kind)
+	obj.SetNamespace(namespace)
+	obj.SetName(name)
+	obj.SetLabels(labels)
+	return obj
+}
+
+// newSourceCluster returns a loader of a fake cluster with a policy auditing pods with a
+// ConfigMap parameter
+func newSourceCluster(t *testing.T) *loader.ClusterResourceLoader {
+	resources := []*metav1.APIResourceList{
+		{
+			GroupVersion: "v1",
+			APIResources: []metav1.APIResource{
+				{Name: "pods", Kind: "Pod", Namespaced: true, Verbs: listVerbs, ShortNames: []string{"po"}},
+				{Name: "pods/status", Kind: "Pod", Namespaced: true, Verbs: metav1.Verbs{"get"}},
+				{Name: "namespaces", Kind: "Namespace", Verbs: listVerbs},
+				{Name: "configmaps", Kind: "ConfigMap", Namespaced: true, Verbs: listVerbs},
+				{Name: "secrets", Kind: "Secret", Namespaced: true, Verbs: listVerbs},
+			},
+		},
+		{
+			GroupVersion: "admissionregistration.k8s.io/v1",
+			APIResources: []metav1.APIResource{
+				{Name: "validatingadmissionpolicies", Kind: "ValidatingAdmissionPolicy", Verbs: listVerbs},
+				{Name: "validatingadmissionpolicybindings", Kind: "ValidatingAdmissionPolicyBinding", Verbs: listVerbs},
+			},
+		},
+	}
+	discoveryClient := &discoveryfake.FakeDiscovery{
+		Fake:               &clienttesting.Fake{Resources: resources},
+		FakedServerVersion: &version.Info{GitVersion: "v1.32.3"},
+	}
+
+	policy := object("admissionregistration.k8s.io/v1", "ValidatingAdmissionPolicy", "", "pod-limits", nil)
+	require.NoError(t, unstructured.SetNestedField(policy.Object, map[string]interface{}{
+		"paramKind": map[string]interface{}{"apiVersion": "v1", "kind": "ConfigMap"},
+		"matchConstraints": map[string]interface{}{
+			"resourceRules": []interface{}{map[string]interface{}{
+				"apiGroups":   []interface{}{""},
+				"apiVersions": []interface{}{"v1"},
+				"resources":   []interface{}{"pods"},
+				"operations":  []interface{}{"CREATE", "UPDATE"},
+			}},
+		},
+		"validations": []interface{}{map[string]interface{}{"expression": "has(object.metadata.labels) && 'app' in object.metadata.labels", "message": "app label required"}},
+	}, "spec"))
+	binding := object("admissionregistration.k8s.io/v1", "ValidatingAdmissionPolicyBinding", "", "pod-limits", nil)
+	require.NoError(t, unstructured.SetNestedField(binding.Object, map[string]interface{}{
+		"policyName":        "pod-limits",
+		"paramRef":          map[string]interface{}{"name": "limits"},
+		"validationActions": []interface{}{"Deny"},
+	}, "spec"))
+
+	objects := map[schema.GroupVersionResource][]*unstructured.Unstructured{
+		{Group: "admissionregistration.k8s.io", Version: "v1", Resource: "validatingadmissionpolicies"}:       {policy},
+		{Group: "admissionregistration.k8s.io", Version: "v1", Resource: "validatingadmissionpolicybindings"}: {binding},
+		{Version: "v1", Resource: "namespaces"}: {
+			object("v1", "Namespace", "", "team-a", map[string]string{"env": "prod"}),
+			object("v1", "Namespace", "", "team-b", nil),
+			object("v1", "Namespace", "", "kube-system", nil),
+		},
+		{Version: "v1", Resource: "configmaps"}: {
+			object("v1", "ConfigMap", "team-a", "limits", nil),
+			object("v1", "ConfigMap", "team-a", "other", nil),
+		},
+		{Version: "v1", Resource: "pods"}: {
+			object("v1", "Pod", "team-a", "web", map[string]string{"app": "web"}),
+			object("v1", "Pod", "team-b", "db", map[string]string{"app": "db"}),
+			object("v1", "Pod", "kube-system", "dns", nil),
+		},
+		{Version: "v1", Resource: "secrets"}: {object("v1", "Secret", "team-a", "token", nil)},
+	}
+
+	listKinds := make(map[schema.GroupVersionResource]string)
+	for _, list := range resources {
+		gv := schema.GroupVersion{Version: "v1"}
+		if list.GroupVersion != "v1" {
+			gv.Group = "admissionregistration.k8s.io"
+		}
+		for _, resource := range list.APIResources {
+			listKinds[gv.WithResource(resource.Name)] = resource.Kind + "List"
+		}
+	}
+	dynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), listKinds)
+	for gvr, objs := range objects {
+		for _, obj := range objs {
+			require.NoError(t, dynamicClient.Tracker().Create(gvr, obj, obj.GetNamespace()))
+		}
+	}
+	dynamicClient.PrependReactor("list", "*", selectFields(dynamicClient.Tracker()))
+
+	clusterLoader, err := loader.NewClusterResourceLoaderForClients(dynamicClient, discoveryClient)
+	require.NoError(t, err)
+	return clusterLoader
+}
+
+// names returns the namespaced names of the objects a loader lists for a resource
+func names(t *testing.T, clusterLoader *loader.ClusterResourceLoader, resource string, opts loader.ListOptions) []string {
+	mappings, err := clusterLoader.ResolveResources([]string{resource})
+	require.NoError(t, err)
+
+	var got []string
+	err = clusterLoader.VisitResources(context.Background(), mappings[0], opts, func(obj *unstructured.Unstructured) error {
+		got = append(got, obj.GetNamespace()+"/"+obj.GetName())
+		return nil
+	})
+	require.NoError(t, err)
+	return got
+}
+
+func TestCaptureAndRead(t *testing.T) {
+	var archive bytes.Buffer
+	manifest, err := Capture(context.Background(), newSourceCluster(t), Options{
+		List: loader.ListOptions{ExcludeNamespaces: []string{"kube-system"}, ChunkSize: 2},
+	}, &archive)
+	require.NoError(t, err)
+
+	// Pods are captured for the resource rules of the policy, and the parameter it selects
+	wantResources := []Resource{
+		{Group: "admissionregistration.k8s.io", Version: "v1", Resource: "validatingadmissionpolicies", File: "objects/admissionregistration.k8s.io/v1/validatingadmissionpolicies.json", Count: 1},
+		{Group: "admissionregistration.k8s.io", Version: "v1", Resource: "validatingadmissionpolicybindings", File: "objects/admissionregistration.k8s.io/v1/validatingadmissionpolicybindings.json", Count: 1},
+		{Version: "v1", Resource: "configmaps", File: "objects/core/v1/configmaps.json", Count: 1},
+		{Version: "v1", Resource: "namespaces", File: "objects/core/v1/namespaces.json", Count: 3},
+		{Version: "v1", Resource: "pods", File: "objects/core/v1/pods.json", Count: 2},
+	}
+	assert.Equal(t, wantResources, manifest.Resources)
+	assert.Equal(t, "v1.32.3", manifest.ServerVersion.GitVersion)
+
+	snapshot, err := Read(&archive)
+	require.NoError(t, err)
+	assert.Equal(t, wantResources, snapshot.Manifest.Resources)
+	assert.True(t, snapshot.Captured(schema.GroupVersionResource{Version: "v1", Resource: "pods"}))
+	assert.False(t, snapshot.Captured(schema.GroupVersionResource{Version: "v1", Resource: "secrets"}))
+
+	offline, err := snapshot.Loader()
+	require.NoError(t, err)
+	serverVersion, err := offline.Discovery().ServerVersion()
+	require.NoError(t, err)
+	assert.Equal(t, "v1.32.3", serverVersion.GitVersion)
+
+	// The policies, bindings, parameters and namespaces of the cluster are served offline
+	bundle, err := offline.LoadBundle(loader.ResourceSource{Type: loader.SourceTypeCluster})
+	require.NoError(t, err)
+	require.Len(t, bundle.Policies, 1)
+	assert.Equal(t, "pod-limits", bundle.Policies[0].Name)
+	require.Len(t, bundle.Bindings, 1)
+	assert.Equal(t, "limits", bundle.Bindings[0].Spec.ParamRef.Name)
+
+	params, err := offline.LoadParams(context.Background(), bundle.Policies, bundle.Bindings)
+	require.NoError(t, err)
+	require.Len(t, params, 1)
+	assert.Equal(t, "limits", params[0].GetName())
+
+	namespaces, err := offline.LoadNamespaces(context.Background())
+	require.NoError(t, err)
+	require.Len(t, namespaces, 3)
+
+	// Resources are resolved with the discovery data of the cluster
+	mappings, err := offline.ResolvePolicyResources(bundle.Policies)
+	require.NoError(t, err)
+	require.Len(t, mappings, 1)
+	assert.Equal(t, "pods.v1", loader.ResourceType(mappings[0]))
+
+	// Objects are selected by labels and fields, resources that were not captured have none
+	assert.Equal(t, []string{"team-a/web", "team-b/db"}, names(t, offline, "po", loader.ListOptions{}))
+	assert.Equal(t, []string{"team-a/web"}, names(t, offline, "pods", loader.ListOptions{ExcludeNamespaces: []string{"team-b"}}))
+	assert.Equal(t, []string{"team-b/db"}, names(t, offline, "pods", loader.ListOptions{LabelSelector: "app=db"}))
+	assert.Equal(t, []string{"team-a/web"}, names(t, offline, "pods", loader.ListOptions{FieldSelector: "metadata.name=web"}))
+	assert.Empty(t, names(t, offline, "secrets", loader.ListOptions{}))
+}
+
+func TestCaptureResources(t *testing.T) {
+	var archive bytes.Buffer
+	manifest, err := Capture(context.Background(), newSourceCluster(t), Options{
+		Resources: []string{"secrets", "namespaces"},
+		List:      loader.ListOptions{Namespaces: []string{"team-a"}},
+	}, &archive)
+	require.NoError(t, err)
+
+	// Cluster-scoped resources are skipped in namespaces, but every namespace is captured
+	counts := make(map[string]int)
+	for _, resource := range manifest.Resources {
+		counts[resource.Resource] = resource.Count
+	}
+	assert.Equal(t, map[string]int{
+		"validatingadmissionpolicies":       1,
+		"validatingadmissionpolicybindings": 1,
+		"configmaps":                        1,
+		"namespaces":                        3,
+		"secrets":                           1,
+	}, counts)
+}
+
+func TestReadErrors(t *testing.T) {
+	archive := func(entries map[string]string) *bytes.Buffer {
+		var buf bytes.Buffer
+		gzipWriter := gzip.NewWriter(&buf)
+		tarWriter := tar.NewWriter(gzipWriter)
+		for name, content := range entries {
+			require.NoError(t, tarWriter.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Size: int64(len(content))}))
+			_, err := tarWriter.Write([]byte(content))
+			require.NoError(t, err)
+		}
+		require.NoError(t, tarWriter.Close())
+		require.NoError(t, gzipWriter.Close())
+		return &buf
+	}
+
+	tests := []struct {
+		name    string
+		archive *bytes.Buffer
+		wantErr string
+	}{
+		{name: "not gzipped", archive: bytes.NewBufferString("policies: []"), wantErr: "failed to read snapshot"},
+		{name: "no manifest", archive: archive(map[string]string{"discovery.json": "{}"}), wantErr: "snapshot.json is missing"},
+		{
+			name:    "other kind",
+			archive: archive(map[string]string{"snapshot.json": `{"apiVersion":"admission.k8s.io/v1","kind":"ViolationBaseline"}`}),
+			wantErr: "unsupported snapshot admission.k8s.io/v1 ViolationBaseline",
+		},
+		{
+			name: "missing objects",
+			archive: archive(map[string]string{
+				"snapshot.json":  `{"apiVersion":"admission.k8s.io/v1","kind":"ClusterSnapshot","resources":[{"version":"v1","resource":"pods","file":"objects/core/v1/pods.json"}]}`,
+				"discovery.json": "{}",
+			}),
+			wantErr: "snapshot entry objects/core/v1/pods.json is missing",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Read(tt.archive)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+}
@@ -0,0 +1,82 @@
+package source
+
+import (
+	"fmt"
+	"strings"
+
+	kaptestv1 "github.com/yashirook/kube-vap-test/pkg/apis/admission/v1"
+)
+
+// Scalar is the position of a YAML string holding a CEL expression
+type Scalar struct {
+	// File is the path of the file
+	File string
+	// Line and Column of the first character of the expression, starting at 1
+	Line   int
+	Column int
+	// Exact is true when every line of the expression keeps its position in the file,
+	// as in literal block scalars (|) and single-line strings
+	// Positions in folded strings are reported at the start of the string
+	Exact bool
+}
+
+// Locate returns the position in the file of a position in the expression
+// line starts at 1 and column at 0, like CEL source locations
+func (s Scalar) Locate(line, column int) kaptestv1.SourceLocation {
+	if !s.Exact || line < 1 {
+		return kaptestv1.SourceLocation{File: s.File, Line: s.Line, Column: s.Column}
+	}
+	return kaptestv1.SourceLocation{File: s.File, Line: s.Line + line - 1, Column: s.Column + column}
+}
+
+// Policy holds the positions of a policy document and of its expressions
+type Policy struct {
+	// File is the path of the file
+	File string
+	// Line is the line the policy document starts at
+	Line int
+	// Expressions are the positions of the expressions by field path,
+	// e.g. spec.validations[0].expression
+	Expressions map[string]Scalar
+}
+
+// Locate returns the position in the file of a position in an expression of the policy
+// The start of the policy document is returned for unknown fields
+func (p *Policy) Locate(field string, line, column int) kaptestv1.SourceLocation {
+	if scalar, ok := p.Expressions[field]; ok {
+		return scalar.Locate(line, column)
+	}
+	return kaptestv1.SourceLocation{File: p.File, Line: p.Line}
+}
+
+// Format returns a location as file:line:col, leaving out unknown parts
+// Documents of streams without a file are formatted as <stdin>:docN
+func Format(location kaptestv1.SourceLocation) string {
+	switch {
+	case location.Line == 0 && location.Document > 0:
+		return fmt.Sprintf("%s:doc%d", location.File, location.Document)
+	case location.Line == 0:
+		return location.File
+	case location.Column == 0:
+		return fmt.Sprintf("%s:%d", location.File, location.Line)
+	default:
+		return fmt.Sprintf("%s:%d:%d", location.File, location.Line, location.Column)
+	}
+}
+
+// Excerpt returns the line of an expression with a caret under the column
+// line starts at 1 and column at 0, like CEL source locations
+func Excerpt(expression string, line, column int) string {
+	lines := strings.Split(expression, "\n")
+	if line < 1 || line > len(lines) {
+		return ""
+	}
+	text := strings.ReplaceAll(strings.TrimRight(lines[line-1], "\r"), "\t", " ")
+
+	// Align the caret by runes, so that it stays under multi-byte characters
+	runes := []rune(text)
+	if column > len(runes) {
+		column = len(runes)
+	}
+	return fmt.Sprintf("%s\n%s^", text, strings.Repeat(" ", column))
+}
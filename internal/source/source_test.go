@@ -0,0 +1,46 @@
+package source
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	kaptestv1 "github.com/yashirook/kube-vap-test/pkg/apis/admission/v1"
+)
+
+func TestScalarLocate(t *testing.T) {
+	exact := Scalar{File: "policy.yaml", Line: 10, Column: 7, Exact: true}
+	assert.Equal(t, kaptestv1.SourceLocation{File: "policy.yaml", Line: 10, Column: 12}, exact.Locate(1, 5))
+	assert.Equal(t, kaptestv1.SourceLocation{File: "policy.yaml", Line: 12, Column: 7}, exact.Locate(3, 0))
+
+	// Positions in folded strings fall back to the start of the string
+	folded := Scalar{File: "policy.yaml", Line: 10, Column: 7}
+	assert.Equal(t, kaptestv1.SourceLocation{File: "policy.yaml", Line: 10, Column: 7}, folded.Locate(3, 4))
+}
+
+func TestPolicyLocate(t *testing.T) {
+	policy := &Policy{
+		File: "policy.yaml",
+		Line: 3,
+		Expressions: map[string]Scalar{
+			"spec.validations[0].expression": {File: "policy.yaml", Line: 12, Column: 19, Exact: true},
+		},
+	}
+	assert.Equal(t, kaptestv1.SourceLocation{File: "policy.yaml", Line: 12, Column: 21}, policy.Locate("spec.validations[0].expression", 1, 2))
+	assert.Equal(t, kaptestv1.SourceLocation{File: "policy.yaml", Line: 3}, policy.Locate("spec.validations[1].expression", 1, 2))
+}
+
+func TestFormat(t *testing.T) {
+	assert.Equal(t, "policy.yaml", Format(kaptestv1.SourceLocation{File: "policy.yaml"}))
+	assert.Equal(t, "policy.yaml:3", Format(kaptestv1.SourceLocation{File: "policy.yaml", Line: 3}))
+	assert.Equal(t, "policy.yaml:3:14", Format(kaptestv1.SourceLocation{File: "policy.yaml", Line: 3, Column: 14}))
+	assert.Equal(t, "<stdin>:doc2", Format(kaptestv1.SourceLocation{File: "<stdin>", Document: 2}))
+}
+
+func TestExcerpt(t *testing.T) {
+	assert.Equal(t, "object.spec.replicas < 5\n            ^", Excerpt("object.spec.replicas < 5", 1, 12))
+	assert.Equal(t, "  object.b\n         ^", Excerpt("object.a &&\n  object.b", 2, 9))
+	// The caret is aligned by characters, not bytes
+	assert.Equal(t, "'日本' == x\n        ^", Excerpt("'日本' == x", 1, 8))
+	assert.Equal(t, "", Excerpt("x", 2, 0))
+}
@@ -24,6 +24,22 @@ type ValidatingAdmissionPolicyTestSpec struct {
 	// +optional
 	IncludeParameters bool `json:"includeParameters,omitempty"`
 
+	// AdmissionPlugins lists built-in mutating admission plugins to emulate before evaluation
+	// (ServiceAccount, DefaultTolerationSeconds, LimitRanger, DefaultStorageClass, PodSecurity).
+	// LimitRange, StorageClass and ServiceAccount objects in the source are used as fixtures
+	// +optional
+	AdmissionPlugins []string `json:"admissionPlugins,omitempty"`
+
+	// ApplyDefaults applies Kubernetes API defaults (imagePullPolicy, restartPolicy, protocol, ...)
+	// to test objects before evaluation, as the apiserver does before admission
+	// +optional
+	ApplyDefaults bool `json:"applyDefaults,omitempty"`
+
+	// PodSecurity evaluates the Pod Security Admission policy on pod-bearing objects
+	// and reports its verdict next to the policy verdict
+	// +optional
+	PodSecurity *PodSecurityConfig `json:"podSecurity,omitempty"`
+
 	// TestCases is a list of test cases
 	TestCases []TestCase `json:"testCases"`
 }
@@ -45,11 +61,80 @@ type SourceConfig struct {
 	Type SourceType `json:"type,omitempty"`
 
 	// Files is a list of file paths for local source type
-	// Can include directories, which will be expanded to all YAML files
+	// Can include directories, which will be expanded recursively to all YAML and JSON files,
+	// and glob patterns such as policies/**/*.yaml
 	// +optional
 	Files []string `json:"files,omitempty"`
+
+	// Ignore is a list of glob patterns of files and directories to skip when expanding Files
+	// Patterns without a slash match file and directory names at any depth
+	// +optional
+	Ignore []string `json:"ignore,omitempty"`
+}
+
+// PolicyWaiver accepts violations of policies by matching resources until it expires
+type PolicyWaiver struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	// Spec is the specification of the waiver
+	Spec PolicyWaiverSpec `json:"spec"`
 }
 
+// PolicyWaiverSpec is the specification of a waiver
+type PolicyWaiverSpec struct {
+	// Policies are the waived policies
+	Policies []WaivedPolicy `json:"policies"`
+
+	// Resources select the resources whose violations are waived
+	Resources []WaivedResource `json:"resources"`
+
+	// Expires is the last day of the waiver (2006-01-02, in UTC) or its expiry time (RFC 3339)
+	Expires string `json:"expires"`
+
+	// Reason is why the violations are accepted
+	// +optional
+	Reason string `json:"reason,omitempty"`
+
+	// Ticket tracks the fix of the violations
+	// +optional
+	Ticket string `json:"ticket,omitempty"`
+}
+
+// WaivedPolicy is a policy whose violations are waived
+type WaivedPolicy struct {
+	// Name is the name of the policy
+	Name string `json:"name"`
+
+	// Validations are the indexes of the waived validations in spec.validations
+	// Every violation of the policy is waived when empty
+	// +optional
+	Validations []int `json:"validations,omitempty"`
+}
+
+// WaivedResource selects resources whose violations are waived
+// Empty fields match any resource
+type WaivedResource struct {
+	// APIVersion is the API version of the resources, e.g. apps/v1
+	// +optional
+	APIVersion string `json:"apiVersion,omitempty"`
+
+	// Kind is the kind of the resources
+	// +optional
+	Kind string `json:"kind,omitempty"`
+
+	// Namespace is the namespace of the resources
+	// +optional
+	Namespace string `json:"namespace,omitempty"`
+
+	// Name is the name of the resource
+	// +optional
+	Name string `json:"name,omitempty"`
+
+	// Selector selects the resources by label
+	// +optional
+	Selector *metav1.LabelSelector `json:"selector,omitempty"`
+}
 
 // TestCase represents a single test case
 type TestCase struct {
@@ -79,6 +164,10 @@ type TestCase struct {
 	// Operation is the operation to test (CREATE, UPDATE, DELETE, etc.)
 	Operation string `json:"operation"`
 
+	// ApplyDefaults overrides whether API defaults are applied to this test case's objects
+	// +optional
+	ApplyDefaults *bool `json:"applyDefaults,omitempty"`
+
 	// Expected is the expected result of the test
 	Expected ExpectedResult `json:"expected"`
 }
@@ -110,6 +199,30 @@ type ValidatingAdmissionPolicyTestStatus struct {
 	// Summary is a summary of test execution
 	// +optional
 	Summary TestSummary `json:"summary,omitempty"`
+
+	// PodSecurity summarizes how policy verdicts compare with Pod Security Admission
+	// +optional
+	PodSecurity *PodSecuritySummary `json:"podSecurity,omitempty"`
+
+	// Engine is the evaluation engine that produced the results (native, upstream)
+	// +optional
+	Engine string `json:"engine,omitempty"`
+
+	// APIVersions lists the policy API version each policy needs on a target Kubernetes version
+	// +optional
+	APIVersions *APIVersionReport `json:"apiVersions,omitempty"`
+
+	// TestFile is the path of the test definition the results belong to
+	// +optional
+	TestFile string `json:"testFile,omitempty"`
+
+	// Baseline compares the violations with a baseline of accepted violations
+	// +optional
+	Baseline *BaselineReport `json:"baseline,omitempty"`
+
+	// Impact compares the results with those of another version of the policies
+	// +optional
+	Impact *ImpactReport `json:"impact,omitempty"`
 }
 
 // TestResult represents the result of a single test case
@@ -128,6 +241,15 @@ type TestResult struct {
 	// +optional
 	ActualResponse *ResponseDetails `json:"actualResponse,omitempty"`
 
+	// RejectedBy is the built-in admission plugin that rejected the request before the policies
+	// evaluated it
+	// +optional
+	RejectedBy string `json:"rejectedBy,omitempty"`
+
+	// ExpectedResponse is the expected result of the test case
+	// +optional
+	ExpectedResponse *ExpectedResult `json:"expectedResponse,omitempty"`
+
 	// PolicyResults is the evaluation results for each policy (for multiple policies)
 	// +optional
 	PolicyResults []PolicyResult `json:"policyResults,omitempty"`
@@ -135,6 +257,183 @@ type TestResult struct {
 	// Metadata is additional metadata information (such as resource type)
 	// +optional
 	Metadata map[string]string `json:"metadata,omitempty"`
+
+	// PodSecurity is the Pod Security Admission verdict for pod-bearing objects
+	// +optional
+	PodSecurity *PodSecurityResult `json:"podSecurity,omitempty"`
+
+	// Differential is the verdict of the second engine in differential mode
+	// +optional
+	Differential *EngineComparison `json:"differential,omitempty"`
+
+	// Waived indicates every denial of the object is waived, so the object is allowed
+	// +optional
+	Waived bool `json:"waived,omitempty"`
+
+	// Resource identifies the evaluated object of check results
+	// +optional
+	Resource *ResourceReference `json:"resource,omitempty"`
+
+	// Source is the position of the evaluated object in its manifest file
+	// +optional
+	Source *SourceLocation `json:"source,omitempty"`
+
+	// Patches are the Kustomize patches applied to the evaluated object
+	// +optional
+	Patches []SourceLocation `json:"patches,omitempty"`
+
+	// ExpressionErrors are the CEL compilation and evaluation errors of the policy expressions
+	// +optional
+	ExpressionErrors []ExpressionError `json:"expressionErrors,omitempty"`
+}
+
+// ResourceReference identifies a Kubernetes object
+type ResourceReference struct {
+	// APIVersion is the API version of the object
+	APIVersion string `json:"apiVersion,omitempty"`
+
+	// Kind is the kind of the object
+	Kind string `json:"kind,omitempty"`
+
+	// Namespace is the namespace of namespaced objects
+	// +optional
+	Namespace string `json:"namespace,omitempty"`
+
+	// Name is the name of the object
+	Name string `json:"name,omitempty"`
+
+	// UID is the UID of objects read from a cluster
+	// +optional
+	UID string `json:"uid,omitempty"`
+}
+
+// BaselineViolation is a violation of a policy validation by a resource, recorded in a baseline
+type BaselineViolation struct {
+	// Policy is the name of the policy
+	Policy string `json:"policy"`
+
+	// Validation is the path of the failed validation, e.g. spec.validations[0],
+	// empty when the engine does not report validations
+	// +optional
+	Validation string `json:"validation,omitempty"`
+
+	// Resource is the violating object
+	Resource ResourceReference `json:"resource"`
+
+	// Message is the message of the violation when it was recorded
+	// +optional
+	Message string `json:"message,omitempty"`
+}
+
+// BaselineReport compares the violations of a check with a baseline
+type BaselineReport struct {
+	// File is the path of the baseline
+	File string `json:"file"`
+
+	// New is the number of violations not in the baseline
+	New int `json:"new"`
+
+	// Known is the number of violations in the baseline
+	Known int `json:"known"`
+
+	// Fixed lists the violations of the baseline that no longer occur
+	// +optional
+	Fixed []BaselineViolation `json:"fixed,omitempty"`
+}
+
+// ImpactChange is how the admission of a resource changes between two versions of the policies
+type ImpactChange string
+
+const (
+	// ImpactNewlyDenied is a resource denied by the new policies only
+	ImpactNewlyDenied ImpactChange = "NewlyDenied"
+	// ImpactNewlyAllowed is a resource denied by the old policies only
+	ImpactNewlyAllowed ImpactChange = "NewlyAllowed"
+	// ImpactMessageChanged is a resource denied by both versions with different messages
+	ImpactMessageChanged ImpactChange = "MessageChanged"
+)
+
+// ImpactResult is a resource whose admission changes between two versions of the policies
+type ImpactResult struct {
+	// Change is how the admission of the resource changes
+	Change ImpactChange `json:"change"`
+
+	// Resource is the evaluated object
+	Resource ResourceReference `json:"resource"`
+
+	// Source is the position of the object in its manifest file
+	// +optional
+	Source *SourceLocation `json:"source,omitempty"`
+
+	// Old and New are the responses of the old and new policies
+	Old ResponseDetails `json:"old"`
+	New ResponseDetails `json:"new"`
+
+	// DeniedBy lists the policies denying the resource in the new version only
+	// +optional
+	DeniedBy []string `json:"deniedBy,omitempty"`
+
+	// NoLongerDeniedBy lists the policies denying the resource in the old version only
+	// +optional
+	NoLongerDeniedBy []string `json:"noLongerDeniedBy,omitempty"`
+}
+
+// ImpactReport compares the admission of the same resources by two versions of the policies
+type ImpactReport struct {
+	// Old and New are the policy sources of the versions
+	Old []string `json:"old"`
+	New []string `json:"new"`
+
+	// Evaluated is the number of resources evaluated by both versions
+	Evaluated int `json:"evaluated"`
+
+	// NewlyDenied, NewlyAllowed and MessageChanged count the resources of each change
+	NewlyDenied    int `json:"newlyDenied"`
+	NewlyAllowed   int `json:"newlyAllowed"`
+	MessageChanged int `json:"messageChanged"`
+
+	// Results lists the resources whose admission changes
+	// +optional
+	Results []ImpactResult `json:"results,omitempty"`
+}
+
+// SourceLocation is a position in a file
+type SourceLocation struct {
+	// File is the path of the file
+	File string `json:"file"`
+
+	// Line is the line in the file, starting at 1
+	// +optional
+	Line int `json:"line,omitempty"`
+
+	// Column is the column in the line, starting at 1
+	// +optional
+	Column int `json:"column,omitempty"`
+
+	// Document is the position of the document in a stream without a file such as standard input,
+	// starting at 1
+	// +optional
+	Document int `json:"document,omitempty"`
+}
+
+// ExpressionError is a compilation or evaluation error of a policy CEL expression
+type ExpressionError struct {
+	// Policy is the name of the policy
+	Policy string `json:"policy"`
+
+	// Field is the path of the expression in the policy, e.g. spec.validations[0].expression
+	Field string `json:"field"`
+
+	// Message is the CEL error
+	Message string `json:"message"`
+
+	// Location is the position of the error in the policy file, when the file is known
+	// +optional
+	Location *SourceLocation `json:"location,omitempty"`
+
+	// Excerpt is the expression line holding the error, with a caret under the error
+	// +optional
+	Excerpt string `json:"excerpt,omitempty"`
 }
 
 // PolicyResult represents the evaluation result of a single policy
@@ -152,6 +451,59 @@ type PolicyResult struct {
 	// Message is the response message
 	// +optional
 	Message string `json:"message,omitempty"`
+
+	// Violations are the failed validations of the policy
+	// +optional
+	Violations []PolicyViolation `json:"violations,omitempty"`
+
+	// Baselined indicates every violation of the policy is accepted by the baseline
+	// +optional
+	Baselined bool `json:"baselined,omitempty"`
+
+	// Waiver is the waiver matching the violations of the policy
+	// +optional
+	Waiver *WaiverReference `json:"waiver,omitempty"`
+}
+
+// WaiverReference identifies the waiver of policy violations
+type WaiverReference struct {
+	// Name is the name of the waiver
+	Name string `json:"name"`
+
+	// Expires is the expiry of the waiver
+	Expires string `json:"expires"`
+
+	// Expired indicates the waiver has expired, so the violations are no longer waived
+	// +optional
+	Expired bool `json:"expired,omitempty"`
+
+	// Reason is why the violations are accepted
+	// +optional
+	Reason string `json:"reason,omitempty"`
+
+	// Ticket tracks the fix of the violations
+	// +optional
+	Ticket string `json:"ticket,omitempty"`
+}
+
+// PolicyViolation is a failed validation of a policy
+type PolicyViolation struct {
+	// Field is the path of the failed policy entry, e.g. spec.validations[0]
+	// +optional
+	Field string `json:"field,omitempty"`
+
+	// Reason is the reason of the failure
+	// +optional
+	Reason string `json:"reason,omitempty"`
+
+	// Message is the message of the failure
+	// +optional
+	Message string `json:"message,omitempty"`
+
+	// EvaluationError is true when an expression failed to evaluate,
+	// rather than a validation returning false
+	// +optional
+	EvaluationError bool `json:"evaluationError,omitempty"`
 }
 
 // ResponseDetails is the actual response details of policy evaluation
@@ -168,6 +520,30 @@ type ResponseDetails struct {
 	Message string `json:"message,omitempty"`
 }
 
+// EngineComparison is the verdict of a second evaluation engine for the same test case
+type EngineComparison struct {
+	// Engine is the name of the second engine
+	Engine string `json:"engine"`
+
+	// Allowed indicates whether the second engine allowed the operation
+	Allowed bool `json:"allowed"`
+
+	// Reason is the response reason of the second engine
+	// +optional
+	Reason string `json:"reason,omitempty"`
+
+	// Message is the response message of the second engine
+	// +optional
+	Message string `json:"message,omitempty"`
+
+	// Agree indicates whether both engines reached the same verdict
+	Agree bool `json:"agree"`
+
+	// Error is the error of the second engine, when it could not evaluate the request
+	// +optional
+	Error string `json:"error,omitempty"`
+}
+
 // TestSummary represents a summary of test execution
 type TestSummary struct {
 	// Total is the total number of test cases
@@ -179,3 +555,91 @@ type TestSummary struct {
 	// Failed is the number of failed test cases
 	Failed int `json:"failed"`
 }
+
+// PodSecurityConfig selects the Pod Security Standards level and version to evaluate
+type PodSecurityConfig struct {
+	// Level is the Pod Security Standards level (privileged, baseline, restricted)
+	Level string `json:"level"`
+
+	// Version is the Pod Security Standards version (e.g. v1.32), defaults to latest
+	// +optional
+	Version string `json:"version,omitempty"`
+}
+
+// PodSecurityDivergence describes how the policy verdict compares with Pod Security Admission
+type PodSecurityDivergence string
+
+const (
+	// PodSecurityAgree means the policies and Pod Security Admission reached the same verdict
+	PodSecurityAgree PodSecurityDivergence = "Agree"
+	// PodSecurityVAPStricter means the policies denied an object Pod Security Admission allows
+	PodSecurityVAPStricter PodSecurityDivergence = "VAPStricter"
+	// PodSecurityVAPLooser means the policies allowed an object Pod Security Admission denies
+	PodSecurityVAPLooser PodSecurityDivergence = "VAPLooser"
+)
+
+// PodSecurityResult is the Pod Security Admission verdict for a single object
+type PodSecurityResult struct {
+	// Policy is the evaluated level and version (e.g. restricted:latest)
+	Policy string `json:"policy"`
+
+	// Allowed indicates whether Pod Security Admission allows the object
+	Allowed bool `json:"allowed"`
+
+	// ForbiddenReason lists the failed checks
+	// +optional
+	ForbiddenReason string `json:"forbiddenReason,omitempty"`
+
+	// ForbiddenDetail explains the failed checks
+	// +optional
+	ForbiddenDetail string `json:"forbiddenDetail,omitempty"`
+
+	// Divergence compares the policy verdict with the Pod Security Admission verdict
+	Divergence PodSecurityDivergence `json:"divergence"`
+}
+
+// PodSecuritySummary counts how policy verdicts compare with Pod Security Admission
+type PodSecuritySummary struct {
+	// Policy is the evaluated level and version (e.g. restricted:latest)
+	Policy string `json:"policy"`
+
+	// Evaluated is the number of pod-bearing objects evaluated
+	Evaluated int `json:"evaluated"`
+
+	// Agree is the number of objects with the same verdict
+	Agree int `json:"agree"`
+
+	// VAPStricter is the number of objects denied by policies but allowed by Pod Security Admission
+	VAPStricter int `json:"vapStricter"`
+
+	// VAPLooser is the number of objects allowed by policies but denied by Pod Security Admission
+	VAPLooser int `json:"vapLooser"`
+}
+
+// APIVersionReport lists the policy API version each policy needs on a target Kubernetes version
+type APIVersionReport struct {
+	// KubernetesVersion is the target Kubernetes version (e.g. 1.29)
+	KubernetesVersion string `json:"kubernetesVersion"`
+
+	// Policies is the requirement of each policy
+	// +optional
+	Policies []PolicyAPIVersion `json:"policies,omitempty"`
+}
+
+// PolicyAPIVersion is the policy API version a single policy needs on the target Kubernetes version
+type PolicyAPIVersion struct {
+	// Policy is the name of the policy
+	Policy string `json:"policy"`
+
+	// APIVersion is the apiVersion to use (e.g. admissionregistration.k8s.io/v1beta1)
+	// It is empty when the target version does not serve ValidatingAdmissionPolicies
+	// +optional
+	APIVersion string `json:"apiVersion,omitempty"`
+
+	// Supported indicates whether the policy can be used on the target version as written
+	Supported bool `json:"supported"`
+
+	// Notes explain feature gates to enable and fields or CEL functions the target version lacks
+	// +optional
+	Notes []string `json:"notes,omitempty"`
+}
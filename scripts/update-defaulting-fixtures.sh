@@ -0,0 +1,25 @@
+#!/bin/bash
+
+# Regenerate the apiserver responses the defaulting tests compare the defaulting functions with
+# Every manifest of internal/engine/defaulting/testdata is sent to the apiserver of the current
+# kubectl context as a server-side dry-run create, and the response is written next to it as
+# <name>.apiserver.yaml. Use a cluster of the Kubernetes version of the k8s.io/api module, e.g.
+#   kind create cluster --name defaulting --image kindest/node:v1.32.2
+
+# Stop on error
+set -e
+
+SCRIPT_DIR="$(cd "$(dirname "${BASH_SOURCE[0]}")" && pwd)"
+REPO_ROOT="$(cd "${SCRIPT_DIR}/.." && pwd)"
+TESTDATA_DIR="${REPO_ROOT}/internal/engine/defaulting/testdata"
+
+echo "Server version: $(kubectl version -o json | grep -m1 '"gitVersion"' | cut -d'"' -f4)"
+
+for manifest in "${TESTDATA_DIR}"/*.yaml; do
+  case "${manifest}" in
+    *.apiserver.yaml) continue ;;
+  esac
+  response="${manifest%.yaml}.apiserver.yaml"
+  kubectl create --dry-run=server -o yaml -f "${manifest}" > "${response}"
+  echo "Wrote ${response#"${REPO_ROOT}/"}"
+done